@@ -0,0 +1,118 @@
+/*
+ * Copyright (c) 2021 LuanDNH
+ *
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at https://mozilla.org/MPL/2.0/.
+ *
+ * Contributor(s):
+ * LuanDNH <luandnh98@gmail.com>
+ */
+
+package goesl
+
+import (
+	"context"
+	"errors"
+	"strings"
+)
+
+// ShutdownMode - Mode given to fsctl shutdown
+type ShutdownMode string
+
+const (
+	ShutdownNow     ShutdownMode = ""
+	ShutdownElegant ShutdownMode = "elegant"
+	ShutdownASAP    ShutdownMode = "asap"
+	ShutdownRestart ShutdownMode = "restart"
+	ShutdownCancel  ShutdownMode = "cancel"
+)
+
+// CommandResult - Outcome of an administrative command.
+// Commands like reload report each step on its own line, Success is false if any of them failed
+type CommandResult struct {
+	Success  bool
+	Messages []string
+	Raw      string
+}
+
+// ReloadXML - Run reloadxml
+func (c *ESLConnection) ReloadXML(ctx context.Context) (*CommandResult, error) {
+	return c.adminCommand(ctx, "reloadxml")
+}
+
+// ReloadACL - Run reloadacl
+func (c *ESLConnection) ReloadACL(ctx context.Context) (*CommandResult, error) {
+	return c.adminCommand(ctx, "reloadacl")
+}
+
+// ReloadModule - Run reload <module>, this blocks until the module is unloaded and loaded again
+func (c *ESLConnection) ReloadModule(ctx context.Context, module string) (*CommandResult, error) {
+	if err := validateModuleName(module); err != nil {
+		return nil, err
+	}
+	return c.adminCommand(ctx, "reload "+module)
+}
+
+// LoadModule - Run load <module>
+func (c *ESLConnection) LoadModule(ctx context.Context, module string) (*CommandResult, error) {
+	if err := validateModuleName(module); err != nil {
+		return nil, err
+	}
+	return c.adminCommand(ctx, "load "+module)
+}
+
+// UnloadModule - Run unload <module>
+func (c *ESLConnection) UnloadModule(ctx context.Context, module string) (*CommandResult, error) {
+	if err := validateModuleName(module); err != nil {
+		return nil, err
+	}
+	return c.adminCommand(ctx, "unload "+module)
+}
+
+// Shutdown - Run fsctl shutdown [elegant|asap|restart|cancel], freeswitch closes the connection afterwards
+func (c *ESLConnection) Shutdown(ctx context.Context, mode ShutdownMode) (*CommandResult, error) {
+	cmd := "fsctl shutdown"
+	if mode != ShutdownNow {
+		cmd += " " + string(mode)
+	}
+	return c.adminCommand(ctx, cmd)
+}
+
+func (c *ESLConnection) adminCommand(ctx context.Context, cmd string) (*CommandResult, error) {
+	response, err := c.ApiWithContext(ctx, cmd)
+	if response == nil {
+		return nil, err
+	}
+	return parseCommandResult(string(response.Body)), nil
+}
+
+func parseCommandResult(body string) *CommandResult {
+	result := &CommandResult{Raw: body}
+	ok, failed := false, false
+	for _, line := range strings.Split(body, "\n") {
+		line = strings.TrimSpace(line)
+		switch {
+		case line == "":
+			continue
+		case strings.HasPrefix(line, "+OK"):
+			ok = true
+			line = strings.TrimPrefix(line, "+OK")
+		case strings.HasPrefix(line, "-ERR"):
+			failed = true
+			line = strings.TrimPrefix(line, "-ERR")
+		}
+		if line = strings.Trim(strings.TrimSpace(line), "[]"); line != "" {
+			result.Messages = append(result.Messages, line)
+		}
+	}
+	result.Success = ok && !failed
+	return result
+}
+
+func validateModuleName(module string) error {
+	if module == "" || strings.ContainsAny(module, " \t\r\n") {
+		return errors.New("invalid module name : " + module)
+	}
+	return nil
+}
@@ -0,0 +1,82 @@
+/*
+ * Copyright (c) 2021 LuanDNH
+ *
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at https://mozilla.org/MPL/2.0/.
+ *
+ * Contributor(s):
+ * LuanDNH <luandnh98@gmail.com>
+ */
+
+package goesl
+
+import (
+	"context"
+)
+
+// Answer - Answer the channel uuid. An outbound connection executes answer on the channel, uuid may be empty
+// for its own channel, and waits until it is done. An inbound one runs uuid_answer which replies once answered
+func (c *ESLConnection) Answer(ctx context.Context, uuid string) error {
+	return c.controlChannel(ctx, uuid, "answer", "uuid_answer")
+}
+
+// PreAnswer - Establish early media on the channel uuid, the same way as Answer with pre_answer and uuid_pre_answer
+func (c *ESLConnection) PreAnswer(ctx context.Context, uuid string) error {
+	return c.controlChannel(ctx, uuid, "pre_answer", "uuid_pre_answer")
+}
+
+// RingReady - Send ringing to the caller of the channel uuid by executing ring_ready, and wait until it is done
+func (c *ESLConnection) RingReady(ctx context.Context, uuid string) error {
+	return c.controlChannel(ctx, uuid, "ring_ready", "")
+}
+
+// controlChannel - Execute app on an outbound connection or when there is no api, run the api otherwise
+func (c *ESLConnection) controlChannel(ctx context.Context, uuid, app, api string) error {
+	if c.outbound || api == "" {
+		_, err := c.ExecuteAndWait(ctx, uuid, app, "", &ExecuteOptions{EventLock: true})
+		return err
+	}
+	_, err := c.ApiWithContext(ctx, api+" "+uuid)
+	return err
+}
+
+// Hangup - Hang the channel uuid up with cause and wait for its CHANNEL_HANGUP event. An outbound connection
+// sends the hangup call command, uuid may be empty for its own channel, an inbound one runs uuid_kill.
+// On an inbound connection CHANNEL_HANGUP is subscribed while waiting, an outbound connection must use myevents
+func (c *ESLConnection) Hangup(ctx context.Context, uuid string, cause HangupCause) error {
+	if !c.outbound {
+		if err := c.subscribeInternal(EventChannelHangup); err != nil {
+			return err
+		}
+		defer c.Unsubscribe(EventChannelHangup)
+	}
+	listenUUID := uuid
+	if listenUUID == "" {
+		listenUUID = EventListenAll
+	}
+	waiter := c.newEventWaiter(listenUUID, func(event *Event) bool {
+		return event.GetHeader("Event-Name") == EventChannelHangup
+	})
+	defer waiter.Close()
+
+	var err error
+	if c.outbound {
+		_, err = c.SendMsgWithContext(ctx, uuid, []string{"call-command: hangup", "hangup-cause: " + cause.String()}, "")
+	} else {
+		_, err = c.ApiWithContext(ctx, "uuid_kill "+uuid+" "+cause.String())
+	}
+	if err != nil {
+		return err
+	}
+	event, err := waiter.Wait(ctx)
+	if err != nil {
+		// Without linger freeswitch may close the socket of the channel before the event is read
+		if c.outbound && ctx.Err() == nil && c.DisconnectNotice() != nil {
+			return nil
+		}
+		return err
+	}
+	event.Release()
+	return nil
+}
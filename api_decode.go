@@ -0,0 +1,147 @@
+/*
+ * Copyright (c) 2021 LuanDNH
+ *
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at https://mozilla.org/MPL/2.0/.
+ *
+ * Contributor(s):
+ * LuanDNH <luandnh98@gmail.com>
+ */
+
+package goesl
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"strings"
+	"sync"
+)
+
+// ApiDecoder - Decode the body of the api response to cmd into v, ok is false when the body is not of its kind
+// and the next decoder is tried
+type ApiDecoder func(cmd string, body []byte, v interface{}) (ok bool, err error)
+
+// apiDecoderEntry - A registered decoder, funcs can not be compared so it is removed by its entry
+type apiDecoderEntry struct {
+	decoder ApiDecoder
+}
+
+var (
+	apiDecodersLock sync.RWMutex
+	// apiDecoders - Registered decoders, the last registered first, then the built in ones
+	apiDecoders []*apiDecoderEntry
+	// builtinApiDecoders - show output, json bodies and key: value blocks, in this order
+	builtinApiDecoders = []ApiDecoder{decodeShowBody, decodeJSONBody, decodeKeyValueBody}
+)
+
+// RegisterApiDecoder - Add a decoder used by ApiDecode, tried before those already registered and the built in ones.
+// Calling the returned func removes it
+func RegisterApiDecoder(decoder ApiDecoder) (unregister func()) {
+	entry := &apiDecoderEntry{decoder: decoder}
+	apiDecodersLock.Lock()
+	defer apiDecodersLock.Unlock()
+	apiDecoders = append([]*apiDecoderEntry{entry}, apiDecoders...)
+	return func() {
+		apiDecodersLock.Lock()
+		defer apiDecodersLock.Unlock()
+		for i, registered := range apiDecoders {
+			if registered == entry {
+				// Copied, DecodeApiBody may be going through the current slice
+				apiDecoders = append(append([]*apiDecoderEntry(nil), apiDecoders[:i]...), apiDecoders[i+1:]...)
+				return
+			}
+		}
+	}
+}
+
+// ApiDecode - Run the api command cmd and decode its body into v with the first decoder accepting it. The built in
+// decoders handle the show output, csv or as json, as a list of rows, json bodies, and blocks of "Name: value"
+// lines like uuid_dump as an object. Rows and blocks are decoded into v as json objects of strings, so v can be
+// a map or a struct with json tags. A *string gets the body as is
+func (c *ESLConnection) ApiDecode(ctx context.Context, cmd string, v interface{}) error {
+	response, err := c.ApiWithContext(ctx, cmd)
+	if err != nil {
+		return err
+	}
+	return DecodeApiBody(cmd, response.Body, v)
+}
+
+// DecodeApiBody - Decode the body of the api response to cmd into v, see ApiDecode
+func DecodeApiBody(cmd string, body []byte, v interface{}) error {
+	if text, ok := v.(*string); ok {
+		*text = string(body)
+		return nil
+	}
+	apiDecodersLock.RLock()
+	decoders := make([]ApiDecoder, 0, len(apiDecoders)+len(builtinApiDecoders))
+	for _, entry := range apiDecoders {
+		decoders = append(decoders, entry.decoder)
+	}
+	apiDecodersLock.RUnlock()
+	decoders = append(decoders, builtinApiDecoders...)
+	for _, decoder := range decoders {
+		if ok, err := decoder(cmd, body, v); ok {
+			return err
+		}
+	}
+	return errors.New("no decoder for the reply of " + cmd)
+}
+
+// decodeShowBody - Rows of show, as json or csv
+func decodeShowBody(cmd string, body []byte, v interface{}) (bool, error) {
+	if !strings.HasPrefix(cmd, "show ") {
+		return false, nil
+	}
+	body = bytes.TrimSpace(body)
+	var rows []map[string]string
+	if bytes.HasPrefix(body, []byte("{")) {
+		var decoded showJSON
+		if err := json.Unmarshal(body, &decoded); err != nil {
+			return true, err
+		}
+		rows = decoded.Rows
+	} else {
+		var err error
+		if rows, err = parseShowCSV(body); err != nil {
+			return true, err
+		}
+	}
+	if rows == nil {
+		rows = []map[string]string{}
+	}
+	return true, decodeStrings(rows, v)
+}
+
+// decodeJSONBody - Bodies which are a json object or array
+func decodeJSONBody(_ string, body []byte, v interface{}) (bool, error) {
+	body = bytes.TrimSpace(body)
+	if !bytes.HasPrefix(body, []byte("{")) && !bytes.HasPrefix(body, []byte("[")) {
+		return false, nil
+	}
+	return true, json.Unmarshal(body, v)
+}
+
+// decodeKeyValueBody - Blocks where every line is "Name: value"
+func decodeKeyValueBody(_ string, body []byte, v interface{}) (bool, error) {
+	fields := make(map[string]string)
+	for _, line := range strings.Split(strings.TrimSpace(string(body)), "\n") {
+		i := strings.Index(line, ":")
+		if i <= 0 {
+			return false, nil
+		}
+		fields[strings.TrimSpace(line[:i])] = strings.TrimSpace(line[i+1:])
+	}
+	return true, decodeStrings(fields, v)
+}
+
+// decodeStrings - Decode rows or fields of strings into v through json, for the json tags of v
+func decodeStrings(value interface{}, v interface{}) error {
+	encoded, err := json.Marshal(value)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(encoded, v)
+}
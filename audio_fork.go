@@ -0,0 +1,145 @@
+/*
+ * Copyright (c) 2021 LuanDNH
+ *
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at https://mozilla.org/MPL/2.0/.
+ *
+ * Contributor(s):
+ * LuanDNH <luandnh98@gmail.com>
+ */
+
+package goesl
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+)
+
+// AudioForkMix - Audio sent by uuid_audio_fork
+type AudioForkMix string
+
+const (
+	// AudioForkMono - Only the audio of the caller
+	AudioForkMono AudioForkMix = "mono"
+	// AudioForkMixed - Both sides mixed in a single channel
+	AudioForkMixed AudioForkMix = "mixed"
+	// AudioForkStereo - Caller on the left channel, callee on the right one
+	AudioForkStereo AudioForkMix = "stereo"
+)
+
+// Subclasses of the CUSTOM events fired by mod_audio_fork
+const (
+	AudioForkConnect       = "mod_audio_fork::connect"
+	AudioForkConnectFailed = "mod_audio_fork::connect_failed"
+	AudioForkDisconnect    = "mod_audio_fork::disconnect"
+	AudioForkError         = "mod_audio_fork::error"
+	AudioForkBufferOverrun = "mod_audio_fork::buffer_overrun"
+	// AudioForkJSON - Text message sent back by the websocket server, like a transcription
+	AudioForkJSON      = "mod_audio_fork::json"
+	AudioForkPlayAudio = "mod_audio_fork::play_audio"
+	AudioForkKillAudio = "mod_audio_fork::kill_audio"
+	AudioForkTransfer  = "mod_audio_fork::transfer"
+)
+
+// AudioForkEvents - Subscription to every mod_audio_fork event, for Subscribe
+var AudioForkEvents = EventCustom + " " + strings.Join([]string{
+	AudioForkConnect, AudioForkConnectFailed, AudioForkDisconnect, AudioForkError, AudioForkBufferOverrun,
+	AudioForkJSON, AudioForkPlayAudio, AudioForkKillAudio, AudioForkTransfer,
+}, " ")
+
+// AudioForkOptions - Stream started by AudioForkStart
+type AudioForkOptions struct {
+	// URL - ws:// or wss:// url of the server receiving the audio
+	URL string
+	// Mix - AudioForkMono when empty
+	Mix AudioForkMix
+	// SampleRate - Rate of the forked audio in Hz, 8000 when 0. Must be a multiple of 8000
+	SampleRate int
+	// Metadata - Text sent to the server once connected, usually a json document
+	Metadata string
+}
+
+// AudioForkEvent - A mod_audio_fork event, see ParseAudioForkEvent
+type AudioForkEvent struct {
+	UUID string
+	// Subclass - One of the AudioFork constants
+	Subclass string
+	// Body - Payload of the event, the json message of the server for AudioForkJSON
+	Body []byte
+}
+
+// AudioForkStart - Start streaming the audio of uuid to a websocket server with uuid_audio_fork
+func (c *ESLConnection) AudioForkStart(uuid string, opts AudioForkOptions) error {
+	if !strings.HasPrefix(opts.URL, "ws://") && !strings.HasPrefix(opts.URL, "wss://") {
+		return errors.New("audio fork url must be ws:// or wss:// : " + opts.URL)
+	}
+	mix := opts.Mix
+	if mix == "" {
+		mix = AudioForkMono
+	}
+	rate := opts.SampleRate
+	if rate == 0 {
+		rate = 8000
+	}
+	if rate < 0 || rate%8000 != 0 {
+		return errors.New("audio fork sample rate must be a multiple of 8000 : " + strconv.Itoa(rate))
+	}
+	args := []string{uuid, "start", opts.URL, string(mix), strconv.Itoa(rate/1000) + "k"}
+	if opts.Metadata != "" {
+		args = append(args, opts.Metadata)
+	}
+	_, err := c.Api(Command("uuid_audio_fork", args...))
+	return err
+}
+
+// AudioForkStop - Stop the audio stream of uuid, text is sent to the server before closing when not empty
+func (c *ESLConnection) AudioForkStop(uuid, text string) error {
+	args := []string{uuid, "stop"}
+	if text != "" {
+		args = append(args, text)
+	}
+	_, err := c.Api(Command("uuid_audio_fork", args...))
+	return err
+}
+
+// AudioForkSendText - Send text to the server receiving the audio of uuid
+func (c *ESLConnection) AudioForkSendText(uuid, text string) error {
+	_, err := c.Api(Command("uuid_audio_fork", uuid, "send_text", text))
+	return err
+}
+
+// RecordStart - Record uuid to path with uuid_record, limit in seconds when not 0.
+// path may be any location the record application can write, like a file or a websocket capable stream
+func (c *ESLConnection) RecordStart(uuid, path string, limit int) error {
+	args := []string{uuid, "start", path}
+	if limit > 0 {
+		args = append(args, strconv.Itoa(limit))
+	}
+	_, err := c.Api(Command("uuid_record", args...))
+	return err
+}
+
+// RecordStop - Stop recording uuid to path, every recording of uuid when path is empty
+func (c *ESLConnection) RecordStop(uuid, path string) error {
+	if path == "" {
+		path = "all"
+	}
+	_, err := c.Api(Command("uuid_record", uuid, "stop", path))
+	return err
+}
+
+// ParseAudioForkEvent - Decode a mod_audio_fork event, false for any other event
+func ParseAudioForkEvent(event *Event) (*AudioForkEvent, bool) {
+	subclass := event.GetHeader("Event-Subclass")
+	if event.GetHeader("Event-Name") != EventCustom || !strings.HasPrefix(subclass, "mod_audio_fork::") {
+		return nil, false
+	}
+	return &AudioForkEvent{
+		UUID:     event.GetHeader("Unique-ID"),
+		Subclass: subclass,
+		// Copied, the body of a pooled event is reused once released
+		Body: append([]byte(nil), event.Body...),
+	}, true
+}
@@ -0,0 +1,95 @@
+/*
+ * Copyright (c) 2021 LuanDNH
+ *
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at https://mozilla.org/MPL/2.0/.
+ *
+ * Contributor(s):
+ * LuanDNH <luandnh98@gmail.com>
+ */
+
+package goesl
+
+import "sync/atomic"
+
+// BackpressurePolicy - What the read loop does when the ReadMessage buffer is full
+type BackpressurePolicy int
+
+const (
+	// BackpressureBlock - Wait for ReadMessage, freeswitch eventually stops writing to the socket.
+	// Until ReadMessage is first called the oldest queued messages are dropped instead, so a connection
+	// only consuming events through listeners, dispatchers or WaitFor never stalls
+	BackpressureBlock BackpressurePolicy = iota
+	// BackpressureDropOldest - Drop the oldest queued message to make room
+	BackpressureDropOldest
+	// BackpressureDropNewest - Drop the message which does not fit
+	BackpressureDropNewest
+	// BackpressureCallback - Hand the message which does not fit to Options.OnEventOverflow instead of queuing it
+	BackpressureCallback
+)
+
+// queueMessage - Queue a message for ReadMessage honoring the backpressure policy.
+// The reader of a queued message owns a reference to it, see ESLResponse.Release
+func (c *ESLConnection) queueMessage(msg *ESLResponse) {
+	msg.retain()
+	if c.backpressure == BackpressureBlock {
+		if atomic.LoadInt32(&c.readingMessages) == 0 {
+			c.queueUnread(msg)
+			return
+		}
+		select {
+		case c.eventMessage <- msg:
+		case <-c.done:
+			msg.Release()
+		}
+		return
+	}
+	for {
+		select {
+		case c.eventMessage <- msg:
+			return
+		default:
+		}
+		switch c.backpressure {
+		case BackpressureDropOldest:
+			select {
+			case dropped := <-c.eventMessage:
+				dropped.Release()
+				atomic.AddUint64(&c.droppedEvents, 1)
+			default:
+			}
+			// Retry, ReadMessage may have taken the room meanwhile
+			continue
+		case BackpressureCallback:
+			if c.onEventOverflow != nil {
+				c.runHandler("event overflow handler", func() { c.onEventOverflow(msg) })
+			}
+		}
+		atomic.AddUint64(&c.droppedEvents, 1)
+		msg.Release()
+		return
+	}
+}
+
+// queueUnread - Queue a message while nobody called ReadMessage, making room by dropping the oldest one.
+// Those drops are not counted, the messages were never asked for
+func (c *ESLConnection) queueUnread(msg *ESLResponse) {
+	for {
+		select {
+		case c.eventMessage <- msg:
+			return
+		default:
+		}
+		select {
+		case dropped := <-c.eventMessage:
+			dropped.Release()
+		default:
+		}
+	}
+}
+
+// DroppedEvents - Number of messages dropped, or handed to OnEventOverflow, because the ReadMessage buffer was full
+func (c *ESLConnection) DroppedEvents() uint64 {
+	return atomic.LoadUint64(&c.droppedEvents)
+}
@@ -0,0 +1,209 @@
+/*
+ * Copyright (c) 2021 LuanDNH
+ *
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at https://mozilla.org/MPL/2.0/.
+ *
+ * Contributor(s):
+ * LuanDNH <luandnh98@gmail.com>
+ */
+package goesl
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+)
+
+// ErrChannelNotFound - A channel given to a command does not exist, or hung up while waiting for it
+var ErrChannelNotFound = errors.New("channel not found")
+
+// bridgeEvents - Events a Bridge follows its legs with
+var bridgeEvents = []string{EventChannelBridge, EventChannelUnbridge, EventChannelHangup}
+
+// missingChannelReplies - uuid_bridge and uuid_park answers for a leg which is gone
+var missingChannelReplies = []string{"Invalid uuid", "no such channel", "Cannot locate session"}
+
+// BridgeError - Unsuccessful uuid_bridge or uuid_park, it matches ErrChannelNotFound with errors.Is when a leg is gone
+type BridgeError struct {
+	// Reply - Text of the -ERR reply
+	Reply string
+}
+
+func (e *BridgeError) Error() string {
+	return "bridge failed : " + e.Reply
+}
+
+func (e *BridgeError) Is(target error) bool {
+	if target != ErrChannelNotFound {
+		return false
+	}
+	reply := strings.ToLower(e.Reply)
+	for _, missing := range missingChannelReplies {
+		if strings.Contains(reply, strings.ToLower(missing)) {
+			return true
+		}
+	}
+	return false
+}
+
+// Bridge - Two legs bridged together by Bridge, until one hangs up or they are unbridged
+type Bridge struct {
+	connection *ESLConnection
+	legA, legB string
+	listeners  [2]string
+
+	bridged    chan struct{}
+	bridgeOnce sync.Once
+	// gone - Set when the bridge ended with a leg hanging up
+	gone         bool
+	unbridged    chan struct{}
+	unbridgeOnce sync.Once
+}
+
+// Bridge - Bridge the channels uuidA and uuidB with uuid_bridge and wait for CHANNEL_BRIDGE.
+// Errors match ErrChannelNotFound when one of the legs is gone
+func (c *ESLConnection) Bridge(ctx context.Context, uuidA, uuidB string) (*Bridge, error) {
+	if !c.outbound {
+		if err := c.subscribeInternal(bridgeEvents...); err != nil {
+			return nil, err
+		}
+	}
+	bridge := &Bridge{
+		connection: c,
+		legA:       uuidA,
+		legB:       uuidB,
+		bridged:    make(chan struct{}),
+		unbridged:  make(chan struct{}),
+	}
+	bridge.listeners[0] = c.RegisterEventListener(uuidA, bridge.apply)
+	bridge.listeners[1] = c.RegisterEventListener(uuidB, bridge.apply)
+	go func() {
+		select {
+		case <-bridge.unbridged:
+		case <-c.done:
+			bridge.end(false)
+		}
+	}()
+
+	if response, err := c.ApiWithContext(ctx, "uuid_bridge "+uuidA+" "+uuidB); err != nil {
+		bridge.end(false)
+		if response != nil {
+			return nil, &BridgeError{Reply: strings.TrimSpace(strings.TrimPrefix(response.GetReply(), "-ERR"))}
+		}
+		return nil, err
+	}
+	select {
+	case <-bridge.bridged:
+		return bridge, nil
+	case <-bridge.unbridged:
+		select {
+		case <-bridge.bridged:
+			return bridge, nil
+		default:
+		}
+		if err := c.Err(); err != nil {
+			return nil, err
+		}
+		return nil, ErrChannelNotFound
+	case <-ctx.Done():
+		bridge.end(false)
+		return nil, ctx.Err()
+	}
+}
+
+// apply - Listener of both legs
+func (b *Bridge) apply(event *Event) {
+	switch event.GetHeader("Event-Name") {
+	case EventChannelBridge:
+		if b.isOtherLeg(event) {
+			b.bridgeOnce.Do(func() { close(b.bridged) })
+		}
+	case EventChannelUnbridge:
+		if b.isOtherLeg(event) {
+			b.end(false)
+		}
+	case EventChannelHangup:
+		b.end(true)
+	}
+}
+
+// isOtherLeg - The event of one leg names the other one
+func (b *Bridge) isOtherLeg(event *Event) bool {
+	other := event.GetHeader("Other-Leg-Unique-ID")
+	if other == "" {
+		other = event.GetHeader("Bridge-B-Unique-ID")
+	}
+	switch event.GetHeader("Unique-ID") {
+	case b.legA:
+		return other == b.legB
+	case b.legB:
+		return other == b.legA
+	}
+	return false
+}
+
+func (b *Bridge) end(gone bool) {
+	b.unbridgeOnce.Do(func() {
+		b.gone = gone
+		b.connection.RemoveEventListener(b.legA, b.listeners[0])
+		b.connection.RemoveEventListener(b.legB, b.listeners[1])
+		close(b.unbridged)
+		if !b.connection.outbound {
+			go b.connection.Unsubscribe(bridgeEvents...)
+		}
+	})
+}
+
+// LegA - First channel given to Bridge
+func (b *Bridge) LegA() string {
+	return b.legA
+}
+
+// LegB - Second channel given to Bridge
+func (b *Bridge) LegB() string {
+	return b.legB
+}
+
+// Unbridged - Closed on CHANNEL_UNBRIDGE, when a leg hangs up or the connection is closed
+func (b *Bridge) Unbridged() <-chan struct{} {
+	return b.unbridged
+}
+
+// HungUp - Tells if the bridge ended with a leg hanging up, valid once Unbridged is closed
+func (b *Bridge) HungUp() bool {
+	select {
+	case <-b.unbridged:
+		return b.gone
+	default:
+		return false
+	}
+}
+
+// Park - Park both legs, which ends the bridge and keeps the channels up
+func (b *Bridge) Park(ctx context.Context) error {
+	for _, leg := range []string{b.legA, b.legB} {
+		if response, err := b.connection.ApiWithContext(ctx, "uuid_park "+leg); err != nil {
+			if response != nil {
+				return &BridgeError{Reply: strings.TrimSpace(strings.TrimPrefix(response.GetReply(), "-ERR"))}
+			}
+			return err
+		}
+	}
+	return nil
+}
+
+// Unbridge - Park both legs and wait for CHANNEL_UNBRIDGE
+func (b *Bridge) Unbridge(ctx context.Context) error {
+	if err := b.Park(ctx); err != nil {
+		return err
+	}
+	select {
+	case <-b.unbridged:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,177 @@
+/*
+ * Copyright (c) 2021 LuanDNH
+ *
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at https://mozilla.org/MPL/2.0/.
+ *
+ * Contributor(s):
+ * LuanDNH <luandnh98@gmail.com>
+ */
+package goesl
+
+import (
+	"path"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// DefaultBusQueueSize - Events queued per EventBus subscriber before the next ones are dropped
+const DefaultBusQueueSize = 256
+
+// EventBus - Fans the events of a connection out to subscribers matching them by name, wildcard, CUSTOM subclass
+// or header. Every subscriber has its own queue and goroutine, so a slow one only drops its own events.
+// The bus does not subscribe events on the connection, see Subscribe
+type EventBus struct {
+	dispatcher  *OrderedDispatcher
+	queueSize   int
+	lock        sync.RWMutex
+	subscribers map[*BusSubscription]struct{}
+	closeOnce   sync.Once
+}
+
+// BusSubscription - A subscriber of an EventBus
+type BusSubscription struct {
+	bus     *EventBus
+	match   func(event *Event) bool
+	handler EventListener
+	queue   chan *Event
+	dropped uint64
+	done    chan struct{}
+	once    sync.Once
+}
+
+// NewEventBus - Start a bus fed by the events of c until Close. queueSize is the queue of each subscriber,
+// DefaultBusQueueSize when 0
+func (c *ESLConnection) NewEventBus(queueSize int) *EventBus {
+	if queueSize <= 0 {
+		queueSize = DefaultBusQueueSize
+	}
+	bus := &EventBus{
+		queueSize:   queueSize,
+		subscribers: make(map[*BusSubscription]struct{}),
+	}
+	// A single worker so every subscriber sees the events in the order received
+	bus.dispatcher = c.DispatchOrdered(1, 0, bus.publish)
+	return bus
+}
+
+// Close - Stop the bus and every subscription, the events already queued are still handled
+func (b *EventBus) Close() {
+	b.closeOnce.Do(func() {
+		b.dispatcher.Stop()
+		b.lock.Lock()
+		subscribers := b.subscribers
+		b.subscribers = make(map[*BusSubscription]struct{})
+		b.lock.Unlock()
+		for sub := range subscribers {
+			sub.stop()
+		}
+	})
+}
+
+func (b *EventBus) publish(event *Event) {
+	b.lock.RLock()
+	defer b.lock.RUnlock()
+	for sub := range b.subscribers {
+		if !sub.match(event) {
+			continue
+		}
+		event.retain()
+		select {
+		case sub.queue <- event:
+		default:
+			event.Release()
+			atomic.AddUint64(&sub.dropped, 1)
+		}
+	}
+}
+
+// Subscribe - Call handler with the events matching pattern: an event name like "CHANNEL_ANSWER", a wildcard
+// like "CHANNEL_*" or "*", or "CUSTOM " followed by a subclass which may be a wildcard too, like "CUSTOM sofia::*"
+func (b *EventBus) Subscribe(pattern string, handler EventListener) *BusSubscription {
+	return b.SubscribeMatch(patternMatcher(pattern), handler)
+}
+
+// SubscribeHeader - Call handler with the events where header equals value, like Unique-ID
+func (b *EventBus) SubscribeHeader(header, value string, handler EventListener) *BusSubscription {
+	return b.SubscribeMatch(func(event *Event) bool {
+		return event.HasHeader(header) && event.GetHeader(header) == value
+	}, handler)
+}
+
+// SubscribeMatch - Call handler with the events match returns true for. match is called from the bus goroutine
+// and must be quick, handler from the goroutine of the subscription
+func (b *EventBus) SubscribeMatch(match func(event *Event) bool, handler EventListener) *BusSubscription {
+	sub := &BusSubscription{
+		bus:     b,
+		match:   match,
+		handler: handler,
+		queue:   make(chan *Event, b.queueSize),
+		done:    make(chan struct{}),
+	}
+	go sub.run()
+	b.lock.Lock()
+	b.subscribers[sub] = struct{}{}
+	b.lock.Unlock()
+	return sub
+}
+
+// patternMatcher - Matcher of a Subscribe pattern
+func patternMatcher(pattern string) func(event *Event) bool {
+	name, subclass := pattern, ""
+	if strings.HasPrefix(pattern, EventCustom+" ") {
+		name, subclass = EventCustom, strings.TrimSpace(pattern[len(EventCustom)+1:])
+	}
+	return func(event *Event) bool {
+		if ok, _ := path.Match(name, event.GetHeader("Event-Name")); !ok {
+			return false
+		}
+		if subclass == "" {
+			return true
+		}
+		ok, _ := path.Match(subclass, event.GetHeader("Event-Subclass"))
+		return ok
+	}
+}
+
+func (s *BusSubscription) run() {
+	defer close(s.done)
+	for event := range s.queue {
+		s.bus.dispatcher.connection.callListener(s.handler, event)
+	}
+}
+
+// Unsubscribe - Stop the subscription and wait until its handler returns, it must not be called from the handler.
+// Events still queued are released without being handled
+func (s *BusSubscription) Unsubscribe() {
+	s.bus.lock.Lock()
+	delete(s.bus.subscribers, s)
+	s.bus.lock.Unlock()
+	s.once.Do(func() {
+		// Nothing is queued once removed, publishing happens under the read lock
+	drain:
+		for {
+			select {
+			case event := <-s.queue:
+				event.Release()
+			default:
+				break drain
+			}
+		}
+		close(s.queue)
+	})
+	<-s.done
+}
+
+// stop - End the subscription once its queue is handled
+func (s *BusSubscription) stop() {
+	s.once.Do(func() { close(s.queue) })
+	<-s.done
+}
+
+// Dropped - Events dropped because the queue of the subscription was full
+func (s *BusSubscription) Dropped() uint64 {
+	return atomic.LoadUint64(&s.dropped)
+}
@@ -0,0 +1,400 @@
+/*
+ * Copyright (c) 2021 LuanDNH
+ *
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at https://mozilla.org/MPL/2.0/.
+ *
+ * Contributor(s):
+ * LuanDNH <luandnh98@gmail.com>
+ */
+package goesl
+
+import (
+	"context"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// callEvents - Events a Call follows its channel with
+var callEvents = []string{
+	EventChannelCreate,
+	EventChannelState,
+	EventChannelCallState,
+	EventChannelAnswer,
+	EventChannelHangup,
+	EventChannelHangupComplete,
+}
+
+// Call - A channel followed through its events: state, answer and hangup times, hangup cause and variables.
+// It is created by TrackCall, OnNewCall or OriginateCall
+type Call struct {
+	connection *ESLConnection
+	uuid       string
+	// handlerID - OnNewCall registration which created the call, 0 for TrackCall
+	handlerID int
+
+	lock      sync.Mutex
+	sequence  uint64
+	state     ChannelState
+	callState CallState
+	direction Direction
+	created   time.Time
+	answered  time.Time
+	hungup    time.Time
+	cause     HangupCause
+	variables map[string]string
+
+	answer     chan struct{}
+	answerOnce sync.Once
+	done       chan struct{}
+	doneOnce   sync.Once
+}
+
+// TrackCall - Follow the channel uuid. The channel events are subscribed until the call is done,
+// on an outbound connection they must be enabled with myevents
+func (c *ESLConnection) TrackCall(uuid string) (*Call, error) {
+	call := c.newCall(uuid)
+	if !c.outbound {
+		if err := c.subscribeInternal(callEvents...); err != nil {
+			call.stop()
+			return nil, err
+		}
+		go func() {
+			<-call.done
+			_ = c.Unsubscribe(callEvents...)
+		}()
+	}
+	return call, nil
+}
+
+// OnNewCall - Call handler with a Call for every CHANNEL_CREATE received, until the returned function is called.
+// The Call is created before any later event of its channel is handled, the handler runs on its own goroutine
+func (c *ESLConnection) OnNewCall(handler func(call *Call)) (func(), error) {
+	if !c.outbound {
+		if err := c.subscribeInternal(callEvents...); err != nil {
+			return nil, err
+		}
+	}
+	router := c.calls()
+	id := router.addHandler(handler)
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			router.removeHandler(id)
+			if !c.outbound {
+				_ = c.Unsubscribe(callEvents...)
+			}
+		})
+	}, nil
+}
+
+// OriginateCall - Same as Originate, returning the answered channel as a Call
+func (c *ESLConnection) OriginateCall(ctx context.Context, endpoint string, vars map[string]string, app string) (*Call, error) {
+	uuid := vars["origination_uuid"]
+	if uuid == "" {
+		uuid = newUUID()
+		withUUID := make(map[string]string, len(vars)+1)
+		for k, v := range vars {
+			withUUID[k] = v
+		}
+		withUUID["origination_uuid"] = uuid
+		vars = withUUID
+	}
+	// Tracked before the channel exists so none of its events are missed
+	call, err := c.TrackCall(uuid)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := c.Originate(ctx, endpoint, vars, app); err != nil {
+		call.stop()
+		return nil, err
+	}
+	return call, nil
+}
+
+func (c *ESLConnection) newCall(uuid string) *Call {
+	call := c.makeCall(uuid, 0)
+	router := c.calls()
+	router.lock.Lock()
+	router.channels[uuid] = append(router.channels[uuid], call)
+	router.lock.Unlock()
+	return call
+}
+
+// makeCall - Call not yet known to the router, stopped once the connection is closed
+func (c *ESLConnection) makeCall(uuid string, handlerID int) *Call {
+	call := &Call{
+		connection: c,
+		uuid:       uuid,
+		handlerID:  handlerID,
+		variables:  make(map[string]string),
+		answer:     make(chan struct{}),
+		done:       make(chan struct{}),
+	}
+	go func() {
+		select {
+		case <-call.done:
+		case <-c.done:
+			call.stop()
+		}
+	}()
+	return call
+}
+
+// callRouter - Applies the channel events to their Calls from a single OrderedDispatcher worker. Events are
+// applied in the order received, and the Calls of OnNewCall are created on CHANNEL_CREATE before any later
+// event of the channel is routed
+type callRouter struct {
+	connection *ESLConnection
+	lock       sync.Mutex
+	channels   map[string][]*Call
+	handlers   map[int]func(call *Call)
+	nextID     int
+}
+
+// calls - Router of the connection, started on first use and stopped with the connection
+func (c *ESLConnection) calls() *callRouter {
+	c.callRouterOnce.Do(func() {
+		router := &callRouter{
+			connection: c,
+			channels:   make(map[string][]*Call),
+			handlers:   make(map[int]func(call *Call)),
+		}
+		dispatcher := c.DispatchOrdered(1, 0, router.route)
+		go func() {
+			<-c.done
+			dispatcher.Stop()
+		}()
+		c.callRouter = router
+	})
+	return c.callRouter
+}
+
+func (r *callRouter) addHandler(handler func(call *Call)) int {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	r.nextID++
+	r.handlers[r.nextID] = handler
+	return r.nextID
+}
+
+func (r *callRouter) removeHandler(id int) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	delete(r.handlers, id)
+}
+
+// remove - Forget a stopped call
+func (r *callRouter) remove(call *Call) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	calls := r.channels[call.uuid]
+	for i, known := range calls {
+		if known == call {
+			calls = append(calls[:i:i], calls[i+1:]...)
+			break
+		}
+	}
+	if len(calls) == 0 {
+		delete(r.channels, call.uuid)
+	} else {
+		r.channels[call.uuid] = calls
+	}
+}
+
+// route - Apply event to the calls of its channel, creating those of the OnNewCall handlers on CHANNEL_CREATE
+func (r *callRouter) route(event *Event) {
+	uuid := event.GetHeader("Unique-ID")
+	if uuid == "" {
+		return
+	}
+	var created []*Call
+	var handlers []func(call *Call)
+	r.lock.Lock()
+	if event.GetHeader("Event-Name") == EventChannelCreate {
+		for id, handler := range r.handlers {
+			if r.tracks(uuid, id) {
+				continue
+			}
+			call := r.connection.makeCall(uuid, id)
+			r.channels[uuid] = append(r.channels[uuid], call)
+			created = append(created, call)
+			handlers = append(handlers, handler)
+		}
+	}
+	calls := append([]*Call(nil), r.channels[uuid]...)
+	r.lock.Unlock()
+
+	for _, call := range calls {
+		call.apply(event)
+	}
+	for i, call := range created {
+		call, handler := call, handlers[i]
+		go r.connection.runHandler("new call handler", func() { handler(call) })
+	}
+}
+
+// tracks - Check if the handler id already has a call for uuid, with the lock held
+func (r *callRouter) tracks(uuid string, id int) bool {
+	for _, call := range r.channels[uuid] {
+		if call.handlerID == id {
+			return true
+		}
+	}
+	return false
+}
+
+// apply - Update the call from one of its events. Events are applied in the order received, one older than
+// the last one applied, like an event replayed from a journal, only fills what is still unknown
+func (call *Call) apply(event *Event) {
+	name := event.GetHeader("Event-Name")
+	sequence, _ := strconv.ParseUint(event.GetHeader("Event-Sequence"), 10, 64)
+
+	call.lock.Lock()
+	newer := sequence == 0 || sequence > call.sequence
+	if newer {
+		call.sequence = sequence
+	}
+	if state := event.ChannelState(); newer && event.HasHeader("Channel-State") {
+		call.state = state
+	}
+	if newer && event.HasHeader("Channel-Call-State") {
+		call.callState = event.CallState()
+	}
+	if call.direction == "" && event.HasHeader("Call-Direction") {
+		call.direction = event.Direction()
+	}
+	if t := parseEpochMicro(event.GetHeader("Caller-Channel-Created-Time")); call.created.IsZero() && !t.IsZero() {
+		call.created = t
+	}
+	if t := parseEpochMicro(event.GetHeader("Caller-Channel-Answered-Time")); call.answered.IsZero() && !t.IsZero() {
+		call.answered = t
+	}
+	if t := parseEpochMicro(event.GetHeader("Caller-Channel-Hangup-Time")); call.hungup.IsZero() && !t.IsZero() {
+		call.hungup = t
+	}
+	if event.HasHeader("Hangup-Cause") {
+		call.cause = event.HangupCause()
+	}
+	for variable, value := range event.Variables() {
+		if _, ok := call.variables[variable]; newer || !ok {
+			call.variables[variable] = value
+		}
+	}
+	call.lock.Unlock()
+
+	switch name {
+	case EventChannelAnswer:
+		call.answerOnce.Do(func() { close(call.answer) })
+	case EventChannelHangupComplete:
+		call.stop()
+	}
+}
+
+func (call *Call) stop() {
+	call.doneOnce.Do(func() {
+		call.connection.calls().remove(call)
+		close(call.done)
+	})
+}
+
+// UUID - Unique-ID of the channel
+func (call *Call) UUID() string {
+	return call.uuid
+}
+
+// Done - Closed once CHANNEL_HANGUP_COMPLETE is received or the connection is closed
+func (call *Call) Done() <-chan struct{} {
+	return call.done
+}
+
+// State - Last channel state received
+func (call *Call) State() ChannelState {
+	call.lock.Lock()
+	defer call.lock.Unlock()
+	return call.state
+}
+
+// CallState - Last call state received, like RINGING, ACTIVE or HANGUP
+func (call *Call) CallState() CallState {
+	call.lock.Lock()
+	defer call.lock.Unlock()
+	return call.callState
+}
+
+// Direction - Direction of the channel
+func (call *Call) Direction() Direction {
+	call.lock.Lock()
+	defer call.lock.Unlock()
+	return call.direction
+}
+
+// CreatedAt - Time the channel was created, zero if unknown
+func (call *Call) CreatedAt() time.Time {
+	call.lock.Lock()
+	defer call.lock.Unlock()
+	return call.created
+}
+
+// AnsweredAt - Time the channel was answered, zero if it was not
+func (call *Call) AnsweredAt() time.Time {
+	call.lock.Lock()
+	defer call.lock.Unlock()
+	return call.answered
+}
+
+// HungupAt - Time the channel was hung up, zero while it is up
+func (call *Call) HungupAt() time.Time {
+	call.lock.Lock()
+	defer call.lock.Unlock()
+	return call.hungup
+}
+
+// HangupCause - Hangup cause, HangupCause(0) while the channel is up
+func (call *Call) HangupCause() HangupCause {
+	call.lock.Lock()
+	defer call.lock.Unlock()
+	return call.cause
+}
+
+// Variable - Channel variable carried by the last events, empty if not seen
+func (call *Call) Variable(name string) string {
+	call.lock.Lock()
+	defer call.lock.Unlock()
+	return call.variables[name]
+}
+
+// Variables - Copy of the channel variables seen so far
+func (call *Call) Variables() map[string]string {
+	call.lock.Lock()
+	defer call.lock.Unlock()
+	variables := make(map[string]string, len(call.variables))
+	for k, v := range call.variables {
+		variables[k] = v
+	}
+	return variables
+}
+
+// Hangup - Hang the channel up with cause
+func (call *Call) Hangup(cause HangupCause) error {
+	_, err := call.connection.Api("uuid_kill " + call.uuid + " " + cause.String())
+	return err
+}
+
+// Transfer - Transfer the channel to extension, dialplan and context may be empty
+func (call *Call) Transfer(extension, dialplan, dialplanContext string) error {
+	_, err := call.connection.Api(transferCommand(call.uuid, extension, dialplan, dialplanContext))
+	return err
+}
+
+// Playback - Play file on the channel and wait until it is done
+func (call *Call) Playback(ctx context.Context, file string, opts *PlaybackOptions) (*PlaybackResult, error) {
+	return call.connection.Playback(ctx, call.uuid, file, opts)
+}
+
+// Execute - Queue an application on the channel without waiting for it to complete
+func (call *Call) Execute(app, arg string, opts *ExecuteOptions) (*ESLResponse, error) {
+	return call.connection.Execute(call.uuid, app, arg, opts)
+}
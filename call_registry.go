@@ -0,0 +1,264 @@
+/*
+ * Copyright (c) 2021 LuanDNH
+ *
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at https://mozilla.org/MPL/2.0/.
+ *
+ * Contributor(s):
+ * LuanDNH <luandnh98@gmail.com>
+ */
+package goesl
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// registryEvents - Events a CallRegistry follows the channels with
+var registryEvents = []string{
+	EventChannelCreate,
+	EventChannelState,
+	EventChannelCallState,
+	EventChannelAnswer,
+	EventChannelBridge,
+	EventChannelUnbridge,
+	EventChannelHangupComplete,
+	EventChannelDestroy,
+}
+
+// CallInfo - Snapshot of an active channel in a CallRegistry
+type CallInfo struct {
+	UUID         string
+	Direction    Direction
+	State        ChannelState
+	CallState    CallState
+	CallerName   string
+	CallerNumber string
+	CalleeName   string
+	CalleeNumber string
+	// OtherLeg - Unique-ID of the bridged channel, empty when not bridged
+	OtherLeg string
+	Created  time.Time
+	Answered time.Time
+	// updated - Last time an event or show channels touched the entry
+	updated time.Time
+}
+
+// CallRegistry - Live map of the active channels, fed by channel events and reconciled with show channels.
+// Attach it again to the new connection after a reconnect
+type CallRegistry struct {
+	lock       sync.RWMutex
+	calls      map[string]*CallInfo
+	connection *ESLConnection
+	dispatcher *OrderedDispatcher
+	// reconciling - Reconcile calls running, ended is only kept meanwhile
+	reconciling int
+	// ended - Channels which ended while show channels ran, so its list does not bring them back
+	ended map[string]bool
+}
+
+// NewCallRegistry - Empty registry, see Attach
+func NewCallRegistry() *CallRegistry {
+	return &CallRegistry{calls: make(map[string]*CallInfo)}
+}
+
+// Attach - Follow the channel events of c, then reconcile with show channels. A connection attached before is detached.
+// On an outbound connection the events must be enabled with myevents
+func (r *CallRegistry) Attach(c *ESLConnection) error {
+	r.Detach()
+	if !c.outbound {
+		if err := c.subscribeInternal(registryEvents...); err != nil {
+			return err
+		}
+	}
+	r.lock.Lock()
+	r.connection = c
+	// Ordered so the events of a channel are applied in the order received
+	r.dispatcher = c.DispatchOrdered(1, 0, r.apply)
+	r.lock.Unlock()
+	return r.Reconcile()
+}
+
+// Detach - Stop following the attached connection, the calls known so far are kept
+func (r *CallRegistry) Detach() {
+	r.lock.Lock()
+	c, dispatcher := r.connection, r.dispatcher
+	r.connection, r.dispatcher = nil, nil
+	r.lock.Unlock()
+	if dispatcher == nil {
+		return
+	}
+	dispatcher.Stop()
+	if !c.outbound && c.Err() == nil {
+		_ = c.Unsubscribe(registryEvents...)
+	}
+}
+
+// Reconcile - Add the channels listed by show channels which are missing, and drop those which are gone
+func (r *CallRegistry) Reconcile() error {
+	r.lock.RLock()
+	c := r.connection
+	r.lock.RUnlock()
+	if c == nil {
+		return ErrConnectionClosed
+	}
+	r.lock.Lock()
+	r.reconciling++
+	r.lock.Unlock()
+	started := time.Now()
+	channels, err := c.ShowChannels()
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	ended := r.ended
+	if r.reconciling--; r.reconciling == 0 {
+		r.ended = nil
+	}
+	if err != nil {
+		return err
+	}
+	listed := make(map[string]bool, len(channels))
+	for _, channel := range channels {
+		listed[channel.UUID] = true
+		if _, ok := r.calls[channel.UUID]; ok || ended[channel.UUID] {
+			continue
+		}
+		state, _ := ParseChannelState(channel.State)
+		callState, _ := ParseCallState(channel.CallState)
+		direction, _ := ParseDirection(channel.Direction)
+		r.calls[channel.UUID] = &CallInfo{
+			UUID:         channel.UUID,
+			Direction:    direction,
+			State:        state,
+			CallState:    callState,
+			CallerName:   channel.CIDName,
+			CallerNumber: channel.CIDNum,
+			CalleeName:   channel.CalleeName,
+			CalleeNumber: firstNonEmpty(channel.CalleeNum, channel.Dest),
+			Created:      channel.Created,
+			updated:      started,
+		}
+	}
+	for uuid, call := range r.calls {
+		// An entry updated by an event while show channels ran may be newer than the list
+		if !listed[uuid] && call.updated.Before(started) {
+			delete(r.calls, uuid)
+		}
+	}
+	return nil
+}
+
+func (r *CallRegistry) apply(event *Event) {
+	uuid := event.GetHeader("Unique-ID")
+	if uuid == "" {
+		return
+	}
+	name := event.GetHeader("Event-Name")
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	switch name {
+	case EventChannelHangupComplete, EventChannelDestroy:
+		delete(r.calls, uuid)
+		if r.reconciling > 0 {
+			if r.ended == nil {
+				r.ended = make(map[string]bool)
+			}
+			r.ended[uuid] = true
+		}
+		return
+	case EventChannelCreate, EventChannelState, EventChannelCallState, EventChannelAnswer, EventChannelBridge, EventChannelUnbridge:
+	default:
+		return
+	}
+	call, ok := r.calls[uuid]
+	if !ok {
+		// A channel missed at creation is added, unless the event is about its end
+		if name != EventChannelCreate && isEnding(event) {
+			return
+		}
+		call = &CallInfo{UUID: uuid}
+		r.calls[uuid] = call
+	}
+	call.updated = time.Now()
+	if event.HasHeader("Channel-State") {
+		call.State = event.ChannelState()
+	}
+	if event.HasHeader("Channel-Call-State") {
+		call.CallState = event.CallState()
+	}
+	if direction := event.Direction(); direction != "" {
+		call.Direction = direction
+	}
+	if v := event.GetHeader("Caller-Caller-ID-Name"); v != "" {
+		call.CallerName = v
+	}
+	if v := event.GetHeader("Caller-Caller-ID-Number"); v != "" {
+		call.CallerNumber = v
+	}
+	if v := event.GetHeader("Caller-Callee-ID-Name"); v != "" {
+		call.CalleeName = v
+	}
+	if v := firstNonEmpty(event.GetHeader("Caller-Callee-ID-Number"), event.GetHeader("Caller-Destination-Number")); v != "" {
+		call.CalleeNumber = v
+	}
+	if t := parseEpochMicro(event.GetHeader("Caller-Channel-Created-Time")); !t.IsZero() {
+		call.Created = t
+	}
+	if t := parseEpochMicro(event.GetHeader("Caller-Channel-Answered-Time")); !t.IsZero() {
+		call.Answered = t
+	}
+	switch name {
+	case EventChannelBridge:
+		call.OtherLeg = event.GetHeader("Other-Leg-Unique-ID")
+	case EventChannelUnbridge:
+		call.OtherLeg = ""
+	}
+}
+
+// isEnding - The event reports a channel hanging up or being destroyed
+func isEnding(event *Event) bool {
+	if event.CallState() == CallStateHangup {
+		return true
+	}
+	switch event.ChannelState() {
+	case ChannelStateHangup, ChannelStateReporting, ChannelStateDestroy:
+		return true
+	}
+	return false
+}
+
+// Get - Snapshot of the channel uuid, false when it is not active
+func (r *CallRegistry) Get(uuid string) (CallInfo, bool) {
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+	call, ok := r.calls[uuid]
+	if !ok {
+		return CallInfo{}, false
+	}
+	return *call, true
+}
+
+// Snapshot - Every active channel, oldest first
+func (r *CallRegistry) Snapshot() []CallInfo {
+	r.lock.RLock()
+	calls := make([]CallInfo, 0, len(r.calls))
+	for _, call := range r.calls {
+		calls = append(calls, *call)
+	}
+	r.lock.RUnlock()
+	sort.Slice(calls, func(i, j int) bool {
+		if !calls[i].Created.Equal(calls[j].Created) {
+			return calls[i].Created.Before(calls[j].Created)
+		}
+		return calls[i].UUID < calls[j].UUID
+	})
+	return calls
+}
+
+// Count - Number of active channels
+func (r *CallRegistry) Count() int {
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+	return len(r.calls)
+}
@@ -0,0 +1,150 @@
+/*
+ * Copyright (c) 2021 LuanDNH
+ *
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at https://mozilla.org/MPL/2.0/.
+ *
+ * Contributor(s):
+ * LuanDNH <luandnh98@gmail.com>
+ */
+package goesl
+
+import (
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// CDR - Call detail record of a channel, built from its CHANNEL_HANGUP_COMPLETE event
+type CDR struct {
+	UUID      string
+	Name      string
+	Direction Direction
+	Caller    CallerProfile
+	// OtherLeg - Unique-ID of the last channel it was bridged with
+	OtherLeg string
+
+	Created  time.Time
+	Answered time.Time
+	Hungup   time.Time
+	// Duration - Time from creation to hangup, Billsec - Time from answer to hangup, zero when not answered
+	Duration time.Duration
+	Billsec  time.Duration
+
+	HangupCause HangupCause
+	// Variables - Channel variables selected by CDROptions.Variables, without the variable_ prefix
+	Variables map[string]string
+}
+
+// CDRSink - Receives the CDRs of a CDRCollector, WriteCDR may be called from several goroutines at once
+type CDRSink interface {
+	WriteCDR(cdr *CDR) error
+}
+
+// CDRSinkFunc - Function used as a CDRSink
+type CDRSinkFunc func(cdr *CDR) error
+
+func (f CDRSinkFunc) WriteCDR(cdr *CDR) error {
+	return f(cdr)
+}
+
+// CDROptions - Options of CollectCDRs
+type CDROptions struct {
+	// Variables - Channel variables copied to the CDR, like "sip_call_id" or "accountcode"
+	Variables []string
+	// OnError - Called when the sink fails to write a CDR
+	OnError func(cdr *CDR, err error)
+}
+
+// CDRCollector - Builds a CDR for every CHANNEL_HANGUP_COMPLETE and writes it to a sink, see CollectCDRs
+type CDRCollector struct {
+	connection *ESLConnection
+	listenerID string
+	stopOnce   sync.Once
+}
+
+// CollectCDRs - Write a CDR to sink for every channel hanging up, until Stop. On an inbound connection
+// CHANNEL_HANGUP_COMPLETE is subscribed, an outbound connection must use myevents
+func (c *ESLConnection) CollectCDRs(sink CDRSink, opts CDROptions) (*CDRCollector, error) {
+	if !c.outbound {
+		if err := c.subscribeInternal(EventChannelHangupComplete); err != nil {
+			return nil, err
+		}
+	}
+	collector := &CDRCollector{connection: c}
+	collector.listenerID = c.RegisterEventListener(EventListenAll, func(event *Event) {
+		if event.GetHeader("Event-Name") != EventChannelHangupComplete {
+			return
+		}
+		cdr := ParseCDR(event, opts.Variables)
+		if err := sink.WriteCDR(cdr); err != nil && opts.OnError != nil {
+			c.runHandler("cdr error handler", func() { opts.OnError(cdr, err) })
+		}
+	})
+	return collector, nil
+}
+
+// Stop - Stop collecting, CDRs being written are not waited for
+func (cc *CDRCollector) Stop() error {
+	var err error
+	cc.stopOnce.Do(func() {
+		cc.connection.RemoveEventListener(EventListenAll, cc.listenerID)
+		if !cc.connection.outbound {
+			err = cc.connection.Unsubscribe(EventChannelHangupComplete)
+		}
+	})
+	return err
+}
+
+// ParseCDR - Build the CDR of a CHANNEL_HANGUP_COMPLETE event, variables are the channel variables to copy
+func ParseCDR(event *Event, variables []string) *CDR {
+	cdr := &CDR{
+		UUID:      event.GetHeader("Unique-ID"),
+		Name:      event.GetHeader("Channel-Name"),
+		Direction: event.Direction(),
+		Caller: CallerProfile{
+			Username:          event.GetHeader("Caller-Username"),
+			Dialplan:          event.GetHeader("Caller-Dialplan"),
+			CallerIDName:      event.GetHeader("Caller-Caller-ID-Name"),
+			CallerIDNumber:    event.GetHeader("Caller-Caller-ID-Number"),
+			CalleeIDName:      event.GetHeader("Caller-Callee-ID-Name"),
+			CalleeIDNumber:    event.GetHeader("Caller-Callee-ID-Number"),
+			ANI:               event.GetHeader("Caller-ANI"),
+			DestinationNumber: event.GetHeader("Caller-Destination-Number"),
+			Context:           event.GetHeader("Caller-Context"),
+			NetworkAddr:       event.GetHeader("Caller-Network-Addr"),
+			Source:            event.GetHeader("Caller-Source"),
+			ChannelName:       event.GetHeader("Caller-Channel-Name"),
+		},
+		OtherLeg:    firstNonEmpty(event.GetHeader("Other-Leg-Unique-ID"), event.GetHeader("variable_last_bridge_to")),
+		Created:     parseEpochMicro(event.GetHeader("Caller-Channel-Created-Time")),
+		Answered:    parseEpochMicro(event.GetHeader("Caller-Channel-Answered-Time")),
+		Hungup:      parseEpochMicro(event.GetHeader("Caller-Channel-Hangup-Time")),
+		HangupCause: event.HangupCause(),
+		Variables:   make(map[string]string, len(variables)),
+	}
+	// Freeswitch computes duration and billsec in microseconds too, the times are the fallback
+	cdr.Duration = cdrDuration(event.GetHeader("variable_uduration"), cdr.Created, cdr.Hungup)
+	if !cdr.Answered.IsZero() {
+		cdr.Billsec = cdrDuration(event.GetHeader("variable_billusec"), cdr.Answered, cdr.Hungup)
+	}
+	for _, name := range variables {
+		name = strings.TrimPrefix(name, "variable_")
+		if value := event.GetHeader("variable_" + name); value != "" {
+			cdr.Variables[name] = value
+		}
+	}
+	return cdr
+}
+
+func cdrDuration(usec string, from, to time.Time) time.Duration {
+	if v, err := strconv.ParseInt(strings.TrimSpace(usec), 10, 64); err == nil && v >= 0 {
+		return time.Duration(v) * time.Microsecond
+	}
+	if from.IsZero() || to.Before(from) {
+		return 0
+	}
+	return to.Sub(from)
+}
@@ -0,0 +1,167 @@
+/*
+ * Copyright (c) 2021 LuanDNH
+ *
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at https://mozilla.org/MPL/2.0/.
+ *
+ * Contributor(s):
+ * LuanDNH <luandnh98@gmail.com>
+ */
+
+package goesl
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ChannelInfo - Parsed output of uuid_dump
+type ChannelInfo struct {
+	UUID      string
+	Name      string
+	State     string
+	CallState string
+	Direction string
+	Caller    CallerProfile
+
+	Created       time.Time
+	Answered      time.Time
+	Progress      time.Time
+	ProgressMedia time.Time
+	Hangup        time.Time
+	Transfer      time.Time
+
+	Read  MediaInfo
+	Write MediaInfo
+
+	// Variables - Channel variables without the variable_ prefix
+	Variables map[string]string
+	// Headers - Every field as returned by freeswitch
+	Headers map[string]string
+}
+
+// CallerProfile - Caller-* fields of a channel
+type CallerProfile struct {
+	Username          string
+	Dialplan          string
+	CallerIDName      string
+	CallerIDNumber    string
+	CalleeIDName      string
+	CalleeIDNumber    string
+	ANI               string
+	DestinationNumber string
+	Context           string
+	NetworkAddr       string
+	Source            string
+	ChannelName       string
+}
+
+// MediaInfo - Codec of one media direction
+type MediaInfo struct {
+	Codec   string
+	Rate    int
+	BitRate int
+}
+
+// ChannelInfo - Run uuid_dump and decode the channel, json is used unless the build only supports plain
+func (c *ESLConnection) ChannelInfo(uuid string) (*ChannelInfo, error) {
+	response, err := c.query("uuid_dump " + uuid + " json")
+	if err != nil {
+		return nil, err
+	}
+	headers := make(map[string]string)
+	body := bytes.TrimSpace(response.Body)
+	if bytes.HasPrefix(body, []byte("{")) {
+		var decoded map[string]interface{}
+		if err := json.Unmarshal(body, &decoded); err != nil {
+			return nil, err
+		}
+		for k, v := range decoded {
+			if value, ok := v.(string); ok {
+				headers[k] = value
+			}
+		}
+	} else {
+		headers = parseDumpPlain(string(body))
+	}
+	return newChannelInfo(headers), nil
+}
+
+// parseDumpPlain - Parse the "Name: value" lines of a plain uuid_dump, values are url encoded
+func parseDumpPlain(body string) map[string]string {
+	headers := make(map[string]string)
+	for _, line := range strings.Split(body, "\n") {
+		i := strings.Index(line, ": ")
+		if i <= 0 {
+			continue
+		}
+		value := strings.TrimRight(line[i+2:], "\r")
+		if unescaped, err := url.QueryUnescape(value); err == nil {
+			value = unescaped
+		}
+		headers[line[:i]] = value
+	}
+	return headers
+}
+
+func newChannelInfo(headers map[string]string) *ChannelInfo {
+	info := &ChannelInfo{
+		UUID:      headers["Unique-ID"],
+		Name:      headers["Channel-Name"],
+		State:     headers["Channel-State"],
+		CallState: headers["Channel-Call-State"],
+		Direction: headers["Call-Direction"],
+		Caller: CallerProfile{
+			Username:          headers["Caller-Username"],
+			Dialplan:          headers["Caller-Dialplan"],
+			CallerIDName:      headers["Caller-Caller-ID-Name"],
+			CallerIDNumber:    headers["Caller-Caller-ID-Number"],
+			CalleeIDName:      headers["Caller-Callee-ID-Name"],
+			CalleeIDNumber:    headers["Caller-Callee-ID-Number"],
+			ANI:               headers["Caller-ANI"],
+			DestinationNumber: headers["Caller-Destination-Number"],
+			Context:           headers["Caller-Context"],
+			NetworkAddr:       headers["Caller-Network-Addr"],
+			Source:            headers["Caller-Source"],
+			ChannelName:       headers["Caller-Channel-Name"],
+		},
+		Created:       parseEpochMicro(headers["Caller-Channel-Created-Time"]),
+		Answered:      parseEpochMicro(headers["Caller-Channel-Answered-Time"]),
+		Progress:      parseEpochMicro(headers["Caller-Channel-Progress-Time"]),
+		ProgressMedia: parseEpochMicro(headers["Caller-Channel-Progress-Media-Time"]),
+		Hangup:        parseEpochMicro(headers["Caller-Channel-Hangup-Time"]),
+		Transfer:      parseEpochMicro(headers["Caller-Channel-Transfer-Time"]),
+		Read: MediaInfo{
+			Codec:   headers["Channel-Read-Codec-Name"],
+			Rate:    atoi(headers["Channel-Read-Codec-Rate"]),
+			BitRate: atoi(headers["Channel-Read-Codec-Bit-Rate"]),
+		},
+		Write: MediaInfo{
+			Codec:   headers["Channel-Write-Codec-Name"],
+			Rate:    atoi(headers["Channel-Write-Codec-Rate"]),
+			BitRate: atoi(headers["Channel-Write-Codec-Bit-Rate"]),
+		},
+		Variables: make(map[string]string),
+		Headers:   headers,
+	}
+	for k, v := range headers {
+		if strings.HasPrefix(k, "variable_") {
+			info.Variables[strings.TrimPrefix(k, "variable_")] = v
+		}
+	}
+	return info
+}
+
+// parseEpochMicro - Parse a freeswitch *-Time field, an epoch in microseconds where 0 means never
+func parseEpochMicro(s string) time.Time {
+	v, err := strconv.ParseInt(strings.TrimSpace(s), 10, 64)
+	if err != nil || v <= 0 {
+		return time.Time{}
+	}
+	return time.Unix(0, v*int64(time.Microsecond))
+}
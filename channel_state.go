@@ -0,0 +1,160 @@
+/*
+ * Copyright (c) 2021 LuanDNH
+ *
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at https://mozilla.org/MPL/2.0/.
+ *
+ * Contributor(s):
+ * LuanDNH <luandnh98@gmail.com>
+ */
+
+package goesl
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+)
+
+// ChannelState - State of the channel state machine, the value is the Channel-State-Number
+type ChannelState int
+
+// Channel states as listed in switch_types.h
+const (
+	ChannelStateNew ChannelState = iota
+	ChannelStateInit
+	ChannelStateRouting
+	ChannelStateSoftExecute
+	ChannelStateExecute
+	ChannelStateExchangeMedia
+	ChannelStatePark
+	ChannelStateConsumeMedia
+	ChannelStateHibernate
+	ChannelStateReset
+	ChannelStateHangup
+	ChannelStateReporting
+	ChannelStateDestroy
+	ChannelStateNone
+)
+
+var channelStateNames = []string{
+	"CS_NEW",
+	"CS_INIT",
+	"CS_ROUTING",
+	"CS_SOFT_EXECUTE",
+	"CS_EXECUTE",
+	"CS_EXCHANGE_MEDIA",
+	"CS_PARK",
+	"CS_CONSUME_MEDIA",
+	"CS_HIBERNATE",
+	"CS_RESET",
+	"CS_HANGUP",
+	"CS_REPORTING",
+	"CS_DESTROY",
+	"CS_NONE",
+}
+
+// String - Freeswitch name of the state, like CS_EXECUTE
+func (s ChannelState) String() string {
+	if s >= 0 && int(s) < len(channelStateNames) {
+		return channelStateNames[s]
+	}
+	return "CS_NONE"
+}
+
+// ParseChannelState - Parse a state name like CS_EXECUTE, the CS_ prefix is optional and case is ignored
+func ParseChannelState(name string) (ChannelState, error) {
+	key := strings.ToUpper(strings.TrimSpace(name))
+	if !strings.HasPrefix(key, "CS_") {
+		key = "CS_" + key
+	}
+	for i, stateName := range channelStateNames {
+		if stateName == key {
+			return ChannelState(i), nil
+		}
+	}
+	return ChannelStateNone, errors.New("unknown channel state : " + name)
+}
+
+// CallState - Call state of a channel as sent in Channel-Call-State
+type CallState string
+
+const (
+	CallStateDown     CallState = "DOWN"
+	CallStateDialing  CallState = "DIALING"
+	CallStateRinging  CallState = "RINGING"
+	CallStateEarly    CallState = "EARLY"
+	CallStateActive   CallState = "ACTIVE"
+	CallStateHeld     CallState = "HELD"
+	CallStateRingWait CallState = "RING_WAIT"
+	CallStateHangup   CallState = "HANGUP"
+	CallStateUnheld   CallState = "UNHELD"
+)
+
+var callStates = []CallState{
+	CallStateDown,
+	CallStateDialing,
+	CallStateRinging,
+	CallStateEarly,
+	CallStateActive,
+	CallStateHeld,
+	CallStateRingWait,
+	CallStateHangup,
+	CallStateUnheld,
+}
+
+// ParseCallState - Parse a call state like ACTIVE, case is ignored
+func ParseCallState(name string) (CallState, error) {
+	state := CallState(strings.ToUpper(strings.TrimSpace(name)))
+	for _, s := range callStates {
+		if s == state {
+			return state, nil
+		}
+	}
+	return "", errors.New("unknown call state : " + name)
+}
+
+// Direction - Direction of a call leg as seen by freeswitch
+type Direction string
+
+const (
+	DirectionInbound  Direction = "inbound"
+	DirectionOutbound Direction = "outbound"
+)
+
+// ParseDirection - Parse inbound or outbound, case is ignored
+func ParseDirection(name string) (Direction, error) {
+	switch direction := Direction(strings.ToLower(strings.TrimSpace(name))); direction {
+	case DirectionInbound, DirectionOutbound:
+		return direction, nil
+	}
+	return "", errors.New("unknown call direction : " + name)
+}
+
+// ChannelState - Channel state carried by the event, from Channel-State or Channel-State-Number
+func (r *ESLResponse) ChannelState() ChannelState {
+	if state, err := ParseChannelState(r.GetHeader("Channel-State")); err == nil {
+		return state
+	}
+	if n, err := strconv.Atoi(r.GetHeader("Channel-State-Number")); err == nil && n >= 0 && n < len(channelStateNames) {
+		return ChannelState(n)
+	}
+	return ChannelStateNone
+}
+
+// CallState - Call state carried by the event, empty when it is missing or unknown
+func (r *ESLResponse) CallState() CallState {
+	state, _ := ParseCallState(r.GetHeader("Channel-Call-State"))
+	return state
+}
+
+// Direction - Call direction carried by the event, from Call-Direction or variable_direction
+func (r *ESLResponse) Direction() Direction {
+	for _, header := range []string{"Call-Direction", "Caller-Direction", "variable_direction"} {
+		if direction, err := ParseDirection(r.GetHeader(header)); err == nil {
+			return direction
+		}
+	}
+	return ""
+}
@@ -0,0 +1,190 @@
+/*
+ * Copyright (c) 2021 LuanDNH
+ *
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at https://mozilla.org/MPL/2.0/.
+ *
+ * Contributor(s):
+ * LuanDNH <luandnh98@gmail.com>
+ */
+
+package goesl
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Channel - A row of show channels
+type Channel struct {
+	UUID            string
+	Direction       string
+	Created         time.Time
+	Name            string
+	State           string
+	CallState       string
+	CIDName         string
+	CIDNum          string
+	IPAddr          string
+	Dest            string
+	Application     string
+	ApplicationData string
+	Dialplan        string
+	Context         string
+	ReadCodec       string
+	ReadRate        int
+	WriteCodec      string
+	WriteRate       int
+	Secure          string
+	Hostname        string
+	PresenceID      string
+	Accountcode     string
+	CalleeName      string
+	CalleeNum       string
+	CalleeDirection string
+	CallUUID        string
+	// Fields - Every column as returned by freeswitch
+	Fields map[string]string
+}
+
+// BridgedCall - A row of show calls, A and B are the two bridged legs
+type BridgedCall struct {
+	A       Channel
+	B       Channel
+	Created time.Time
+	// Fields - Every column as returned by freeswitch
+	Fields map[string]string
+}
+
+type showJSON struct {
+	RowCount int                 `json:"row_count"`
+	Rows     []map[string]string `json:"rows"`
+}
+
+// ShowChannels - Run show channels and decode every active channel
+func (c *ESLConnection) ShowChannels() ([]Channel, error) {
+	rows, err := c.show("channels")
+	if err != nil {
+		return nil, err
+	}
+	channels := make([]Channel, 0, len(rows))
+	for _, row := range rows {
+		channels = append(channels, newChannel(row, ""))
+	}
+	return channels, nil
+}
+
+// ShowCalls - Run show calls and decode every bridged call
+func (c *ESLConnection) ShowCalls() ([]BridgedCall, error) {
+	rows, err := c.show("calls")
+	if err != nil {
+		return nil, err
+	}
+	calls := make([]BridgedCall, 0, len(rows))
+	for _, row := range rows {
+		calls = append(calls, BridgedCall{
+			A:       newChannel(row, ""),
+			B:       newChannel(row, "b_"),
+			Created: parseEpoch(row["call_created_epoch"]),
+			Fields:  row,
+		})
+	}
+	return calls, nil
+}
+
+// show - Run show <what> as json, falling back to the csv output on builds without json support
+func (c *ESLConnection) show(what string) ([]map[string]string, error) {
+	response, err := c.query("show " + what + " as json")
+	if err != nil {
+		return nil, err
+	}
+	body := bytes.TrimSpace(response.Body)
+	if bytes.HasPrefix(body, []byte("{")) {
+		var decoded showJSON
+		if err := json.Unmarshal(body, &decoded); err != nil {
+			return nil, err
+		}
+		return decoded.Rows, nil
+	}
+	response, err = c.query("show " + what)
+	if err != nil {
+		return nil, err
+	}
+	return parseShowCSV(response.Body)
+}
+
+// parseShowCSV - Parse the default show output, a csv header, rows and a "N total." footer
+func parseShowCSV(body []byte) ([]map[string]string, error) {
+	reader := csv.NewReader(bytes.NewReader(body))
+	reader.FieldsPerRecord = -1
+	reader.LazyQuotes = true
+	records, err := reader.ReadAll()
+	if err != nil {
+		return nil, err
+	}
+	if len(records) == 0 {
+		return nil, errors.New("empty show reply")
+	}
+	columns := records[0]
+	rows := make([]map[string]string, 0, len(records)-1)
+	for _, record := range records[1:] {
+		if len(record) == 1 && strings.HasSuffix(record[0], " total.") {
+			break
+		}
+		row := make(map[string]string, len(columns))
+		for i, column := range columns {
+			if i < len(record) {
+				row[column] = record[i]
+			}
+		}
+		rows = append(rows, row)
+	}
+	return rows, nil
+}
+
+func newChannel(row map[string]string, prefix string) Channel {
+	return Channel{
+		UUID:            row[prefix+"uuid"],
+		Direction:       row[prefix+"direction"],
+		Created:         parseEpoch(row[prefix+"created_epoch"]),
+		Name:            row[prefix+"name"],
+		State:           row[prefix+"state"],
+		CallState:       row[prefix+"callstate"],
+		CIDName:         row[prefix+"cid_name"],
+		CIDNum:          row[prefix+"cid_num"],
+		IPAddr:          row[prefix+"ip_addr"],
+		Dest:            row[prefix+"dest"],
+		Application:     row[prefix+"application"],
+		ApplicationData: row[prefix+"application_data"],
+		Dialplan:        row[prefix+"dialplan"],
+		Context:         row[prefix+"context"],
+		ReadCodec:       row[prefix+"read_codec"],
+		ReadRate:        atoi(row[prefix+"read_rate"]),
+		WriteCodec:      row[prefix+"write_codec"],
+		WriteRate:       atoi(row[prefix+"write_rate"]),
+		Secure:          row[prefix+"secure"],
+		Hostname:        row["hostname"],
+		PresenceID:      row[prefix+"presence_id"],
+		Accountcode:     row[prefix+"accountcode"],
+		CalleeName:      row[prefix+"callee_name"],
+		CalleeNum:       row[prefix+"callee_num"],
+		CalleeDirection: row[prefix+"callee_direction"],
+		CallUUID:        row["call_uuid"],
+		Fields:          row,
+	}
+}
+
+// parseEpoch - Parse an epoch in seconds, zero time when empty or invalid
+func parseEpoch(s string) time.Time {
+	v, err := strconv.ParseInt(strings.TrimSpace(s), 10, 64)
+	if err != nil || v <= 0 {
+		return time.Time{}
+	}
+	return time.Unix(v, 0)
+}
@@ -0,0 +1,143 @@
+/*
+ * Copyright (c) 2021 LuanDNH
+ *
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at https://mozilla.org/MPL/2.0/.
+ *
+ * Contributor(s):
+ * LuanDNH <luandnh98@gmail.com>
+ */
+package goesl
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+// ErrCircuitOpen - The circuit breaker is open after too many consecutive failures, see Options.CircuitThreshold
+var ErrCircuitOpen = errors.New("circuit open")
+
+// DefaultCircuitProbeInterval - Time between two probes of an open circuit
+const DefaultCircuitProbeInterval = 5 * time.Second
+
+// CircuitState - State of the circuit breaker of a connection
+type CircuitState int
+
+const (
+	// CircuitClosed - Commands are sent as usual
+	CircuitClosed CircuitState = iota
+	// CircuitOpen - Commands fail fast with ErrCircuitOpen until a probe succeeds
+	CircuitOpen
+	// CircuitHalfOpen - A probe is in flight, commands still fail fast
+	CircuitHalfOpen
+)
+
+func (s CircuitState) String() string {
+	switch s {
+	case CircuitClosed:
+		return "closed"
+	case CircuitOpen:
+		return "open"
+	case CircuitHalfOpen:
+		return "half-open"
+	}
+	return "unknown"
+}
+
+// circuitBreaker - Counts consecutive transport failures and timeouts of commands, -ERR replies are answers and don't count
+type circuitBreaker struct {
+	lock      sync.Mutex
+	state     CircuitState
+	failures  int
+	threshold int
+	interval  time.Duration
+	probe     string
+}
+
+func newCircuitBreaker(opts Options) *circuitBreaker {
+	if opts.CircuitProbeInterval <= 0 {
+		opts.CircuitProbeInterval = DefaultCircuitProbeInterval
+	}
+	if opts.CircuitProbeCommand == "" {
+		opts.CircuitProbeCommand = "api status"
+	}
+	return &circuitBreaker{
+		threshold: opts.CircuitThreshold,
+		interval:  opts.CircuitProbeInterval,
+		probe:     opts.CircuitProbeCommand,
+	}
+}
+
+// CircuitState - Current state of the circuit breaker, always CircuitClosed when Options.CircuitThreshold is 0
+func (c *ESLConnection) CircuitState() CircuitState {
+	if c.breaker == nil {
+		return CircuitClosed
+	}
+	c.breaker.lock.Lock()
+	defer c.breaker.lock.Unlock()
+	return c.breaker.state
+}
+
+// circuitAllows - ErrCircuitOpen while the circuit is not closed
+func (c *ESLConnection) circuitAllows() error {
+	if c.CircuitState() != CircuitClosed {
+		return ErrCircuitOpen
+	}
+	return nil
+}
+
+// recordCommand - Count the outcome of a command, opening the circuit on the threshold-th failure in a row
+func (c *ESLConnection) recordCommand(response *ESLResponse, err error) {
+	if c.breaker == nil {
+		return
+	}
+	failed := err != nil && response == nil && err != context.Canceled && err != ErrCircuitOpen && err != ErrRateLimited
+	b := c.breaker
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	if !failed {
+		b.failures = 0
+		return
+	}
+	b.failures++
+	if b.state == CircuitClosed && b.failures >= b.threshold {
+		b.state = CircuitOpen
+		c.logger.Warn("circuit open after %d consecutive failures : %v", b.failures, err)
+		go c.probeCircuit()
+	}
+}
+
+// probeCircuit - Send the probe command every interval until it succeeds and the circuit closes again
+func (c *ESLConnection) probeCircuit() {
+	b := c.breaker
+	timer := time.NewTimer(b.interval)
+	defer timer.Stop()
+	for {
+		select {
+		case <-timer.C:
+		case <-c.done:
+			return
+		}
+		b.lock.Lock()
+		b.state = CircuitHalfOpen
+		b.lock.Unlock()
+
+		ctx, cancel := context.WithTimeout(c.runningContext, b.interval)
+		response, err := c.roundTrip(ctx, commandFrame(b.probe), false)
+		cancel()
+
+		b.lock.Lock()
+		if err == nil && response != nil {
+			b.state, b.failures = CircuitClosed, 0
+			b.lock.Unlock()
+			c.logger.Info("circuit closed, probe succeeded")
+			return
+		}
+		b.state = CircuitOpen
+		b.lock.Unlock()
+		timer.Reset(b.interval)
+	}
+}
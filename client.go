@@ -15,52 +15,116 @@ import (
 	"context"
 	"net"
 	"strconv"
+	"sync/atomic"
 	"time"
 )
 
 // Client - Used to create an inbound connection to Freeswitch server
 // In order to originate call, transfer, or something amazing ...
 type Client struct {
+	// established - Connections made by EstablishConnection, first for atomic access
+	established uint64
 	*ESLConnection
 	Protocol     string
 	Address      string
 	Password     string
 	Timeout      int
 	OnDisconnect func()
+	// DialOptions - Keepalive, TCP_NODELAY and local address used by EstablishConnection
+	DialOptions DialOptions
+	// options - Connection options of NewClientWithConn, DefaultOptions when nil
+	options *Options
 }
 
 // NewClient - Init new client connection, this will establish connection and attempt to authenticate against connected freeswitch server
 func NewClient(host string, port int, password string, timeout int) (*Client, error) {
+	return NewClientWithDialOptions(host, port, password, timeout, DialOptions{})
+}
+
+// NewClientWithDialOptions - Same as NewClient, dialing with the given socket options
+func NewClientWithDialOptions(host string, port int, password string, timeout int, opts DialOptions) (*Client, error) {
+	client := &Client{
+		Protocol:    "tcp",
+		Address:     net.JoinHostPort(host, strconv.Itoa(int(port))),
+		Password:    password,
+		Timeout:     timeout,
+		DialOptions: opts,
+	}
+	var err error
+	client.ESLConnection, err = client.EstablishConnection()
+	if err != nil {
+		return nil, err
+	}
+	return client, nil
+}
+
+// NewClientWithConn - Client authenticating on an already established connection, like a tunnel or one end
+// of a net.Pipe, with opts as RoleInbound. timeout bounds the auth handshake in seconds, 0 waits forever.
+// Protocol and Address are the remote address of conn, EstablishConnection dials them again with
+// opts.DialContext, or a net.Dialer when it is nil which fails for a net.Pipe
+func NewClientWithConn(conn net.Conn, password string, timeout int, opts Options) (*Client, error) {
+	opts.Role = RoleInbound
 	client := &Client{
-		Protocol: "tcp",
-		Address:  net.JoinHostPort(host, strconv.Itoa(int(port))),
+		Protocol: conn.RemoteAddr().Network(),
+		Address:  conn.RemoteAddr().String(),
 		Password: password,
 		Timeout:  timeout,
+		options:  &opts,
 	}
 	var err error
-	client.ESLConnection, err = client.EstablishConnection()
+	client.ESLConnection, err = client.authenticate(conn)
 	if err != nil {
 		return nil, err
 	}
 	return client, nil
 }
 
-// EstablishConnection - Will attempt to establish connection against freeswitch and create new connection
+// EstablishConnection - Will attempt to establish connection against freeswitch and create new connection.
+// The DialContext of the Options given to NewClientWithConn is used when DialOptions has none
 func (client *Client) EstablishConnection() (*ESLConnection, error) {
-	c, err := client.Dial("tcp", client.Address, time.Duration(client.Timeout*int(time.Second)))
+	protocol := client.Protocol
+	if protocol == "" {
+		protocol = "tcp"
+	}
+	dialOptions := client.DialOptions
+	if dialOptions.DialContext == nil && client.options != nil {
+		dialOptions.DialContext = client.options.DialContext
+	}
+	c, err := Dial(protocol, client.Address, time.Duration(client.Timeout*int(time.Second)), dialOptions)
 	if err != nil {
 		return nil, err
 	}
-	connection := newConnection(c, false, DefaultOptions)
-	authCtx, cancel := context.WithTimeout(connection.runningContext, time.Duration(client.Timeout)*time.Second)
-	err = connection.Authenticate(authCtx, client.Password)
+	return client.authenticate(c)
+}
+
+// authenticate - Create the connection of c and authenticate it, it is closed on failure
+func (client *Client) authenticate(c net.Conn) (*ESLConnection, error) {
+	opts := DefaultOptions
+	if client.options != nil {
+		opts = *client.options
+	}
+	connection := newConnection(c, false, opts)
+	authCtx, cancel := context.Background(), context.CancelFunc(func() {})
+	if client.Timeout > 0 {
+		authCtx, cancel = context.WithTimeout(connection.runningContext, time.Duration(client.Timeout)*time.Second)
+	}
+	err := connection.Authenticate(authCtx, client.Password)
 	cancel()
 	if err != nil {
 		// Disconnect, we have the wrong password.
 		connection.Close()
 		return nil, err
-	} else {
-		connection.logger.Info("Successfully connect to %s\n", connection.conn.RemoteAddr())
 	}
+	connection.logger.Info("Successfully connect to %s\n", connection.conn.RemoteAddr())
+	atomic.AddUint64(&client.established, 1)
 	return connection, nil
 }
+
+// Stats - Stats of the current connection, with Reconnects the connections established after the first one
+func (client *Client) Stats() ConnectionStats {
+	stats := client.ESLConnection.Stats()
+	if established := atomic.LoadUint64(&client.established); established > 1 {
+		stats.Reconnects = established - 1
+	}
+	return stats
+}
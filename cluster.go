@@ -0,0 +1,414 @@
+/*
+ * Copyright (c) 2021 LuanDNH
+ *
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at https://mozilla.org/MPL/2.0/.
+ *
+ * Contributor(s):
+ * LuanDNH <luandnh98@gmail.com>
+ */
+package goesl
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// ErrNoHealthyNode - Every node of a Cluster is down
+var ErrNoHealthyNode = errors.New("no healthy node")
+
+// errNoHeartbeat - Why a node whose heartbeats stopped is unhealthy
+var errNoHeartbeat = errors.New("no heartbeat")
+
+// DefaultClusterReconnectInterval - Time between two attempts to reconnect a node which is down
+const DefaultClusterReconnectInterval = 5 * time.Second
+
+// DefaultClusterResolveInterval - Time between two resolutions of ClusterOptions.Discover
+const DefaultClusterResolveInterval = 30 * time.Second
+
+// ClusterStrategy - How a Cluster picks the node a command is sent to
+type ClusterStrategy int
+
+const (
+	// ClusterPrimaryBackup - Commands go to the first healthy node in the order of ClusterOptions.Addresses
+	ClusterPrimaryBackup ClusterStrategy = iota
+	// ClusterRoundRobin - Commands are spread over the healthy nodes
+	ClusterRoundRobin
+	// ClusterLeastOutstanding - Commands go to the healthy node with the fewest commands waiting for a reply
+	ClusterLeastOutstanding
+)
+
+// ClusterOptions - Options of NewCluster
+type ClusterOptions struct {
+	// Addresses - host:port of the event socket of each node, in order of preference for ClusterPrimaryBackup.
+	// An address given several times gets as many connections
+	Addresses []string
+	Password  string
+	// Timeout - Connection and authentication timeout in seconds, like Client.Timeout
+	Timeout     int
+	Strategy    ClusterStrategy
+	DialOptions DialOptions
+	// ReconnectInterval - Time between two attempts to reconnect a node, DefaultClusterReconnectInterval when 0
+	ReconnectInterval time.Duration
+	// Discover - SRV or host:port name resolved with ResolveEndpoints into the nodes, instead of Addresses.
+	// It is resolved again every ResolveInterval, DefaultClusterResolveInterval when 0, nodes are added
+	// and removed as the records change
+	Discover        string
+	Resolver        EndpointResolver
+	ResolveInterval time.Duration
+	// HealthCheckInterval - Time between two health checks of each node, 0 disables them. A node is healthy
+	// while HealthCheckCommand, "api status" by default, succeeds within HealthCheckTimeout, the interval when 0
+	HealthCheckInterval time.Duration
+	HealthCheckCommand  string
+	HealthCheckTimeout  time.Duration
+	// HeartbeatWindow - When set each node is monitored with MonitorHeartbeat and is unhealthy while
+	// its heartbeats are older than the window
+	HeartbeatWindow time.Duration
+}
+
+// ClusterNodeStatus - State of a node of a Cluster
+type ClusterNodeStatus struct {
+	Address   string
+	Connected bool
+	// Healthy - Connected and passing its health checks, only healthy nodes get commands
+	Healthy bool
+	// Outstanding - Commands sent to the node and waiting for their reply
+	Outstanding int
+	// LastCheck - Time of the last health check, Latency how long it took
+	LastCheck time.Time
+	Latency   time.Duration
+	// LastHeartbeat - Time the last heartbeat was received, with ClusterOptions.HeartbeatWindow
+	LastHeartbeat time.Time
+	// LastError - Why the node is down or unhealthy, nil otherwise
+	LastError error
+}
+
+// Cluster - Connections to several freeswitch nodes, commands go to a healthy node and fail over to
+// another one when it dies. Nodes which are down are reconnected in the background
+type Cluster struct {
+	opts ClusterOptions
+	// lock - Guards nodes, which change when Discover is resolved again
+	lock  sync.RWMutex
+	nodes []*clusterNode
+	next  uint32
+	stop  chan struct{}
+	once  sync.Once
+	wg    sync.WaitGroup
+}
+
+type clusterNode struct {
+	// outstanding - Commands in flight, updated atomically. First so it is 64-bit aligned on 32-bit platforms
+	outstanding int64
+	lock        sync.Mutex
+	address     string
+	client      *Client
+	lastErr     error
+	healthy     bool
+	connectedAt time.Time
+	lastCheck   time.Time
+	latency     time.Duration
+	monitor     *HeartbeatMonitor
+}
+
+// NewCluster - Connect to every node, an error is returned only when none could be reached
+func NewCluster(opts ClusterOptions) (*Cluster, error) {
+	if opts.ReconnectInterval <= 0 {
+		opts.ReconnectInterval = DefaultClusterReconnectInterval
+	}
+	if opts.ResolveInterval <= 0 {
+		opts.ResolveInterval = DefaultClusterResolveInterval
+	}
+	cluster := &Cluster{opts: opts, stop: make(chan struct{})}
+	addresses := opts.Addresses
+	if opts.Discover != "" {
+		var err error
+		if addresses, err = cluster.resolve(); err != nil {
+			return nil, err
+		}
+	}
+	if len(addresses) == 0 {
+		return nil, errors.New("cluster has no address")
+	}
+	var lastErr error
+	connected := 0
+	for _, address := range addresses {
+		node := &clusterNode{address: address}
+		if err := cluster.connect(node); err != nil {
+			lastErr = err
+		} else {
+			connected++
+		}
+		cluster.nodes = append(cluster.nodes, node)
+	}
+	if connected == 0 {
+		return nil, lastErr
+	}
+	cluster.wg.Add(1)
+	go cluster.reconnectLoop()
+	if opts.HealthCheckInterval > 0 {
+		cluster.wg.Add(1)
+		go cluster.healthLoop()
+	}
+	return cluster, nil
+}
+
+func (cl *Cluster) resolve() ([]string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), cl.opts.ResolveInterval)
+	defer cancel()
+	endpoints, err := ResolveEndpoints(ctx, cl.opts.Resolver, cl.opts.Discover)
+	if err != nil {
+		return nil, err
+	}
+	addresses := make([]string, 0, len(endpoints))
+	for _, endpoint := range endpoints {
+		addresses = append(addresses, endpoint.Address)
+	}
+	return addresses, nil
+}
+
+// updateNodes - Follow the resolved addresses, new ones get a node and the nodes of vanished ones are closed.
+// Nodes are kept in the order of the records
+func (cl *Cluster) updateNodes(addresses []string) {
+	cl.lock.Lock()
+	current := make(map[string]*clusterNode, len(cl.nodes))
+	for _, node := range cl.nodes {
+		current[node.address] = node
+	}
+	nodes := make([]*clusterNode, 0, len(addresses))
+	for _, address := range addresses {
+		node, ok := current[address]
+		if !ok {
+			node = &clusterNode{address: address}
+		}
+		delete(current, address)
+		nodes = append(nodes, node)
+	}
+	cl.nodes = nodes
+	cl.lock.Unlock()
+	for _, node := range current {
+		node.close()
+	}
+}
+
+func (cl *Cluster) connect(node *clusterNode) error {
+	client := &Client{
+		Protocol:    "tcp",
+		Address:     node.address,
+		Password:    cl.opts.Password,
+		Timeout:     cl.opts.Timeout,
+		DialOptions: cl.opts.DialOptions,
+	}
+	connection, err := client.EstablishConnection()
+	if err != nil {
+		node.lock.Lock()
+		node.lastErr = err
+		node.lock.Unlock()
+		return err
+	}
+	client.ESLConnection = connection
+	var monitor *HeartbeatMonitor
+	if cl.opts.HeartbeatWindow > 0 {
+		monitor, err = connection.MonitorHeartbeat(HeartbeatOptions{
+			Window: cl.opts.HeartbeatWindow,
+			OnTimeout: func(Heartbeat) {
+				node.setHealth(false, errNoHeartbeat)
+			},
+			// Without health checks nothing else brings the node back
+			OnResume: func(Heartbeat) {
+				node.resumeHeartbeat()
+			},
+		})
+		if err != nil {
+			connection.Close()
+			node.lock.Lock()
+			node.lastErr = err
+			node.lock.Unlock()
+			return err
+		}
+	}
+	node.lock.Lock()
+	defer node.lock.Unlock()
+	node.client, node.lastErr, node.healthy = client, nil, true
+	node.connectedAt, node.monitor = time.Now(), monitor
+	return nil
+}
+
+// connection - Connection of a node, nil when it is down
+func (node *clusterNode) connection() *ESLConnection {
+	node.lock.Lock()
+	defer node.lock.Unlock()
+	if node.client == nil {
+		return nil
+	}
+	if err := node.client.Err(); err != nil {
+		node.client, node.lastErr = nil, err
+		return nil
+	}
+	return node.client.ESLConnection
+}
+
+func (node *clusterNode) close() {
+	node.lock.Lock()
+	defer node.lock.Unlock()
+	if node.client != nil {
+		node.client.Close()
+		node.client = nil
+	}
+}
+
+func (cl *Cluster) currentNodes() []*clusterNode {
+	cl.lock.RLock()
+	defer cl.lock.RUnlock()
+	return cl.nodes
+}
+
+func (cl *Cluster) reconnectLoop() {
+	defer cl.wg.Done()
+	ticker := time.NewTicker(cl.opts.ReconnectInterval)
+	defer ticker.Stop()
+	var resolveTicks <-chan time.Time
+	if cl.opts.Discover != "" {
+		resolveTicker := time.NewTicker(cl.opts.ResolveInterval)
+		defer resolveTicker.Stop()
+		resolveTicks = resolveTicker.C
+	}
+	for {
+		select {
+		case <-ticker.C:
+		case <-resolveTicks:
+			// A failed resolution keeps the nodes known so far
+			if addresses, err := cl.resolve(); err == nil && len(addresses) > 0 {
+				cl.updateNodes(addresses)
+			}
+		case <-cl.stop:
+			return
+		}
+		for _, node := range cl.currentNodes() {
+			if node.connection() == nil {
+				_ = cl.connect(node)
+			}
+		}
+	}
+}
+
+// clusterCandidate - A healthy node and its connection
+type clusterCandidate struct {
+	node       *clusterNode
+	connection *ESLConnection
+}
+
+// candidates - Healthy nodes in the order they should be tried
+func (cl *Cluster) candidates() []clusterCandidate {
+	nodes := cl.currentNodes()
+	if len(nodes) == 0 {
+		return nil
+	}
+	start := 0
+	if cl.opts.Strategy == ClusterRoundRobin {
+		start = int(atomic.AddUint32(&cl.next, 1)-1) % len(nodes)
+	}
+	candidates := make([]clusterCandidate, 0, len(nodes))
+	for i := range nodes {
+		node := nodes[(start+i)%len(nodes)]
+		if connection := node.connection(); connection != nil && node.isHealthy() {
+			candidates = append(candidates, clusterCandidate{node: node, connection: connection})
+		}
+	}
+	if cl.opts.Strategy == ClusterLeastOutstanding {
+		sort.SliceStable(candidates, func(i, j int) bool {
+			return atomic.LoadInt64(&candidates[i].node.outstanding) < atomic.LoadInt64(&candidates[j].node.outstanding)
+		})
+	}
+	return candidates
+}
+
+// do - Run a command on the healthy nodes in turn until one answers. A node is only skipped once its
+// connection is dead, a command interrupted by the death of its node may have run there
+func (cl *Cluster) do(command func(connection *ESLConnection) (*ESLResponse, error)) (*ESLResponse, error) {
+	err := ErrNoHealthyNode
+	for _, candidate := range cl.candidates() {
+		var response *ESLResponse
+		atomic.AddInt64(&candidate.node.outstanding, 1)
+		response, err = command(candidate.connection)
+		atomic.AddInt64(&candidate.node.outstanding, -1)
+		if candidate.connection.Err() == nil {
+			return response, err
+		}
+	}
+	return nil, err
+}
+
+// SendWithContext - Send a command to a healthy node, see ESLConnection.SendWithContext
+func (cl *Cluster) SendWithContext(ctx context.Context, cmd string) (*ESLResponse, error) {
+	return cl.do(func(connection *ESLConnection) (*ESLResponse, error) {
+		return connection.SendWithContext(ctx, cmd)
+	})
+}
+
+// Send - Send a command to a healthy node, see ESLConnection.Send
+func (cl *Cluster) Send(cmd string) (*ESLResponse, error) {
+	return cl.SendWithContext(context.Background(), cmd)
+}
+
+// ApiWithContext - Run an api command on a healthy node, see ESLConnection.ApiWithContext
+func (cl *Cluster) ApiWithContext(ctx context.Context, cmd string) (*ESLResponse, error) {
+	return cl.do(func(connection *ESLConnection) (*ESLResponse, error) {
+		return connection.ApiWithContext(ctx, cmd)
+	})
+}
+
+// Api - Run an api command on a healthy node, see ESLConnection.Api
+func (cl *Cluster) Api(cmd string) (*ESLResponse, error) {
+	return cl.ApiWithContext(context.Background(), cmd)
+}
+
+// BgApi - Run a bgapi command on a healthy node, see ESLConnection.BgApi
+func (cl *Cluster) BgApi(cmd string) error {
+	_, err := cl.do(func(connection *ESLConnection) (*ESLResponse, error) {
+		return nil, connection.BgApi(cmd)
+	})
+	return err
+}
+
+// Nodes - State of every node, in the order of ClusterOptions.Addresses or of the resolved records
+func (cl *Cluster) Nodes() []ClusterNodeStatus {
+	nodes := cl.currentNodes()
+	statuses := make([]ClusterNodeStatus, 0, len(nodes))
+	for _, node := range nodes {
+		connected := node.connection() != nil
+		node.lock.Lock()
+		status := ClusterNodeStatus{
+			Address:     node.address,
+			Connected:   connected,
+			Healthy:     connected && node.healthy,
+			Outstanding: int(atomic.LoadInt64(&node.outstanding)),
+			LastCheck:   node.lastCheck,
+			Latency:     node.latency,
+			LastError:   node.lastErr,
+		}
+		monitor := node.monitor
+		node.lock.Unlock()
+		if monitor != nil {
+			last, _ := monitor.Last()
+			status.LastHeartbeat = last.Time
+		}
+		statuses = append(statuses, status)
+	}
+	return statuses
+}
+
+// Close - Stop reconnecting and close every connection
+func (cl *Cluster) Close() {
+	cl.once.Do(func() {
+		close(cl.stop)
+	})
+	cl.wg.Wait()
+	for _, node := range cl.currentNodes() {
+		node.close()
+	}
+}
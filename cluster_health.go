@@ -0,0 +1,89 @@
+/*
+ * Copyright (c) 2021 LuanDNH
+ *
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at https://mozilla.org/MPL/2.0/.
+ *
+ * Contributor(s):
+ * LuanDNH <luandnh98@gmail.com>
+ */
+package goesl
+
+import (
+	"context"
+	"time"
+)
+
+func (node *clusterNode) isHealthy() bool {
+	node.lock.Lock()
+	defer node.lock.Unlock()
+	return node.healthy
+}
+
+func (node *clusterNode) setHealth(healthy bool, err error) {
+	node.lock.Lock()
+	defer node.lock.Unlock()
+	node.healthy, node.lastErr = healthy, err
+}
+
+// resumeHeartbeat - Heartbeats are back, the node is healthy again unless it failed for another reason
+func (node *clusterNode) resumeHeartbeat() {
+	node.lock.Lock()
+	defer node.lock.Unlock()
+	if node.lastErr == errNoHeartbeat {
+		node.healthy, node.lastErr = true, nil
+	}
+}
+
+func (cl *Cluster) healthLoop() {
+	defer cl.wg.Done()
+	ticker := time.NewTicker(cl.opts.HealthCheckInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+		case <-cl.stop:
+			return
+		}
+		for _, node := range cl.currentNodes() {
+			if connection := node.connection(); connection != nil {
+				cl.checkHealth(node, connection)
+			}
+		}
+	}
+}
+
+// checkHealth - Run the health command and check the heartbeats are fresh
+func (cl *Cluster) checkHealth(node *clusterNode, connection *ESLConnection) {
+	command := cl.opts.HealthCheckCommand
+	if command == "" {
+		command = "api status"
+	}
+	timeout := cl.opts.HealthCheckTimeout
+	if timeout <= 0 {
+		timeout = cl.opts.HealthCheckInterval
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	start := time.Now()
+	_, err := connection.SendWithContext(ctx, command)
+	cancel()
+	latency := time.Since(start)
+
+	node.lock.Lock()
+	node.lastCheck, node.latency = start, latency
+	monitor, connectedAt := node.monitor, node.connectedAt
+	node.lock.Unlock()
+
+	if err == nil && monitor != nil {
+		last, seen := monitor.Last()
+		since := connectedAt
+		if seen {
+			since = last.Time
+		}
+		if time.Since(since) > cl.opts.HeartbeatWindow {
+			err = errNoHeartbeat
+		}
+	}
+	node.setHealth(err == nil, err)
+}
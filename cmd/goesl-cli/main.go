@@ -0,0 +1,519 @@
+/*
+ * Copyright (c) 2021 LuanDNH
+ *
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at https://mozilla.org/MPL/2.0/.
+ *
+ * Contributor(s):
+ * LuanDNH <luandnh98@gmail.com>
+ */
+// goesl-cli - Interactive console for the freeswitch event socket, in the spirit of fs_cli.
+//
+// Lines are sent as api commands, lines starting with / are console commands, see /help.
+// With -x the command is run once and its output printed, the exit status tells if it succeeded
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/luandnh/goesl"
+)
+
+// maxHistory - Lines kept in the history file
+const maxHistory = 1000
+
+const (
+	colorReset   = "\x1b[0m"
+	colorRed     = "\x1b[31m"
+	colorGreen   = "\x1b[32m"
+	colorYellow  = "\x1b[33m"
+	colorBlue    = "\x1b[34m"
+	colorMagenta = "\x1b[35m"
+	colorCyan    = "\x1b[36m"
+	colorGray    = "\x1b[90m"
+)
+
+func main() {
+	os.Exit(run(os.Args[1:], os.Stdin, os.Stdout, os.Stderr))
+}
+
+// run - Parse args and run the console on stdin, or the -x command, returns the exit status
+func run(args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	flags := flag.NewFlagSet("goesl-cli", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	host := flags.String("H", "127.0.0.1", "freeswitch host")
+	port := flags.Int("P", 8021, "event socket port")
+	password := flags.String("p", "ClueCon", "event socket password")
+	timeout := flags.Duration("t", 5*time.Second, "connect and command timeout, 0 waits forever for commands")
+	execute := flags.String("x", "", "run the api command, print its output and exit")
+	noColor := flags.Bool("no-color", false, "disable colored output")
+	historyFile := flags.String("history", defaultHistoryFile(), "history file, empty keeps the history in memory")
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+
+	c, err := connect(net.JoinHostPort(*host, strconv.Itoa(*port)), *password, *timeout)
+	if err != nil {
+		fmt.Fprintln(stderr, "goesl-cli:", err)
+		return 1
+	}
+	if *execute != "" {
+		defer c.ExitAndClose()
+		return runOnce(c, *execute, *timeout, stdout, stderr)
+	}
+
+	cli := &console{
+		conn:        c,
+		out:         stdout,
+		color:       !*noColor && os.Getenv("NO_COLOR") == "" && isTerminal(stdout),
+		timeout:     *timeout,
+		historyFile: *historyFile,
+		prompt:      "freeswitch@" + *host + "> ",
+	}
+	cli.loadHistory()
+	events := make(chan struct{})
+	go func() {
+		defer close(events)
+		cli.readEvents()
+	}()
+	cli.run(stdin)
+	// The server hangs up after exit, that is not a lost connection
+	atomic.StoreInt32(&cli.quitting, 1)
+	c.ExitAndClose()
+	<-events
+	return 0
+}
+
+// connect - Dial and authenticate, without the library logging to the console
+func connect(address, password string, timeout time.Duration) (*goesl.ESLConnection, error) {
+	conn, err := goesl.Dial("tcp", address, timeout, goesl.DialOptions{})
+	if err != nil {
+		return nil, err
+	}
+	c := goesl.NewConnectionFromConn(conn, goesl.Options{Logger: goesl.NilLogger{}})
+	ctx, cancel := withTimeout(context.Background(), timeout)
+	defer cancel()
+	if err := c.Authenticate(ctx, password); err != nil {
+		c.Close()
+		return nil, err
+	}
+	return c, nil
+}
+
+// runOnce - The -x mode, returns the exit status
+func runOnce(c *goesl.ESLConnection, cmd string, timeout time.Duration, stdout, stderr io.Writer) int {
+	ctx, cancel := withTimeout(context.Background(), timeout)
+	defer cancel()
+	response, err := c.ApiWithContext(ctx, cmd)
+	if response != nil {
+		stdout.Write(withNewline(response.Body))
+	}
+	if err != nil {
+		if response == nil {
+			fmt.Fprintln(stderr, "goesl-cli:", err)
+		}
+		return 1
+	}
+	return 0
+}
+
+type console struct {
+	conn    *goesl.ESLConnection
+	out     io.Writer
+	color   bool
+	timeout time.Duration
+	prompt  string
+
+	// outputLock - Events and command output are written from different goroutines
+	outputLock sync.Mutex
+
+	history     []string
+	historyFile string
+	// events - Events subscribed with /events, released by /noevents
+	events []string
+	// quitting - Set once the console is done, readEvents then returns quietly
+	quitting int32
+}
+
+// run - Read commands until /quit or the end of the input
+func (cli *console) run(input io.Reader) {
+	scanner := bufio.NewScanner(input)
+	for {
+		cli.printf("%s", cli.prompt)
+		if !scanner.Scan() {
+			cli.printf("\n")
+			return
+		}
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+		line, ok := cli.expandHistory(line)
+		if !ok {
+			continue
+		}
+		cli.addHistory(line)
+		if !cli.handle(line) {
+			return
+		}
+		select {
+		case <-cli.conn.Done():
+			return
+		default:
+		}
+	}
+}
+
+// handle - Run one line, false once the console should exit
+func (cli *console) handle(line string) bool {
+	if !strings.HasPrefix(line, "/") {
+		cli.api(line)
+		return true
+	}
+	fields := strings.Fields(line)
+	args := fields[1:]
+	switch fields[0] {
+	case "/quit", "/exit", "/bye":
+		return false
+	case "/help":
+		cli.help()
+	case "/history":
+		for i, entry := range cli.history {
+			cli.printf("%4d  %s\n", i+1, entry)
+		}
+	case "/events", "/event":
+		cli.subscribe(args)
+	case "/nixevent":
+		cli.report(cli.conn.Unsubscribe(args...))
+		cli.events = removeEvents(cli.events, args)
+	case "/noevents":
+		if len(cli.events) > 0 {
+			cli.report(cli.conn.Unsubscribe(cli.events...))
+			cli.events = nil
+		}
+	case "/filter":
+		cli.filter(args)
+	case "/log":
+		level := "debug"
+		if len(args) > 0 {
+			level = args[0]
+		}
+		cli.send("log " + level)
+	case "/nolog":
+		cli.send("nolog")
+	default:
+		cli.errorf("unknown command %s, see /help\n", fields[0])
+	}
+	return true
+}
+
+func (cli *console) help() {
+	cli.printf(`Commands:
+  <api command>                 run an api command, like status or show channels
+  /events [plain|json] <events> subscribe to events, ALL or names like CHANNEL_CREATE "CUSTOM sofia::register"
+  /nixevent <events>            unsubscribe from events
+  /noevents                     unsubscribe from every event subscribed with /events
+  /filter <header> <value>      only receive the events matching a filter
+  /filter delete <header> [value]
+                                remove a filter
+  /log [level]                  receive the console log, debug by default
+  /nolog                        stop receiving the console log
+  /history                      list the history, !! runs the last line again and !N the line N
+  /help                         this help
+  /quit, /exit, /bye            leave
+`)
+}
+
+func (cli *console) api(cmd string) {
+	ctx, cancel := withTimeout(context.Background(), cli.timeout)
+	defer cancel()
+	response, err := cli.conn.ApiWithContext(ctx, cmd)
+	if response != nil {
+		cli.write(withNewline(response.Body))
+		return
+	}
+	cli.report(err)
+}
+
+// send - Run a plain command and print its reply
+func (cli *console) send(cmd string) {
+	ctx, cancel := withTimeout(context.Background(), cli.timeout)
+	defer cancel()
+	response, err := cli.conn.SendWithContext(ctx, cmd)
+	if err != nil {
+		cli.report(err)
+		return
+	}
+	cli.printf("%s\n", response.GetReply())
+}
+
+func (cli *console) subscribe(args []string) {
+	format := goesl.EventFormatPlain
+	if len(args) > 0 {
+		switch strings.ToLower(args[0]) {
+		case goesl.EventFormatPlain, goesl.EventFormatJSON, goesl.EventFormatXML:
+			format, args = strings.ToLower(args[0]), args[1:]
+		}
+	}
+	if len(args) == 0 {
+		args = []string{goesl.EventAll}
+	}
+	if err := cli.conn.Subscribe(format, args...); err != nil {
+		cli.report(err)
+		return
+	}
+	cli.events = append(cli.events, args...)
+	cli.printf("+OK event listener enabled %s\n", format)
+}
+
+func (cli *console) filter(args []string) {
+	var err error
+	switch {
+	case len(args) >= 2 && args[0] == "delete":
+		value := strings.Join(args[2:], " ")
+		err = cli.conn.FilterDelete(args[1], value)
+	case len(args) >= 2:
+		err = cli.conn.Filter(args[0], strings.Join(args[1:], " "))
+	default:
+		err = errors.New("usage : /filter <header> <value> or /filter delete <header> [value]")
+	}
+	if err != nil {
+		cli.report(err)
+		return
+	}
+	cli.printf("+OK filter updated\n")
+}
+
+// readEvents - Print the events and log lines until the connection is gone
+func (cli *console) readEvents() {
+	for {
+		message, err := cli.conn.ReadMessage()
+		if err != nil {
+			if !errors.Is(err, goesl.ErrConnectionClosed) && atomic.LoadInt32(&cli.quitting) == 0 {
+				cli.errorf("\nconnection lost : %v\n", err)
+			}
+			return
+		}
+		switch {
+		case message.IsEvent():
+			cli.printEvent(message)
+		case message.ContentType == goesl.ContentType_LogData:
+			cli.printLog(message)
+		case message.ContentType == goesl.ContentType_Disconnect:
+			cli.printf("\n%s", withNewline(message.Body))
+		}
+		message.Release()
+	}
+}
+
+func (cli *console) printEvent(event *goesl.ESLResponse) {
+	name := event.GetHeader("Event-Name")
+	if subclass := event.GetHeader("Event-Subclass"); subclass != "" {
+		name += " " + subclass
+	}
+	dump := event.Dump()
+	// The content type line is the same for every event, the name is shown instead
+	if i := strings.IndexByte(dump, '\n'); i >= 0 {
+		dump = dump[i+1:]
+	}
+	cli.outputLock.Lock()
+	defer cli.outputLock.Unlock()
+	fmt.Fprintf(cli.out, "\n%s\n%s\n", cli.paint(eventColor(event.GetHeader("Event-Name")), "[EVENT] "+name), dump)
+}
+
+func (cli *console) printLog(message *goesl.ESLResponse) {
+	level, _ := strconv.Atoi(message.GetHeader("Log-Level"))
+	cli.outputLock.Lock()
+	defer cli.outputLock.Unlock()
+	fmt.Fprint(cli.out, cli.paint(logColor(level), string(withNewline(message.Body))))
+}
+
+// eventColor - Channel life cycle events stand out from the rest
+func eventColor(name string) string {
+	switch {
+	case name == goesl.EventHeartbeat || name == goesl.EventReSchedule:
+		return colorGray
+	case name == goesl.EventChannelCreate || name == goesl.EventChannelAnswer:
+		return colorGreen
+	case strings.HasPrefix(name, "CHANNEL_HANGUP"):
+		return colorRed
+	case strings.HasPrefix(name, "CHANNEL_"):
+		return colorCyan
+	case name == goesl.EventBackgroundJob:
+		return colorBlue
+	case name == goesl.EventCustom:
+		return colorMagenta
+	}
+	return colorYellow
+}
+
+// logColor - Colors of fs_cli for the syslog levels of log/data
+func logColor(level int) string {
+	switch level {
+	case 0, 1, 2, 3:
+		return colorRed
+	case 4:
+		return colorMagenta
+	case 5:
+		return colorCyan
+	case 6:
+		return colorGreen
+	}
+	return colorYellow
+}
+
+func (cli *console) paint(color, text string) string {
+	if !cli.color {
+		return text
+	}
+	return color + text + colorReset
+}
+
+func (cli *console) printf(format string, args ...interface{}) {
+	cli.outputLock.Lock()
+	defer cli.outputLock.Unlock()
+	fmt.Fprintf(cli.out, format, args...)
+}
+
+func (cli *console) write(p []byte) {
+	cli.outputLock.Lock()
+	defer cli.outputLock.Unlock()
+	cli.out.Write(p)
+}
+
+func (cli *console) errorf(format string, args ...interface{}) {
+	cli.printf("%s", cli.paint(colorRed, fmt.Sprintf(format, args...)))
+}
+
+func (cli *console) report(err error) {
+	if err != nil {
+		cli.errorf("-ERR %v\n", err)
+	}
+}
+
+// expandHistory - Replace !! and !N with the matching history line, echoed like a shell does
+func (cli *console) expandHistory(line string) (string, bool) {
+	if !strings.HasPrefix(line, "!") {
+		return line, true
+	}
+	index := len(cli.history)
+	if line != "!!" {
+		n, err := strconv.Atoi(line[1:])
+		if err != nil {
+			return line, true
+		}
+		index = n
+	}
+	if index < 1 || index > len(cli.history) {
+		cli.errorf("%s : event not found\n", line)
+		return "", false
+	}
+	line = cli.history[index-1]
+	cli.printf("%s\n", line)
+	return line, true
+}
+
+func (cli *console) addHistory(line string) {
+	if n := len(cli.history); n > 0 && cli.history[n-1] == line {
+		return
+	}
+	cli.history = append(cli.history, line)
+	if len(cli.history) > maxHistory {
+		cli.history = cli.history[len(cli.history)-maxHistory:]
+	}
+	if cli.historyFile == "" {
+		return
+	}
+	file, err := os.OpenFile(cli.historyFile, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0600)
+	if err != nil {
+		return
+	}
+	defer file.Close()
+	fmt.Fprintln(file, line)
+}
+
+// loadHistory - Read the history file, keeping its last maxHistory lines
+func (cli *console) loadHistory() {
+	if cli.historyFile == "" {
+		return
+	}
+	file, err := os.Open(cli.historyFile)
+	if err != nil {
+		return
+	}
+	defer file.Close()
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		if line := strings.TrimSpace(scanner.Text()); line != "" {
+			cli.history = append(cli.history, line)
+		}
+	}
+	if len(cli.history) > maxHistory {
+		cli.history = cli.history[len(cli.history)-maxHistory:]
+		// Rewrite the file so it does not grow forever
+		_ = os.WriteFile(cli.historyFile, []byte(strings.Join(cli.history, "\n")+"\n"), 0600)
+	}
+}
+
+func defaultHistoryFile() string {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(home, ".goesl_history")
+}
+
+// removeEvents - events without the ones given, compared case insensitively like freeswitch does
+func removeEvents(events, removed []string) []string {
+	var kept []string
+	for _, event := range events {
+		keep := true
+		for _, r := range removed {
+			if strings.EqualFold(event, r) {
+				keep = false
+				break
+			}
+		}
+		if keep {
+			kept = append(kept, event)
+		}
+	}
+	return kept
+}
+
+func isTerminal(w io.Writer) bool {
+	file, ok := w.(*os.File)
+	if !ok {
+		return false
+	}
+	info, err := file.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
+
+func withTimeout(ctx context.Context, timeout time.Duration) (context.Context, context.CancelFunc) {
+	if timeout <= 0 {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeout(ctx, timeout)
+}
+
+func withNewline(body []byte) []byte {
+	if len(body) > 0 && body[len(body)-1] != '\n' {
+		return append(body, '\n')
+	}
+	return body
+}
@@ -0,0 +1,129 @@
+/*
+ * Copyright (c) 2021 LuanDNH
+ *
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at https://mozilla.org/MPL/2.0/.
+ *
+ * Contributor(s):
+ * LuanDNH <luandnh98@gmail.com>
+ */
+
+package main
+
+import (
+	"bytes"
+	"net"
+	"strings"
+	"testing"
+
+	"github.com/luandnh/goesl/goesltest"
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeFreeswitch - Listen on TCP, authenticate the first connection with ClueCon and hand it to script.
+// The -H and -P arguments of the listener are returned
+func fakeFreeswitch(t *testing.T, script func(server *goesltest.Server)) []string {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { listener.Close() })
+	done := make(chan struct{})
+	t.Cleanup(func() { <-done })
+	go func() {
+		defer close(done)
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		server := goesltest.NewServer(t, conn)
+		defer server.Close()
+		server.Write("Content-Type: auth/request\n\n")
+		command := server.ReadCommand()
+		if command == nil || command.Line != "auth "+goesltest.Password {
+			server.Reply("-ERR invalid")
+			return
+		}
+		server.Reply("+OK accepted")
+		script(server)
+	}()
+	host, port, _ := net.SplitHostPort(listener.Addr().String())
+	return []string{"-H", host, "-P", port, "-history", "", "-t", "1s"}
+}
+
+func TestRun_Execute(t *testing.T) {
+	args := fakeFreeswitch(t, func(server *goesltest.Server) {
+		server.ExpectCommand("api show calls count")
+		server.APIResponse("\n0 total.")
+		server.ExpectCommand("exit")
+		server.Reply("+OK bye")
+	})
+	var stdout, stderr bytes.Buffer
+	assert.Equal(t, 0, run(append(args, "-x", "show calls count"), nil, &stdout, &stderr))
+	assert.Equal(t, "\n0 total.\n", stdout.String())
+	assert.Equal(t, "", stderr.String())
+}
+
+func TestRun_ExecuteError(t *testing.T) {
+	args := fakeFreeswitch(t, func(server *goesltest.Server) {
+		server.ExpectCommand("api bogus")
+		server.APIResponse("-ERR bogus Command not found!\n")
+		server.ExpectCommand("exit")
+		server.Reply("+OK bye")
+	})
+	var stdout, stderr bytes.Buffer
+	assert.Equal(t, 1, run(append(args, "-x", "bogus"), nil, &stdout, &stderr))
+	assert.Equal(t, "-ERR bogus Command not found!\n", stdout.String())
+}
+
+func TestRun_WrongPassword(t *testing.T) {
+	args := fakeFreeswitch(t, func(server *goesltest.Server) {})
+	var stdout, stderr bytes.Buffer
+	assert.Equal(t, 1, run(append(args, "-p", "wrong", "-x", "status"), nil, &stdout, &stderr))
+	assert.Equal(t, "", stdout.String())
+	assert.True(t, strings.HasPrefix(stderr.String(), "goesl-cli: "), stderr.String())
+}
+
+func TestRun_BadArguments(t *testing.T) {
+	var stdout, stderr bytes.Buffer
+	assert.Equal(t, 2, run([]string{"-P", "not-a-port"}, nil, &stdout, &stderr))
+	assert.Contains(t, stderr.String(), "invalid value \"not-a-port\" for flag -P")
+	assert.Contains(t, stderr.String(), "Usage of goesl-cli")
+}
+
+func TestRun_Console(t *testing.T) {
+	args := fakeFreeswitch(t, func(server *goesltest.Server) {
+		server.ExpectCommand("api status")
+		server.APIResponse("UP 0 years, 0 days\n")
+		server.ExpectCommand("event json CHANNEL_CREATE")
+		server.Reply("+OK event listener enabled json")
+		server.ExpectCommand("api status")
+		server.APIResponse("UP 0 years, 0 days\n")
+		server.ExpectCommand("filter Unique-ID abc")
+		server.Reply("+OK filter added. [Unique-ID]=[abc]")
+		server.ExpectCommand("exit")
+		server.Reply("+OK bye")
+	})
+	input := strings.Join([]string{
+		"status",
+		"/events json CHANNEL_CREATE",
+		"/bogus",
+		"!1",
+		"/filter Unique-ID",
+		"/filter Unique-ID abc",
+		"/quit",
+		"status",
+	}, "\n") + "\n"
+	var stdout, stderr bytes.Buffer
+	assert.Equal(t, 0, run(append(args, "-no-color"), strings.NewReader(input), &stdout, &stderr))
+	prompt := "freeswitch@127.0.0.1> "
+	assert.Equal(t, prompt+"UP 0 years, 0 days\n"+
+		prompt+"+OK event listener enabled json\n"+
+		prompt+"unknown command /bogus, see /help\n"+
+		prompt+"status\nUP 0 years, 0 days\n"+
+		prompt+"-ERR usage : /filter <header> <value> or /filter delete <header> [value]\n"+
+		prompt+"+OK filter updated\n"+
+		prompt, stdout.String())
+	assert.Equal(t, "", stderr.String())
+}
@@ -0,0 +1,249 @@
+/*
+ * Copyright (c) 2021 LuanDNH
+ *
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at https://mozilla.org/MPL/2.0/.
+ *
+ * Contributor(s):
+ * LuanDNH <luandnh98@gmail.com>
+ */
+// goesl-dump - Dump the events of a freeswitch to stdout or a file, a tcpdump for the event socket.
+//
+// The json and journal formats are journals, they can be read back with goesl.NewJournalReader or
+// fed to goesl.ESLConnection.Replay. Stops on SIGINT or SIGTERM, or once -c events are written
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"net"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/luandnh/goesl"
+)
+
+// headerFlag - Repeatable Header=Value flag
+type headerFlag [][2]string
+
+func (f *headerFlag) String() string {
+	var pairs []string
+	for _, pair := range *f {
+		pairs = append(pairs, pair[0]+"="+pair[1])
+	}
+	return strings.Join(pairs, ",")
+}
+
+func (f *headerFlag) Set(value string) error {
+	i := strings.IndexByte(value, '=')
+	if i <= 0 {
+		return errors.New("expected Header=Value")
+	}
+	*f = append(*f, [2]string{value[:i], value[i+1:]})
+	return nil
+}
+
+func (f headerFlag) matchers() []goesl.EventMatcher {
+	var matchers []goesl.EventMatcher
+	for _, pair := range f {
+		matchers = append(matchers, goesl.HeaderEq(pair[0], pair[1]))
+	}
+	return matchers
+}
+
+func main() {
+	host := flag.String("H", "127.0.0.1", "freeswitch host")
+	port := flag.Int("P", 8021, "event socket port")
+	password := flag.String("p", "ClueCon", "event socket password")
+	timeout := flag.Duration("t", 5*time.Second, "connect timeout")
+	events := flag.String("e", goesl.EventAll, `events to subscribe, space separated like "CHANNEL_ANSWER CUSTOM sofia::register"`)
+	format := flag.String("f", "text", "output format: text, json (json lines journal) or journal (binary journal)")
+	output := flag.String("w", "", "write to the file instead of stdout, appending to it")
+	count := flag.Int("c", 0, "exit after writing count events, 0 never exits")
+	keep := flag.String("headers", "", "comma separated headers to keep, every header when empty")
+	var filters, matches, excludes headerFlag
+	flag.Var(&filters, "filter", "Header=Value sent as a freeswitch filter, events matching any filter are received. Repeatable")
+	flag.Var(&matches, "match", "Header=Value every written event must have. Repeatable")
+	flag.Var(&excludes, "exclude", "Header=Value of the events not written. Repeatable")
+	flag.Parse()
+
+	encode, err := encoder(*format)
+	if err != nil {
+		fatal(err)
+	}
+	var matchers []goesl.EventMatcher
+	matchers = append(matchers, matches.matchers()...)
+	for _, m := range excludes.matchers() {
+		matchers = append(matchers, goesl.Not(m))
+	}
+
+	out := os.Stdout
+	if *output != "" {
+		if out, err = os.OpenFile(*output, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644); err != nil {
+			fatal(err)
+		}
+		defer out.Close()
+	}
+	writer := bufio.NewWriter(out)
+	defer writer.Flush()
+
+	c, err := connect(net.JoinHostPort(*host, strconv.Itoa(*port)), *password, *timeout)
+	if err != nil {
+		fatal(err)
+	}
+	defer c.ExitAndClose()
+	for _, filter := range filters {
+		if err := c.Filter(filter[0], filter[1]); err != nil {
+			fatal(err)
+		}
+	}
+	if err := c.Subscribe(goesl.EventFormatJSON, strings.Fields(*events)...); err != nil {
+		fatal(err)
+	}
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		<-signals
+		c.Close()
+	}()
+
+	dump := dumper{writer: writer, encode: encode, matchers: matchers, keep: splitHeaders(*keep)}
+	// A pipe closed by a reader like head is not worth an error
+	if err := dump.run(c, *count); err != nil && !errors.Is(err, goesl.ErrConnectionClosed) && !errors.Is(err, syscall.EPIPE) {
+		writer.Flush()
+		fatal(err)
+	}
+}
+
+// connect - Dial and authenticate, without the library logging to the output
+func connect(address, password string, timeout time.Duration) (*goesl.ESLConnection, error) {
+	conn, err := goesl.Dial("tcp", address, timeout, goesl.DialOptions{})
+	if err != nil {
+		return nil, err
+	}
+	c := goesl.NewConnectionFromConn(conn, goesl.Options{Logger: goesl.NilLogger{}})
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	if err := c.Authenticate(ctx, password); err != nil {
+		c.Close()
+		return nil, err
+	}
+	return c, nil
+}
+
+type dumper struct {
+	writer   *bufio.Writer
+	encode   func(received time.Time, event *goesl.Event) ([]byte, error)
+	matchers []goesl.EventMatcher
+	// keep - Lower cased headers to keep, all when empty
+	keep map[string]bool
+}
+
+// run - Write the events until the connection is closed or count events are written
+func (d *dumper) run(c *goesl.ESLConnection, count int) error {
+	written := 0
+	for count <= 0 || written < count {
+		message, err := c.ReadMessage()
+		if err != nil {
+			return err
+		}
+		if !message.IsEvent() {
+			message.Release()
+			continue
+		}
+		ok, err := d.write(message)
+		message.Release()
+		if err != nil {
+			return err
+		}
+		if ok {
+			written++
+		}
+	}
+	return nil
+}
+
+// write - Write the event unless a matcher drops it, true once written
+func (d *dumper) write(event *goesl.Event) (bool, error) {
+	for _, m := range d.matchers {
+		if !m.Match(event) {
+			return false, nil
+		}
+	}
+	if len(d.keep) > 0 {
+		for _, f := range event.Headers.Fields() {
+			if !d.keep[strings.ToLower(f.Name)] {
+				event.Headers.Del(f.Name)
+			}
+		}
+	}
+	entry, err := d.encode(time.Now(), event)
+	if err != nil {
+		return false, err
+	}
+	if _, err := d.writer.Write(entry); err != nil {
+		return false, err
+	}
+	// Events are rare enough to flush each of them, a tail of the output sees them at once
+	return true, d.writer.Flush()
+}
+
+func encoder(format string) (func(time.Time, *goesl.Event) ([]byte, error), error) {
+	switch format {
+	case "text":
+		return encodeText, nil
+	case "json":
+		return journalEncoder(goesl.JournalNDJSON), nil
+	case "journal":
+		return journalEncoder(goesl.JournalBinary), nil
+	}
+	return nil, errors.New("unknown format " + format + ", expected text, json or journal")
+}
+
+func journalEncoder(format goesl.JournalFormat) func(time.Time, *goesl.Event) ([]byte, error) {
+	return func(received time.Time, event *goesl.Event) ([]byte, error) {
+		return goesl.EncodeJournalEntry(received, event, format)
+	}
+}
+
+// encodeText - The receive time and event name on a line, then the headers and the body
+func encodeText(received time.Time, event *goesl.Event) ([]byte, error) {
+	name := event.GetHeader("Event-Name")
+	if subclass := event.GetHeader("Event-Subclass"); subclass != "" {
+		name += " " + subclass
+	}
+	dump := event.Dump()
+	// The content type line is the same for every event
+	if i := strings.IndexByte(dump, '\n'); i >= 0 {
+		dump = dump[i+1:]
+	}
+	return []byte(fmt.Sprintf("%s %s\n%s\n", received.Format("15:04:05.000000"), name, dump)), nil
+}
+
+// splitHeaders - Lower cased names of list, Event-Name is always kept when a list is given
+func splitHeaders(list string) map[string]bool {
+	keep := make(map[string]bool)
+	if strings.TrimSpace(list) != "" {
+		keep["event-name"] = true
+	}
+	for _, name := range strings.Split(list, ",") {
+		if name = strings.TrimSpace(name); name != "" {
+			keep[strings.ToLower(name)] = true
+		}
+	}
+	return keep
+}
+
+func fatal(err error) {
+	fmt.Fprintln(os.Stderr, "goesl-dump:", err)
+	os.Exit(1)
+}
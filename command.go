@@ -11,10 +11,38 @@
 
 package goesl
 
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"strconv"
+	"strings"
+)
+
 func (c *ESLConnection) Api(cmd string) (*ESLResponse, error) {
 	return c.Send("api " + cmd)
 }
 
+// ApiWithContext - Same as Api but give up waiting for the response when ctx is done
+func (c *ESLConnection) ApiWithContext(ctx context.Context, cmd string) (*ESLResponse, error) {
+	return c.SendWithContext(ctx, "api "+cmd)
+}
+
+// ApiStream - Send api command and return its body as a stream rather than reading it in memory, for large outputs
+// like show channels. The stream ends after the declared Content-Length, it must be closed so the connection
+// can read the next messages. Interceptors are not run, nothing else must hold on to the stream
+func (c *ESLConnection) ApiStream(cmd string) (io.ReadCloser, error) {
+	response, err := c.writeAndWait(context.Background(), commandFrame("api "+cmd), true)
+	if err != nil {
+		return nil, err
+	}
+	if response.stream == nil {
+		return io.NopCloser(bytes.NewReader(response.Body)), nil
+	}
+	return response.stream, nil
+}
+
 func (c *ESLConnection) BgApi(cmd string) error {
 	return c.SendAsync("api " + cmd)
 }
@@ -22,3 +50,48 @@ func (c *ESLConnection) BgApi(cmd string) error {
 func (c *ESLConnection) Exit(cmd string) error {
 	return c.SendAsync("exit")
 }
+
+// SendEvent - Fire an event with sendevent, headers are "Name: value" lines.
+// A non empty body is framed with its Content-Length
+func (c *ESLConnection) SendEvent(name string, headers []string, body string) (*ESLResponse, error) {
+	frame, err := buildFrame("sendevent "+name, headers, body)
+	if err != nil {
+		return nil, err
+	}
+	return c.sendFrame(context.Background(), frame)
+}
+
+// buildFrame - Build a command frame with headers and an optional body in a pooled buffer,
+// so it is written with a single Write. The buffer goes back to the pool once written
+func buildFrame(cmd string, headers []string, body string) ([]byte, error) {
+	size := len(cmd) + 1 + len(body) + len("Content-Length: \n\n") + 20
+	for _, header := range headers {
+		if strings.ContainsAny(header, "\r\n") {
+			return nil, errors.New("header can not contain line breaks : " + strconv.Quote(header))
+		}
+		size += len(header) + 1
+	}
+	frame := getFrameBuffer(size)
+	frame = append(frame, cmd...)
+	frame = append(frame, '\n')
+	for _, header := range headers {
+		frame = append(frame, header...)
+		frame = append(frame, '\n')
+	}
+	if body != "" {
+		frame = append(frame, "Content-Length: "...)
+		frame = strconv.AppendInt(frame, int64(len(body)), 10)
+		frame = append(frame, "\n\n"...)
+		frame = append(frame, body...)
+	} else {
+		frame = append(frame, '\n')
+	}
+	return frame, nil
+}
+
+// commandFrame - Frame of a command without headers, in a pooled buffer
+func commandFrame(cmd string) []byte {
+	frame := getFrameBuffer(len(cmd) + len(EndOfMessage))
+	frame = append(frame, cmd...)
+	return append(frame, EndOfMessage...)
+}
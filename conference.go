@@ -0,0 +1,320 @@
+/*
+ * Copyright (c) 2021 LuanDNH
+ *
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at https://mozilla.org/MPL/2.0/.
+ *
+ * Contributor(s):
+ * LuanDNH <luandnh98@gmail.com>
+ */
+package goesl
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// conferenceEvents - Events a ConferenceManager follows
+var conferenceEvents = []string{EventCustom + " conference::maintenance"}
+
+// conferenceWatchSize - Changes buffered per watcher, later ones are dropped until it catches up
+const conferenceWatchSize = 64
+
+// Actions of conference::maintenance events handled by ConferenceManager
+const (
+	ConferenceActionCreate       = "conference-create"
+	ConferenceActionDestroy      = "conference-destroy"
+	ConferenceActionAddMember    = "add-member"
+	ConferenceActionDelMember    = "del-member"
+	ConferenceActionStartTalking = "start-talking"
+	ConferenceActionStopTalking  = "stop-talking"
+	ConferenceActionMuteMember   = "mute-member"
+	ConferenceActionUnmuteMember = "unmute-member"
+	ConferenceActionDeafMember   = "deaf-member"
+	ConferenceActionUndeafMember = "undeaf-member"
+	ConferenceActionFloorChange  = "floor-change"
+)
+
+// ConferenceMember - A member of a conference roster
+type ConferenceMember struct {
+	ID     int
+	UUID   string
+	Name   string
+	Number string
+	// Talking - Speaking right now, Muted - Can not speak, Deaf - Can not hear, Floor - Holds the floor
+	Talking bool
+	Muted   bool
+	Deaf    bool
+	Floor   bool
+	Joined  time.Time
+}
+
+// ConferenceChange - A roster change, Member is the member after the change. Actions are the ConferenceAction* constants
+type ConferenceChange struct {
+	Conference string
+	Action     string
+	Member     ConferenceMember
+}
+
+type conferenceRoster struct {
+	members  map[int]*ConferenceMember
+	watchers map[chan ConferenceChange]struct{}
+}
+
+// ConferenceManager - Live rosters of the conferences, fed by conference::maintenance events. See ManageConferences
+type ConferenceManager struct {
+	connection  *ESLConnection
+	dispatcher  *OrderedDispatcher
+	lock        sync.RWMutex
+	conferences map[string]*conferenceRoster
+	stopOnce    sync.Once
+}
+
+// ManageConferences - Start following the conferences until Stop. Only the members joining from now on are known.
+// On an outbound connection the events must be enabled with myevents
+func (c *ESLConnection) ManageConferences() (*ConferenceManager, error) {
+	if !c.outbound {
+		if err := c.subscribeInternal(conferenceEvents...); err != nil {
+			return nil, err
+		}
+	}
+	m := &ConferenceManager{
+		connection:  c,
+		conferences: make(map[string]*conferenceRoster),
+	}
+	// A single worker keeps the changes of a conference in order
+	m.dispatcher = c.DispatchOrdered(1, 0, m.apply)
+	return m, nil
+}
+
+// Stop - Stop following the conferences and close the channels returned by Watch
+func (m *ConferenceManager) Stop() error {
+	var err error
+	m.stopOnce.Do(func() {
+		m.dispatcher.Stop()
+		m.lock.Lock()
+		for _, roster := range m.conferences {
+			for watcher := range roster.watchers {
+				close(watcher)
+			}
+			roster.watchers = nil
+		}
+		m.lock.Unlock()
+		if !m.connection.outbound {
+			err = m.connection.Unsubscribe(conferenceEvents...)
+		}
+	})
+	return err
+}
+
+func (m *ConferenceManager) apply(event *Event) {
+	if event.GetHeader("Event-Subclass") != "conference::maintenance" {
+		return
+	}
+	name := event.GetHeader("Conference-Name")
+	action := event.GetHeader("Action")
+	if name == "" {
+		return
+	}
+	id, err := strconv.Atoi(event.GetHeader("Member-ID"))
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	roster := m.rosterLocked(name)
+	if action == ConferenceActionDestroy {
+		for _, member := range roster.members {
+			roster.notify(ConferenceChange{Conference: name, Action: ConferenceActionDelMember, Member: *member})
+		}
+		roster.members = make(map[int]*ConferenceMember)
+		roster.notify(ConferenceChange{Conference: name, Action: action})
+		// Kept while watched, so a conference created again with the same name is still reported
+		if len(roster.watchers) == 0 {
+			delete(m.conferences, name)
+		}
+		return
+	}
+	if err != nil {
+		if action == ConferenceActionCreate {
+			roster.notify(ConferenceChange{Conference: name, Action: action})
+		}
+		return
+	}
+	member, ok := roster.members[id]
+	if !ok {
+		if action == ConferenceActionDelMember {
+			return
+		}
+		member = &ConferenceMember{ID: id, Joined: time.Now()}
+		roster.members[id] = member
+	}
+	member.UUID = firstNonEmpty(event.GetHeader("Unique-ID"), member.UUID)
+	member.Name = firstNonEmpty(event.GetHeader("Caller-Caller-ID-Name"), member.Name)
+	member.Number = firstNonEmpty(event.GetHeader("Caller-Caller-ID-Number"), member.Number)
+	// Speak and Hear are false when muted or deaf
+	if v := event.GetHeader("Speak"); v != "" {
+		member.Muted = v != "true"
+	}
+	if v := event.GetHeader("Hear"); v != "" {
+		member.Deaf = v != "true"
+	}
+	if v := event.GetHeader("Talking"); v != "" {
+		member.Talking = v == "true"
+	}
+	if v := event.GetHeader("Floor"); v != "" {
+		member.Floor = v == "true"
+	}
+	switch action {
+	case ConferenceActionStartTalking:
+		member.Talking = true
+	case ConferenceActionStopTalking:
+		member.Talking = false
+	case ConferenceActionMuteMember:
+		member.Muted, member.Talking = true, false
+	case ConferenceActionUnmuteMember:
+		member.Muted = false
+	case ConferenceActionDeafMember:
+		member.Deaf = true
+	case ConferenceActionUndeafMember:
+		member.Deaf = false
+	case ConferenceActionDelMember:
+		delete(roster.members, id)
+	}
+	roster.notify(ConferenceChange{Conference: name, Action: action, Member: *member})
+}
+
+func (m *ConferenceManager) rosterLocked(name string) *conferenceRoster {
+	roster := m.conferences[name]
+	if roster == nil {
+		roster = &conferenceRoster{
+			members:  make(map[int]*ConferenceMember),
+			watchers: make(map[chan ConferenceChange]struct{}),
+		}
+		m.conferences[name] = roster
+	}
+	return roster
+}
+
+// notify - Hand change to the watchers without waiting, a watcher which is full misses it
+func (r *conferenceRoster) notify(change ConferenceChange) {
+	for watcher := range r.watchers {
+		select {
+		case watcher <- change:
+		default:
+		}
+	}
+}
+
+// Watch - Channel of the roster changes of conference, until the returned function is called or Stop.
+// Changes are dropped while the channel is full
+func (m *ConferenceManager) Watch(conference string) (<-chan ConferenceChange, func()) {
+	watcher := make(chan ConferenceChange, conferenceWatchSize)
+	m.lock.Lock()
+	m.rosterLocked(conference).watchers[watcher] = struct{}{}
+	m.lock.Unlock()
+	var once sync.Once
+	return watcher, func() {
+		once.Do(func() {
+			m.lock.Lock()
+			defer m.lock.Unlock()
+			roster := m.conferences[conference]
+			if roster == nil {
+				return
+			}
+			if _, ok := roster.watchers[watcher]; ok {
+				delete(roster.watchers, watcher)
+				close(watcher)
+			}
+		})
+	}
+}
+
+// Conferences - Names of the conferences with members, sorted
+func (m *ConferenceManager) Conferences() []string {
+	m.lock.RLock()
+	defer m.lock.RUnlock()
+	var names []string
+	for name, roster := range m.conferences {
+		if len(roster.members) > 0 {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Members - Roster of conference ordered by member id, empty when it has no member
+func (m *ConferenceManager) Members(conference string) []ConferenceMember {
+	m.lock.RLock()
+	defer m.lock.RUnlock()
+	roster := m.conferences[conference]
+	if roster == nil {
+		return nil
+	}
+	members := make([]ConferenceMember, 0, len(roster.members))
+	for _, member := range roster.members {
+		members = append(members, *member)
+	}
+	sort.Slice(members, func(i, j int) bool { return members[i].ID < members[j].ID })
+	return members
+}
+
+// conferenceMember - Run conference <name> <action> <member id> with extra arguments
+func (m *ConferenceManager) conferenceMember(conference, action string, memberID int, args ...string) error {
+	cmd := Command("conference", append([]string{conference, action, strconv.Itoa(memberID)}, args...)...)
+	response, err := m.connection.Api(cmd)
+	if err != nil {
+		return err
+	}
+	// The conference api answers errors as plain text, like "Non-Existant ID 12"
+	if reply := strings.TrimSpace(string(response.Body)); strings.HasPrefix(reply, "Non-Existant") || strings.HasPrefix(reply, "Conference "+conference+" not found") {
+		return &ConferenceError{Reply: reply}
+	}
+	return nil
+}
+
+// ConferenceError - Conference command refused by mod_conference
+type ConferenceError struct {
+	Reply string
+}
+
+func (e *ConferenceError) Error() string {
+	return "conference command failed : " + e.Reply
+}
+
+// Mute - Stop the member from speaking
+func (m *ConferenceManager) Mute(conference string, memberID int) error {
+	return m.conferenceMember(conference, "mute", memberID)
+}
+
+// Unmute - Let the member speak again
+func (m *ConferenceManager) Unmute(conference string, memberID int) error {
+	return m.conferenceMember(conference, "unmute", memberID)
+}
+
+// Deaf - Stop the member from hearing the conference
+func (m *ConferenceManager) Deaf(conference string, memberID int) error {
+	return m.conferenceMember(conference, "deaf", memberID)
+}
+
+// Undeaf - Let the member hear the conference again
+func (m *ConferenceManager) Undeaf(conference string, memberID int) error {
+	return m.conferenceMember(conference, "undeaf", memberID)
+}
+
+// Kick - Remove the member from the conference, playing the kicked sound
+func (m *ConferenceManager) Kick(conference string, memberID int) error {
+	return m.conferenceMember(conference, "kick", memberID)
+}
+
+// Hangup - Remove the member from the conference without any sound
+func (m *ConferenceManager) Hangup(conference string, memberID int) error {
+	return m.conferenceMember(conference, "hup", memberID)
+}
+
+// SetVolume - Set the input gain of the member, from -4 to 4
+func (m *ConferenceManager) SetVolume(conference string, memberID int, level int) error {
+	return m.conferenceMember(conference, "volume_in", memberID, strconv.Itoa(level))
+}
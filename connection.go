@@ -18,32 +18,167 @@ import (
 	"io"
 	"net"
 	"net/textproto"
+	"strconv"
+	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
 // ESLConnection
 type ESLConnection struct {
-	conn net.Conn
-	err  chan error
+	// droppedEvents - See DroppedEvents, first so it is 64-bit aligned on 32-bit platforms
+	droppedEvents uint64
+	conn          net.Conn
 
-	reader            *bufio.Reader
-	header            *textproto.Reader
-	writeLock         sync.Mutex
-	responseMessage   chan *ESLResponse
-	responseChanMutex sync.RWMutex
+	// state - connectionOpen or connectionClosed, done - Closed once the connection is closed,
+	// closeErr - Why it was closed, set before done is closed
+	state     int32
+	done      chan struct{}
+	closeOnce sync.Once
+	closeErr  error
+
+	reader       *bufio.Reader
+	header       *textproto.Reader
+	eventMessage chan *ESLResponse
+	// readingMessages - Set once ReadMessage is called, BackpressureBlock only blocks from then on
+	readingMessages int32
+
+	// commands - Requests handed to the writer goroutine, pending - Requests written and waiting for their reply
+	commands    chan *request
+	pendingLock sync.Mutex
+	pending     []*request
+	// inFlight - One slot per pending request when Options.MaxInFlight is set
+	inFlight chan struct{}
+	// limiter - Set when Options.RateLimit is
+	limiter *tokenBucket
+	// breaker - Set when Options.CircuitThreshold is
+	breaker *circuitBreaker
+	// retryPolicy - Options.Retry, used by query
+	retryPolicy RetryPolicy
+	// tracer - Options.Tracer, nil when not tracing
+	tracer Tracer
+	stats  *connectionStats
+	// interceptors - Options.Interceptors and those added by Use, replaced rather than modified
+	interceptorsLock sync.RWMutex
+	interceptors     []Interceptor
+	// dialContext - Options.DialContext
+	dialContext func(ctx context.Context, network, address string) (net.Conn, error)
+
+	eventListenerLock sync.RWMutex
+	eventListeners    map[string]map[string]EventListener
+	dispatchers       map[*OrderedDispatcher]struct{}
+
+	subscriptionLock   sync.Mutex
+	subscriptionFormat string
+	subscriptions      map[string]int
 
 	runningContext context.Context
 	logger         Logger
 	stopFunc       func()
+	outbound       bool
+	parser         messageParser
+
+	backpressure    BackpressurePolicy
+	onEventOverflow func(message *ESLResponse)
+	idleTimeout     time.Duration
+	onPanic         func(err *PanicError)
+	// sequences - Set when event gaps are detected, see Options.DetectEventGaps
+	sequences  eventSequences
+	onEventGap func(gap EventGap)
+
+	disconnectLock    sync.Mutex
+	disconnectNotice  *DisconnectNotice
+	disconnectHandler DisconnectHandler
+
+	// callRouter - Hands channel events to the Calls, started by the first TrackCall or OnNewCall
+	callRouterOnce sync.Once
+	callRouter     *callRouter
+
+	channelDataLock sync.Mutex
+	channelData     *ChannelData
 }
 
 const EndOfMessage = "\r\n\r\n"
 
+// EventBufferSize - Default number of events queued for ReadMessage before the backpressure policy applies
+const EventBufferSize = 1 << 10
+
+// ConnectionRole - Side of the event socket a connection is on
+type ConnectionRole int
+
+const (
+	// RoleInbound - Connection made to freeswitch mod_event_socket, it must be authenticated
+	RoleInbound ConnectionRole = iota
+	// RoleOutbound - Connection made by freeswitch socket application to us
+	RoleOutbound
+)
+
 // Options - Generic options for an ESL connection, either inbound or outbound
 type Options struct {
 	Context context.Context
 	Logger  Logger
+	Role    ConnectionRole
+	// HeaderDecoding - Which messages get their header values URL decoded, HeaderDecodingAuto by default
+	HeaderDecoding HeaderDecoding
+	// ParseMode - ParseStrict by default, ParseLenient keeps the read loop going on frames it does not understand
+	ParseMode ParseMode
+	// ReadBufferSize - Size of the read buffer, ReadBufferSize when 0
+	ReadBufferSize int
+	// MaxFrameSize - Largest message body accepted, a larger one ends the connection. 0 means no limit,
+	// ApiStream bodies are not limited
+	MaxFrameSize int
+	// MaxHeaderSize - Largest header block accepted, DefaultMaxHeaderSize when 0
+	MaxHeaderSize int
+	// EventBufferSize - Number of messages queued for ReadMessage, EventBufferSize when 0
+	EventBufferSize int
+	// Backpressure - What happens once the ReadMessage buffer is full, BackpressureBlock by default.
+	// Events reach listeners and dispatchers whatever the policy. With BackpressureBlock the read loop only
+	// waits for ReadMessage once it has been called, until then the oldest messages make room for new ones
+	Backpressure BackpressurePolicy
+	// OnEventOverflow - Called from the read loop with the message which does not fit, with BackpressureCallback.
+	// It must not block, nor keep the message with PoolResponses
+	OnEventOverflow func(message *ESLResponse)
+	// IdleTimeout - Longest time without receiving anything, heartbeats included, before the connection
+	// is declared dead with ErrIdleTimeout. 0 waits forever
+	IdleTimeout time.Duration
+	// OnPanic - Called with the panics recovered in the read loop, which end the connection,
+	// and in event listeners and other handlers, which only end the handler. Panics are logged either way
+	OnPanic func(err *PanicError)
+	// MaxInFlight - Most commands written and waiting for their reply, further commands wait to be written.
+	// 0 means no limit
+	MaxInFlight int
+	// RateLimit - Most commands sent per second, with bursts of RateBurst commands. 0 means no limit.
+	// Commands above the rate wait for their turn, or fail with ErrRateLimited when RateLimitFailFast is set
+	RateLimit         float64
+	RateBurst         int
+	RateLimitFailFast bool
+	// CircuitThreshold - Consecutive failed or timed out commands after which commands fail fast with ErrCircuitOpen.
+	// CircuitProbeCommand, "api status" by default, is then sent every CircuitProbeInterval and closes the circuit
+	// again once it succeeds. 0 disables the circuit breaker
+	CircuitThreshold     int
+	CircuitProbeInterval time.Duration
+	CircuitProbeCommand  string
+	// PoolResponses - Reuse messages once released, see ESLResponse.Release for who owns a message
+	PoolResponses bool
+	// Retry - Retry policy of the read only helpers like Status, GetVar or the sofia queries.
+	// The zero value makes a single attempt, see DefaultRetryPolicy
+	Retry RetryPolicy
+	// Tracer - Called with every frame written and every message read, for debugging the protocol exchange.
+	// Passwords are redacted from the frames written
+	Tracer Tracer
+	// DetectEventGaps - Check the Event-Sequence of the events received, a gap means freeswitch dropped events,
+	// most likely because its queue for the connection was full while the read loop was blocked. The sequence
+	// counts every event of the core, it is only meaningful when all events are subscribed without filters.
+	// Gaps are counted in Stats and given to OnEventGap, which must not block, or logged when it is nil
+	DetectEventGaps bool
+	OnEventGap      func(gap EventGap)
+	// DialContext - Used by Dial instead of a net.Dialer, see DialOptions.DialContext
+	DialContext func(ctx context.Context, network, address string) (net.Conn, error)
+	// Interceptors - Wrap every command waiting for a reply, the first one is the outermost. See Use
+	Interceptors []Interceptor
+	// ExpvarPrefix - When set the connection is published with PublishExpvar under this name
+	ExpvarPrefix string
 }
 
 // DefaultOptions - The default options used for creating the connection
@@ -52,13 +187,33 @@ var DefaultOptions = Options{
 	Logger:  NormalLogger{},
 }
 
+// NewConnectionFromConn - Wrap an already established connection (TLS, proxied socket, net.Pipe, ...).
+// An inbound connection starts reading once Authenticate succeeds, an outbound one starts reading right away
+func NewConnectionFromConn(conn net.Conn, opts Options) *ESLConnection {
+	connection := newConnection(conn, opts.Role == RoleOutbound, opts)
+	if connection.outbound {
+		go connection.HandleMessage()
+	}
+	return connection
+}
+
 func newConnection(c net.Conn, outbound bool, opts Options) *ESLConnection {
-	reader := bufio.NewReader(c)
+	if opts.ReadBufferSize <= 0 {
+		opts.ReadBufferSize = ReadBufferSize
+	}
+	stats := newConnectionStats()
+	reader := bufio.NewReaderSize(countingReader{reader: c, count: &stats.bytesRead}, opts.ReadBufferSize)
 	header := textproto.NewReader(reader)
 
 	if opts.Logger == nil {
 		opts.Logger = NilLogger{}
 	}
+	if opts.EventBufferSize <= 0 {
+		opts.EventBufferSize = EventBufferSize
+	}
+	if opts.Context == nil {
+		opts.Context = context.Background()
+	}
 
 	runningContext, stop := context.WithCancel(opts.Context)
 
@@ -66,152 +221,328 @@ func newConnection(c net.Conn, outbound bool, opts Options) *ESLConnection {
 		conn:            c,
 		reader:          reader,
 		header:          header,
-		responseMessage: make(chan *ESLResponse),
+		eventMessage:    make(chan *ESLResponse, opts.EventBufferSize),
+		commands:        make(chan *request),
+		eventListeners:  make(map[string]map[string]EventListener),
+		dispatchers:     make(map[*OrderedDispatcher]struct{}),
+		subscriptions:   make(map[string]int),
 		runningContext:  runningContext,
 		stopFunc:        stop,
 		logger:          opts.Logger,
-		err:             make(chan error),
+		done:            make(chan struct{}),
+		outbound:        outbound,
+		parser:          newMessageParser(reader, opts),
+		backpressure:    opts.Backpressure,
+		onEventOverflow: opts.OnEventOverflow,
+		idleTimeout:     opts.IdleTimeout,
+		onPanic:         opts.OnPanic,
+		onEventGap:      opts.OnEventGap,
+		retryPolicy:     opts.Retry,
+		tracer:          opts.Tracer,
+		interceptors:    opts.Interceptors,
+		dialContext:     opts.DialContext,
+		stats:           stats,
 	}
+	if opts.DetectEventGaps {
+		instance.sequences = make(eventSequences)
+	}
+	if opts.MaxInFlight > 0 {
+		instance.inFlight = make(chan struct{}, opts.MaxInFlight)
+	}
+	if opts.RateLimit > 0 {
+		instance.limiter = newTokenBucket(opts.RateLimit, opts.RateBurst, opts.RateLimitFailFast)
+	}
+	if opts.CircuitThreshold > 0 {
+		instance.breaker = newCircuitBreaker(opts)
+	}
+	instance.parser.streamReply = instance.nextReplyStreams
+	instance.parser.stats = stats
+	if instance.tracer != nil {
+		// A panicking tracer must not end the read loop
+		instance.parser.onReceive = instance.traceReceive
+	}
+	if opts.ExpvarPrefix != "" {
+		if err := instance.PublishExpvar(opts.ExpvarPrefix); err != nil {
+			instance.logger.Warn("could not publish the connection : %v", err)
+		}
+	}
+	go instance.writeLoop()
+	go func() {
+		// Cancelling the parent context closes the connection
+		<-runningContext.Done()
+		instance.Close()
+	}()
 	return instance
 }
 
+// Dial - Open a connection to address with Options.DialContext, or a net.Dialer when it is nil
 func (c *ESLConnection) Dial(protocol string, address string, timeout time.Duration) (net.Conn, error) {
-	return net.DialTimeout(protocol, address, timeout)
+	return Dial(protocol, address, timeout, DialOptions{DialContext: c.dialContext})
 }
 
 // Authenticate - Method used to authenticate client against freeswitch.
+// The deadline of ctx bounds the handshake
 func (c *ESLConnection) Authenticate(ctx context.Context, password string) error {
+	if deadline, ok := ctx.Deadline(); ok {
+		_ = c.conn.SetDeadline(deadline)
+	}
 	header, err := c.header.ReadMIMEHeader()
 	if err != nil && err.Error() != "EOF" {
 		return err
 	}
+	c.traceMIMEHeader(header)
+	if header.Get("Content-Type") == ContentType_Rejection {
+		return c.readRejection(header)
+	}
 	if header.Get("Content-Type") != "auth/request" {
 		return errors.New("auth request is invalid")
 	}
 	cmd := "auth " + password + EndOfMessage
+	c.traceSend([]byte(cmd))
 	_, err = io.WriteString(c.conn, cmd)
 	if err != nil {
 		return err
 	}
+	c.stats.sent(len(cmd))
 	am, err := c.header.ReadMIMEHeader()
 	if err != nil && err.Error() != "EOF" {
 		return err
 	}
+	c.traceMIMEHeader(am)
 	if am.Get("Reply-Text") != "+OK accepted" {
 		return errors.New("invalid password")
 	}
+	// The read loop sets its own deadlines
+	_ = c.conn.SetDeadline(time.Time{})
 	go c.HandleMessage()
 	return nil
 }
 
-// SendWithContext - Send command and get response message with deadline
-func (c *ESLConnection) SendWithContext(ctx context.Context, cmd string) (*ESLResponse, error) {
-	c.writeLock.Lock()
-	defer c.writeLock.Unlock()
+// ErrIdleTimeout - Nothing was received within Options.IdleTimeout, the connection is considered dead
+var ErrIdleTimeout = errors.New("idle timeout")
 
-	if deadline, ok := ctx.Deadline(); ok {
-		_ = c.conn.SetWriteDeadline(deadline)
-	}
-	_, err := c.conn.Write([]byte(cmd + EndOfMessage))
-	if err != nil {
-		return nil, err
-	}
+// ErrAccessDenied - Freeswitch refused the connection because the client address is not allowed by the event socket ACL
+var ErrAccessDenied = errors.New("access denied")
 
-	// Get response
-	c.responseChanMutex.RLock()
-	defer c.responseChanMutex.RUnlock()
-	select {
-	case response := <-c.responseMessage:
-		if response == nil {
-			// Nil here if the channel is closed
-			return nil, errors.New("connection closed")
-		}
-		return response, nil
-	case err := <-c.err:
-		return nil, err
-	case <-ctx.Done():
-		return nil, ctx.Err()
+// AccessDeniedError - Error returned on text/rude-rejection, it matches ErrAccessDenied with errors.Is
+type AccessDeniedError struct {
+	// Reason - Rejection text sent by freeswitch
+	Reason string
+}
+
+func (e *AccessDeniedError) Error() string {
+	return "access denied : " + e.Reason
+}
+
+func (e *AccessDeniedError) Is(target error) bool {
+	return target == ErrAccessDenied
+}
+
+// readRejection - Read the body of a text/rude-rejection, freeswitch closes the socket right after
+func (c *ESLConnection) readRejection(header textproto.MIMEHeader) error {
+	var reason []byte
+	if length, err := strconv.Atoi(header.Get("Content-Length")); err == nil && length > 0 {
+		reason = make([]byte, length)
+		n, _ := io.ReadFull(c.reader, reason)
+		reason = reason[:n]
 	}
+	return &AccessDeniedError{Reason: strings.TrimSpace(string(reason))}
 }
 
-// Send - Send command and get response message
+// SendWithContext - Send command and get response message with deadline.
+// An unsuccessful reply (-ERR) is returned along with an error
+func (c *ESLConnection) SendWithContext(ctx context.Context, cmd string) (*ESLResponse, error) {
+	return c.sendFrame(ctx, commandFrame(cmd))
+}
+
+// Send - Send command and get response message.
+// An unsuccessful reply (-ERR) is returned along with an error
 func (c *ESLConnection) Send(cmd string) (*ESLResponse, error) {
-	c.writeLock.Lock()
-	defer c.writeLock.Unlock()
+	return c.sendFrame(context.Background(), commandFrame(cmd))
+}
+
+// sendFrame - Write a complete frame and wait for its reply
+func (c *ESLConnection) sendFrame(ctx context.Context, frame []byte) (*ESLResponse, error) {
+	return c.writeAndWait(ctx, frame, false)
+}
 
-	_, err := c.conn.Write([]byte(cmd + EndOfMessage))
+// writeAndWait - Write a frame and wait for its reply, when stream is set an api/response body is left
+// on the socket for the caller to read through the reply stream.
+// Replies are matched to requests in the order they were written, a request given up on keeps its place
+// so its reply, if it ever comes, is not taken by the next one
+func (c *ESLConnection) writeAndWait(ctx context.Context, frame []byte, stream bool) (*ESLResponse, error) {
+	invoke := func(ctx context.Context, frame []byte) (*ESLResponse, error) {
+		if err := c.circuitAllows(); err != nil {
+			return nil, err
+		}
+		response, err := c.roundTrip(ctx, frame, stream)
+		c.recordCommand(response, err)
+		return response, err
+	}
+	if stream {
+		// Not intercepted, a stream dropped by an interceptor giving up or calling next again would never be
+		// read and the read loop would wait for it forever
+		return invoke(ctx, frame)
+	}
+	return c.intercept(ctx, frame, invoke)
+}
+
+// roundTrip - Write a frame and wait for its reply, regardless of the circuit breaker
+func (c *ESLConnection) roundTrip(ctx context.Context, frame []byte, stream bool) (*ESLResponse, error) {
+	req, err := c.submit(ctx, frame, stream)
 	if err != nil {
 		return nil, err
 	}
+	return c.waitReply(ctx, req)
+}
 
-	// Get response
-	c.responseChanMutex.RLock()
-	defer c.responseChanMutex.RUnlock()
-	select { /*
-	 * Created on Sat Dec 11 2021
-	 *
-	 * Copyright (c) 2021 Your Company
-	 */
-
-	case err := <-c.err:
-		return nil, err
-	case response := <-c.responseMessage:
-		if response == nil {
-			// Nil here if the channel is closed
-			return nil, errors.New("connection closed")
+// waitReply - Wait for the reply of a written request
+func (c *ESLConnection) waitReply(ctx context.Context, req *request) (*ESLResponse, error) {
+	var result requestResult
+	select {
+	case result = <-req.reply:
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case <-c.done:
+		// The reply may have been read just before the connection closed
+		select {
+		case result = <-req.reply:
+		default:
+			return nil, c.closeErr
 		}
-		return response, nil
 	}
+	if result.err != nil {
+		return nil, result.err
+	}
+	return result.response, result.response.replyError()
 }
 
 // SendAsync - Send command but don't get response message
 func (c *ESLConnection) SendAsync(cmd string) error {
-	c.writeLock.Lock()
-	defer c.writeLock.Unlock()
-
-	_, err := c.conn.Write([]byte(cmd + EndOfMessage))
+	_, err := c.submit(context.Background(), commandFrame(cmd), false)
 	return err
 }
 
-// ReadMessage - Read message from channel and return ESLResponse
+// ReadMessage - Read the next event, or message which is not the reply of a command, and return ESLResponse.
+// Once the connection is closed the messages already queued are returned, then the error which closed it.
+// With BackpressureBlock, only the last EventBufferSize messages received before the first call are kept
 func (c *ESLConnection) ReadMessage() (*ESLResponse, error) {
+	if atomic.LoadInt32(&c.readingMessages) == 0 {
+		atomic.StoreInt32(&c.readingMessages, 1)
+	}
 	select {
-	case response := <-c.responseMessage:
-		if response == nil {
-			// Nil here if the channel is closed
-			return nil, errors.New("connection closed")
+	case event := <-c.eventMessage:
+		return event, nil
+	case <-c.done:
+		select {
+		case event := <-c.eventMessage:
+			return event, nil
+		default:
+			return nil, c.closeErr
 		}
-		return response, nil
-	case err := <-c.err:
-		return nil, err
 	}
 }
 
-// HandleMessage - Handle message from channel
+// HandleMessage - Handle message from channel, until the connection fails or is closed
 func (c *ESLConnection) HandleMessage() {
-	done := make(chan bool)
-	go func() {
-		for {
-			msg, err := c.ParseResponse()
-			if err != nil {
-				c.err <- err
-				done <- true
-				break
+	err := c.readLoop()
+	c.closeWithError(err)
+	c.failPending(c.closeErr)
+}
+
+// readLoop - Dispatch messages until the connection fails, a panic while parsing or dispatching ends it too
+func (c *ESLConnection) readLoop() (err error) {
+	defer c.recoverPanic("read loop", &err)
+	for {
+		if c.idleTimeout > 0 {
+			_ = c.conn.SetReadDeadline(time.Now().Add(c.idleTimeout))
+		}
+		msg, err := c.ParseResponse()
+		if err != nil {
+			var netErr net.Error
+			if c.idleTimeout > 0 && errors.As(err, &netErr) && netErr.Timeout() {
+				err = ErrIdleTimeout
 			}
-			c.responseMessage <- msg
+			return err
 		}
-	}()
-	<-done
-	c.Close()
+		c.stats.received(msg)
+		if msg.IsEvent() {
+			if c.sequences != nil {
+				c.checkSequence(msg)
+			}
+			// Events never answer a command, keep them away from Send
+			c.callEventListener(msg)
+			c.queueMessage(msg)
+			// Listeners and ReadMessage hold their own reference
+			msg.Release()
+			continue
+		}
+		if msg.ContentType == ContentType_Disconnect {
+			// Neither a reply, ReadMessage still gets it along with the events
+			c.handleDisconnectNotice(msg)
+			c.queueMessage(msg)
+			msg.Release()
+			continue
+		}
+		// Read before the message changes hands
+		stream := msg.stream
+		if !isReply(msg) || !c.deliverReply(msg) {
+			// Nobody is waiting for it, ReadMessage gets it
+			c.queueMessage(msg)
+			msg.Release()
+		}
+		if stream != nil {
+			// The body is still on the socket, wait until the stream has been read or closed.
+			// The reader of the stream sets its own pace
+			if c.idleTimeout > 0 {
+				_ = c.conn.SetReadDeadline(time.Time{})
+			}
+			stream.wait(c.runningContext)
+		}
+	}
 }
 
-// Close - Close connection
+const (
+	connectionOpen int32 = iota
+	connectionClosed
+)
+
+// Close - Close connection. It is safe to call concurrently with reads and sends, and more than once,
+// only the first call closes the socket and returns its error
 func (c *ESLConnection) Close() error {
-	if err := c.conn.Close(); err != nil {
-		return err
+	return c.closeWithError(ErrConnectionClosed)
+}
+
+// closeWithError - Close the connection recording why, the first reason is kept
+func (c *ESLConnection) closeWithError(reason error) error {
+	var err error
+	c.closeOnce.Do(func() {
+		c.closeErr = reason
+		atomic.StoreInt32(&c.state, connectionClosed)
+		close(c.done)
+		c.stopFunc()
+		err = c.conn.Close()
+	})
+	return err
+}
+
+// Done - Channel closed once the connection is closed, either by Close or because reading from it failed
+func (c *ESLConnection) Done() <-chan struct{} {
+	return c.done
+}
+
+// Err - Error which closed the connection, nil while it is open. ErrConnectionClosed after Close,
+// otherwise the read error, ErrIdleTimeout or the PanicError which ended the read loop
+func (c *ESLConnection) Err() error {
+	if !c.isClosed() {
+		return nil
 	}
+	return c.closeErr
+}
 
-	return nil
+// isClosed - Check if the connection was closed, without waiting
+func (c *ESLConnection) isClosed() bool {
+	return atomic.LoadInt32(&c.state) == connectionClosed
 }
 
 // ExitAndClose - Send exit command before close connection
@@ -0,0 +1,345 @@
+/*
+ * Copyright (c) 2021 LuanDNH
+ *
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at https://mozilla.org/MPL/2.0/.
+ *
+ * Contributor(s):
+ * LuanDNH <luandnh98@gmail.com>
+ */
+
+package goesl
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"io"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// ContentDecoder - Decode a message in place. response holds the frame headers and the raw body,
+// the decoder may replace both. logger is the one of the connection reading the message
+type ContentDecoder func(response *ESLResponse, logger Logger) error
+
+var (
+	contentDecoderLock sync.RWMutex
+	contentDecoders    = map[string]ContentDecoder{
+		ContentType_AuthRequest: decodeNothing,
+		ContentType_Reply:       decodeNothing,
+		ContentType_APIResponse: decodeNothing,
+		ContentType_Disconnect:  decodeNothing,
+		ContentType_Rejection:   decodeNothing,
+		ContentType_LogData:     decodeNothing,
+		ContentType_EventPlain:  decodePlainEvent,
+		ContentType_EventJSON:   decodeJSONEvent,
+		ContentType_EventXML:    decodeXMLEventBody,
+	}
+	// pooledContentTypes - Built in decoders which copy what they keep, so the raw body buffer can be reused
+	pooledContentTypes = map[string]bool{
+		ContentType_EventPlain: true,
+		ContentType_EventJSON:  true,
+		ContentType_EventXML:   true,
+	}
+	defaultContentDecoder ContentDecoder
+)
+
+// RegisterContentDecoder - Register the decoder of a content type, like a custom module emitting application/x-mydata.
+// A nil decoder accepts the content type and keeps the message as received. Built in decoders may be replaced
+func RegisterContentDecoder(contentType string, decoder ContentDecoder) {
+	if decoder == nil {
+		decoder = decodeNothing
+	}
+	contentDecoderLock.Lock()
+	contentDecoders[contentType] = decoder
+	delete(pooledContentTypes, contentType)
+	contentDecoderLock.Unlock()
+}
+
+// SetDefaultContentDecoder - Decoder of the content types with no registered decoder.
+// Without one, unknown content types are errors in ParseStrict mode and passed through in ParseLenient mode
+func SetDefaultContentDecoder(decoder ContentDecoder) {
+	contentDecoderLock.Lock()
+	defaultContentDecoder = decoder
+	contentDecoderLock.Unlock()
+}
+
+// lookupContentDecoder - Decoder of a content type, pooled tells if the raw body may be read in a pooled buffer
+func lookupContentDecoder(contentType string) (decoder ContentDecoder, pooled bool, ok bool) {
+	contentDecoderLock.RLock()
+	defer contentDecoderLock.RUnlock()
+	if decoder, ok := contentDecoders[contentType]; ok {
+		return decoder, pooledContentTypes[contentType], true
+	}
+	return defaultContentDecoder, false, defaultContentDecoder != nil
+}
+
+// maxPooledBody - Bodies above this size are not kept in the pool, a large show output must not stay in memory
+const maxPooledBody = 1 << 16
+
+var bodyPool = sync.Pool{
+	New: func() interface{} {
+		buffer := make([]byte, 0, 4096)
+		return &buffer
+	},
+}
+
+// getBodyBuffer - Pooled buffer of length bytes
+func getBodyBuffer(length int) *[]byte {
+	buffer := bodyPool.Get().(*[]byte)
+	if cap(*buffer) < length {
+		*buffer = make([]byte, length)
+	}
+	*buffer = (*buffer)[:length]
+	return buffer
+}
+
+func putBodyBuffer(buffer *[]byte) {
+	if buffer == nil || cap(*buffer) > maxPooledBody {
+		return
+	}
+	bodyPool.Put(buffer)
+}
+
+func decodeNothing(*ESLResponse, Logger) error {
+	return nil
+}
+
+func decodeJSONEvent(response *ESLResponse, logger Logger) error {
+	headers, err := decodeJSONHeaders(response.Body, logger)
+	if err != nil {
+		return err
+	}
+	body := []byte(headers.Get("_body"))
+	headers.Del("_body")
+	response.Headers, response.Body = headers, body
+	return nil
+}
+
+func decodeXMLEventBody(response *ESLResponse, _ Logger) error {
+	xmlHeaders, body, err := decodeXMLEvent(response.Body)
+	if err != nil {
+		return err
+	}
+	for _, f := range xmlHeaders.fields {
+		response.Headers.Add(f.Name, f.Value)
+	}
+	response.Body = body
+	return nil
+}
+
+// decodePlainEvent - Replace the frame headers by the ones of the event, like for json events, and keep its own body
+func decodePlainEvent(response *ESLResponse, _ Logger) error {
+	// The raw body may be a pooled buffer, the headers slice a copy of it
+	text := string(response.Body)
+	headers, offset, err := parsePlainHeaders(text)
+	if err != nil {
+		return err
+	}
+
+	body := []byte{}
+	if contentLength := headers.Get("Content-Length"); len(contentLength) > 0 {
+		length, err := strconv.Atoi(contentLength)
+		if err != nil || length < 0 {
+			return errors.New("invalid content-length : " + contentLength)
+		}
+		if offset+length > len(text) {
+			return errors.New("could not read body : " + io.ErrUnexpectedEOF.Error())
+		}
+		body = []byte(text[offset : offset+length])
+	}
+	response.Headers, response.Body = headers, body
+	return nil
+}
+
+func parsePlainHeaders(text string) (Headers, int, error) {
+	headers, offset, err := parseHeaderBlock(text, strings.Count(text, "\n"))
+	if err != nil {
+		return headers, offset, errors.New("could not read headers : " + err.Error())
+	}
+	return headers, offset, nil
+}
+
+// decodeJSONHeaders - Decode a json event keeping the order of its properties, arrays become repeated headers
+func decodeJSONHeaders(body []byte, logger Logger) (Headers, error) {
+	headers := newHeaders(bytes.Count(body, []byte(`","`)) + 1)
+	// Names and values are substrings of a single copy of the body
+	if scanJSONHeaders(string(body), &headers) {
+		return headers, nil
+	}
+	headers = Headers{}
+	decoder := json.NewDecoder(bytes.NewReader(body))
+	if token, err := decoder.Token(); err != nil {
+		return headers, err
+	} else if delim, ok := token.(json.Delim); !ok || delim != '{' {
+		return headers, errors.New("json event is not an object")
+	}
+	for decoder.More() {
+		token, err := decoder.Token()
+		if err != nil {
+			return headers, err
+		}
+		key, _ := token.(string)
+		var raw json.RawMessage
+		if err := decoder.Decode(&raw); err != nil {
+			return headers, err
+		}
+		var value string
+		if err := json.Unmarshal(raw, &value); err == nil {
+			headers.Add(key, value)
+			continue
+		}
+		// Repeated headers are sent as an array of strings
+		var values []string
+		if err := json.Unmarshal(raw, &values); err != nil {
+			logger.Warn("non-string property (%s)", key)
+			continue
+		}
+		for _, v := range values {
+			headers.Add(key, v)
+		}
+	}
+	return headers, nil
+}
+
+// scanJSONHeaders - Fast path for the flat object of strings and arrays of strings freeswitch sends,
+// false is returned on anything else so the generic decoder can take over
+func scanJSONHeaders(data string, headers *Headers) bool {
+	i := skipJSONSpace(data, 0)
+	if i >= len(data) || data[i] != '{' {
+		return false
+	}
+	i = skipJSONSpace(data, i+1)
+	if i < len(data) && data[i] == '}' {
+		return true
+	}
+	for i < len(data) {
+		key, next, ok := scanJSONString(data, i)
+		if !ok {
+			return false
+		}
+		i = skipJSONSpace(data, next)
+		if i >= len(data) || data[i] != ':' {
+			return false
+		}
+		i = skipJSONSpace(data, i+1)
+		if i >= len(data) {
+			return false
+		}
+		switch data[i] {
+		case '"':
+			value, next, ok := scanJSONString(data, i)
+			if !ok {
+				return false
+			}
+			headers.Add(key, value)
+			i = next
+		case '[':
+			i = skipJSONSpace(data, i+1)
+			for i < len(data) && data[i] != ']' {
+				value, next, ok := scanJSONString(data, i)
+				if !ok {
+					return false
+				}
+				headers.Add(key, value)
+				i = skipJSONSpace(data, next)
+				if i < len(data) && data[i] == ',' {
+					i = skipJSONSpace(data, i+1)
+				} else if i < len(data) && data[i] != ']' {
+					return false
+				}
+			}
+			if i >= len(data) {
+				return false
+			}
+			i++
+		default:
+			return false
+		}
+		i = skipJSONSpace(data, i)
+		if i >= len(data) {
+			return false
+		}
+		switch data[i] {
+		case ',':
+			i = skipJSONSpace(data, i+1)
+		case '}':
+			return skipJSONSpace(data, i+1) == len(data)
+		default:
+			return false
+		}
+	}
+	return false
+}
+
+// scanJSONString - Read the string starting at data[i], escaped strings are left to encoding/json
+func scanJSONString(data string, i int) (string, int, bool) {
+	if i >= len(data) || data[i] != '"' {
+		return "", i, false
+	}
+	escaped := false
+	for j := i + 1; j < len(data); j++ {
+		switch c := data[j]; {
+		case c == '\\':
+			escaped = true
+			j++
+		case c == '"':
+			if !escaped {
+				return data[i+1 : j], j + 1, true
+			}
+			var value string
+			if err := json.Unmarshal([]byte(data[i:j+1]), &value); err != nil {
+				return "", j, false
+			}
+			return value, j + 1, true
+		case c < ' ':
+			return "", j, false
+		}
+	}
+	return "", len(data), false
+}
+
+func skipJSONSpace(data string, i int) int {
+	for i < len(data) && (data[i] == ' ' || data[i] == '\t' || data[i] == '\r' || data[i] == '\n') {
+		i++
+	}
+	return i
+}
+
+// decodeXMLEvent - Decode <event><headers>...</headers><body>...</body></event> keeping header order
+func decodeXMLEvent(data []byte) (Headers, []byte, error) {
+	var headers Headers
+	var body []byte
+	decoder := xml.NewDecoder(bytes.NewReader(data))
+	var path []string
+	var text strings.Builder
+	for {
+		token, err := decoder.Token()
+		if err == io.EOF {
+			return headers, body, nil
+		}
+		if err != nil {
+			return headers, body, err
+		}
+		switch t := token.(type) {
+		case xml.StartElement:
+			path = append(path, t.Name.Local)
+			text.Reset()
+		case xml.CharData:
+			text.Write(t)
+		case xml.EndElement:
+			switch {
+			case len(path) == 3 && path[1] == "headers":
+				headers.Add(t.Name.Local, text.String())
+			case len(path) == 2 && path[1] == "body":
+				body = []byte(text.String())
+			}
+			path = path[:len(path)-1]
+			text.Reset()
+		}
+	}
+}
@@ -0,0 +1,45 @@
+//go:build linux
+// +build linux
+
+/*
+ * Copyright (c) 2021 LuanDNH
+ *
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at https://mozilla.org/MPL/2.0/.
+ *
+ * Contributor(s):
+ * LuanDNH <luandnh98@gmail.com>
+ */
+
+package goesl
+
+import (
+	"net"
+	"syscall"
+	"time"
+)
+
+// setKeepAliveProbes - Set TCP_KEEPINTVL and TCP_KEEPCNT, the period set by net.Dialer only covers the idle time
+func setKeepAliveProbes(conn *net.TCPConn, interval time.Duration, count int) error {
+	raw, err := conn.SyscallConn()
+	if err != nil {
+		return err
+	}
+	var sockErr error
+	err = raw.Control(func(fd uintptr) {
+		if interval > 0 {
+			seconds := int((interval + time.Second - 1) / time.Second)
+			if sockErr = syscall.SetsockoptInt(int(fd), syscall.IPPROTO_TCP, syscall.TCP_KEEPINTVL, seconds); sockErr != nil {
+				return
+			}
+		}
+		if count > 0 {
+			sockErr = syscall.SetsockoptInt(int(fd), syscall.IPPROTO_TCP, syscall.TCP_KEEPCNT, count)
+		}
+	})
+	if err != nil {
+		return err
+	}
+	return sockErr
+}
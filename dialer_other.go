@@ -0,0 +1,25 @@
+//go:build !linux
+// +build !linux
+
+/*
+ * Copyright (c) 2021 LuanDNH
+ *
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at https://mozilla.org/MPL/2.0/.
+ *
+ * Contributor(s):
+ * LuanDNH <luandnh98@gmail.com>
+ */
+
+package goesl
+
+import (
+	"net"
+	"time"
+)
+
+// setKeepAliveProbes - Probe interval and count are left to the system outside linux
+func setKeepAliveProbes(*net.TCPConn, time.Duration, int) error {
+	return nil
+}
@@ -0,0 +1,253 @@
+/*
+ * Copyright (c) 2021 LuanDNH
+ *
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at https://mozilla.org/MPL/2.0/.
+ *
+ * Contributor(s):
+ * LuanDNH <luandnh98@gmail.com>
+ */
+
+package goesl
+
+import (
+	"bufio"
+	"encoding/base64"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// proxyEnvironment - Variables read by ProxyFromEnvironment, in order, upper case first
+var proxyEnvironment = []string{"ALL_PROXY", "all_proxy", "HTTPS_PROXY", "https_proxy", "HTTP_PROXY", "http_proxy"}
+
+// ProxyFromEnvironment - Proxy to reach address according to the environment: the first of ALL_PROXY,
+// HTTPS_PROXY and HTTP_PROXY which is set, in upper or lower case, empty when NO_PROXY matches the host.
+// NO_PROXY is a comma separated list of hosts, domains matching their sub domains, or "*"
+func ProxyFromEnvironment(address string) string {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		host = address
+	}
+	noProxy := os.Getenv("NO_PROXY")
+	if noProxy == "" {
+		noProxy = os.Getenv("no_proxy")
+	}
+	for _, entry := range strings.Split(noProxy, ",") {
+		entry = strings.ToLower(strings.TrimSpace(entry))
+		if entry == "" {
+			continue
+		}
+		if entryHost, _, err := net.SplitHostPort(entry); err == nil {
+			entry = entryHost
+		}
+		domain := strings.TrimPrefix(entry, ".")
+		host := strings.ToLower(host)
+		if entry == "*" || host == domain || strings.HasSuffix(host, "."+domain) {
+			return ""
+		}
+	}
+	for _, name := range proxyEnvironment {
+		if proxy := os.Getenv(name); proxy != "" {
+			return proxy
+		}
+	}
+	return ""
+}
+
+// parseProxyURL - Parse a proxy setting, "host:port" without scheme is an HTTP proxy
+func parseProxyURL(proxy string) (*url.URL, error) {
+	if !strings.Contains(proxy, "://") {
+		proxy = "http://" + proxy
+	}
+	proxyURL, err := url.Parse(proxy)
+	if err != nil {
+		return nil, errors.New("invalid proxy : " + err.Error())
+	}
+	switch proxyURL.Scheme {
+	case "socks5", "socks5h":
+		if proxyURL.Port() == "" {
+			proxyURL.Host = net.JoinHostPort(proxyURL.Hostname(), "1080")
+		}
+	case "http":
+		if proxyURL.Port() == "" {
+			proxyURL.Host = net.JoinHostPort(proxyURL.Hostname(), "80")
+		}
+	default:
+		return nil, errors.New("unsupported proxy scheme : " + proxyURL.Scheme)
+	}
+	return proxyURL, nil
+}
+
+// proxyHandshake - Ask the proxy conn is connected to for a tunnel to address, conn is closed on failure
+func proxyHandshake(conn net.Conn, proxyURL *url.URL, address string) (net.Conn, error) {
+	var err error
+	if proxyURL.Scheme == "http" {
+		conn, err = httpConnect(conn, proxyURL, address)
+	} else {
+		err = socks5Connect(conn, proxyURL, address)
+	}
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return conn, nil
+}
+
+// httpConnect - Open a tunnel with HTTP CONNECT. freeswitch speaks first, what the proxy sent after its
+// response is read from the returned connection
+func httpConnect(conn net.Conn, proxyURL *url.URL, address string) (net.Conn, error) {
+	request := "CONNECT " + address + " HTTP/1.1\r\nHost: " + address + "\r\n"
+	if user := proxyURL.User; user != nil {
+		password, _ := user.Password()
+		credentials := base64.StdEncoding.EncodeToString([]byte(user.Username() + ":" + password))
+		request += "Proxy-Authorization: Basic " + credentials + "\r\n"
+	}
+	if _, err := io.WriteString(conn, request+"\r\n"); err != nil {
+		return conn, err
+	}
+	reader := bufio.NewReader(conn)
+	response, err := http.ReadResponse(reader, &http.Request{Method: http.MethodConnect})
+	if err != nil {
+		return conn, errors.New("invalid proxy response : " + err.Error())
+	}
+	response.Body.Close()
+	if response.StatusCode != http.StatusOK {
+		return conn, errors.New("proxy refused the connection : " + response.Status)
+	}
+	if reader.Buffered() > 0 {
+		return &bufferedConn{Conn: conn, reader: reader}, nil
+	}
+	return conn, nil
+}
+
+// bufferedConn - Connection whose first bytes were already read in reader
+type bufferedConn struct {
+	net.Conn
+	reader *bufio.Reader
+}
+
+func (c *bufferedConn) Read(p []byte) (int, error) {
+	return c.reader.Read(p)
+}
+
+// socks5Replies - Messages of the SOCKS5 reply codes, RFC 1928
+var socks5Replies = []string{
+	1: "general failure",
+	2: "connection not allowed by ruleset",
+	3: "network unreachable",
+	4: "host unreachable",
+	5: "connection refused",
+	6: "TTL expired",
+	7: "command not supported",
+	8: "address type not supported",
+}
+
+// socks5Connect - Open a tunnel with the SOCKS5 CONNECT command, with username and password authentication
+// when the proxy URL has credentials. The host name is resolved by the proxy
+func socks5Connect(conn net.Conn, proxyURL *url.URL, address string) error {
+	host, portText, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	port, err := strconv.Atoi(portText)
+	if err != nil || port <= 0 || port > 0xffff {
+		return errors.New("invalid port : " + portText)
+	}
+	methods := []byte{0x00}
+	if proxyURL.User != nil {
+		methods = []byte{0x00, 0x02}
+	}
+	if _, err := conn.Write(append([]byte{0x05, byte(len(methods))}, methods...)); err != nil {
+		return err
+	}
+	reply := make([]byte, 2)
+	if _, err := io.ReadFull(conn, reply); err != nil {
+		return err
+	}
+	if reply[0] != 0x05 {
+		return errors.New("not a socks5 proxy")
+	}
+	switch reply[1] {
+	case 0x00:
+	case 0x02:
+		if proxyURL.User == nil {
+			return errors.New("socks5 proxy asks for credentials")
+		}
+		username := proxyURL.User.Username()
+		password, _ := proxyURL.User.Password()
+		if len(username) > 255 || len(password) > 255 {
+			return errors.New("socks5 credentials too long")
+		}
+		auth := []byte{0x01, byte(len(username))}
+		auth = append(auth, username...)
+		auth = append(auth, byte(len(password)))
+		auth = append(auth, password...)
+		if _, err := conn.Write(auth); err != nil {
+			return err
+		}
+		if _, err := io.ReadFull(conn, reply); err != nil {
+			return err
+		}
+		if reply[1] != 0x00 {
+			return errors.New("socks5 authentication failed")
+		}
+	default:
+		return errors.New("socks5 proxy accepts none of the authentication methods")
+	}
+
+	request := []byte{0x05, 0x01, 0x00}
+	if ip := net.ParseIP(host); ip == nil {
+		if len(host) > 255 {
+			return errors.New("host name too long : " + host)
+		}
+		request = append(request, 0x03, byte(len(host)))
+		request = append(request, host...)
+	} else if ip4 := ip.To4(); ip4 != nil {
+		request = append(request, 0x01)
+		request = append(request, ip4...)
+	} else {
+		request = append(request, 0x04)
+		request = append(request, ip.To16()...)
+	}
+	request = append(request, byte(port>>8), byte(port))
+	if _, err := conn.Write(request); err != nil {
+		return err
+	}
+
+	// Version, reply, reserved, address type, then the bound address and port which are skipped
+	header := make([]byte, 4)
+	if _, err := io.ReadFull(conn, header); err != nil {
+		return err
+	}
+	if header[1] != 0x00 {
+		message := "unknown error"
+		if int(header[1]) < len(socks5Replies) {
+			message = socks5Replies[header[1]]
+		}
+		return errors.New("socks5 proxy refused the connection : " + message)
+	}
+	var skip int
+	switch header[3] {
+	case 0x01:
+		skip = net.IPv4len
+	case 0x04:
+		skip = net.IPv6len
+	case 0x03:
+		length := make([]byte, 1)
+		if _, err := io.ReadFull(conn, length); err != nil {
+			return err
+		}
+		skip = int(length[0])
+	default:
+		return errors.New("invalid socks5 reply")
+	}
+	_, err = io.ReadFull(conn, make([]byte, skip+2))
+	return err
+}
@@ -0,0 +1,77 @@
+/*
+ * Copyright (c) 2021 LuanDNH
+ *
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at https://mozilla.org/MPL/2.0/.
+ *
+ * Contributor(s):
+ * LuanDNH <luandnh98@gmail.com>
+ */
+
+package goesl
+
+import (
+	"errors"
+	"strings"
+)
+
+// DisconnectNotice - text/disconnect-notice sent by freeswitch before it closes the socket,
+// usually when the controlled channel of an outbound connection hangs up
+type DisconnectNotice struct {
+	// Reason - Text of the notice, like "Disconnected, goodbye."
+	Reason string
+	// Linger - The socket stays open to deliver the remaining events of the channel, a second notice follows
+	Linger bool
+	// ChannelUUID - Controlled-Session-UUID, empty on inbound connections
+	ChannelUUID string
+	// Response - The notice as received
+	Response *ESLResponse
+}
+
+// DisconnectHandler - Func called with every disconnect notice received
+type DisconnectHandler func(notice *DisconnectNotice)
+
+func newDisconnectNotice(response *ESLResponse) *DisconnectNotice {
+	return &DisconnectNotice{
+		Reason:      strings.TrimSpace(string(response.Body)),
+		Linger:      strings.EqualFold(response.GetHeader("Content-Disposition"), "linger"),
+		ChannelUUID: response.GetHeader("Controlled-Session-UUID"),
+		Response:    response,
+	}
+}
+
+// OnDisconnectNotice - Set the handler called when a disconnect notice is received, it replaces the previous one
+func (c *ESLConnection) OnDisconnectNotice(handler DisconnectHandler) {
+	c.disconnectLock.Lock()
+	c.disconnectHandler = handler
+	c.disconnectLock.Unlock()
+}
+
+// DisconnectNotice - Last disconnect notice received, nil if there is none.
+// Once freeswitch sent a notice without linger, commands fail right away instead of waiting for a reply
+func (c *ESLConnection) DisconnectNotice() *DisconnectNotice {
+	c.disconnectLock.Lock()
+	defer c.disconnectLock.Unlock()
+	return c.disconnectNotice
+}
+
+// handleDisconnectNotice - Record the notice and call the handler, lingering events keep flowing as usual
+func (c *ESLConnection) handleDisconnectNotice(response *ESLResponse) {
+	notice := newDisconnectNotice(response)
+	c.disconnectLock.Lock()
+	c.disconnectNotice = notice
+	handler := c.disconnectHandler
+	c.disconnectLock.Unlock()
+	if handler != nil {
+		go c.runHandler("disconnect handler", func() { handler(notice) })
+	}
+}
+
+// disconnectedError - Error for a command sent after a final disconnect notice, nil otherwise
+func (c *ESLConnection) disconnectedError() error {
+	if notice := c.DisconnectNotice(); notice != nil && !notice.Linger {
+		return errors.New("connection disconnected : " + notice.Reason)
+	}
+	return nil
+}
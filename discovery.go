@@ -0,0 +1,113 @@
+/*
+ * Copyright (c) 2021 LuanDNH
+ *
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at https://mozilla.org/MPL/2.0/.
+ *
+ * Contributor(s):
+ * LuanDNH <luandnh98@gmail.com>
+ */
+package goesl
+
+import (
+	"context"
+	"errors"
+	"math/rand"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Endpoint - An event socket address found by ResolveEndpoints
+type Endpoint struct {
+	// Address - host:port to dial
+	Address string
+	// Priority and Weight - From the SRV record, lower priorities are preferred. Both are 0 for A records
+	Priority uint16
+	Weight   uint16
+}
+
+// EndpointResolver - DNS lookups used by ResolveEndpoints, *net.Resolver implements it
+type EndpointResolver interface {
+	LookupSRV(ctx context.Context, service, proto, name string) (string, []*net.SRV, error)
+	LookupHost(ctx context.Context, host string) ([]string, error)
+}
+
+// ResolveEndpoints - Resolve name into event socket addresses, with net.DefaultResolver when resolver is nil.
+// A SRV name like _esl._tcp.freeswitch.example.com gives its targets ordered by priority, shuffled by weight
+// within a priority as RFC 2782 asks. A host:port name gives one endpoint per A and AAAA record
+func ResolveEndpoints(ctx context.Context, resolver EndpointResolver, name string) ([]Endpoint, error) {
+	if resolver == nil {
+		resolver = net.DefaultResolver
+	}
+	if strings.HasPrefix(name, "_") {
+		_, records, err := resolver.LookupSRV(ctx, "", "", name)
+		if err != nil {
+			return nil, err
+		}
+		return srvEndpoints(records), nil
+	}
+	host, port, err := net.SplitHostPort(name)
+	if err != nil {
+		return nil, err
+	}
+	addresses, err := resolver.LookupHost(ctx, host)
+	if err != nil {
+		return nil, err
+	}
+	if len(addresses) == 0 {
+		return nil, errors.New("no address found for " + host)
+	}
+	endpoints := make([]Endpoint, 0, len(addresses))
+	for _, address := range addresses {
+		endpoints = append(endpoints, Endpoint{Address: net.JoinHostPort(address, port)})
+	}
+	return endpoints, nil
+}
+
+// srvEndpoints - Order SRV records by priority, then by weighted random selection within a priority
+func srvEndpoints(records []*net.SRV) []Endpoint {
+	sorted := make([]*net.SRV, len(records))
+	copy(sorted, records)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return sorted[i].Priority < sorted[j].Priority
+	})
+	endpoints := make([]Endpoint, 0, len(sorted))
+	for start := 0; start < len(sorted); {
+		end := start
+		for end < len(sorted) && sorted[end].Priority == sorted[start].Priority {
+			end++
+		}
+		group := sorted[start:end]
+		for len(group) > 0 {
+			i := pickWeighted(group)
+			record := group[i]
+			endpoints = append(endpoints, Endpoint{
+				Address:  net.JoinHostPort(strings.TrimSuffix(record.Target, "."), strconv.Itoa(int(record.Port))),
+				Priority: record.Priority,
+				Weight:   record.Weight,
+			})
+			group = append(group[:i:i], group[i+1:]...)
+		}
+		start = end
+	}
+	return endpoints
+}
+
+// pickWeighted - Index of a record picked with a probability proportional to its weight, records of weight 0
+// have a small chance to be picked first
+func pickWeighted(records []*net.SRV) int {
+	total := 0
+	for _, record := range records {
+		total += int(record.Weight) + 1
+	}
+	n := rand.Intn(total)
+	for i, record := range records {
+		if n -= int(record.Weight) + 1; n < 0 {
+			return i
+		}
+	}
+	return len(records) - 1
+}
@@ -0,0 +1,129 @@
+/*
+ * Copyright (c) 2021 LuanDNH
+ *
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at https://mozilla.org/MPL/2.0/.
+ *
+ * Contributor(s):
+ * LuanDNH <luandnh98@gmail.com>
+ */
+package goesl
+
+import (
+	"hash/fnv"
+	"sync"
+	"sync/atomic"
+)
+
+// DefaultDispatchQueueSize - Events queued per worker of an OrderedDispatcher before the read loop waits
+const DefaultDispatchQueueSize = 64
+
+// OrderedDispatcher - Worker pool handling events in parallel across channels, while the events of a
+// same Unique-ID are handled one at a time in the order received. See DispatchOrdered
+type OrderedDispatcher struct {
+	// handled - Events handled by the workers, first for atomic access
+	handled    uint64
+	connection *ESLConnection
+	handler    EventListener
+	queues     []chan *Event
+	next       uint32
+	wg         sync.WaitGroup
+	stopOnce   sync.Once
+	// lock - Held for reading while an event is enqueued, Stop takes it before closing the queues
+	lock    sync.RWMutex
+	stopped bool
+}
+
+// DispatchOrdered - Start a pool of workers calling handler with every event. Events of a channel always go
+// to the same worker, so its CHANNEL_CREATE, CHANNEL_ANSWER and CHANNEL_HANGUP are never reordered.
+// Events without Unique-ID are spread over the workers. When queueSize events are waiting for a worker
+// the read loop waits, DefaultDispatchQueueSize is used when queueSize is 0
+func (c *ESLConnection) DispatchOrdered(workers, queueSize int, handler EventListener) *OrderedDispatcher {
+	if workers <= 0 {
+		workers = 1
+	}
+	if queueSize <= 0 {
+		queueSize = DefaultDispatchQueueSize
+	}
+	d := &OrderedDispatcher{
+		connection: c,
+		handler:    handler,
+		queues:     make([]chan *Event, workers),
+	}
+	for i := range d.queues {
+		d.queues[i] = make(chan *Event, queueSize)
+		d.wg.Add(1)
+		go d.work(d.queues[i])
+	}
+	c.eventListenerLock.Lock()
+	c.dispatchers[d] = struct{}{}
+	c.eventListenerLock.Unlock()
+	return d
+}
+
+// Stop - Stop receiving events and wait until the queued ones are handled, it must not be called from the handler
+func (d *OrderedDispatcher) Stop() {
+	d.stopOnce.Do(func() {
+		d.connection.eventListenerLock.Lock()
+		delete(d.connection.dispatchers, d)
+		d.connection.eventListenerLock.Unlock()
+		// The read loop may still be enqueuing an event taken before the removal
+		d.lock.Lock()
+		d.stopped = true
+		for _, queue := range d.queues {
+			close(queue)
+		}
+		d.lock.Unlock()
+	})
+	d.wg.Wait()
+}
+
+func (d *OrderedDispatcher) work(queue chan *Event) {
+	defer d.wg.Done()
+	for event := range queue {
+		d.connection.callListener(d.handler, event)
+		atomic.AddUint64(&d.handled, 1)
+	}
+}
+
+// DispatcherStats - Snapshot of the state of an OrderedDispatcher
+type DispatcherStats struct {
+	Workers int
+	// Queued - Events waiting for a worker, Handled - Events handled since the dispatcher started
+	Queued  int
+	Handled uint64
+}
+
+// Stats - Current state of the dispatcher
+func (d *OrderedDispatcher) Stats() DispatcherStats {
+	stats := DispatcherStats{Workers: len(d.queues), Handled: atomic.LoadUint64(&d.handled)}
+	for _, queue := range d.queues {
+		stats.Queued += len(queue)
+	}
+	return stats
+}
+
+// dispatch - Queue an event to its worker, called from the read loop. The listener lock must not be held,
+// a handler registering a listener while the read loop waits for room would deadlock
+func (d *OrderedDispatcher) dispatch(event *Event) {
+	var worker uint32
+	if uuid := event.GetHeader("Unique-ID"); uuid != "" {
+		hash := fnv.New32a()
+		_, _ = hash.Write([]byte(uuid))
+		worker = hash.Sum32()
+	} else {
+		worker = atomic.AddUint32(&d.next, 1)
+	}
+	d.lock.RLock()
+	defer d.lock.RUnlock()
+	if d.stopped {
+		return
+	}
+	event.retain()
+	select {
+	case d.queues[worker%uint32(len(d.queues))] <- event:
+	case <-d.connection.done:
+		event.Release()
+	}
+}
@@ -0,0 +1,86 @@
+/*
+ * Copyright (c) 2021 LuanDNH
+ *
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at https://mozilla.org/MPL/2.0/.
+ *
+ * Contributor(s):
+ * LuanDNH <luandnh98@gmail.com>
+ */
+
+package goesl
+
+import (
+	"context"
+	"errors"
+)
+
+// EavesdropMode - DTMF understood by eavesdrop when eavesdrop_enable_dtmf is set
+type EavesdropMode string
+
+const (
+	// EavesdropListen - Listen only, nobody hears the supervisor
+	EavesdropListen EavesdropMode = "0"
+	// EavesdropWhisperA - Talk to the eavesdropped leg only
+	EavesdropWhisperA EavesdropMode = "1"
+	// EavesdropWhisperB - Talk to the other leg only
+	EavesdropWhisperB EavesdropMode = "2"
+	// EavesdropThreeWay - Talk to both legs
+	EavesdropThreeWay EavesdropMode = "3"
+	// EavesdropNext - Move to the next channel when eavesdropping on all
+	EavesdropNext EavesdropMode = "*"
+)
+
+// EavesdropOptions - Supervisor leg of an eavesdrop
+type EavesdropOptions struct {
+	// Endpoint - Supervisor endpoint, like user/1000
+	Endpoint string
+	// Variables - Extra channel variables of the supervisor leg
+	Variables map[string]string
+	// DisableDTMF - Prevent the supervisor from switching modes with DTMF
+	DisableDTMF bool
+	// Whisper - Start by talking to the eavesdropped leg
+	Whisper bool
+}
+
+// Eavesdrop - Call the supervisor and eavesdrop on uuid, the supervisor leg uuid is returned
+func (c *ESLConnection) Eavesdrop(ctx context.Context, uuid string, opts EavesdropOptions) (string, error) {
+	if uuid == "" || opts.Endpoint == "" {
+		return "", errors.New("eavesdrop needs a uuid and an endpoint")
+	}
+	return c.Originate(ctx, opts.Endpoint, spyVariables(opts), "&eavesdrop("+uuid+")")
+}
+
+// UserSpy - Call the supervisor and spy on every call of user@domain
+func (c *ESLConnection) UserSpy(ctx context.Context, user string, opts EavesdropOptions) (string, error) {
+	if user == "" || opts.Endpoint == "" {
+		return "", errors.New("userspy needs a user and an endpoint")
+	}
+	return c.Originate(ctx, opts.Endpoint, spyVariables(opts), "&userspy("+user+")")
+}
+
+// SetEavesdropMode - Switch the eavesdrop mode of the supervisor leg by injecting the DTMF it would press
+func (c *ESLConnection) SetEavesdropMode(supervisorUUID string, mode EavesdropMode) error {
+	_, err := c.Api("uuid_recv_dtmf " + supervisorUUID + " " + string(mode))
+	return err
+}
+
+// EscalateThreeWay - Let the supervisor leg talk to both legs
+func (c *ESLConnection) EscalateThreeWay(supervisorUUID string) error {
+	return c.SetEavesdropMode(supervisorUUID, EavesdropThreeWay)
+}
+
+func spyVariables(opts EavesdropOptions) map[string]string {
+	vars := make(map[string]string, len(opts.Variables)+2)
+	for k, v := range opts.Variables {
+		vars[k] = v
+	}
+	if !opts.DisableDTMF {
+		vars["eavesdrop_enable_dtmf"] = "true"
+	}
+	if opts.Whisper {
+		vars["eavesdrop_whisper_aleg"] = "true"
+	}
+	return vars
+}
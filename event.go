@@ -0,0 +1,204 @@
+/*
+ * Copyright (c) 2021 LuanDNH
+ *
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at https://mozilla.org/MPL/2.0/.
+ *
+ * Contributor(s):
+ * LuanDNH <luandnh98@gmail.com>
+ */
+
+package goesl
+
+import (
+	"context"
+	"strconv"
+	"strings"
+	"sync/atomic"
+)
+
+// EventListenAll - Channel UUID used to register a listener which receives every event
+const EventListenAll = "ALL"
+
+const variablePrefix = "variable_"
+
+// Event - Event received from freeswitch, it shares the representation of any other ESL message
+type Event = ESLResponse
+
+// EventListener - Func called with every event dispatched to a listener, concurrently and in no particular
+// order when registered with RegisterEventListener
+type EventListener func(event *Event)
+
+var listenerCounter uint64
+
+// IsEvent - Check if the message is an event (text/event-plain, text/event-json or text/event-xml)
+func (r *ESLResponse) IsEvent() bool {
+	return strings.HasPrefix(r.ContentType, "text/event-")
+}
+
+// Variables - Channel variables carried by the event, the variable_ headers without their prefix
+func (r *ESLResponse) Variables() map[string]string {
+	variables := make(map[string]string)
+	for _, f := range r.Headers.fields {
+		if len(f.Name) <= len(variablePrefix) || !strings.EqualFold(f.Name[:len(variablePrefix)], variablePrefix) {
+			continue
+		}
+		name := f.Name[len(variablePrefix):]
+		if _, ok := variables[name]; !ok {
+			variables[name] = r.GetHeader(f.Name)
+		}
+	}
+	return variables
+}
+
+// Variable - Value of a single channel variable carried by the event, empty if not present
+func (r *ESLResponse) Variable(name string) string {
+	return r.GetHeader(variablePrefix + name)
+}
+
+// RegisterEventListener - Register a listener for events of a channel UUID, or EventListenAll for every event.
+// The returned id is used to remove the listener. Each event is handed to the listener in its own goroutine so
+// the listener may see events out of order, like a CHANNEL_HANGUP before its CHANNEL_CREATE. Use DispatchOrdered
+// when the order of the events matters
+func (c *ESLConnection) RegisterEventListener(channelUUID string, listener EventListener) string {
+	c.eventListenerLock.Lock()
+	defer c.eventListenerLock.Unlock()
+
+	id := strconv.FormatUint(atomic.AddUint64(&listenerCounter, 1), 10)
+	if _, ok := c.eventListeners[channelUUID]; !ok {
+		c.eventListeners[channelUUID] = make(map[string]EventListener)
+	}
+	c.eventListeners[channelUUID][id] = listener
+	return id
+}
+
+// RemoveEventListener - Remove a listener previously registered with RegisterEventListener
+func (c *ESLConnection) RemoveEventListener(channelUUID string, id string) {
+	c.eventListenerLock.Lock()
+	defer c.eventListenerLock.Unlock()
+
+	if listeners, ok := c.eventListeners[channelUUID]; ok {
+		delete(listeners, id)
+		if len(listeners) == 0 {
+			delete(c.eventListeners, channelUUID)
+		}
+	}
+}
+
+// WaitFor - Block until an event matching the predicate arrives, the context is done or the connection is closed.
+// Other listeners and ReadMessage still receive the event as usual
+func (c *ESLConnection) WaitFor(ctx context.Context, predicate func(*Event) bool) (*Event, error) {
+	waiter := c.newEventWaiter(EventListenAll, predicate)
+	defer waiter.Close()
+	return waiter.Wait(ctx)
+}
+
+// WaitForEvent - Same as WaitFor. To wait for the event resulting from a command, use ExpectEvent
+// before sending it so the event can't arrive before the wait starts
+func (c *ESLConnection) WaitForEvent(ctx context.Context, predicate func(*Event) bool) (*Event, error) {
+	return c.WaitFor(ctx, predicate)
+}
+
+// PendingEvent - Event expected with ExpectEvent
+type PendingEvent struct {
+	waiter *eventWaiter
+}
+
+// ExpectEvent - Start listening for the first event matching predicate, to be waited for with Wait.
+// Events arriving between ExpectEvent and Wait are not missed. Cancel must be called once done
+func (c *ESLConnection) ExpectEvent(predicate func(*Event) bool) *PendingEvent {
+	return &PendingEvent{waiter: c.newEventWaiter(EventListenAll, predicate)}
+}
+
+// Wait - Block until the event arrives, the context is done or the connection is closed. The caller owns the event
+func (p *PendingEvent) Wait(ctx context.Context) (*Event, error) {
+	return p.waiter.Wait(ctx)
+}
+
+// Cancel - Stop listening, an event matched but not waited for is released
+func (p *PendingEvent) Cancel() {
+	p.waiter.Close()
+	select {
+	case event := <-p.waiter.found:
+		event.Release()
+	default:
+	}
+}
+
+// eventWaiter - Listener registered before a command is sent, so its resulting event can't be missed
+type eventWaiter struct {
+	connection  *ESLConnection
+	channelUUID string
+	id          string
+	found       chan *Event
+}
+
+func (c *ESLConnection) newEventWaiter(channelUUID string, predicate func(*Event) bool) *eventWaiter {
+	waiter := &eventWaiter{connection: c, channelUUID: channelUUID, found: make(chan *Event, 1)}
+	waiter.id = c.RegisterEventListener(channelUUID, func(event *Event) {
+		if !predicate(event) {
+			return
+		}
+		// The caller of Wait owns the event
+		event.retain()
+		select {
+		case waiter.found <- event:
+		default:
+			event.Release()
+		}
+	})
+	return waiter
+}
+
+func (w *eventWaiter) Wait(ctx context.Context) (*Event, error) {
+	select {
+	case event := <-w.found:
+		return event, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case <-w.connection.done:
+		return nil, w.connection.closeErr
+	}
+}
+
+func (w *eventWaiter) Close() {
+	w.connection.RemoveEventListener(w.channelUUID, w.id)
+}
+
+// callEventListener - Hand event to the listeners and dispatchers. They are copied under the lock which is
+// released before dispatching, a dispatcher may block while its handlers register or remove listeners
+func (c *ESLConnection) callEventListener(event *Event) {
+	uuid := event.GetHeader("Unique-ID")
+	c.eventListenerLock.RLock()
+	listeners := make([]EventListener, 0, len(c.eventListeners[EventListenAll])+len(c.eventListeners[uuid]))
+	for _, listener := range c.eventListeners[EventListenAll] {
+		listeners = append(listeners, listener)
+	}
+	if uuid != "" {
+		for _, listener := range c.eventListeners[uuid] {
+			listeners = append(listeners, listener)
+		}
+	}
+	var dispatchers []*OrderedDispatcher
+	for dispatcher := range c.dispatchers {
+		dispatchers = append(dispatchers, dispatcher)
+	}
+	c.eventListenerLock.RUnlock()
+
+	for _, listener := range listeners {
+		event.retain()
+		go c.callListener(listener, event)
+	}
+	for _, dispatcher := range dispatchers {
+		dispatcher.dispatch(event)
+	}
+}
+
+// callListener - Call a listener, a panic ends the listener call only. The reference taken for the listener
+// is released once it returns
+func (c *ESLConnection) callListener(listener EventListener, event *Event) {
+	defer event.Release()
+	defer c.recoverPanic("event listener", nil)
+	listener(event)
+}
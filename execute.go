@@ -0,0 +1,161 @@
+/*
+ * Copyright (c) 2021 LuanDNH
+ *
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at https://mozilla.org/MPL/2.0/.
+ *
+ * Contributor(s):
+ * LuanDNH <luandnh98@gmail.com>
+ */
+
+package goesl
+
+import (
+	"context"
+	"strconv"
+	"sync"
+)
+
+// ExecuteOptions - Options of an execute sendmsg
+type ExecuteOptions struct {
+	// Loops - Number of times the application runs, 0 and 1 both run it once
+	Loops int
+	// EventLock - Run the application before processing the next message for the channel
+	EventLock bool
+	// Async - Queue the application without blocking the socket, for a socket application not started async
+	Async bool
+}
+
+// SendMsg - Send a sendmsg for uuid with headers and an optional body.
+// uuid may be empty on an outbound connection to target its own channel
+func (c *ESLConnection) SendMsg(uuid string, headers []string, body string) (*ESLResponse, error) {
+	return c.SendMsgWithContext(context.Background(), uuid, headers, body)
+}
+
+// SendMsgWithContext - Same as SendMsg but give up waiting for the reply when ctx is done
+func (c *ESLConnection) SendMsgWithContext(ctx context.Context, uuid string, headers []string, body string) (*ESLResponse, error) {
+	cmd := "sendmsg"
+	if uuid != "" {
+		cmd += " " + uuid
+	}
+	frame, err := buildFrame(cmd, headers, body)
+	if err != nil {
+		return nil, err
+	}
+	return c.sendFrame(ctx, frame)
+}
+
+// Execute - Queue an application on uuid without waiting for it to complete
+func (c *ESLConnection) Execute(uuid, app, arg string, opts *ExecuteOptions) (*ESLResponse, error) {
+	return c.SendMsg(uuid, executeHeaders(app, "", opts), arg)
+}
+
+// ExecuteAndWait - Execute an application on uuid and wait for its CHANNEL_EXECUTE_COMPLETE event.
+// On an inbound connection CHANNEL_EXECUTE_COMPLETE is subscribed while waiting, an outbound connection must use myevents
+func (c *ESLConnection) ExecuteAndWait(ctx context.Context, uuid, app, arg string, opts *ExecuteOptions) (*Event, error) {
+	pending, err := c.ExecuteAsync(ctx, uuid, app, arg, opts)
+	if err != nil {
+		return nil, err
+	}
+	return pending.Wait(ctx)
+}
+
+// PendingExecution - Application queued by ExecuteAsync, waiting for its CHANNEL_EXECUTE_COMPLETE event
+type PendingExecution struct {
+	// AppUUID - Event-UUID sent with the application, the Application-UUID of its events
+	AppUUID string
+
+	connection  *ESLConnection
+	waiter      *eventWaiter
+	unsubscribe bool
+	closeOnce   sync.Once
+}
+
+// ExecuteAsync - Queue an application on uuid and return once freeswitch accepted it, its completion is
+// matched by Event-UUID so several applications may be queued and waited for in any order. Wait or Cancel
+// must be called. ctx only bounds the wait for the reply.
+// On an inbound connection CHANNEL_EXECUTE_COMPLETE is subscribed until then, an outbound connection must use myevents
+func (c *ESLConnection) ExecuteAsync(ctx context.Context, uuid, app, arg string, opts *ExecuteOptions) (*PendingExecution, error) {
+	pending := &PendingExecution{AppUUID: newUUID(), connection: c}
+	if !c.outbound {
+		if err := c.subscribeInternal(EventChannelExecuteComplete); err != nil {
+			return nil, err
+		}
+		pending.unsubscribe = true
+	}
+	listenUUID := uuid
+	if listenUUID == "" {
+		listenUUID = EventListenAll
+	}
+	pending.waiter = c.newEventWaiter(listenUUID, func(event *Event) bool {
+		return event.GetHeader("Event-Name") == EventChannelExecuteComplete &&
+			event.GetHeader("Application-UUID") == pending.AppUUID
+	})
+	if _, err := c.SendMsgWithContext(ctx, uuid, executeHeaders(app, pending.AppUUID, opts), arg); err != nil {
+		pending.close()
+		return nil, err
+	}
+	return pending, nil
+}
+
+// Wait - Block until the application completed and return its CHANNEL_EXECUTE_COMPLETE event,
+// the caller owns the event. The execution is released either way
+func (p *PendingExecution) Wait(ctx context.Context) (*Event, error) {
+	defer p.close()
+	return p.waiter.Wait(ctx)
+}
+
+// Cancel - Stop waiting for the completion, the application itself keeps running
+func (p *PendingExecution) Cancel() {
+	p.close()
+	select {
+	case event := <-p.waiter.found:
+		event.Release()
+	default:
+	}
+}
+
+func (p *PendingExecution) close() {
+	p.closeOnce.Do(func() {
+		p.waiter.Close()
+		if p.unsubscribe {
+			_ = p.connection.Unsubscribe(EventChannelExecuteComplete)
+		}
+	})
+}
+
+// subscribeInternal - Subscribe on behalf of a helper, keeping the format already in use
+func (c *ESLConnection) subscribeInternal(events ...string) error {
+	c.subscriptionLock.Lock()
+	format := c.subscriptionFormat
+	c.subscriptionLock.Unlock()
+	if format == "" {
+		format = EventFormatJSON
+	}
+	return c.Subscribe(format, events...)
+}
+
+// executeHeaders - Headers of an execute sendmsg, the argument is sent as body so it can be of any length
+func executeHeaders(app, appUUID string, opts *ExecuteOptions) []string {
+	headers := []string{
+		"call-command: execute",
+		"execute-app-name: " + app,
+	}
+	if appUUID != "" {
+		headers = append(headers, "Event-UUID: "+appUUID)
+	}
+	if opts != nil {
+		if opts.Loops > 1 {
+			headers = append(headers, "loops: "+strconv.Itoa(opts.Loops))
+		}
+		if opts.EventLock {
+			headers = append(headers, "event-lock: true")
+		}
+		if opts.Async {
+			headers = append(headers, "async: true")
+		}
+	}
+	headers = append(headers, "content-type: text/plain")
+	return headers
+}
@@ -0,0 +1,54 @@
+/*
+ * Copyright (c) 2021 LuanDNH
+ *
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at https://mozilla.org/MPL/2.0/.
+ *
+ * Contributor(s):
+ * LuanDNH <luandnh98@gmail.com>
+ */
+
+package goesl
+
+import "strings"
+
+var variableReplacer = strings.NewReplacer(`\`, `\\`, "$", `\$`)
+
+// EscapeVariables - Escape $ and backslashes so ${var} and $${var} are taken literally by variable expansion,
+// which removes one level of backslash escaping
+func EscapeVariables(s string) string {
+	return variableReplacer.Replace(s)
+}
+
+// Command - Build an api command line where every argument is quoted with QuoteArgument.
+// Arguments are not escaped for expansion, use SafeCommand to build a command given to Expand
+func Command(name string, args ...string) string {
+	parts := make([]string, 0, len(args)+1)
+	parts = append(parts, name)
+	for _, arg := range args {
+		parts = append(parts, QuoteArgument(arg))
+	}
+	return strings.Join(parts, " ")
+}
+
+// SafeCommand - Same as Command for use with Expand, quoted arguments are escaped with EscapeVariables
+// so they reach the command unchanged and only variables written in name are expanded
+func SafeCommand(name string, args ...string) string {
+	parts := make([]string, 0, len(args)+1)
+	parts = append(parts, name)
+	for _, arg := range args {
+		parts = append(parts, EscapeVariables(QuoteArgument(arg)))
+	}
+	return strings.Join(parts, " ")
+}
+
+// Expand - Run api expand, variables in cmd are expanded against globals before the command runs
+func (c *ESLConnection) Expand(cmd string) (*ESLResponse, error) {
+	return c.Api("expand " + lineBreakReplacer.Replace(cmd))
+}
+
+// ExpandOnChannel - Same as Expand but variables are expanded against the channel uuid
+func (c *ESLConnection) ExpandOnChannel(uuid, cmd string) (*ESLResponse, error) {
+	return c.Api("expand uuid:" + uuid + " " + lineBreakReplacer.Replace(cmd))
+}
@@ -0,0 +1,80 @@
+/*
+ * Copyright (c) 2021 LuanDNH
+ *
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at https://mozilla.org/MPL/2.0/.
+ *
+ * Contributor(s):
+ * LuanDNH <luandnh98@gmail.com>
+ */
+
+package goesl
+
+import (
+	"errors"
+	"expvar"
+	"strconv"
+	"sync"
+	"sync/atomic"
+)
+
+var (
+	// expvarLock - Serializes the creation of the published maps, expvar.Publish panics on a name taken twice
+	expvarLock sync.Mutex
+	// expvarCounter - Key of the next connection published
+	expvarCounter uint64
+)
+
+// ExpvarConnection - Value published for a connection by PublishExpvar
+type ExpvarConnection struct {
+	LocalAddress  string
+	RemoteAddress string
+	Outbound      bool
+	Stats         ConnectionStats
+	Dispatchers   []DispatcherStats
+}
+
+// PublishExpvar - Publish the Stats of the connection and of its dispatchers with expvar, as an entry of the
+// map named prefix, so they show in /debug/vars. Connections sharing the prefix get their own key,
+// the entry is removed once the connection is closed. See Options.ExpvarPrefix
+func (c *ESLConnection) PublishExpvar(prefix string) error {
+	expvarLock.Lock()
+	published, ok := expvar.Get(prefix).(*expvar.Map)
+	if !ok {
+		if expvar.Get(prefix) != nil {
+			expvarLock.Unlock()
+			return errors.New("expvar " + prefix + " is already published and is not a map")
+		}
+		published = expvar.NewMap(prefix)
+	}
+	expvarLock.Unlock()
+
+	key := strconv.FormatUint(atomic.AddUint64(&expvarCounter, 1), 10)
+	published.Set(key, expvar.Func(func() interface{} { return c.expvarValue() }))
+	go func() {
+		<-c.done
+		published.Delete(key)
+	}()
+	return nil
+}
+
+// expvarValue - Current value of the connection published by PublishExpvar
+func (c *ESLConnection) expvarValue() ExpvarConnection {
+	value := ExpvarConnection{
+		LocalAddress:  c.conn.LocalAddr().String(),
+		RemoteAddress: c.conn.RemoteAddr().String(),
+		Outbound:      c.outbound,
+		Stats:         c.Stats(),
+	}
+	c.eventListenerLock.RLock()
+	dispatchers := make([]*OrderedDispatcher, 0, len(c.dispatchers))
+	for dispatcher := range c.dispatchers {
+		dispatchers = append(dispatchers, dispatcher)
+	}
+	c.eventListenerLock.RUnlock()
+	for _, dispatcher := range dispatchers {
+		value.Dispatchers = append(value.Dispatchers, dispatcher.Stats())
+	}
+	return value
+}
@@ -0,0 +1,189 @@
+/*
+ * Copyright (c) 2021 LuanDNH
+ *
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at https://mozilla.org/MPL/2.0/.
+ *
+ * Contributor(s):
+ * LuanDNH <luandnh98@gmail.com>
+ */
+
+package goesl
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+)
+
+// FifoQueue - A fifo as reported by fifo list
+type FifoQueue struct {
+	Name             string
+	ConsumerCount    int
+	CallerCount      int
+	WaitingCount     int
+	Importance       int
+	OutboundStrategy string
+	Callers          []FifoChannel
+	Consumers        []FifoChannel
+	Members          []FifoMember
+}
+
+// FifoChannel - A caller waiting in, or a consumer serving, a fifo
+type FifoChannel struct {
+	UUID      string
+	Status    string
+	Timestamp string
+}
+
+// FifoMember - An outbound member (agent) of a fifo
+type FifoMember struct {
+	Dialstring string
+	Simo       int
+	UseCount   int
+	Timeout    int
+	Lag        int
+}
+
+// FifoCount - A line of fifo count
+type FifoCount struct {
+	Name              string
+	ConsumerCount     int
+	CallerCount       int
+	MemberCount       int
+	RingConsumerCount int
+	IdleConsumerCount int
+}
+
+type fifoChannelXML struct {
+	UUID      string `xml:"uuid,attr"`
+	Status    string `xml:"status,attr"`
+	Timestamp string `xml:"timestamp,attr"`
+}
+
+type fifoReportXML struct {
+	Fifos []struct {
+		Name             string           `xml:"name,attr"`
+		ConsumerCount    string           `xml:"consumer_count,attr"`
+		CallerCount      string           `xml:"caller_count,attr"`
+		WaitingCount     string           `xml:"waiting_count,attr"`
+		Importance       string           `xml:"importance,attr"`
+		OutboundStrategy string           `xml:"outbound_strategy,attr"`
+		Callers          []fifoChannelXML `xml:"callers>caller"`
+		Consumers        []fifoChannelXML `xml:"consumers>consumer"`
+		Members          []struct {
+			Simo       string `xml:"simo,attr"`
+			UseCount   string `xml:"use_count,attr"`
+			Timeout    string `xml:"timeout,attr"`
+			Lag        string `xml:"lag,attr"`
+			Dialstring string `xml:",chardata"`
+		} `xml:"outbound>member"`
+	} `xml:"fifo"`
+}
+
+// FifoList - Run fifo list for a fifo, every fifo when empty
+func (c *ESLConnection) FifoList(name string) ([]FifoQueue, error) {
+	cmd := "fifo list"
+	if name != "" {
+		cmd += " " + name
+	}
+	response, err := c.Api(cmd)
+	if err != nil {
+		return nil, err
+	}
+	body := strings.TrimSpace(string(response.Body))
+	if !strings.HasPrefix(body, "<") {
+		return nil, errors.New("unexpected fifo list reply : " + body)
+	}
+	var decoded fifoReportXML
+	if err := unmarshalXML([]byte(body), &decoded); err != nil {
+		return nil, err
+	}
+	queues := make([]FifoQueue, 0, len(decoded.Fifos))
+	for _, f := range decoded.Fifos {
+		queue := FifoQueue{
+			Name:             f.Name,
+			ConsumerCount:    atoi(f.ConsumerCount),
+			CallerCount:      atoi(f.CallerCount),
+			WaitingCount:     atoi(f.WaitingCount),
+			Importance:       atoi(f.Importance),
+			OutboundStrategy: f.OutboundStrategy,
+			Callers:          newFifoChannels(f.Callers),
+			Consumers:        newFifoChannels(f.Consumers),
+		}
+		for _, m := range f.Members {
+			queue.Members = append(queue.Members, FifoMember{
+				Dialstring: strings.TrimSpace(m.Dialstring),
+				Simo:       atoi(m.Simo),
+				UseCount:   atoi(m.UseCount),
+				Timeout:    atoi(m.Timeout),
+				Lag:        atoi(m.Lag),
+			})
+		}
+		queues = append(queues, queue)
+	}
+	return queues, nil
+}
+
+// FifoCount - Run fifo count for a fifo, every fifo when empty
+func (c *ESLConnection) FifoCount(name string) ([]FifoCount, error) {
+	cmd := "fifo count"
+	if name != "" {
+		cmd += " " + name
+	}
+	response, err := c.Api(cmd)
+	if err != nil {
+		return nil, err
+	}
+	var counts []FifoCount
+	for _, line := range strings.Split(string(response.Body), "\n") {
+		// The fifo name may contain : so the counters are taken from the end
+		fields := strings.Split(strings.TrimSpace(line), ":")
+		if len(fields) < 6 {
+			continue
+		}
+		n := len(fields)
+		counts = append(counts, FifoCount{
+			Name:              strings.Join(fields[:n-5], ":"),
+			ConsumerCount:     atoi(fields[n-5]),
+			CallerCount:       atoi(fields[n-4]),
+			MemberCount:       atoi(fields[n-3]),
+			RingConsumerCount: atoi(fields[n-2]),
+			IdleConsumerCount: atoi(fields[n-1]),
+		})
+	}
+	return counts, nil
+}
+
+// FifoAddCaller - Put uuid in the fifo as a caller waiting for a consumer
+func (c *ESLConnection) FifoAddCaller(uuid, name string) error {
+	_, err := c.Execute(uuid, "fifo", name+" in", nil)
+	return err
+}
+
+// FifoRemoveCaller - Take uuid out of its fifo by transferring it to extension in dialplan and context
+func (c *ESLConnection) FifoRemoveCaller(uuid, extension, dialplan, dialplanContext string) error {
+	_, err := c.Api(transferCommand(uuid, extension, dialplan, dialplanContext))
+	return err
+}
+
+// FifoAddMember - Add an outbound member (agent) reached with dialstring, simo is the number of simultaneous calls
+func (c *ESLConnection) FifoAddMember(name, dialstring string, simo, timeout, lag int) error {
+	_, err := c.Api(Command("fifo_member", "add", name, dialstring, strconv.Itoa(simo), strconv.Itoa(timeout), strconv.Itoa(lag)))
+	return err
+}
+
+// FifoRemoveMember - Remove an outbound member from the fifo
+func (c *ESLConnection) FifoRemoveMember(name, dialstring string) error {
+	_, err := c.Api(Command("fifo_member", "del", name, dialstring))
+	return err
+}
+
+func newFifoChannels(channels []fifoChannelXML) []FifoChannel {
+	var result []FifoChannel
+	for _, ch := range channels {
+		result = append(result, FifoChannel{UUID: ch.UUID, Status: ch.Status, Timestamp: ch.Timestamp})
+	}
+	return result
+}
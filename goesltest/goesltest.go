@@ -0,0 +1,223 @@
+/*
+ * Copyright (c) 2021 LuanDNH
+ *
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at https://mozilla.org/MPL/2.0/.
+ *
+ * Contributor(s):
+ * LuanDNH <luandnh98@gmail.com>
+ */
+// Package goesltest - In memory freeswitch for tests, like net/http/httptest. A connection is wired to a scripted
+// Server over net.Pipe, the test then expects the commands of the code under test and answers them with
+// replies and events, without sockets nor a real freeswitch
+package goesltest
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/luandnh/goesl"
+)
+
+// Password - Password expected by NewInbound
+const Password = "ClueCon"
+
+// DefaultTimeout - Longest wait of a Server for a command, or for the connection to read what it writes
+const DefaultTimeout = 5 * time.Second
+
+// Server - Freeswitch side of a net.Pipe. Failures are reported to the test with Errorf, the connection going
+// away is not one. Its methods can be called from any goroutine but not concurrently
+type Server struct {
+	// Timeout - Longest wait for a command or a write, DefaultTimeout when 0
+	Timeout time.Duration
+
+	t      testing.TB
+	conn   net.Conn
+	reader *bufio.Reader
+}
+
+// Command - Frame sent by the connection
+type Command struct {
+	// Line - First line, like "api status" or "sendmsg <uuid>"
+	Line string
+	// Headers - Following lines, "Name: value", Content-Length included
+	Headers []string
+	Body    string
+}
+
+// Header - Value of the header name, empty when missing
+func (c *Command) Header(name string) string {
+	for _, header := range c.Headers {
+		if i := strings.Index(header, ":"); i > 0 && strings.EqualFold(header[:i], name) {
+			return strings.TrimSpace(header[i+1:])
+		}
+	}
+	return ""
+}
+
+// NewServer - Server on the server end of a net.Pipe, closed when the test ends
+func NewServer(t testing.TB, server net.Conn) *Server {
+	t.Cleanup(func() { server.Close() })
+	return &Server{t: t, conn: server, reader: bufio.NewReader(server)}
+}
+
+// NewInbound - Inbound connection made with opts and authenticated with Password against a Server
+func NewInbound(t testing.TB, opts goesl.Options) (*goesl.ESLConnection, *Server) {
+	t.Helper()
+	client, server := net.Pipe()
+	s := NewServer(t, server)
+	opts.Role = goesl.RoleInbound
+	con := goesl.NewConnectionFromConn(client, opts)
+	t.Cleanup(func() { con.Close() })
+	authenticated := make(chan error, 1)
+	go func() {
+		authenticated <- con.Authenticate(context.Background(), Password)
+	}()
+	s.Write("Content-Type: auth/request\n\n")
+	s.ExpectCommand("auth " + Password)
+	s.Reply("+OK accepted")
+	if err := <-authenticated; err != nil {
+		t.Fatalf("goesltest: authentication failed : %v", err)
+	}
+	return con, s
+}
+
+// NewOutbound - Outbound connection made with opts, as served by the socket application. Its first command is
+// usually connect, answered with ConnectReply
+func NewOutbound(t testing.TB, opts goesl.Options) (*goesl.ESLConnection, *Server) {
+	client, server := net.Pipe()
+	s := NewServer(t, server)
+	opts.Role = goesl.RoleOutbound
+	con := goesl.NewConnectionFromConn(client, opts)
+	t.Cleanup(func() { con.Close() })
+	return con, s
+}
+
+func (s *Server) timeout() time.Duration {
+	if s.Timeout > 0 {
+		return s.Timeout
+	}
+	return DefaultTimeout
+}
+
+// ReadCommand - Next frame sent by the connection, nil once the pipe is closed or after Timeout. Only the timeout
+// fails the test, a goroutine can serve commands until the connection goes away
+func (s *Server) ReadCommand() *Command {
+	s.t.Helper()
+	_ = s.conn.SetReadDeadline(time.Now().Add(s.timeout()))
+	command := &Command{}
+	for {
+		line, err := s.reader.ReadString('\n')
+		if err != nil {
+			if !closed(err) || command.Line != "" {
+				s.t.Errorf("goesltest: no command received : %v", err)
+			}
+			return nil
+		}
+		line = strings.TrimRight(line, "\r\n")
+		if line == "" {
+			if command.Line != "" {
+				break
+			}
+			continue
+		}
+		if command.Line == "" {
+			command.Line = line
+		} else {
+			command.Headers = append(command.Headers, line)
+		}
+	}
+	if length, err := strconv.Atoi(command.Header("Content-Length")); err == nil && length > 0 {
+		body := make([]byte, length)
+		if _, err := io.ReadFull(s.reader, body); err != nil {
+			s.t.Errorf("goesltest: truncated body of %s : %v", command.Line, err)
+			return nil
+		}
+		command.Body = string(body)
+	}
+	return command
+}
+
+// ExpectCommand - Read the next frame and check its first line is line
+func (s *Server) ExpectCommand(line string) *Command {
+	s.t.Helper()
+	command := s.ReadCommand()
+	switch {
+	case command == nil:
+		s.t.Errorf("goesltest: expected command %q, got none", line)
+	case command.Line != line:
+		s.t.Errorf("goesltest: expected command %q, got %q", line, command.Line)
+	}
+	return command
+}
+
+// Write - Write a raw frame, dropped once the connection is gone
+func (s *Server) Write(frame string) {
+	s.t.Helper()
+	_ = s.conn.SetWriteDeadline(time.Now().Add(s.timeout()))
+	if _, err := io.WriteString(s.conn, frame); err != nil && !closed(err) {
+		s.t.Errorf("goesltest: could not write : %v", err)
+	}
+}
+
+// Reply - Answer a command with a command/reply
+func (s *Server) Reply(text string) {
+	s.t.Helper()
+	s.Write("Content-Type: command/reply\nReply-Text: " + text + "\n\n")
+}
+
+// APIResponse - Answer an api command
+func (s *Server) APIResponse(body string) {
+	s.t.Helper()
+	s.Write(fmt.Sprintf("Content-Type: api/response\nContent-Length: %d\n\n%s", len(body), body))
+}
+
+// ConnectReply - Answer connect on an outbound connection with the channel data headers
+func (s *Server) ConnectReply(headers map[string]string) {
+	s.t.Helper()
+	frame := "Content-Type: command/reply\nReply-Text: +OK\nSocket-Mode: async\nControl: full\n"
+	for name, value := range headers {
+		frame += name + ": " + value + "\n"
+	}
+	s.Write(frame + "\n")
+}
+
+// Event - Send a text/event-json event with headers, "_body" is its body
+func (s *Server) Event(headers map[string]string) {
+	s.t.Helper()
+	body, err := json.Marshal(headers)
+	if err != nil {
+		s.t.Errorf("goesltest: could not encode the event : %v", err)
+		return
+	}
+	s.Write(fmt.Sprintf("Content-Type: text/event-json\nContent-Length: %d\n\n%s", len(body), body))
+}
+
+// Disconnect - Send a text/disconnect-notice and close the pipe, as freeswitch does
+func (s *Server) Disconnect(reason string) {
+	s.t.Helper()
+	s.Write(fmt.Sprintf("Content-Type: text/disconnect-notice\nContent-Length: %d\n\n%s", len(reason), reason))
+	s.Close()
+}
+
+// closed - Whether err means either end of the connection was closed
+func closed(err error) bool {
+	return errors.Is(err, io.EOF) || errors.Is(err, io.ErrClosedPipe) || errors.Is(err, net.ErrClosed) ||
+		errors.Is(err, syscall.ECONNRESET) || errors.Is(err, syscall.EPIPE)
+}
+
+// Close - Close the server end of the pipe, the connection sees it as freeswitch going away
+func (s *Server) Close() {
+	s.conn.Close()
+}
@@ -0,0 +1,251 @@
+/*
+ * Copyright (c) 2021 LuanDNH
+ *
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at https://mozilla.org/MPL/2.0/.
+ *
+ * Contributor(s):
+ * LuanDNH <luandnh98@gmail.com>
+ */
+
+package goesl
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+)
+
+// HangupCause - Freeswitch hangup cause, the value is the Q.850 cause code (or the freeswitch specific code above 127)
+type HangupCause int
+
+// Hangup causes as listed in switch_types.h
+const (
+	HangupCauseNone                        HangupCause = 0
+	HangupCauseUnallocatedNumber           HangupCause = 1
+	HangupCauseNoRouteTransitNet           HangupCause = 2
+	HangupCauseNoRouteDestination          HangupCause = 3
+	HangupCauseChannelUnacceptable         HangupCause = 6
+	HangupCauseCallAwardedDelivered        HangupCause = 7
+	HangupCauseNormalClearing              HangupCause = 16
+	HangupCauseUserBusy                    HangupCause = 17
+	HangupCauseNoUserResponse              HangupCause = 18
+	HangupCauseNoAnswer                    HangupCause = 19
+	HangupCauseSubscriberAbsent            HangupCause = 20
+	HangupCauseCallRejected                HangupCause = 21
+	HangupCauseNumberChanged               HangupCause = 22
+	HangupCauseRedirectionToNewDestination HangupCause = 23
+	HangupCauseExchangeRoutingError        HangupCause = 25
+	HangupCauseDestinationOutOfOrder       HangupCause = 27
+	HangupCauseInvalidNumberFormat         HangupCause = 28
+	HangupCauseFacilityRejected            HangupCause = 29
+	HangupCauseResponseToStatusEnquiry     HangupCause = 30
+	HangupCauseNormalUnspecified           HangupCause = 31
+	HangupCauseNormalCircuitCongestion     HangupCause = 34
+	HangupCauseNetworkOutOfOrder           HangupCause = 38
+	HangupCauseNormalTemporaryFailure      HangupCause = 41
+	HangupCauseSwitchCongestion            HangupCause = 42
+	HangupCauseAccessInfoDiscarded         HangupCause = 43
+	HangupCauseRequestedChanUnavail        HangupCause = 44
+	HangupCausePreEmpted                   HangupCause = 45
+	HangupCauseFacilityNotSubscribed       HangupCause = 50
+	HangupCauseOutgoingCallBarred          HangupCause = 52
+	HangupCauseIncomingCallBarred          HangupCause = 54
+	HangupCauseBearerCapabilityNotAuth     HangupCause = 57
+	HangupCauseBearerCapabilityNotAvail    HangupCause = 58
+	HangupCauseServiceUnavailable          HangupCause = 63
+	HangupCauseBearerCapabilityNotImpl     HangupCause = 65
+	HangupCauseChanNotImplemented          HangupCause = 66
+	HangupCauseFacilityNotImplemented      HangupCause = 69
+	HangupCauseServiceNotImplemented       HangupCause = 79
+	HangupCauseInvalidCallReference        HangupCause = 81
+	HangupCauseIncompatibleDestination     HangupCause = 88
+	HangupCauseInvalidMsgUnspecified       HangupCause = 95
+	HangupCauseMandatoryIEMissing          HangupCause = 96
+	HangupCauseMessageTypeNonExist         HangupCause = 97
+	HangupCauseWrongMessage                HangupCause = 98
+	HangupCauseIENonExist                  HangupCause = 99
+	HangupCauseInvalidIEContents           HangupCause = 100
+	HangupCauseWrongCallState              HangupCause = 101
+	HangupCauseRecoveryOnTimerExpire       HangupCause = 102
+	HangupCauseMandatoryIELengthError      HangupCause = 103
+	HangupCauseProtocolError               HangupCause = 111
+	HangupCauseInterworking                HangupCause = 127
+	HangupCauseSuccess                     HangupCause = 142
+	HangupCauseOriginatorCancel            HangupCause = 487
+	HangupCauseCrash                       HangupCause = 700
+	HangupCauseSystemShutdown              HangupCause = 701
+	HangupCauseLoseRace                    HangupCause = 702
+	HangupCauseManagerRequest              HangupCause = 703
+	HangupCauseBlindTransfer               HangupCause = 800
+	HangupCauseAttendedTransfer            HangupCause = 801
+	HangupCauseAllottedTimeout             HangupCause = 802
+	HangupCauseUserChallenge               HangupCause = 803
+	HangupCauseMediaTimeout                HangupCause = 804
+	HangupCausePickedOff                   HangupCause = 805
+	HangupCauseUserNotRegistered           HangupCause = 806
+	HangupCauseProgressTimeout             HangupCause = 807
+	HangupCauseInvalidGateway              HangupCause = 808
+	HangupCauseGatewayDown                 HangupCause = 809
+	HangupCauseInvalidURL                  HangupCause = 810
+	HangupCauseInvalidProfile              HangupCause = 811
+	HangupCauseNoPickup                    HangupCause = 812
+	HangupCauseSRTPReadError               HangupCause = 813
+	HangupCauseBowout                      HangupCause = 814
+	HangupCauseBusyEverywhere              HangupCause = 815
+	HangupCauseDecline                     HangupCause = 816
+	HangupCauseDoesNotExistAnywhere        HangupCause = 817
+	HangupCauseNotAcceptable               HangupCause = 818
+	HangupCauseUnwanted                    HangupCause = 819
+	HangupCauseNoIdentity                  HangupCause = 820
+	HangupCauseBadIdentityInfo             HangupCause = 821
+	HangupCauseUnsupportedCertificate      HangupCause = 822
+	HangupCauseInvalidIdentity             HangupCause = 823
+	HangupCauseStaleDate                   HangupCause = 824
+	HangupCauseRejectAll                   HangupCause = 825
+)
+
+var hangupCauseNames = map[HangupCause]string{
+	HangupCauseNone:                        "NONE",
+	HangupCauseUnallocatedNumber:           "UNALLOCATED_NUMBER",
+	HangupCauseNoRouteTransitNet:           "NO_ROUTE_TRANSIT_NET",
+	HangupCauseNoRouteDestination:          "NO_ROUTE_DESTINATION",
+	HangupCauseChannelUnacceptable:         "CHANNEL_UNACCEPTABLE",
+	HangupCauseCallAwardedDelivered:        "CALL_AWARDED_DELIVERED",
+	HangupCauseNormalClearing:              "NORMAL_CLEARING",
+	HangupCauseUserBusy:                    "USER_BUSY",
+	HangupCauseNoUserResponse:              "NO_USER_RESPONSE",
+	HangupCauseNoAnswer:                    "NO_ANSWER",
+	HangupCauseSubscriberAbsent:            "SUBSCRIBER_ABSENT",
+	HangupCauseCallRejected:                "CALL_REJECTED",
+	HangupCauseNumberChanged:               "NUMBER_CHANGED",
+	HangupCauseRedirectionToNewDestination: "REDIRECTION_TO_NEW_DESTINATION",
+	HangupCauseExchangeRoutingError:        "EXCHANGE_ROUTING_ERROR",
+	HangupCauseDestinationOutOfOrder:       "DESTINATION_OUT_OF_ORDER",
+	HangupCauseInvalidNumberFormat:         "INVALID_NUMBER_FORMAT",
+	HangupCauseFacilityRejected:            "FACILITY_REJECTED",
+	HangupCauseResponseToStatusEnquiry:     "RESPONSE_TO_STATUS_ENQUIRY",
+	HangupCauseNormalUnspecified:           "NORMAL_UNSPECIFIED",
+	HangupCauseNormalCircuitCongestion:     "NORMAL_CIRCUIT_CONGESTION",
+	HangupCauseNetworkOutOfOrder:           "NETWORK_OUT_OF_ORDER",
+	HangupCauseNormalTemporaryFailure:      "NORMAL_TEMPORARY_FAILURE",
+	HangupCauseSwitchCongestion:            "SWITCH_CONGESTION",
+	HangupCauseAccessInfoDiscarded:         "ACCESS_INFO_DISCARDED",
+	HangupCauseRequestedChanUnavail:        "REQUESTED_CHAN_UNAVAIL",
+	HangupCausePreEmpted:                   "PRE_EMPTED",
+	HangupCauseFacilityNotSubscribed:       "FACILITY_NOT_SUBSCRIBED",
+	HangupCauseOutgoingCallBarred:          "OUTGOING_CALL_BARRED",
+	HangupCauseIncomingCallBarred:          "INCOMING_CALL_BARRED",
+	HangupCauseBearerCapabilityNotAuth:     "BEARERCAPABILITY_NOTAUTH",
+	HangupCauseBearerCapabilityNotAvail:    "BEARERCAPABILITY_NOTAVAIL",
+	HangupCauseServiceUnavailable:          "SERVICE_UNAVAILABLE",
+	HangupCauseBearerCapabilityNotImpl:     "BEARERCAPABILITY_NOTIMPL",
+	HangupCauseChanNotImplemented:          "CHAN_NOT_IMPLEMENTED",
+	HangupCauseFacilityNotImplemented:      "FACILITY_NOT_IMPLEMENTED",
+	HangupCauseServiceNotImplemented:       "SERVICE_NOT_IMPLEMENTED",
+	HangupCauseInvalidCallReference:        "INVALID_CALL_REFERENCE",
+	HangupCauseIncompatibleDestination:     "INCOMPATIBLE_DESTINATION",
+	HangupCauseInvalidMsgUnspecified:       "INVALID_MSG_UNSPECIFIED",
+	HangupCauseMandatoryIEMissing:          "MANDATORY_IE_MISSING",
+	HangupCauseMessageTypeNonExist:         "MESSAGE_TYPE_NONEXIST",
+	HangupCauseWrongMessage:                "WRONG_MESSAGE",
+	HangupCauseIENonExist:                  "IE_NONEXIST",
+	HangupCauseInvalidIEContents:           "INVALID_IE_CONTENTS",
+	HangupCauseWrongCallState:              "WRONG_CALL_STATE",
+	HangupCauseRecoveryOnTimerExpire:       "RECOVERY_ON_TIMER_EXPIRE",
+	HangupCauseMandatoryIELengthError:      "MANDATORY_IE_LENGTH_ERROR",
+	HangupCauseProtocolError:               "PROTOCOL_ERROR",
+	HangupCauseInterworking:                "INTERWORKING",
+	HangupCauseSuccess:                     "SUCCESS",
+	HangupCauseOriginatorCancel:            "ORIGINATOR_CANCEL",
+	HangupCauseCrash:                       "CRASH",
+	HangupCauseSystemShutdown:              "SYSTEM_SHUTDOWN",
+	HangupCauseLoseRace:                    "LOSE_RACE",
+	HangupCauseManagerRequest:              "MANAGER_REQUEST",
+	HangupCauseBlindTransfer:               "BLIND_TRANSFER",
+	HangupCauseAttendedTransfer:            "ATTENDED_TRANSFER",
+	HangupCauseAllottedTimeout:             "ALLOTTED_TIMEOUT",
+	HangupCauseUserChallenge:               "USER_CHALLENGE",
+	HangupCauseMediaTimeout:                "MEDIA_TIMEOUT",
+	HangupCausePickedOff:                   "PICKED_OFF",
+	HangupCauseUserNotRegistered:           "USER_NOT_REGISTERED",
+	HangupCauseProgressTimeout:             "PROGRESS_TIMEOUT",
+	HangupCauseInvalidGateway:              "INVALID_GATEWAY",
+	HangupCauseGatewayDown:                 "GATEWAY_DOWN",
+	HangupCauseInvalidURL:                  "INVALID_URL",
+	HangupCauseInvalidProfile:              "INVALID_PROFILE",
+	HangupCauseNoPickup:                    "NO_PICKUP",
+	HangupCauseSRTPReadError:               "SRTP_READ_ERROR",
+	HangupCauseBowout:                      "BOWOUT",
+	HangupCauseBusyEverywhere:              "BUSY_EVERYWHERE",
+	HangupCauseDecline:                     "DECLINE",
+	HangupCauseDoesNotExistAnywhere:        "DOES_NOT_EXIST_ANYWHERE",
+	HangupCauseNotAcceptable:               "NOT_ACCEPTABLE",
+	HangupCauseUnwanted:                    "UNWANTED",
+	HangupCauseNoIdentity:                  "NO_IDENTITY",
+	HangupCauseBadIdentityInfo:             "BAD_IDENTITY_INFO",
+	HangupCauseUnsupportedCertificate:      "UNSUPPORTED_CERTIFICATE",
+	HangupCauseInvalidIdentity:             "INVALID_IDENTITY",
+	HangupCauseStaleDate:                   "STALE_DATE",
+	HangupCauseRejectAll:                   "REJECT_ALL",
+}
+
+var hangupCauseValues = make(map[string]HangupCause, len(hangupCauseNames))
+
+func init() {
+	for cause, name := range hangupCauseNames {
+		hangupCauseValues[name] = cause
+	}
+}
+
+// String - Freeswitch name of the cause, like NORMAL_CLEARING
+func (h HangupCause) String() string {
+	if name, ok := hangupCauseNames[h]; ok {
+		return name
+	}
+	return "UNKNOWN"
+}
+
+// Q850 - Q.850 cause code, as sent in Hangup-Cause-Q850 or SIP Reason headers
+func (h HangupCause) Q850() int {
+	return int(h)
+}
+
+// ParseHangupCause - Parse a cause name like NORMAL_CLEARING, case insensitive, or its numeric code like 16
+func ParseHangupCause(name string) (HangupCause, error) {
+	name = strings.ToUpper(strings.TrimSpace(name))
+	if cause, ok := hangupCauseValues[name]; ok {
+		return cause, nil
+	}
+	if code, err := strconv.Atoi(name); err == nil {
+		if _, ok := hangupCauseNames[HangupCause(code)]; ok {
+			return HangupCause(code), nil
+		}
+	}
+	return HangupCauseNone, errors.New("unknown hangup cause : " + name)
+}
+
+// HangupCause - Hangup cause of a hangup event, from Hangup-Cause or variable_hangup_cause,
+// falling back to the Q.850 code when the name is missing
+func (r *ESLResponse) HangupCause() HangupCause {
+	for _, header := range []string{"Hangup-Cause", "variable_hangup_cause", "variable_hangup_cause_q850"} {
+		if cause, err := ParseHangupCause(r.GetHeader(header)); err == nil {
+			return cause
+		}
+	}
+	return HangupCauseNone
+}
+
+// Hupall - Hangup every channel with cause, when varName is set only channels where varName equals varValue
+func (c *ESLConnection) Hupall(cause HangupCause, varName, varValue string) error {
+	cmd := "hupall " + cause.String()
+	if varName != "" {
+		if err := validateVarName(varName); err != nil {
+			return err
+		}
+		cmd += " " + varName + " " + QuoteArgument(varValue)
+	}
+	_, err := c.Api(cmd)
+	return err
+}
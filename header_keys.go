@@ -0,0 +1,55 @@
+/*
+ * Copyright (c) 2021 LuanDNH
+ *
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at https://mozilla.org/MPL/2.0/.
+ *
+ * Contributor(s):
+ * LuanDNH <luandnh98@gmail.com>
+ */
+package goesl
+
+import "strings"
+
+// commonHeaderNames - Header names found in most messages and events, their index keys are computed once
+var commonHeaderNames = []string{
+	"Content-Type", "Content-Length", "Content-Disposition", "Reply-Text", "Job-UUID", "Socket-Mode", "Control",
+	"Event-Name", "Event-Subclass", "Core-UUID", "FreeSWITCH-Hostname", "FreeSWITCH-Switchname",
+	"FreeSWITCH-IPv4", "FreeSWITCH-IPv6", "FreeSWITCH-Version", "Event-Date-Local", "Event-Date-GMT",
+	"Event-Date-Timestamp", "Event-Calling-File", "Event-Calling-Function", "Event-Calling-Line-Number",
+	"Event-Sequence", "Unique-ID", "Controlled-Session-UUID", "Application", "Application-Data",
+	"Application-Response", "Application-UUID", "Hangup-Cause", "Answer-State", "Call-Direction",
+	"Presence-Call-Direction", "Channel-State", "Channel-State-Number", "Channel-Name", "Channel-Call-State",
+	"Channel-Call-UUID", "Channel-Read-Codec-Name", "Channel-Read-Codec-Rate", "Channel-Read-Codec-Bit-Rate",
+	"Channel-Write-Codec-Name", "Channel-Write-Codec-Rate", "Channel-Write-Codec-Bit-Rate",
+	"Channel-Presence-ID", "Channel-HIT-Dialplan", "Session-External-ID", "Other-Type", "Other-Leg-Unique-ID",
+	"Caller-Direction", "Caller-Logical-Direction", "Caller-Username", "Caller-Dialplan", "Caller-Caller-ID-Name",
+	"Caller-Caller-ID-Number", "Caller-Orig-Caller-ID-Name", "Caller-Orig-Caller-ID-Number",
+	"Caller-Callee-ID-Name", "Caller-Callee-ID-Number", "Caller-Network-Addr", "Caller-ANI",
+	"Caller-Destination-Number", "Caller-Unique-ID", "Caller-Source", "Caller-Context", "Caller-Channel-Name",
+	"Caller-Profile-Index", "Caller-Profile-Created-Time", "Caller-Channel-Created-Time",
+	"Caller-Channel-Answered-Time", "Caller-Channel-Progress-Time", "Caller-Channel-Progress-Media-Time",
+	"Caller-Channel-Hangup-Time", "Caller-Channel-Transfer-Time", "Caller-Channel-Resurrect-Time",
+	"Caller-Channel-Bridged-Time", "Caller-Channel-Last-Hold", "Caller-Channel-Hold-Accum", "Caller-Screen-Bit",
+	"Caller-Privacy-Hide-Name", "Caller-Privacy-Hide-Number", "Up-Time", "Uptime-msec", "Session-Count",
+	"Max-Sessions", "Session-Per-Sec", "Session-Per-Sec-Last", "Session-Per-Sec-Max", "Session-Per-Sec-FiveMin",
+	"Session-Since-Startup", "Session-Peak-Max", "Session-Peak-FiveMin", "Idle-CPU", "Heartbeat-Interval",
+}
+
+// commonHeaderKeys - Index keys of commonHeaderNames, a header lookup by one of those names does not allocate
+var commonHeaderKeys = make(map[string]string, len(commonHeaderNames))
+
+func init() {
+	for _, name := range commonHeaderNames {
+		commonHeaderKeys[name] = strings.ToLower(name)
+	}
+}
+
+// headerKey - Index key of a header name, lower case so lookups ignore case
+func headerKey(name string) string {
+	if key, ok := commonHeaderKeys[name]; ok {
+		return key
+	}
+	return strings.ToLower(name)
+}
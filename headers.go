@@ -0,0 +1,280 @@
+/*
+ * Copyright (c) 2021 LuanDNH
+ *
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at https://mozilla.org/MPL/2.0/.
+ *
+ * Contributor(s):
+ * LuanDNH <luandnh98@gmail.com>
+ */
+
+package goesl
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"strings"
+)
+
+// HeaderField - A single header line
+type HeaderField struct {
+	Name  string
+	Value string
+}
+
+// Headers - Ordered multimap of message headers, repeated headers are kept in the order received.
+// Names are matched case insensitively so plain, json and xml events are read the same way.
+// The zero value is ready to use
+type Headers struct {
+	fields []HeaderField
+	index  map[string][]int
+	// slots - Shared backing array of the index entries of names seen once, so they don't need an allocation each
+	slots []int
+}
+
+// newHeaders - Headers with room for n lines
+func newHeaders(n int) Headers {
+	return Headers{
+		fields: make([]HeaderField, 0, n),
+		index:  make(map[string][]int, n),
+		slots:  make([]int, 0, n),
+	}
+}
+
+// Add - Append a value for name, keeping existing ones
+func (h *Headers) Add(name, value string) {
+	if h.index == nil {
+		h.index = make(map[string][]int)
+	}
+	h.addIndex(headerKey(name), len(h.fields))
+	h.fields = append(h.fields, HeaderField{Name: name, Value: value})
+}
+
+func (h *Headers) addIndex(key string, position int) {
+	if positions, ok := h.index[key]; ok {
+		// Full slices, appending copies them out of slots
+		h.index[key] = append(positions, position)
+		return
+	}
+	h.slots = append(h.slots, position)
+	n := len(h.slots)
+	h.index[key] = h.slots[n-1 : n : n]
+}
+
+// Set - Replace every value of name by value
+func (h *Headers) Set(name, value string) {
+	h.Del(name)
+	h.Add(name, value)
+}
+
+// Get - First value of name, empty if not present
+func (h *Headers) Get(name string) string {
+	if positions := h.index[headerKey(name)]; len(positions) > 0 {
+		return h.fields[positions[0]].Value
+	}
+	return ""
+}
+
+// Values - Every value of name in order
+func (h *Headers) Values(name string) []string {
+	positions := h.index[headerKey(name)]
+	if len(positions) == 0 {
+		return nil
+	}
+	values := make([]string, 0, len(positions))
+	for _, i := range positions {
+		values = append(values, h.fields[i].Value)
+	}
+	return values
+}
+
+// Has - Check if name is present
+func (h *Headers) Has(name string) bool {
+	return len(h.index[headerKey(name)]) > 0
+}
+
+// Del - Remove every value of name
+func (h *Headers) Del(name string) {
+	if !h.Has(name) {
+		return
+	}
+	key := headerKey(name)
+	fields := h.fields[:0]
+	for _, f := range h.fields {
+		if headerKey(f.Name) != key {
+			fields = append(fields, f)
+		}
+	}
+	h.fields = fields
+	h.reindex()
+}
+
+// Len - Number of header lines
+func (h *Headers) Len() int {
+	return len(h.fields)
+}
+
+// Fields - Header lines in the order received
+func (h *Headers) Fields() []HeaderField {
+	fields := make([]HeaderField, len(h.fields))
+	copy(fields, h.fields)
+	return fields
+}
+
+// Map - Headers as a map keeping the first value and spelling of each name
+func (h *Headers) Map() map[string]string {
+	m := make(map[string]string, len(h.index))
+	for _, positions := range h.index {
+		f := h.fields[positions[0]]
+		m[f.Name] = f.Value
+	}
+	return m
+}
+
+// MarshalJSON - Render headers as an object in order, repeated headers become arrays
+func (h Headers) MarshalJSON() ([]byte, error) {
+	var buf bytes.Buffer
+	buf.WriteByte('{')
+	written := 0
+	for i, f := range h.fields {
+		positions := h.index[headerKey(f.Name)]
+		if positions[0] != i {
+			continue
+		}
+		if written > 0 {
+			buf.WriteByte(',')
+		}
+		written++
+		name, err := json.Marshal(f.Name)
+		if err != nil {
+			return nil, err
+		}
+		buf.Write(name)
+		buf.WriteByte(':')
+		var value []byte
+		if len(positions) == 1 {
+			value, err = json.Marshal(f.Value)
+		} else {
+			value, err = json.Marshal(h.Values(f.Name))
+		}
+		if err != nil {
+			return nil, err
+		}
+		buf.Write(value)
+	}
+	buf.WriteByte('}')
+	return buf.Bytes(), nil
+}
+
+func (h *Headers) reindex() {
+	h.index = make(map[string][]int, len(h.fields))
+	h.slots = make([]int, 0, len(h.fields))
+	for i, f := range h.fields {
+		h.addIndex(headerKey(f.Name), i)
+	}
+}
+
+// readHeaders - Read "Name: value" lines up to an empty line, keeping order and repeated names.
+// capacity is the number of lines expected and maxSize the number of bytes allowed, 0 for no limit.
+// When lenient, malformed lines are skipped instead of failing
+func readHeaders(r *bufio.Reader, capacity, maxSize int, lenient bool, logger Logger) (Headers, error) {
+	headers := newHeaders(capacity)
+	size := 0
+	for {
+		limit := -1
+		if maxSize > 0 {
+			if limit = maxSize - size; limit < 0 {
+				return headers, errHeaderTooLarge
+			}
+		}
+		line, err := readLine(r, limit)
+		if err != nil {
+			return headers, err
+		}
+		size += len(line) + 1
+		if line == "" {
+			if headers.Len() == 0 {
+				// Skip blank lines between frames
+				continue
+			}
+			return headers, nil
+		}
+		i := strings.IndexByte(line, ':')
+		if i <= 0 {
+			if lenient {
+				logger.Warn("skipping malformed header line : %s", line)
+				continue
+			}
+			return headers, errors.New("malformed header line : " + line)
+		}
+		headers.Add(line[:i], strings.TrimLeft(line[i+1:], " \t"))
+	}
+}
+
+// parseHeaderBlock - Same as readHeaders from a block already in memory. Names and values are substrings
+// of text, so a whole event costs a single copy. The offset following the empty line is returned
+func parseHeaderBlock(text string, capacity int) (Headers, int, error) {
+	headers := newHeaders(capacity)
+	offset := 0
+	for offset < len(text) {
+		end := strings.IndexByte(text[offset:], '\n')
+		next := len(text)
+		if end >= 0 {
+			end += offset
+			next = end + 1
+		} else {
+			end = len(text)
+		}
+		line := strings.TrimRight(text[offset:end], "\r")
+		offset = next
+		if line == "" {
+			if headers.Len() == 0 {
+				continue
+			}
+			return headers, offset, nil
+		}
+		i := strings.IndexByte(line, ':')
+		if i <= 0 {
+			return headers, offset, errors.New("malformed header line : " + line)
+		}
+		headers.Add(line[:i], strings.TrimLeft(line[i+1:], " \t"))
+	}
+	if headers.Len() == 0 {
+		return headers, offset, io.EOF
+	}
+	// A last block without empty line is accepted
+	return headers, offset, nil
+}
+
+// errHeaderTooLarge - Header block above the allowed size
+var errHeaderTooLarge = errors.New("header too large")
+
+// readLine - Next line without its line ending. When limit >= 0 a longer line fails with errHeaderTooLarge.
+// A last line without line ending is returned before io.EOF
+func readLine(r *bufio.Reader, limit int) (string, error) {
+	var long []byte
+	for {
+		chunk, err := r.ReadSlice('\n')
+		if limit >= 0 && len(long)+len(chunk) > limit {
+			return "", errHeaderTooLarge
+		}
+		if err == bufio.ErrBufferFull {
+			long = append(long, chunk...)
+			continue
+		}
+		if err != nil && (err != io.EOF || len(long)+len(chunk) == 0) {
+			return "", err
+		}
+		var line string
+		if long != nil {
+			line = string(append(long, chunk...))
+		} else {
+			line = string(chunk)
+		}
+		return strings.TrimRight(line, "\r\n"), nil
+	}
+}
@@ -0,0 +1,189 @@
+/*
+ * Copyright (c) 2021 LuanDNH
+ *
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at https://mozilla.org/MPL/2.0/.
+ *
+ * Contributor(s):
+ * LuanDNH <luandnh98@gmail.com>
+ */
+
+package goesl
+
+import (
+	"strconv"
+	"sync"
+	"time"
+)
+
+// DefaultHeartbeatWindow - Silence tolerated by a HeartbeatMonitor, three times the default heartbeat interval of freeswitch
+const DefaultHeartbeatWindow = 60 * time.Second
+
+// Heartbeat - Metrics reported by a HEARTBEAT event
+type Heartbeat struct {
+	// Time - Local time the heartbeat was received at, Timestamp the one reported by freeswitch
+	Time                 time.Time
+	Timestamp            time.Time
+	Version              string
+	Uptime               time.Duration
+	Sessions             int
+	SessionsSinceStartup int
+	SessionsPerSecond    int
+	MaxSessions          int
+	IdleCPU              float64
+	// Interval - Configured event-heartbeat-interval
+	Interval time.Duration
+}
+
+// HeartbeatOptions - Options of MonitorHeartbeat
+type HeartbeatOptions struct {
+	// Window - Longest time without heartbeat before OnTimeout is called, DefaultHeartbeatWindow when 0
+	Window time.Duration
+	// OnTimeout - Called once each time heartbeats stop arriving, with the last one received (zero if none).
+	// When nil the connection is closed, so its error path and reconnect logic take over
+	OnTimeout func(last Heartbeat)
+	// OnResume - Called with the first heartbeat received after OnTimeout
+	OnResume func(heartbeat Heartbeat)
+	// Format - Event format used to subscribe to HEARTBEAT, the one already subscribed or json when empty
+	Format string
+}
+
+// HeartbeatMonitor - Tracks HEARTBEAT events of a connection, see MonitorHeartbeat
+type HeartbeatMonitor struct {
+	connection *ESLConnection
+	window     time.Duration
+	onTimeout  func(last Heartbeat)
+	onResume   func(heartbeat Heartbeat)
+	listenerID string
+
+	lock sync.Mutex
+	last Heartbeat
+	seen bool
+
+	beat     chan struct{}
+	stop     chan struct{}
+	stopOnce sync.Once
+}
+
+// MonitorHeartbeat - Subscribe to HEARTBEAT events and watch they keep arriving within the window.
+// The monitor runs until Stop is called or the connection is closed
+func (c *ESLConnection) MonitorHeartbeat(opts HeartbeatOptions) (*HeartbeatMonitor, error) {
+	if opts.Window <= 0 {
+		opts.Window = DefaultHeartbeatWindow
+	}
+	if opts.Format == "" {
+		opts.Format = c.eventFormat()
+	}
+	monitor := &HeartbeatMonitor{
+		connection: c,
+		window:     opts.Window,
+		onTimeout:  opts.OnTimeout,
+		onResume:   opts.OnResume,
+		beat:       make(chan struct{}, 1),
+		stop:       make(chan struct{}),
+	}
+	if monitor.onTimeout == nil {
+		monitor.onTimeout = func(Heartbeat) {
+			c.logger.Error("no heartbeat received for %s, closing connection", opts.Window)
+			c.Close()
+		}
+	}
+	monitor.listenerID = c.RegisterEventListener(EventListenAll, monitor.handleEvent)
+	if err := c.Subscribe(opts.Format, EventHeartbeat); err != nil {
+		c.RemoveEventListener(EventListenAll, monitor.listenerID)
+		return nil, err
+	}
+	go monitor.run()
+	return monitor, nil
+}
+
+// eventFormat - Format of the current subscriptions, json when there are none
+func (c *ESLConnection) eventFormat() string {
+	c.subscriptionLock.Lock()
+	defer c.subscriptionLock.Unlock()
+	if c.subscriptionFormat == "" || len(c.subscriptions) == 0 {
+		return EventFormatJSON
+	}
+	return c.subscriptionFormat
+}
+
+// Last - Last heartbeat received, false if none was received yet
+func (m *HeartbeatMonitor) Last() (Heartbeat, bool) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	return m.last, m.seen
+}
+
+// Stop - Stop watching heartbeats and release the HEARTBEAT subscription
+func (m *HeartbeatMonitor) Stop() error {
+	var err error
+	m.stopOnce.Do(func() {
+		close(m.stop)
+		m.connection.RemoveEventListener(EventListenAll, m.listenerID)
+		err = m.connection.Unsubscribe(EventHeartbeat)
+	})
+	return err
+}
+
+func (m *HeartbeatMonitor) handleEvent(event *Event) {
+	if event.GetHeader("Event-Name") != EventHeartbeat {
+		return
+	}
+	heartbeat := parseHeartbeat(event)
+	m.lock.Lock()
+	m.last, m.seen = heartbeat, true
+	m.lock.Unlock()
+	select {
+	case m.beat <- struct{}{}:
+	default:
+	}
+}
+
+func (m *HeartbeatMonitor) run() {
+	timer := time.NewTimer(m.window)
+	defer timer.Stop()
+	silent := false
+	for {
+		select {
+		case <-m.beat:
+			if !timer.Stop() {
+				select {
+				case <-timer.C:
+				default:
+				}
+			}
+			timer.Reset(m.window)
+			if silent && m.onResume != nil {
+				last, _ := m.Last()
+				m.connection.runHandler("heartbeat resume handler", func() { m.onResume(last) })
+			}
+			silent = false
+		case <-timer.C:
+			// Not rearmed until the next heartbeat, a silence is reported once
+			silent = true
+			last, _ := m.Last()
+			m.connection.runHandler("heartbeat timeout handler", func() { m.onTimeout(last) })
+		case <-m.stop:
+			return
+		case <-m.connection.done:
+			return
+		}
+	}
+}
+
+func parseHeartbeat(event *Event) Heartbeat {
+	heartbeat := Heartbeat{
+		Time:      time.Now(),
+		Timestamp: parseEpochMicro(event.GetHeader("Event-Date-Timestamp")),
+		Version:   event.GetHeader("FreeSWITCH-Version"),
+	}
+	heartbeat.Uptime, _ = event.GetHeaderDuration("Uptime-msec", time.Millisecond)
+	heartbeat.Interval, _ = event.GetHeaderDuration("Heartbeat-Interval", time.Second)
+	heartbeat.Sessions, _ = event.GetHeaderInt("Session-Count")
+	heartbeat.SessionsSinceStartup, _ = event.GetHeaderInt("Session-Since-Startup")
+	heartbeat.SessionsPerSecond, _ = event.GetHeaderInt("Session-Per-Sec")
+	heartbeat.MaxSessions, _ = event.GetHeaderInt("Max-Sessions")
+	heartbeat.IdleCPU, _ = strconv.ParseFloat(event.GetHeader("Idle-CPU"), 64)
+	return heartbeat
+}
@@ -0,0 +1,67 @@
+/*
+ * Copyright (c) 2021 LuanDNH
+ *
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at https://mozilla.org/MPL/2.0/.
+ *
+ * Contributor(s):
+ * LuanDNH <luandnh98@gmail.com>
+ */
+
+package goesl
+
+import (
+	"bytes"
+	"context"
+)
+
+// Invoker - Send a command and wait for its reply, the next step of an Interceptor
+type Invoker func(ctx context.Context, cmd string) (*ESLResponse, error)
+
+// Interceptor - Wraps the commands waiting for a reply, like gRPC interceptors, for logging, metrics, retries
+// or authorization. cmd is the command line, like "api status" or "sendmsg <uuid>", the headers and body of
+// the frame follow it unchanged. An interceptor may change cmd, call next more than once, or not at all
+// to refuse the command. Commands sent without waiting for a reply, like BgApi, and ApiStream are not intercepted
+type Interceptor func(ctx context.Context, cmd string, next Invoker) (*ESLResponse, error)
+
+// Use - Add interceptors after those already registered, see Options.Interceptors.
+// The first interceptor registered is the outermost
+func (c *ESLConnection) Use(interceptors ...Interceptor) {
+	c.interceptorsLock.Lock()
+	defer c.interceptorsLock.Unlock()
+	// Copied so a chain being run keeps its interceptors
+	chain := make([]Interceptor, 0, len(c.interceptors)+len(interceptors))
+	chain = append(chain, c.interceptors...)
+	c.interceptors = append(chain, interceptors...)
+}
+
+// intercept - Run frame through the interceptors, down to invoke
+func (c *ESLConnection) intercept(ctx context.Context, frame []byte, invoke func(ctx context.Context, frame []byte) (*ESLResponse, error)) (*ESLResponse, error) {
+	c.interceptorsLock.RLock()
+	interceptors := c.interceptors
+	c.interceptorsLock.RUnlock()
+	if len(interceptors) == 0 {
+		return invoke(ctx, frame)
+	}
+	end := bytes.IndexAny(frame, "\r\n")
+	if end < 0 {
+		end = len(frame)
+	}
+	cmd := string(frame[:end])
+	// The frame goes back to the pool once written, every call of next writes its own
+	rest := append([]byte(nil), frame[end:]...)
+	putFrameBuffer(frame)
+	next := func(ctx context.Context, cmd string) (*ESLResponse, error) {
+		frame := getFrameBuffer(len(cmd) + len(rest))
+		frame = append(frame, cmd...)
+		return invoke(ctx, append(frame, rest...))
+	}
+	for i := len(interceptors) - 1; i >= 0; i-- {
+		interceptor, inner := interceptors[i], next
+		next = func(ctx context.Context, cmd string) (*ESLResponse, error) {
+			return interceptor(ctx, cmd, inner)
+		}
+	}
+	return next(ctx, cmd)
+}
@@ -0,0 +1,250 @@
+/*
+ * Copyright (c) 2021 LuanDNH
+ *
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at https://mozilla.org/MPL/2.0/.
+ *
+ * Contributor(s):
+ * LuanDNH <luandnh98@gmail.com>
+ */
+package goesl
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"time"
+)
+
+// ErrMenuExhausted - No valid choice was entered in the tries of a Menu
+var ErrMenuExhausted = errors.New("menu tries exhausted")
+
+// typeAheadSize - DTMF digits kept for the next prompt, later ones are dropped
+const typeAheadSize = 64
+
+// IVR - Prompts and menus on one channel, driven by execute and DTMF events. Digits entered between
+// prompts are kept for the next one. An IVR is used by one goroutine at a time
+type IVR struct {
+	connection *ESLConnection
+	uuid       string
+	dispatcher *OrderedDispatcher
+	digits     chan string
+	// typed - Digits taken from digits by a barge-in and not collected yet
+	typed []string
+}
+
+// NewIVR - Start an IVR on the channel uuid. On an inbound connection DTMF is subscribed until Close,
+// an outbound connection must use myevents
+func (c *ESLConnection) NewIVR(uuid string) (*IVR, error) {
+	if uuid == "" {
+		return nil, errors.New("ivr needs a channel uuid")
+	}
+	if !c.outbound {
+		if err := c.subscribeInternal(EventDTMF); err != nil {
+			return nil, err
+		}
+	}
+	ivr := &IVR{
+		connection: c,
+		uuid:       uuid,
+		digits:     make(chan string, typeAheadSize),
+	}
+	// Ordered so digits are collected in the order they were pressed
+	ivr.dispatcher = c.DispatchOrdered(1, 0, func(event *Event) {
+		if event.GetHeader("Event-Name") != EventDTMF || event.GetHeader("Unique-ID") != uuid {
+			return
+		}
+		select {
+		case ivr.digits <- event.GetHeader("DTMF-Digit"):
+		default:
+		}
+	})
+	return ivr, nil
+}
+
+// Close - Stop following DTMF of the channel
+func (ivr *IVR) Close() error {
+	ivr.dispatcher.Stop()
+	if !ivr.connection.outbound {
+		return ivr.connection.Unsubscribe(EventDTMF)
+	}
+	return nil
+}
+
+// FlushDigits - Forget the digits entered so far
+func (ivr *IVR) FlushDigits() {
+	ivr.typed = nil
+	for {
+		select {
+		case <-ivr.digits:
+		default:
+			return
+		}
+	}
+}
+
+// nextDigit - Next digit entered, "" when wait is done first
+func (ivr *IVR) nextDigit(ctx context.Context, wait <-chan time.Time) (string, error) {
+	if len(ivr.typed) > 0 {
+		digit := ivr.typed[0]
+		ivr.typed = ivr.typed[1:]
+		return digit, nil
+	}
+	select {
+	case digit := <-ivr.digits:
+		return digit, nil
+	case <-wait:
+		return "", nil
+	case <-ctx.Done():
+		return "", ctx.Err()
+	}
+}
+
+// Prompt - Files played in order, a digit stops them unless barge-in is disabled
+type Prompt struct {
+	ivr     *IVR
+	files   []string
+	bargeIn bool
+}
+
+// Prompt - Prompt playing files, with barge-in
+func (ivr *IVR) Prompt(files ...string) *Prompt {
+	return &Prompt{ivr: ivr, files: files, bargeIn: true}
+}
+
+// NoBargeIn - Play every file to the end, digits entered meanwhile are kept for CollectDigits
+func (p *Prompt) NoBargeIn() *Prompt {
+	p.bargeIn = false
+	return p
+}
+
+// Play - Play the files. With barge-in a digit, or one entered before, stops the playback right away
+func (p *Prompt) Play(ctx context.Context) error {
+	ivr := p.ivr
+	for _, file := range p.files {
+		if p.bargeIn && len(ivr.typed)+len(ivr.digits) > 0 {
+			return nil
+		}
+		done := make(chan error, 1)
+		go func(file string) {
+			_, err := ivr.connection.ExecuteAndWait(ctx, ivr.uuid, "playback", file, &ExecuteOptions{EventLock: true})
+			done <- err
+		}(file)
+		var bargeIn <-chan string
+		if p.bargeIn {
+			bargeIn = ivr.digits
+		}
+		select {
+		case err := <-done:
+			if err != nil {
+				return err
+			}
+		case digit := <-bargeIn:
+			ivr.typed = append(ivr.typed, digit)
+			// uuid_break stops the playback, which completes
+			if _, err := ivr.connection.Api("uuid_break " + ivr.uuid); err != nil {
+				return err
+			}
+			return <-done
+		case <-ctx.Done():
+			_, _ = ivr.connection.Api("uuid_break " + ivr.uuid)
+			return ctx.Err()
+		}
+	}
+	return nil
+}
+
+// CollectDigits - Play the prompt then collect up to n digits. Collecting stops on a terminator digit,
+// or when no digit is entered for timeout. Digits is empty when nothing was entered
+func (p *Prompt) CollectDigits(ctx context.Context, n int, timeout time.Duration, terminators string) (*DigitsResult, error) {
+	if err := p.Play(ctx); err != nil {
+		return nil, err
+	}
+	result := &DigitsResult{}
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	for len(result.Digits) < n {
+		digit, err := p.ivr.nextDigit(ctx, timer.C)
+		if err != nil {
+			return nil, err
+		}
+		if digit == "" {
+			break
+		}
+		if strings.Contains(terminators, digit) {
+			result.Terminator = digit
+			break
+		}
+		result.Digits += digit
+		if !timer.Stop() {
+			<-timer.C
+		}
+		timer.Reset(timeout)
+	}
+	return result, nil
+}
+
+// Menu - Prompt offering choices, played again after an invalid choice or no input
+type Menu struct {
+	Prompt []string
+	// Choices - Valid entries, like "1", "2" or "*9"
+	Choices []string
+	// InvalidPrompt - Played after an invalid choice, NoInputPrompt after no input, it defaults to InvalidPrompt
+	InvalidPrompt string
+	NoInputPrompt string
+	// Tries - Times the menu is played, 3 when zero
+	Tries int
+	// Timeout - Wait for a digit, 5 seconds when zero
+	Timeout time.Duration
+	// Terminators - Digits ending an entry early, "#" when empty
+	Terminators string
+}
+
+// RunMenu - Play the menu until a valid choice is entered, which is returned. ErrMenuExhausted is returned
+// once the tries are used
+func (ivr *IVR) RunMenu(ctx context.Context, menu Menu) (string, error) {
+	tries := menu.Tries
+	if tries <= 0 {
+		tries = 3
+	}
+	timeout := menu.Timeout
+	if timeout <= 0 {
+		timeout = 5 * time.Second
+	}
+	terminators := menu.Terminators
+	if terminators == "" {
+		terminators = "#"
+	}
+	noInputPrompt := menu.NoInputPrompt
+	if noInputPrompt == "" {
+		noInputPrompt = menu.InvalidPrompt
+	}
+	length := 1
+	for _, choice := range menu.Choices {
+		if len(choice) > length {
+			length = len(choice)
+		}
+	}
+	for try := 0; try < tries; try++ {
+		result, err := ivr.Prompt(menu.Prompt...).CollectDigits(ctx, length, timeout, terminators)
+		if err != nil {
+			return "", err
+		}
+		for _, choice := range menu.Choices {
+			if result.Digits == choice {
+				return choice, nil
+			}
+		}
+		retryPrompt := menu.InvalidPrompt
+		if result.Digits == "" {
+			retryPrompt = noInputPrompt
+		}
+		if retryPrompt != "" {
+			if err := ivr.Prompt(retryPrompt).Play(ctx); err != nil {
+				return "", err
+			}
+		}
+	}
+	return "", ErrMenuExhausted
+}
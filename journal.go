@@ -0,0 +1,265 @@
+/*
+ * Copyright (c) 2021 LuanDNH
+ *
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at https://mozilla.org/MPL/2.0/.
+ *
+ * Contributor(s):
+ * LuanDNH <luandnh98@gmail.com>
+ */
+package goesl
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// JournalFormat - Encoding of a journal file
+type JournalFormat int
+
+const (
+	// JournalNDJSON - One {"time":...,"event":{...}} json document per line, the event as sent in text/event-json
+	JournalNDJSON JournalFormat = iota
+	// JournalBinary - Records of the receive time in unix nanoseconds (8 bytes), the length of the event (4 bytes)
+	// and the event as sent in text/event-json, integers are big endian
+	JournalBinary
+)
+
+// JournalOptions - Options of StartJournal
+type JournalOptions struct {
+	Path   string
+	Format JournalFormat
+	// MaxSize - The file is rotated once it would grow past MaxSize bytes, never when 0
+	MaxSize int64
+	// MaxFiles - Rotated files kept as Path.1 to Path.MaxFiles, Path.1 being the newest. 1 when 0
+	MaxFiles int
+}
+
+// Journal - Appends every event received by a connection to a file, see StartJournal
+type Journal struct {
+	opts       JournalOptions
+	dispatcher *OrderedDispatcher
+	lock       sync.Mutex
+	file       *os.File
+	writer     *bufio.Writer
+	size       int64
+	err        error
+	closeOnce  sync.Once
+}
+
+type journalLine struct {
+	Time  time.Time       `json:"time"`
+	Event json.RawMessage `json:"event"`
+}
+
+// StartJournal - Append the events received by c to opts.Path until Close. Writing stops on the first error, see Err
+func (c *ESLConnection) StartJournal(opts JournalOptions) (*Journal, error) {
+	if opts.MaxFiles <= 0 {
+		opts.MaxFiles = 1
+	}
+	j := &Journal{opts: opts}
+	if err := j.open(); err != nil {
+		return nil, err
+	}
+	// A single worker keeps the file in the order events are received
+	j.dispatcher = c.DispatchOrdered(1, 0, j.record)
+	return j, nil
+}
+
+func (j *Journal) open() error {
+	file, err := os.OpenFile(j.opts.Path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return err
+	}
+	j.file, j.writer, j.size = file, bufio.NewWriter(file), info.Size()
+	return nil
+}
+
+func (j *Journal) record(event *Event) {
+	entry, err := EncodeJournalEntry(time.Now(), event, j.opts.Format)
+	if err != nil {
+		return
+	}
+
+	j.lock.Lock()
+	defer j.lock.Unlock()
+	if j.err != nil || j.file == nil {
+		return
+	}
+	if j.opts.MaxSize > 0 && j.size > 0 && j.size+int64(len(entry)) > j.opts.MaxSize {
+		if j.err = j.rotate(); j.err != nil {
+			return
+		}
+	}
+	if _, j.err = j.writer.Write(entry); j.err == nil {
+		j.err = j.writer.Flush()
+	}
+	j.size += int64(len(entry))
+}
+
+// EncodeJournalEntry - Record of event received at the given time, as written to a journal in format.
+// Records appended to any writer can be read back with NewJournalReader
+func EncodeJournalEntry(received time.Time, event *Event, format JournalFormat) ([]byte, error) {
+	document, err := event.eventJSON()
+	if err != nil {
+		return nil, err
+	}
+	switch format {
+	case JournalBinary:
+		entry := make([]byte, 12, 12+len(document))
+		binary.BigEndian.PutUint64(entry, uint64(received.UnixNano()))
+		binary.BigEndian.PutUint32(entry[8:], uint32(len(document)))
+		return append(entry, document...), nil
+	default:
+		entry, err := json.Marshal(journalLine{Time: received, Event: document})
+		if err != nil {
+			return nil, err
+		}
+		return append(entry, '\n'), nil
+	}
+}
+
+// rotate - Shift Path.N to Path.N+1 and start a new Path, the oldest file is removed
+func (j *Journal) rotate() error {
+	if err := j.file.Close(); err != nil {
+		return err
+	}
+	_ = os.Remove(j.opts.Path + "." + strconv.Itoa(j.opts.MaxFiles))
+	for i := j.opts.MaxFiles - 1; i >= 1; i-- {
+		_ = os.Rename(j.opts.Path+"."+strconv.Itoa(i), j.opts.Path+"."+strconv.Itoa(i+1))
+	}
+	if err := os.Rename(j.opts.Path, j.opts.Path+".1"); err != nil {
+		return err
+	}
+	return j.open()
+}
+
+// Err - Error which stopped the journal, nil while it is writing
+func (j *Journal) Err() error {
+	j.lock.Lock()
+	defer j.lock.Unlock()
+	return j.err
+}
+
+// Close - Stop journaling once the events already received are written, and close the file
+func (j *Journal) Close() error {
+	var err error
+	j.closeOnce.Do(func() {
+		j.dispatcher.Stop()
+		j.lock.Lock()
+		defer j.lock.Unlock()
+		err = j.file.Close()
+		j.file = nil
+		if j.err != nil {
+			err = j.err
+		}
+	})
+	return err
+}
+
+// JournalReader - Reads back the events of a journal file
+type JournalReader struct {
+	reader *bufio.Reader
+	format JournalFormat
+}
+
+// NewJournalReader - Reader of a journal written in format
+func NewJournalReader(r io.Reader, format JournalFormat) *JournalReader {
+	return &JournalReader{reader: bufio.NewReader(r), format: format}
+}
+
+// Next - Next event with the time it was received, io.EOF once the journal is read
+func (jr *JournalReader) Next() (time.Time, *Event, error) {
+	var received time.Time
+	var document []byte
+	switch jr.format {
+	case JournalBinary:
+		var head [12]byte
+		if _, err := io.ReadFull(jr.reader, head[:]); err != nil {
+			if err == io.ErrUnexpectedEOF {
+				return time.Time{}, nil, errors.New("truncated journal record")
+			}
+			return time.Time{}, nil, err
+		}
+		received = time.Unix(0, int64(binary.BigEndian.Uint64(head[:8])))
+		document = make([]byte, binary.BigEndian.Uint32(head[8:]))
+		if _, err := io.ReadFull(jr.reader, document); err != nil {
+			return time.Time{}, nil, errors.New("truncated journal record")
+		}
+	default:
+		line, err := jr.reader.ReadBytes('\n')
+		if len(line) == 0 && err != nil {
+			return time.Time{}, nil, err
+		}
+		var entry journalLine
+		if err := json.Unmarshal(line, &entry); err != nil {
+			return time.Time{}, nil, err
+		}
+		received, document = entry.Time, entry.Event
+	}
+	frame := fmt.Sprintf("Content-Type: %s\nContent-Length: %d\n\n%s", ContentType_EventJSON, len(document), document)
+	event, err := ParseMessage(bufio.NewReader(strings.NewReader(frame)))
+	if err != nil {
+		return time.Time{}, nil, err
+	}
+	return received, event, nil
+}
+
+// ReplayOptions - Options of Replay
+type ReplayOptions struct {
+	Format JournalFormat
+	// Speed - 1 replays with the original pace, 10 ten times faster, 0 as fast as possible
+	Speed float64
+}
+
+// Replay - Feed the events of a journal to the listeners and dispatchers of c, as if they were received.
+// Nothing is sent to freeswitch, c may be a connection made for the replay only
+func (c *ESLConnection) Replay(ctx context.Context, r io.Reader, opts ReplayOptions) error {
+	reader := NewJournalReader(r, opts.Format)
+	var first time.Time
+	started := time.Now()
+	for {
+		received, event, err := reader.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if first.IsZero() {
+			first = received
+		}
+		if opts.Speed > 0 {
+			at := started.Add(time.Duration(float64(received.Sub(first)) / opts.Speed))
+			if wait := time.Until(at); wait > 0 {
+				timer := time.NewTimer(wait)
+				select {
+				case <-timer.C:
+				case <-ctx.Done():
+					timer.Stop()
+					return ctx.Err()
+				}
+			}
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		c.callEventListener(event)
+	}
+}
@@ -0,0 +1,88 @@
+/*
+ * Copyright (c) 2021 LuanDNH
+ *
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at https://mozilla.org/MPL/2.0/.
+ *
+ * Contributor(s):
+ * LuanDNH <luandnh98@gmail.com>
+ */
+
+package goesl
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+)
+
+// jsonApiRequest - Argument of the json api, data is left out when nil
+type jsonApiRequest struct {
+	Command string      `json:"command"`
+	Data    interface{} `json:"data,omitempty"`
+}
+
+// jsonApiReply - Envelope answered by the json api, the request with its status and response
+type jsonApiReply struct {
+	Command  string          `json:"command"`
+	Status   string          `json:"status"`
+	Message  string          `json:"message"`
+	Response json.RawMessage `json:"response"`
+}
+
+// JSONApiError - Unsuccessful json api command, Response is the payload sent along with the error status
+type JSONApiError struct {
+	Command  string
+	Message  string
+	Response json.RawMessage
+}
+
+func (e *JSONApiError) Error() string {
+	return "json api " + e.Command + " failed : " + e.Message
+}
+
+// JSONApi - Run command through the json api of mod_commands, like json {"command":"status"}, and return
+// the response payload of the reply. data is encoded with encoding/json, a json.RawMessage is sent as is
+func (c *ESLConnection) JSONApi(command string, data interface{}) (json.RawMessage, error) {
+	return c.JSONApiWithContext(context.Background(), command, data)
+}
+
+// JSONApiWithContext - Same as JSONApi but give up waiting for the reply when ctx is done
+func (c *ESLConnection) JSONApiWithContext(ctx context.Context, command string, data interface{}) (json.RawMessage, error) {
+	request, err := json.Marshal(jsonApiRequest{Command: command, Data: data})
+	if err != nil {
+		return nil, err
+	}
+	response, err := c.ApiWithContext(ctx, "json "+string(request))
+	if err != nil {
+		return nil, err
+	}
+	body := bytes.TrimSpace(response.Body)
+	if !bytes.HasPrefix(body, []byte("{")) {
+		// mod_commands answers a request it could not parse in plain text
+		return nil, &JSONApiError{Command: command, Message: string(body)}
+	}
+	var reply jsonApiReply
+	if err := json.Unmarshal(body, &reply); err != nil {
+		return nil, errors.New("invalid json api reply : " + err.Error())
+	}
+	if reply.Status != "success" {
+		message := reply.Message
+		if message == "" && json.Unmarshal(reply.Response, &message) != nil {
+			message = string(reply.Response)
+		}
+		return nil, &JSONApiError{Command: command, Message: message, Response: reply.Response}
+	}
+	return reply.Response, nil
+}
+
+// JSONApiInto - Run JSONApi and decode its response payload into v
+func (c *ESLConnection) JSONApiInto(command string, data interface{}, v interface{}) error {
+	response, err := c.JSONApi(command, data)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(response, v)
+}
@@ -0,0 +1,129 @@
+/*
+ * Copyright (c) 2021 LuanDNH
+ *
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at https://mozilla.org/MPL/2.0/.
+ *
+ * Contributor(s):
+ * LuanDNH <luandnh98@gmail.com>
+ */
+
+package goesl
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+)
+
+// LimitUsage - Current usage of a limit resource, backend is hash, db, redis, ...
+func (c *ESLConnection) LimitUsage(backend, realm, id string) (int, error) {
+	response, err := c.query("limit_usage " + backend + " " + realm + " " + id)
+	if err != nil {
+		return 0, err
+	}
+	reply := strings.TrimSpace(string(response.Body))
+	count, err := strconv.Atoi(reply)
+	if err != nil {
+		return 0, errors.New("unexpected limit_usage reply : " + reply)
+	}
+	return count, nil
+}
+
+// LimitRelease - Release the limits held by uuid on a backend, realm and resource may be empty to release all of them
+func (c *ESLConnection) LimitRelease(uuid, backend, realm, resource string) error {
+	cmd := "uuid_limit_release " + uuid + " " + backend
+	if realm != "" {
+		cmd += " " + realm
+		if resource != "" {
+			cmd += " " + resource
+		}
+	}
+	_, err := c.Api(cmd)
+	return err
+}
+
+// HashInsert - Insert a value in the mod_hash realm
+func (c *ESLConnection) HashInsert(realm, key, value string) error {
+	return c.keyValueInsert("hash", realm, key, value)
+}
+
+// HashSelect - Select a value from the mod_hash realm, ok is false when the key does not exist
+func (c *ESLConnection) HashSelect(realm, key string) (value string, ok bool, err error) {
+	return c.keyValueSelect("hash", realm, key)
+}
+
+// HashDelete - Delete a key from the mod_hash realm, deleting a missing key is not an error
+func (c *ESLConnection) HashDelete(realm, key string) error {
+	return c.keyValueDelete("hash", realm, key)
+}
+
+// DBInsert - Insert a value in the mod_db realm
+func (c *ESLConnection) DBInsert(realm, key, value string) error {
+	return c.keyValueInsert("db", realm, key, value)
+}
+
+// DBSelect - Select a value from the mod_db realm, ok is false when the key does not exist
+func (c *ESLConnection) DBSelect(realm, key string) (value string, ok bool, err error) {
+	return c.keyValueSelect("db", realm, key)
+}
+
+// DBDelete - Delete a key from the mod_db realm
+func (c *ESLConnection) DBDelete(realm, key string) error {
+	return c.keyValueDelete("db", realm, key)
+}
+
+// DBExists - Check if a key exists in the mod_db realm
+func (c *ESLConnection) DBExists(realm, key string) (bool, error) {
+	if err := validateKeyValuePath(realm, key); err != nil {
+		return false, err
+	}
+	response, err := c.query("db exists/" + realm + "/" + key)
+	if err != nil {
+		return false, err
+	}
+	return strings.TrimSpace(string(response.Body)) == "true", nil
+}
+
+func (c *ESLConnection) keyValueInsert(api, realm, key, value string) error {
+	if err := validateKeyValuePath(realm, key); err != nil {
+		return err
+	}
+	if err := validateVarValue(value); err != nil {
+		return err
+	}
+	// The value is the last argument, it may contain /
+	_, err := c.Api(api + " insert/" + realm + "/" + key + "/" + value)
+	return err
+}
+
+func (c *ESLConnection) keyValueSelect(api, realm, key string) (string, bool, error) {
+	if err := validateKeyValuePath(realm, key); err != nil {
+		return "", false, err
+	}
+	response, err := c.query(api + " select/" + realm + "/" + key)
+	if err != nil {
+		return "", false, err
+	}
+	value := strings.TrimRight(string(response.Body), "\r\n")
+	return value, value != "", nil
+}
+
+func (c *ESLConnection) keyValueDelete(api, realm, key string) error {
+	if err := validateKeyValuePath(realm, key); err != nil {
+		return err
+	}
+	_, err := c.Api(api + " delete/" + realm + "/" + key)
+	if err != nil && strings.Contains(err.Error(), "Not found") {
+		return nil
+	}
+	return err
+}
+
+func validateKeyValuePath(realm, key string) error {
+	if realm == "" || key == "" || strings.ContainsAny(realm+key, "/ \t\r\n") {
+		return errors.New("invalid realm or key : " + realm + "/" + key)
+	}
+	return nil
+}
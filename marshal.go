@@ -0,0 +1,188 @@
+/*
+ * Copyright (c) 2021 LuanDNH
+ *
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at https://mozilla.org/MPL/2.0/.
+ *
+ * Contributor(s):
+ * LuanDNH <luandnh98@gmail.com>
+ */
+
+package goesl
+
+import (
+	"encoding/json"
+	"errors"
+	"strconv"
+	"strings"
+)
+
+// Marshal - Render the message back to its wire format, as it would be sent by freeswitch.
+// Events are rendered as text/event-plain or text/event-json according to format, plain values are URL encoded.
+// Other messages are rendered with their own content type and format is ignored
+func (r *ESLResponse) Marshal(format string) ([]byte, error) {
+	if !r.IsEvent() {
+		return marshalFrame(r.ContentType, r.frameHeaders(), r.Body), nil
+	}
+	headers := r.eventHeaders()
+	switch format {
+	case EventFormatPlain:
+		var body strings.Builder
+		for _, f := range headers.fields {
+			body.WriteString(f.Name)
+			body.WriteString(": ")
+			body.WriteString(urlEncode(f.Value))
+			body.WriteString("\n")
+		}
+		if len(r.Body) > 0 {
+			body.WriteString("Content-Length: ")
+			body.WriteString(strconv.Itoa(len(r.Body)))
+			body.WriteString("\n\n")
+			body.Write(r.Body)
+		} else {
+			body.WriteString("\n")
+		}
+		return marshalFrame(ContentType_EventPlain, nil, []byte(body.String())), nil
+	case EventFormatJSON:
+		body, err := r.eventJSON()
+		if err != nil {
+			return nil, err
+		}
+		return marshalFrame(ContentType_EventJSON, nil, body), nil
+	}
+	return nil, errors.New("unsupported event format : " + format)
+}
+
+// eventJSON - Event as the json document of text/event-json, the body is carried as _body
+func (r *ESLResponse) eventJSON() ([]byte, error) {
+	headers := r.eventHeaders()
+	if len(r.Body) > 0 {
+		headers.Add("Content-Length", strconv.Itoa(len(r.Body)))
+		headers.Add("_body", string(r.Body))
+	}
+	return json.Marshal(headers)
+}
+
+// Dump - Readable multi-line rendering of the message, one header per line in order followed by the body
+func (r *ESLResponse) Dump() string {
+	var dump strings.Builder
+	dump.WriteString("Content-Type: ")
+	dump.WriteString(r.ContentType)
+	dump.WriteString("\n")
+	for _, f := range r.Headers.fields {
+		if headerKey(f.Name) == "content-type" && f.Value == r.ContentType {
+			continue
+		}
+		dump.WriteString(f.Name)
+		dump.WriteString(": ")
+		dump.WriteString(f.Value)
+		dump.WriteString("\n")
+	}
+	if len(r.Body) > 0 {
+		dump.WriteString("\n")
+		dump.Write(r.Body)
+		if r.Body[len(r.Body)-1] != '\n' {
+			dump.WriteString("\n")
+		}
+	}
+	return dump.String()
+}
+
+// String - Short single line description, the content type followed by the event name and uuid or the reply
+func (r *ESLResponse) String() string {
+	if r == nil {
+		return "<nil>"
+	}
+	if r.IsEvent() {
+		description := r.ContentType + " " + r.GetHeader("Event-Name")
+		if subclass := r.GetHeader("Event-Subclass"); subclass != "" {
+			description += " " + subclass
+		}
+		if uuid := r.GetHeader("Unique-ID"); uuid != "" {
+			description += " " + uuid
+		}
+		return description
+	}
+	reply := strings.TrimSpace(r.GetReply())
+	if i := strings.IndexAny(reply, "\r\n"); i >= 0 {
+		reply = reply[:i] + " ..."
+	}
+	return r.ContentType + " " + strconv.Quote(reply)
+}
+
+// MarshalJSON - Stable json document of the message, {"content_type":...,"headers":{...},"body":...}
+// with headers in order and repeated headers as arrays
+func (r ESLResponse) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		ContentType string  `json:"content_type"`
+		Headers     Headers `json:"headers"`
+		Body        string  `json:"body"`
+	}{r.ContentType, r.Headers, string(r.Body)})
+}
+
+// marshalFrame - Outer frame, Content-Length is computed from body
+func marshalFrame(contentType string, headers []HeaderField, body []byte) []byte {
+	var frame strings.Builder
+	if len(body) > 0 {
+		frame.WriteString("Content-Length: ")
+		frame.WriteString(strconv.Itoa(len(body)))
+		frame.WriteString("\n")
+	}
+	frame.WriteString("Content-Type: ")
+	frame.WriteString(contentType)
+	frame.WriteString("\n")
+	for _, f := range headers {
+		frame.WriteString(f.Name)
+		frame.WriteString(": ")
+		frame.WriteString(f.Value)
+		frame.WriteString("\n")
+	}
+	frame.WriteString("\n")
+	frame.Write(body)
+	return []byte(frame.String())
+}
+
+// frameHeaders - Headers of a non event message, without the framing ones which are rendered again
+func (r *ESLResponse) frameHeaders() []HeaderField {
+	var headers []HeaderField
+	for _, f := range r.Headers.fields {
+		if key := headerKey(f.Name); key != "content-type" && key != "content-length" {
+			headers = append(headers, f)
+		}
+	}
+	return headers
+}
+
+// eventHeaders - Headers carried by the event itself, without the outer frame ones
+func (r *ESLResponse) eventHeaders() Headers {
+	var headers Headers
+	for _, f := range r.Headers.fields {
+		key := headerKey(f.Name)
+		if key == "content-length" || key == "content-type" && strings.HasPrefix(f.Value, "text/event-") {
+			continue
+		}
+		headers.Add(f.Name, f.Value)
+	}
+	return headers
+}
+
+// urlEncode - Encode a header value the way switch_url_encode does for plain events
+func urlEncode(s string) string {
+	const hex = "0123456789ABCDEF"
+	var encoded strings.Builder
+	for i := 0; i < len(s); i++ {
+		b := s[i]
+		if b < ' ' || b > '~' || strings.IndexByte(urlUnsafe, b) >= 0 {
+			encoded.WriteByte('%')
+			encoded.WriteByte(hex[b>>4])
+			encoded.WriteByte(hex[b&0x0f])
+			continue
+		}
+		encoded.WriteByte(b)
+	}
+	return encoded.String()
+}
+
+// urlUnsafe - SWITCH_URL_UNSAFE
+const urlUnsafe = "\r\n \"#%&+:;<=>?@[\\]^`{|}"
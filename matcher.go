@@ -0,0 +1,220 @@
+/*
+ * Copyright (c) 2021 LuanDNH
+ *
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at https://mozilla.org/MPL/2.0/.
+ *
+ * Contributor(s):
+ * LuanDNH <luandnh98@gmail.com>
+ */
+package goesl
+
+import (
+	"errors"
+	"strings"
+)
+
+// EventMatcher - Composable event predicate, built with EventName, HeaderEq, VarEq, And, Or, Not and MatchFunc.
+// Its Match method can be given wherever a func(*Event) bool is wanted, like WaitFor or EventBus.SubscribeMatch
+type EventMatcher interface {
+	Match(event *Event) bool
+	// filters - Header and value pairs of filter commands letting exactly the matched events through,
+	// false when the matcher can't be expressed as filters
+	filters() ([][2]string, bool)
+}
+
+type headerMatcher struct {
+	header string
+	value  string
+}
+
+// HeaderEq - Events where header equals value
+func HeaderEq(header, value string) EventMatcher {
+	return headerMatcher{header: header, value: value}
+}
+
+// VarEq - Events where the channel variable name equals value
+func VarEq(name, value string) EventMatcher {
+	return headerMatcher{header: "variable_" + name, value: value}
+}
+
+// EventName - Events named name, a CUSTOM subclass is given as "CUSTOM sofia::register"
+func EventName(name string) EventMatcher {
+	if strings.HasPrefix(name, EventCustom+" ") {
+		return subclassMatcher(strings.TrimSpace(name[len(EventCustom)+1:]))
+	}
+	return headerMatcher{header: "Event-Name", value: name}
+}
+
+func (m headerMatcher) Match(event *Event) bool {
+	return event.HasHeader(m.header) && event.GetHeader(m.header) == m.value
+}
+
+func (m headerMatcher) filters() ([][2]string, bool) {
+	return [][2]string{{m.header, m.value}}, true
+}
+
+// subclassMatcher - CUSTOM events of a subclass, the subclass alone is enough for the filter
+type subclassMatcher string
+
+func (m subclassMatcher) Match(event *Event) bool {
+	return event.GetHeader("Event-Name") == EventCustom && event.GetHeader("Event-Subclass") == string(m)
+}
+
+func (m subclassMatcher) filters() ([][2]string, bool) {
+	return [][2]string{{"Event-Subclass", string(m)}}, true
+}
+
+type andMatcher []EventMatcher
+
+// And - Events matched by every matcher
+func And(matchers ...EventMatcher) EventMatcher {
+	if len(matchers) == 1 {
+		return matchers[0]
+	}
+	return andMatcher(matchers)
+}
+
+func (m andMatcher) Match(event *Event) bool {
+	for _, matcher := range m {
+		if !matcher.Match(event) {
+			return false
+		}
+	}
+	return true
+}
+
+// filters - An event passes if any filter matches, an intersection can't be expressed
+func (m andMatcher) filters() ([][2]string, bool) {
+	return nil, false
+}
+
+type orMatcher []EventMatcher
+
+// Or - Events matched by any matcher
+func Or(matchers ...EventMatcher) EventMatcher {
+	if len(matchers) == 1 {
+		return matchers[0]
+	}
+	return orMatcher(matchers)
+}
+
+func (m orMatcher) Match(event *Event) bool {
+	for _, matcher := range m {
+		if matcher.Match(event) {
+			return true
+		}
+	}
+	return false
+}
+
+func (m orMatcher) filters() ([][2]string, bool) {
+	var filters [][2]string
+	for _, matcher := range m {
+		f, ok := matcher.filters()
+		if !ok {
+			return nil, false
+		}
+		filters = append(filters, f...)
+	}
+	return filters, len(filters) > 0
+}
+
+type notMatcher struct {
+	matcher EventMatcher
+}
+
+// Not - Events not matched by matcher
+func Not(matcher EventMatcher) EventMatcher {
+	return notMatcher{matcher: matcher}
+}
+
+func (m notMatcher) Match(event *Event) bool {
+	return !m.matcher.Match(event)
+}
+
+func (m notMatcher) filters() ([][2]string, bool) {
+	return nil, false
+}
+
+type funcMatcher func(event *Event) bool
+
+// MatchFunc - Matcher calling fn, it is only evaluated on the client
+func MatchFunc(fn func(event *Event) bool) EventMatcher {
+	return funcMatcher(fn)
+}
+
+func (m funcMatcher) Match(event *Event) bool {
+	return m(event)
+}
+
+func (m funcMatcher) filters() ([][2]string, bool) {
+	return nil, false
+}
+
+// Filter - Send filter header value, once a filter is set freeswitch only sends the events matching one of them
+func (c *ESLConnection) Filter(header, value string) error {
+	if err := validateFilter(header, value); err != nil {
+		return err
+	}
+	_, err := c.Send("filter " + header + " " + value)
+	return err
+}
+
+// FilterDelete - Remove a filter set with Filter
+func (c *ESLConnection) FilterDelete(header, value string) error {
+	if err := validateFilter(header, value); err != nil {
+		return err
+	}
+	_, err := c.Send("filter delete " + header + " " + value)
+	return err
+}
+
+// validateFilter - The value is the rest of the line and is taken as is, it can't be quoted
+func validateFilter(header, value string) error {
+	if header == "" || strings.ContainsAny(header, " \t\r\n") {
+		return errors.New("invalid filter header : " + header)
+	}
+	if strings.ContainsAny(value, "\r\n") {
+		return errors.New("filter value can not contain line breaks")
+	}
+	return nil
+}
+
+// ListenMatching - Call handler with the events matched by m, until the returned function is called.
+// With serverSide m is also sent as filter commands when it can be expressed as such, so freeswitch
+// drops the other events. Filters apply to the whole connection, other consumers stop receiving
+// those events too. Matching stays on the client either way
+func (c *ESLConnection) ListenMatching(m EventMatcher, serverSide bool, handler EventListener) (func() error, error) {
+	var installed [][2]string
+	if serverSide {
+		if filters, ok := m.filters(); ok {
+			for _, filter := range filters {
+				if err := c.Filter(filter[0], filter[1]); err != nil {
+					for _, set := range installed {
+						_ = c.FilterDelete(set[0], set[1])
+					}
+					return nil, err
+				}
+				installed = append(installed, filter)
+			}
+		}
+	}
+	id := c.RegisterEventListener(EventListenAll, func(event *Event) {
+		if m.Match(event) {
+			handler(event)
+		}
+	})
+	return func() error {
+		c.RemoveEventListener(EventListenAll, id)
+		var err error
+		for _, filter := range installed {
+			if deleteErr := c.FilterDelete(filter[0], filter[1]); deleteErr != nil && err == nil {
+				err = deleteErr
+			}
+		}
+		installed = nil
+		return err
+	}, nil
+}
@@ -0,0 +1,105 @@
+/*
+ * Copyright (c) 2021 LuanDNH
+ *
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at https://mozilla.org/MPL/2.0/.
+ *
+ * Contributor(s):
+ * LuanDNH <luandnh98@gmail.com>
+ */
+
+package goesl
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Notify - A NOTIFY event handled by mod_sofia to send a SIP NOTIFY to a registered user
+type Notify struct {
+	Profile string
+	User    string
+	Host    string
+	// EventString - Event header of the NOTIFY, like check-sync or resync
+	EventString string
+	ContentType string
+	Body        string
+}
+
+// MessageWaiting - A MESSAGE_WAITING event turning the voicemail indicator of Account on or off
+type MessageWaiting struct {
+	// Account - Mailbox like 1000@example.com
+	Account   string
+	New       int
+	Old       int
+	UrgentNew int
+	UrgentOld int
+}
+
+// Headers - sendevent headers of the notify, the body is framed separately
+func (n *Notify) Headers() ([]string, error) {
+	if n.Profile == "" || n.User == "" || n.Host == "" || n.EventString == "" {
+		return nil, errors.New("notify needs a profile, user, host and event string")
+	}
+	headers := []string{
+		"profile: " + n.Profile,
+		"user: " + n.User,
+		"host: " + n.Host,
+		"event-string: " + n.EventString,
+	}
+	if n.ContentType != "" {
+		headers = append(headers, "content-type: "+n.ContentType)
+	}
+	return headers, nil
+}
+
+// Headers - sendevent headers of the message waiting indication
+func (m *MessageWaiting) Headers() ([]string, error) {
+	if m.Account == "" {
+		return nil, errors.New("message waiting needs an account")
+	}
+	waiting := "no"
+	if m.New > 0 {
+		waiting = "yes"
+	}
+	return []string{
+		"MWI-Messages-Waiting: " + waiting,
+		"MWI-Message-Account: sip:" + m.Account,
+		fmt.Sprintf("MWI-Voice-Message: %d/%d (%d/%d)", m.New, m.Old, m.UrgentNew, m.UrgentOld),
+	}, nil
+}
+
+// SendNotify - Send the notify with sendevent NOTIFY
+func (c *ESLConnection) SendNotify(notify *Notify) error {
+	headers, err := notify.Headers()
+	if err != nil {
+		return err
+	}
+	_, err = c.SendEvent(EventNotify, headers, notify.Body)
+	return err
+}
+
+// NotifyCheckSync - Ask a phone to check its configuration, reboot=true makes most phones reboot
+func (c *ESLConnection) NotifyCheckSync(profile, user, host string, reboot bool) error {
+	eventString := "check-sync"
+	if reboot {
+		eventString += ";reboot=true"
+	}
+	return c.SendNotify(&Notify{Profile: profile, User: user, Host: host, EventString: eventString})
+}
+
+// NotifyResync - Ask a phone to resync its configuration, the event used by Linksys/Cisco SPA phones
+func (c *ESLConnection) NotifyResync(profile, user, host string) error {
+	return c.SendNotify(&Notify{Profile: profile, User: user, Host: host, EventString: "resync"})
+}
+
+// SendMessageWaiting - Send the message waiting indication with sendevent MESSAGE_WAITING
+func (c *ESLConnection) SendMessageWaiting(mwi *MessageWaiting) error {
+	headers, err := mwi.Headers()
+	if err != nil {
+		return err
+	}
+	_, err = c.SendEvent(EventMessageWaiting, headers, "")
+	return err
+}
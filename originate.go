@@ -0,0 +1,165 @@
+/*
+ * Copyright (c) 2021 LuanDNH
+ *
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at https://mozilla.org/MPL/2.0/.
+ *
+ * Contributor(s):
+ * LuanDNH <luandnh98@gmail.com>
+ */
+
+package goesl
+
+import (
+	"context"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var dialVariableReplacer = strings.NewReplacer(",", `\,`, "}", `\}`)
+
+// Dialstring - Prefix endpoint with a {var=value,...} block of channel variables, keys are sorted
+func Dialstring(vars map[string]string, endpoint string) string {
+	if len(vars) == 0 {
+		return endpoint
+	}
+	keys := make([]string, 0, len(vars))
+	for k := range vars {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	pairs := make([]string, 0, len(keys))
+	for _, k := range keys {
+		pairs = append(pairs, k+"="+dialVariableReplacer.Replace(vars[k]))
+	}
+	return "{" + strings.Join(pairs, ",") + "}" + endpoint
+}
+
+// OriginateSpec - Call placed by DialCall
+type OriginateSpec struct {
+	// Endpoint - Dialed endpoint, like "user/1000" or "sofia/gateway/gw1/0123456789"
+	Endpoint string
+	// Variables - Channel variables of the new leg, origination_uuid is added when missing
+	Variables map[string]string
+	// App - Where the answered leg goes, "&park()" when empty
+	App string
+	// Timeout - Ring timeout sent as originate_timeout, freeswitch default when zero
+	Timeout time.Duration
+}
+
+// OriginateError - DialCall failure, with the hangup cause of the leg when freeswitch gave one
+type OriginateError struct {
+	UUID  string
+	Cause HangupCause
+	// Reply - Result of the originate job, like "-ERR USER_BUSY", empty when the cause comes from a hangup event
+	Reply string
+}
+
+func (e *OriginateError) Error() string {
+	if e.Reply != "" {
+		return "originate failed : " + e.Reply
+	}
+	return "originate failed : " + e.Cause.String()
+}
+
+// DialCall - Originate spec with bgapi and wait for the leg to be answered. A leg which does not answer
+// fails with an *OriginateError carrying its hangup cause. When ctx is done first the leg is hung up with ORIGINATOR_CANCEL
+func (c *ESLConnection) DialCall(ctx context.Context, spec OriginateSpec) (*Call, error) {
+	vars := make(map[string]string, len(spec.Variables)+2)
+	for k, v := range spec.Variables {
+		vars[k] = v
+	}
+	if vars["origination_uuid"] == "" {
+		vars["origination_uuid"] = newUUID()
+	}
+	if spec.Timeout > 0 {
+		vars["originate_timeout"] = strconv.Itoa(int((spec.Timeout + time.Second - 1) / time.Second))
+	}
+	app := spec.App
+	if app == "" {
+		app = "&park()"
+	}
+	uuid := vars["origination_uuid"]
+
+	call, err := c.TrackCall(uuid)
+	if err != nil {
+		return nil, err
+	}
+	if !c.outbound {
+		if err := c.subscribeInternal(EventBackgroundJob); err != nil {
+			call.stop()
+			return nil, err
+		}
+		defer c.Unsubscribe(EventBackgroundJob)
+	}
+	// The Job-UUID is chosen here so the job result can not be missed before the reply is read
+	jobUUID := newUUID()
+	result := make(chan string, 1)
+	listenerID := c.RegisterEventListener(EventListenAll, func(event *Event) {
+		if event.GetHeader("Event-Name") == EventBackgroundJob && event.GetHeader("Job-UUID") == jobUUID {
+			select {
+			case result <- strings.TrimSpace(string(event.Body)):
+			default:
+			}
+		}
+	})
+	defer c.RemoveEventListener(EventListenAll, listenerID)
+
+	frame, err := buildFrame("bgapi "+Command("originate", Dialstring(vars, spec.Endpoint), app), []string{"Job-UUID: " + jobUUID}, "")
+	if err != nil {
+		call.stop()
+		return nil, err
+	}
+	if _, err := c.sendFrame(ctx, frame); err != nil {
+		call.stop()
+		return nil, err
+	}
+	select {
+	case <-call.answer:
+		return call, nil
+	case reply := <-result:
+		if strings.HasPrefix(reply, "+OK") {
+			// The job only succeeds once the leg answered, CHANNEL_ANSWER may still be on its way
+			return call, nil
+		}
+		call.stop()
+		cause, _ := ParseHangupCause(strings.TrimSpace(strings.TrimPrefix(reply, "-ERR")))
+		return nil, &OriginateError{UUID: uuid, Cause: cause, Reply: reply}
+	case <-call.Done():
+		select {
+		case <-call.answer:
+			return call, nil
+		default:
+		}
+		if err := c.Err(); err != nil {
+			return nil, err
+		}
+		return nil, &OriginateError{UUID: uuid, Cause: call.HangupCause()}
+	case <-ctx.Done():
+		call.stop()
+		_, _ = c.Api("uuid_kill " + uuid + " " + HangupCauseOriginatorCancel.String())
+		return nil, ctx.Err()
+	}
+}
+
+// Originate - Originate endpoint with vars and connect it to app, like "&park()" or an extension.
+// It blocks until the call is answered or fails, the uuid of the new channel is returned
+func (c *ESLConnection) Originate(ctx context.Context, endpoint string, vars map[string]string, app string) (string, error) {
+	uuid := vars["origination_uuid"]
+	if uuid == "" {
+		uuid = newUUID()
+		withUUID := make(map[string]string, len(vars)+1)
+		for k, v := range vars {
+			withUUID[k] = v
+		}
+		withUUID["origination_uuid"] = uuid
+		vars = withUUID
+	}
+	if _, err := c.ApiWithContext(ctx, Command("originate", Dialstring(vars, endpoint), app)); err != nil {
+		return "", err
+	}
+	return uuid, nil
+}
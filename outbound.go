@@ -0,0 +1,222 @@
+/*
+ * Copyright (c) 2021 LuanDNH
+ *
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at https://mozilla.org/MPL/2.0/.
+ *
+ * Contributor(s):
+ * LuanDNH <luandnh98@gmail.com>
+ */
+
+package goesl
+
+import (
+	"context"
+	"net"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// outboundConnectTimeout - Longest wait for the channel data once a socket application connected
+const outboundConnectTimeout = 10 * time.Second
+
+// OutboundHandler - Serves the channels connected by the socket dialplan application, like http.Handler.
+// data is the reply of connect, the channel data. The connection is closed once ServeOutbound returns
+type OutboundHandler interface {
+	ServeOutbound(c *ESLConnection, data *ESLResponse)
+}
+
+// OutboundHandlerFunc - Func used as OutboundHandler
+type OutboundHandlerFunc func(c *ESLConnection, data *ESLResponse)
+
+// ServeOutbound - Call f
+func (f OutboundHandlerFunc) ServeOutbound(c *ESLConnection, data *ESLResponse) {
+	f(c, data)
+}
+
+// OutboundServer - Listener for the socket dialplan application, each channel is served by the handler
+// in its own goroutine
+type OutboundServer struct {
+	// MyEvents - Event format, when set myevents is sent right after connect so the handler receives
+	// the events of its channel. Set it before Serve
+	MyEvents string
+	// Linger - Send linger right after connect, the connection stays open after the hangup until the
+	// remaining events, CHANNEL_HANGUP_COMPLETE included, are received. Set it before Serve
+	Linger bool
+
+	handler OutboundHandler
+	opts    Options
+
+	lock        sync.Mutex
+	listener    net.Listener
+	connections map[*ESLConnection]struct{}
+	closed      bool
+	wg          sync.WaitGroup
+}
+
+// NewOutboundServer - Server calling handler for every channel, the connections are made with opts as RoleOutbound
+func NewOutboundServer(handler OutboundHandler, opts Options) *OutboundServer {
+	opts.Role = RoleOutbound
+	return &OutboundServer{
+		handler:     handler,
+		opts:        opts,
+		connections: make(map[*ESLConnection]struct{}),
+	}
+}
+
+// ListenAndServe - Listen on the tcp address and Serve
+func (s *OutboundServer) ListenAndServe(address string) error {
+	listener, err := net.Listen("tcp", address)
+	if err != nil {
+		return err
+	}
+	return s.Serve(listener)
+}
+
+// Serve - Accept channels on listener until Close, nil is returned once closed
+func (s *OutboundServer) Serve(listener net.Listener) error {
+	s.lock.Lock()
+	if s.closed {
+		s.lock.Unlock()
+		listener.Close()
+		return ErrConnectionClosed
+	}
+	s.listener = listener
+	s.lock.Unlock()
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			s.lock.Lock()
+			closed := s.closed
+			s.lock.Unlock()
+			if closed {
+				return nil
+			}
+			return err
+		}
+		c := NewConnectionFromConn(conn, s.opts)
+		s.lock.Lock()
+		if s.closed {
+			s.lock.Unlock()
+			c.Close()
+			continue
+		}
+		s.connections[c] = struct{}{}
+		s.wg.Add(1)
+		s.lock.Unlock()
+		go s.serve(c)
+	}
+}
+
+// serve - Ask for the channel data and hand the channel to the handler
+func (s *OutboundServer) serve(c *ESLConnection) {
+	defer s.wg.Done()
+	defer func() {
+		c.Close()
+		s.lock.Lock()
+		delete(s.connections, c)
+		s.lock.Unlock()
+	}()
+	ctx, cancel := context.WithTimeout(c.runningContext, outboundConnectTimeout)
+	data, err := c.Connect(ctx)
+	cancel()
+	if err != nil {
+		c.logger.Warn("outbound connect failed : %v", err)
+		return
+	}
+	if s.Linger {
+		if err := c.Linger(0); err != nil {
+			c.logger.Warn("outbound linger failed : %v", err)
+			return
+		}
+	}
+	if s.MyEvents != "" {
+		if err := c.MyEvents(s.MyEvents, ""); err != nil {
+			c.logger.Warn("outbound myevents failed : %v", err)
+			return
+		}
+	}
+	c.runHandler("outbound handler", func() { s.handler.ServeOutbound(c, data) })
+}
+
+// Close - Stop accepting channels and close the connections being served, then wait for their handlers to return
+func (s *OutboundServer) Close() error {
+	s.lock.Lock()
+	s.closed = true
+	listener := s.listener
+	connections := make([]*ESLConnection, 0, len(s.connections))
+	for c := range s.connections {
+		connections = append(connections, c)
+	}
+	s.lock.Unlock()
+	var err error
+	if listener != nil {
+		err = listener.Close()
+	}
+	for _, c := range connections {
+		c.Close()
+	}
+	s.wg.Wait()
+	return err
+}
+
+// Connections - Number of channels being served
+func (s *OutboundServer) Connections() int {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return len(s.connections)
+}
+
+// ChannelData - Channel data sent by freeswitch in reply to connect on an outbound connection
+type ChannelData struct {
+	ChannelInfo
+	// SocketMode - async when the socket application was started with async, static otherwise
+	SocketMode string
+	// Control - full when the socket application was started with full, single-channel otherwise
+	Control string
+}
+
+// Connect - Send connect on an outbound connection, the reply carries the channel data which is
+// then available from ChannelData
+func (c *ESLConnection) Connect(ctx context.Context) (*ESLResponse, error) {
+	response, err := c.SendWithContext(ctx, "connect")
+	if err != nil {
+		return nil, err
+	}
+	headers := response.Headers.Map()
+	data := &ChannelData{
+		ChannelInfo: *newChannelInfo(headers),
+		SocketMode:  headers["Socket-Mode"],
+		Control:     headers["Control"],
+	}
+	c.channelDataLock.Lock()
+	c.channelData = data
+	c.channelDataLock.Unlock()
+	return response, nil
+}
+
+// ChannelData - Channel data received by Connect, nil before it or on an inbound connection
+func (c *ESLConnection) ChannelData() *ChannelData {
+	c.channelDataLock.Lock()
+	defer c.channelDataLock.Unlock()
+	return c.channelData
+}
+
+// Linger - Keep an outbound connection open after the channel hangs up, so its last events are received.
+// freeswitch closes it after timeout, or once the events are sent when timeout is 0
+func (c *ESLConnection) Linger(timeout time.Duration) error {
+	cmd := "linger"
+	if timeout > 0 {
+		cmd += " " + strconv.Itoa(int((timeout+time.Second-1)/time.Second))
+	}
+	_, err := c.Send(cmd)
+	return err
+}
+
+// NoLinger - Cancel Linger, the connection is closed as soon as the channel hangs up
+func (c *ESLConnection) NoLinger() error {
+	_, err := c.Send("nolinger")
+	return err
+}
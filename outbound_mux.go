@@ -0,0 +1,92 @@
+/*
+ * Copyright (c) 2021 LuanDNH
+ *
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at https://mozilla.org/MPL/2.0/.
+ *
+ * Contributor(s):
+ * LuanDNH <luandnh98@gmail.com>
+ */
+
+package goesl
+
+import (
+	"sync"
+)
+
+// OutboundMux - OutboundHandler routing each channel to the first route matching its channel data,
+// in the order the routes were added, like http.ServeMux. Routes may be added while serving
+type OutboundMux struct {
+	lock     sync.RWMutex
+	routes   []outboundRoute
+	notFound OutboundHandler
+}
+
+type outboundRoute struct {
+	match   EventMatcher
+	handler OutboundHandler
+}
+
+// NewOutboundMux - Mux without routes, channels matching no route are left to the dialplan
+func NewOutboundMux() *OutboundMux {
+	return &OutboundMux{}
+}
+
+// Handle - Route the channels whose channel data is matched by match to handler
+func (m *OutboundMux) Handle(match EventMatcher, handler OutboundHandler) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	m.routes = append(m.routes, outboundRoute{match: match, handler: handler})
+}
+
+// HandleFunc - Same as Handle for a func
+func (m *OutboundMux) HandleFunc(match EventMatcher, handler func(c *ESLConnection, data *ESLResponse)) {
+	m.Handle(match, OutboundHandlerFunc(handler))
+}
+
+// HandleDestination - Route the channels dialing number, their Caller-Destination-Number
+func (m *OutboundMux) HandleDestination(number string, handler OutboundHandler) {
+	m.Handle(HeaderEq("Caller-Destination-Number", number), handler)
+}
+
+// HandleContext - Route the channels of the dialplan context, their Caller-Context
+func (m *OutboundMux) HandleContext(context string, handler OutboundHandler) {
+	m.Handle(HeaderEq("Caller-Context", context), handler)
+}
+
+// HandleVariable - Route the channels where the channel variable name equals value,
+// like a variable set in the dialplan before the socket application
+func (m *OutboundMux) HandleVariable(name, value string, handler OutboundHandler) {
+	m.Handle(VarEq(name, value), handler)
+}
+
+// NotFound - Handler of the channels matching no route. Without one the connection is closed
+// and the channel goes on with the dialplan, or hangs up when the socket application is not async
+func (m *OutboundMux) NotFound(handler OutboundHandler) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	m.notFound = handler
+}
+
+// Handler - Handler the channel data is routed to, nil when no route matches and there is no NotFound handler
+func (m *OutboundMux) Handler(data *ESLResponse) OutboundHandler {
+	m.lock.RLock()
+	defer m.lock.RUnlock()
+	for _, route := range m.routes {
+		if route.match.Match(data) {
+			return route.handler
+		}
+	}
+	return m.notFound
+}
+
+// ServeOutbound - Serve the channel with the handler it is routed to
+func (m *OutboundMux) ServeOutbound(c *ESLConnection, data *ESLResponse) {
+	handler := m.Handler(data)
+	if handler == nil {
+		c.logger.Warn("no outbound route for %s to %s", data.GetHeader("Unique-ID"), data.GetHeader("Caller-Destination-Number"))
+		return
+	}
+	handler.ServeOutbound(c, data)
+}
@@ -0,0 +1,51 @@
+/*
+ * Copyright (c) 2021 LuanDNH
+ *
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at https://mozilla.org/MPL/2.0/.
+ *
+ * Contributor(s):
+ * LuanDNH <luandnh98@gmail.com>
+ */
+package goesl
+
+import (
+	"fmt"
+	"runtime/debug"
+)
+
+// PanicError - A panic recovered in the read loop or in a handler
+type PanicError struct {
+	// Where - Part of the connection which panicked, like "read loop" or "event listener"
+	Where string
+	Value interface{}
+	Stack []byte
+}
+
+func (e *PanicError) Error() string {
+	return fmt.Sprintf("panic in %s : %v", e.Where, e.Value)
+}
+
+// recoverPanic - Deferred by the read loop and around user handlers. The panic is logged and given to
+// Options.OnPanic, err is set when the caller turns it into an error
+func (c *ESLConnection) recoverPanic(where string, err *error) {
+	value := recover()
+	if value == nil {
+		return
+	}
+	panicErr := &PanicError{Where: where, Value: value, Stack: debug.Stack()}
+	c.logger.Error("%v\n%s", panicErr, panicErr.Stack)
+	if err != nil {
+		*err = panicErr
+	}
+	if c.onPanic != nil {
+		c.onPanic(panicErr)
+	}
+}
+
+// runHandler - Call a user handler, a panic only ends the handler
+func (c *ESLConnection) runHandler(where string, handler func()) {
+	defer c.recoverPanic(where, nil)
+	handler()
+}
@@ -0,0 +1,71 @@
+/*
+ * Copyright (c) 2021 LuanDNH
+ *
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at https://mozilla.org/MPL/2.0/.
+ *
+ * Contributor(s):
+ * LuanDNH <luandnh98@gmail.com>
+ */
+
+package goesl
+
+import (
+	"context"
+	"strings"
+)
+
+// Park - Park the channel uuid, it waits without media until it is told what to do.
+// An outbound connection executes park, uuid may be empty for its own channel, an inbound one runs uuid_park.
+// Errors match ErrChannelNotFound when the channel is gone
+func (c *ESLConnection) Park(ctx context.Context, uuid string) error {
+	if c.outbound {
+		_, err := c.SendMsgWithContext(ctx, uuid, executeHeaders("park", "", nil), "")
+		return err
+	}
+	if response, err := c.ApiWithContext(ctx, "uuid_park "+uuid); err != nil {
+		if response != nil {
+			return &BridgeError{Reply: strings.TrimSpace(strings.TrimPrefix(response.GetReply(), "-ERR"))}
+		}
+		return err
+	}
+	return nil
+}
+
+// ParkAndWait - Park the channel uuid and wait for the first event matched by match, like a DTMF or the CUSTOM
+// event of a backend which decided what to do with the call. Only the events of the channel and the events of
+// no channel are matched. The channel stays parked, ErrChannelNotFound is returned when it hangs up first.
+// On an inbound connection events and CHANNEL_HANGUP are subscribed while waiting, an outbound connection
+// must use myevents
+func (c *ESLConnection) ParkAndWait(ctx context.Context, uuid string, match EventMatcher, events ...string) (*Event, error) {
+	if !c.outbound {
+		subscribed := append([]string{EventChannelHangup}, events...)
+		if err := c.subscribeInternal(subscribed...); err != nil {
+			return nil, err
+		}
+		defer c.Unsubscribe(subscribed...)
+	}
+	waiter := c.newEventWaiter(EventListenAll, func(event *Event) bool {
+		channel := event.GetHeader("Unique-ID")
+		if uuid != "" && channel != "" && channel != uuid {
+			return false
+		}
+		// The hangup of the channel ends the wait too
+		return match.Match(event) || channel != "" && event.GetHeader("Event-Name") == EventChannelHangup
+	})
+	defer waiter.Close()
+
+	if err := c.Park(ctx, uuid); err != nil {
+		return nil, err
+	}
+	event, err := waiter.Wait(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if event.GetHeader("Event-Name") == EventChannelHangup && !match.Match(event) {
+		event.Release()
+		return nil, ErrChannelNotFound
+	}
+	return event, nil
+}
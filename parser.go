@@ -0,0 +1,221 @@
+/*
+ * Copyright (c) 2021 LuanDNH
+ *
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at https://mozilla.org/MPL/2.0/.
+ *
+ * Contributor(s):
+ * LuanDNH <luandnh98@gmail.com>
+ */
+
+package goesl
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// DefaultMaxHeaderSize - Default limit of the header block of a message, see Options.MaxHeaderSize
+const DefaultMaxHeaderSize = 1 << 20
+
+// frameHeaderCapacity - Lines expected in a frame header, Content-Type and Content-Length for events
+const frameHeaderCapacity = 4
+
+// bodyPreallocLimit - Bodies above this size are read as they arrive rather than allocated up front,
+// a bogus Content-Length must not allocate gigabytes before the body turns out truncated
+const bodyPreallocLimit = 1 << 20
+
+// messageParser - Frame parser shared by connections and ParseMessage
+type messageParser struct {
+	reader        *bufio.Reader
+	logger        Logger
+	mode          ParseMode
+	decoding      HeaderDecoding
+	maxFrameSize  int
+	maxHeaderSize int
+	// pool - Messages come from responsePool, see Options.PoolResponses
+	pool bool
+	// streamReply - Tells if the reply being read should be streamed, nil when streaming is not possible
+	streamReply func() bool
+	// onReceive - Tracer of the messages read, see Options.Tracer
+	onReceive func(headers *Headers, body []byte)
+	// stats - Counts the malformed frames of a connection, nil otherwise
+	stats *connectionStats
+}
+
+func newMessageParser(r *bufio.Reader, opts Options) messageParser {
+	if opts.Logger == nil {
+		opts.Logger = NilLogger{}
+	}
+	if opts.MaxHeaderSize <= 0 {
+		opts.MaxHeaderSize = DefaultMaxHeaderSize
+	}
+	parser := messageParser{
+		reader:        r,
+		logger:        opts.Logger,
+		mode:          opts.ParseMode,
+		decoding:      opts.HeaderDecoding,
+		maxFrameSize:  opts.MaxFrameSize,
+		maxHeaderSize: opts.MaxHeaderSize,
+		pool:          opts.PoolResponses,
+	}
+	if opts.Tracer != nil {
+		parser.onReceive = opts.Tracer.OnReceive
+	}
+	return parser
+}
+
+// ParseMessage - Read a single message from r, without a connection. It is meant for proxies, tests and fuzzing,
+// the message is parsed with the default options
+func ParseMessage(r *bufio.Reader) (*ESLResponse, error) {
+	return ParseMessageWithOptions(r, Options{})
+}
+
+// ParseMessageWithOptions - Same as ParseMessage honoring the parsing fields of opts: Logger, ParseMode,
+// HeaderDecoding, MaxFrameSize, MaxHeaderSize, PoolResponses and Tracer
+func ParseMessageWithOptions(r *bufio.Reader, opts Options) (*ESLResponse, error) {
+	parser := newMessageParser(r, opts)
+	return parser.parse()
+}
+
+func (p *messageParser) parse() (*ESLResponse, error) {
+	header, err := readHeaders(p.reader, frameHeaderCapacity, p.maxHeaderSize, p.mode == ParseLenient, p.logger)
+	if err != nil {
+		return nil, err
+	}
+	var response *ESLResponse
+	if p.pool {
+		response = newPooledResponse()
+	} else {
+		response = &ESLResponse{}
+	}
+	response.ContentType = header.Get("Content-Type")
+
+	if response.ContentType == "" && p.mode == ParseStrict {
+		p.stats.malformed()
+		return nil, fmt.Errorf("Parse EOF")
+	}
+
+	contentType := response.ContentType
+	decoder, pooled, ok := lookupContentDecoder(contentType)
+
+	// Only the reply to the command waiting for it may be streamed, events are read as usual
+	stream := !response.IsEvent() && p.streamReply != nil && p.streamReply()
+	var buffer *[]byte
+	if contentLength := header.Get("Content-Length"); len(contentLength) > 0 {
+		length, err := strconv.Atoi(strings.TrimSpace(contentLength))
+		if err != nil || length < 0 {
+			p.stats.malformed()
+			return nil, errors.New("invalid content-length : " + contentLength)
+		}
+		if stream && response.ContentType == ContentType_APIResponse && !p.peekErrorReply(length) {
+			response.stream = newReplyStream(p.reader, int64(length))
+		} else {
+			if p.maxFrameSize > 0 && length > p.maxFrameSize {
+				// The socket can't be resynchronized without reading the body, the read loop ends
+				p.stats.malformed()
+				return nil, fmt.Errorf("frame of %d bytes is larger than the %d bytes allowed", length, p.maxFrameSize)
+			}
+			if pooled && length <= maxPooledBody {
+				// The raw body of a built in event is dropped once decoded, its buffer can be reused
+				buffer = getBodyBuffer(length)
+				response.Body = *buffer
+				_, err = io.ReadFull(p.reader, response.Body)
+			} else {
+				response.Body, err = readBody(p.reader, length)
+			}
+			if err != nil {
+				return response, err
+			}
+		}
+	}
+
+	if p.onReceive != nil {
+		// Before decoding, the body of a built in event is dropped once decoded
+		p.onReceive(&header, response.Body)
+	}
+	response.Headers = header
+	if !ok {
+		if p.mode == ParseStrict {
+			p.stats.malformed()
+			return nil, errors.New(fmt.Sprintf("%s is not allowed", contentType))
+		}
+		// Pass the frame through as received
+		p.unescapeHeaders(response)
+		return response, nil
+	}
+	if err := decoder(response, p.logger); err != nil {
+		p.stats.malformed()
+		if p.mode == ParseStrict {
+			putBodyBuffer(buffer)
+			return nil, err
+		}
+		// The raw body is kept, its buffer leaves the pool
+		p.logger.Warn("keeping raw %s message : %v", contentType, err)
+	} else {
+		putBodyBuffer(buffer)
+	}
+	p.unescapeHeaders(response)
+	return response, nil
+}
+
+// readBody - Read length bytes, large bodies grow as they arrive
+func readBody(r io.Reader, length int) ([]byte, error) {
+	if length <= bodyPreallocLimit {
+		body := make([]byte, length)
+		_, err := io.ReadFull(r, body)
+		return body, err
+	}
+	var body bytes.Buffer
+	body.Grow(bodyPreallocLimit)
+	n, err := io.CopyN(&body, r, int64(length))
+	if err == io.EOF && n < int64(length) {
+		err = io.ErrUnexpectedEOF
+	}
+	return body.Bytes(), err
+}
+
+// peekErrorReply - Check if the body about to be read is a -ERR reply, those are read in memory to be returned as errors
+func (p *messageParser) peekErrorReply(length int) bool {
+	n := len("-ERR")
+	if length < n {
+		return false
+	}
+	prefix, err := p.reader.Peek(n)
+	return err == nil && string(prefix) == "-ERR"
+}
+
+// unescapeHeaders - URL decode header values according to the HeaderDecoding of the parser
+func (p *messageParser) unescapeHeaders(response *ESLResponse) {
+	switch p.decoding {
+	case HeaderDecodingNever:
+		return
+	case HeaderDecodingAuto:
+		if response.ContentType == ContentType_EventJSON {
+			return
+		}
+	case HeaderDecodingPlainEvents:
+		if response.ContentType != ContentType_EventPlain {
+			return
+		}
+	}
+	for i, f := range response.Headers.fields {
+		if !strings.Contains(f.Value, "%") {
+			continue
+		}
+		// PathUnescape keeps +, freeswitch encodes it as %2B
+		value, err := url.PathUnescape(f.Value)
+		if err != nil {
+			p.logger.Warn("fail to decode header %s : %v", f.Name, err)
+			continue
+		}
+		response.Headers.fields[i].Value = value
+	}
+}
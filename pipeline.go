@@ -0,0 +1,59 @@
+/*
+ * Copyright (c) 2021 LuanDNH
+ *
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at https://mozilla.org/MPL/2.0/.
+ *
+ * Contributor(s):
+ * LuanDNH <luandnh98@gmail.com>
+ */
+package goesl
+
+import "context"
+
+// PendingReply - A command written with SendPipelined, waiting for its reply
+type PendingReply struct {
+	connection *ESLConnection
+	req        *request
+}
+
+// SendPipelined - Write a command and return once it is written, without waiting for its reply.
+// Replies come back in the order commands were written, so many commands can be in flight at once.
+// Options.MaxInFlight caps how many
+func (c *ESLConnection) SendPipelined(ctx context.Context, cmd string) (*PendingReply, error) {
+	req, err := c.submit(ctx, commandFrame(cmd), false)
+	if err != nil {
+		return nil, err
+	}
+	return &PendingReply{connection: c, req: req}, nil
+}
+
+// Wait - Wait for the reply, an unsuccessful reply (-ERR) is returned along with an error.
+// Giving up on a reply keeps its place, it is not taken by the next command
+func (p *PendingReply) Wait(ctx context.Context) (*ESLResponse, error) {
+	return p.connection.waitReply(ctx, p.req)
+}
+
+// Pipeline - Write every command without waiting in between, then wait for their replies.
+// responses[i] and errs[i] are the result of cmds[i], a command which could not be written fails
+// along with the ones after it
+func (c *ESLConnection) Pipeline(ctx context.Context, cmds ...string) (responses []*ESLResponse, errs []error) {
+	responses = make([]*ESLResponse, len(cmds))
+	errs = make([]error, len(cmds))
+	pending := make([]*PendingReply, 0, len(cmds))
+	for i, cmd := range cmds {
+		reply, err := c.SendPipelined(ctx, cmd)
+		if err != nil {
+			for j := i; j < len(cmds); j++ {
+				errs[j] = err
+			}
+			break
+		}
+		pending = append(pending, reply)
+	}
+	for i, reply := range pending {
+		responses[i], errs[i] = reply.Wait(ctx)
+	}
+	return responses, errs
+}
@@ -0,0 +1,135 @@
+/*
+ * Copyright (c) 2021 LuanDNH
+ *
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at https://mozilla.org/MPL/2.0/.
+ *
+ * Contributor(s):
+ * LuanDNH <luandnh98@gmail.com>
+ */
+
+package goesl
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"time"
+)
+
+// PlaybackOptions - Options of Playback
+type PlaybackOptions struct {
+	// Terminators - DTMF digits stopping the playback, like "#" or "any", set as playback_terminators
+	Terminators string
+	Loops       int
+}
+
+// PlaybackResult - Outcome of a playback
+type PlaybackResult struct {
+	// Response - Application-Response, FILE PLAYED, FILE NOT FOUND, ...
+	Response string
+	// Terminator - DTMF digit which stopped the playback, if any
+	Terminator string
+}
+
+// PlayAndGetDigitsParams - Arguments of play_and_get_digits
+type PlayAndGetDigitsParams struct {
+	Min         int
+	Max         int
+	Tries       int
+	Timeout     time.Duration
+	Terminators string
+	File        string
+	InvalidFile string
+	// VarName - Channel variable receiving the digits, defaults to goesl_digits
+	VarName string
+	// Regexp - Digits must match it to be valid, defaults to \d+
+	Regexp       string
+	DigitTimeout time.Duration
+}
+
+// DigitsResult - Digits collected by play_and_get_digits
+type DigitsResult struct {
+	Digits     string
+	Terminator string
+}
+
+// Playback - Play file on uuid and wait until it is done
+func (c *ESLConnection) Playback(ctx context.Context, uuid, file string, opts *PlaybackOptions) (*PlaybackResult, error) {
+	return c.executeMedia(ctx, uuid, "playback", file, opts)
+}
+
+// executeMedia - Run a media application honoring playback_terminators and wait until it is done
+func (c *ESLConnection) executeMedia(ctx context.Context, uuid, app, arg string, opts *PlaybackOptions) (*PlaybackResult, error) {
+	execOpts := &ExecuteOptions{EventLock: true}
+	if opts != nil {
+		execOpts.Loops = opts.Loops
+		if opts.Terminators != "" {
+			if _, err := c.Execute(uuid, "set", "playback_terminators="+opts.Terminators, &ExecuteOptions{EventLock: true}); err != nil {
+				return nil, err
+			}
+		}
+	}
+	event, err := c.ExecuteAndWait(ctx, uuid, app, arg, execOpts)
+	if err != nil {
+		return nil, err
+	}
+	return &PlaybackResult{
+		Response:   event.GetHeader("Application-Response"),
+		Terminator: event.GetHeader("variable_playback_terminator_used"),
+	}, nil
+}
+
+// PlayAndGetDigits - Run play_and_get_digits on uuid and return the collected digits
+func (c *ESLConnection) PlayAndGetDigits(ctx context.Context, uuid string, params PlayAndGetDigitsParams) (*DigitsResult, error) {
+	if params.File == "" {
+		return nil, errors.New("play_and_get_digits needs a file")
+	}
+	if params.VarName == "" {
+		params.VarName = "goesl_digits"
+	}
+	if params.Regexp == "" {
+		params.Regexp = `\d+`
+	}
+	if params.Tries <= 0 {
+		params.Tries = 1
+	}
+	if params.Min <= 0 {
+		params.Min = 1
+	}
+	if params.Max < params.Min {
+		params.Max = params.Min
+	}
+	if params.Terminators == "" {
+		params.Terminators = "none"
+	}
+	if params.Timeout <= 0 {
+		params.Timeout = 5 * time.Second
+	}
+	invalidFile := params.InvalidFile
+	if invalidFile == "" {
+		invalidFile = "silence_stream://250"
+	}
+	arg := Command(strconv.Itoa(params.Min),
+		strconv.Itoa(params.Max),
+		strconv.Itoa(params.Tries),
+		strconv.Itoa(int(params.Timeout/time.Millisecond)),
+		params.Terminators,
+		params.File,
+		invalidFile,
+		params.VarName,
+		params.Regexp,
+	)
+	if params.DigitTimeout > 0 {
+		arg += " " + strconv.Itoa(int(params.DigitTimeout/time.Millisecond))
+	}
+	event, err := c.ExecuteAndWait(ctx, uuid, "play_and_get_digits", arg, &ExecuteOptions{EventLock: true})
+	if err != nil {
+		return nil, err
+	}
+	return &DigitsResult{
+		Digits:     event.GetHeader("variable_" + params.VarName),
+		Terminator: event.GetHeader("variable_read_terminator_used"),
+	}, nil
+}
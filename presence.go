@@ -0,0 +1,181 @@
+/*
+ * Copyright (c) 2021 LuanDNH
+ *
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at https://mozilla.org/MPL/2.0/.
+ *
+ * Contributor(s):
+ * LuanDNH <luandnh98@gmail.com>
+ */
+package goesl
+
+import (
+	"strings"
+	"sync"
+)
+
+// presenceEvents - Events a PresenceTracker follows
+var presenceEvents = []string{EventPresenceIn, EventPresenceProbe}
+
+// PresenceState - BLF state of a user, from the dialogs of its PRESENCE_IN events
+type PresenceState int
+
+const (
+	// PresenceIdle - No dialog
+	PresenceIdle PresenceState = iota
+	// PresenceRinging - Early dialogs only
+	PresenceRinging
+	// PresenceOnCall - At least one confirmed dialog
+	PresenceOnCall
+)
+
+func (s PresenceState) String() string {
+	switch s {
+	case PresenceIdle:
+		return "idle"
+	case PresenceRinging:
+		return "ringing"
+	case PresenceOnCall:
+		return "on-call"
+	}
+	return "unknown"
+}
+
+// PresenceChange - State change of a user reported by a PresenceTracker
+type PresenceChange struct {
+	// User - user@domain as sent in the from header of PRESENCE_IN
+	User     string
+	Previous PresenceState
+	State    PresenceState
+}
+
+// PresenceTracker - BLF style state of users, fed by PRESENCE_IN and PRESENCE_PROBE events. See TrackPresence
+type PresenceTracker struct {
+	connection *ESLConnection
+	onChange   func(change PresenceChange)
+	dispatcher *OrderedDispatcher
+	lock       sync.RWMutex
+	// dialogs - Answer state of the dialogs of each user by Unique-ID
+	dialogs  map[string]map[string]PresenceState
+	known    map[string]bool
+	stopOnce sync.Once
+}
+
+// TrackPresence - Start following the presence of users until Stop, onChange may be nil.
+// A user is known once a PRESENCE_IN or PRESENCE_PROBE names it, and idle until it has a dialog.
+// On an outbound connection the events must be enabled with myevents
+func (c *ESLConnection) TrackPresence(onChange func(change PresenceChange)) (*PresenceTracker, error) {
+	if !c.outbound {
+		if err := c.subscribeInternal(presenceEvents...); err != nil {
+			return nil, err
+		}
+	}
+	tracker := &PresenceTracker{
+		connection: c,
+		onChange:   onChange,
+		dialogs:    make(map[string]map[string]PresenceState),
+		known:      make(map[string]bool),
+	}
+	// A single worker so the changes of a user are computed and reported in order
+	tracker.dispatcher = c.DispatchOrdered(1, 0, tracker.apply)
+	return tracker, nil
+}
+
+// Stop - Stop following presence, the last states are kept
+func (t *PresenceTracker) Stop() error {
+	var err error
+	t.stopOnce.Do(func() {
+		t.dispatcher.Stop()
+		if !t.connection.outbound {
+			err = t.connection.Unsubscribe(presenceEvents...)
+		}
+	})
+	return err
+}
+
+func (t *PresenceTracker) apply(event *Event) {
+	switch event.GetHeader("Event-Name") {
+	case EventPresenceProbe:
+		if user := presenceUser(event.GetHeader("to")); user != "" {
+			t.lock.Lock()
+			t.known[user] = true
+			t.lock.Unlock()
+		}
+	case EventPresenceIn:
+		user := presenceUser(event.GetHeader("from"))
+		if user == "" {
+			return
+		}
+		dialog := firstNonEmpty(event.GetHeader("Unique-ID"), event.GetHeader("call-id"))
+		t.lock.Lock()
+		t.known[user] = true
+		previous := t.stateLocked(user)
+		if dialog != "" {
+			t.updateDialogLocked(user, dialog, event.GetHeader("answer-state"))
+		}
+		state := t.stateLocked(user)
+		t.lock.Unlock()
+		if state != previous && t.onChange != nil {
+			change := PresenceChange{User: user, Previous: previous, State: state}
+			t.connection.runHandler("presence handler", func() { t.onChange(change) })
+		}
+	}
+}
+
+// updateDialogLocked - Record the answer-state of a dialog, a terminated one is forgotten
+func (t *PresenceTracker) updateDialogLocked(user, dialog, answerState string) {
+	dialogs := t.dialogs[user]
+	switch strings.ToLower(answerState) {
+	case "early", "ringing", "trying", "proceeding":
+		if dialogs == nil {
+			dialogs = make(map[string]PresenceState)
+			t.dialogs[user] = dialogs
+		}
+		dialogs[dialog] = PresenceRinging
+	case "confirmed", "answered":
+		if dialogs == nil {
+			dialogs = make(map[string]PresenceState)
+			t.dialogs[user] = dialogs
+		}
+		dialogs[dialog] = PresenceOnCall
+	case "terminated", "hangup":
+		delete(dialogs, dialog)
+		if len(dialogs) == 0 {
+			delete(t.dialogs, user)
+		}
+	}
+}
+
+func (t *PresenceTracker) stateLocked(user string) PresenceState {
+	state := PresenceIdle
+	for _, dialog := range t.dialogs[user] {
+		if dialog > state {
+			state = dialog
+		}
+	}
+	return state
+}
+
+// presenceUser - user@domain of a from or to header, without the sip: scheme
+func presenceUser(value string) string {
+	return strings.ToLower(strings.TrimPrefix(strings.TrimSpace(value), "sip:"))
+}
+
+// State - State of user, like "1000@example.com". PresenceIdle for unknown users
+func (t *PresenceTracker) State(user string) PresenceState {
+	t.lock.RLock()
+	defer t.lock.RUnlock()
+	return t.stateLocked(presenceUser(user))
+}
+
+// States - State of every known user
+func (t *PresenceTracker) States() map[string]PresenceState {
+	t.lock.RLock()
+	defer t.lock.RUnlock()
+	states := make(map[string]PresenceState, len(t.known))
+	for user := range t.known {
+		states[user] = t.stateLocked(user)
+	}
+	return states
+}
@@ -0,0 +1,493 @@
+/*
+ * Copyright (c) 2021 LuanDNH
+ *
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at https://mozilla.org/MPL/2.0/.
+ *
+ * Contributor(s):
+ * LuanDNH <luandnh98@gmail.com>
+ */
+package goesl
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// proxyMaxBody - Largest body a client may send, like the body of a sendevent
+const proxyMaxBody = 16 << 20
+
+// proxyEventQueue - Events waiting to be written to a proxy client, later ones are dropped until it catches up
+const proxyEventQueue = 1024
+
+// Proxy - Event socket server sharing one upstream connection between many clients. Clients authenticate
+// with the proxy password, their subscriptions are reference counted on the upstream connection and the
+// events are fanned back out in the format each client asked for. api, bgapi, sendevent and sendmsg are
+// forwarded, filters are applied by the proxy for the client only. log, myevents and the outbound only
+// commands are refused
+type Proxy struct {
+	upstream *ESLConnection
+	password string
+
+	lock     sync.Mutex
+	listener net.Listener
+	sessions map[*proxySession]struct{}
+	closed   bool
+	wg       sync.WaitGroup
+}
+
+// NewProxy - Proxy for the authenticated inbound connection upstream, clients authenticate with password
+func NewProxy(upstream *ESLConnection, password string) *Proxy {
+	return &Proxy{
+		upstream: upstream,
+		password: password,
+		sessions: make(map[*proxySession]struct{}),
+	}
+}
+
+// ListenAndServe - Listen on the tcp address and Serve
+func (p *Proxy) ListenAndServe(address string) error {
+	listener, err := net.Listen("tcp", address)
+	if err != nil {
+		return err
+	}
+	return p.Serve(listener)
+}
+
+// Serve - Accept clients on listener until Close, nil is returned once closed
+func (p *Proxy) Serve(listener net.Listener) error {
+	p.lock.Lock()
+	if p.closed {
+		p.lock.Unlock()
+		listener.Close()
+		return ErrConnectionClosed
+	}
+	p.listener = listener
+	p.lock.Unlock()
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			p.lock.Lock()
+			closed := p.closed
+			p.lock.Unlock()
+			if closed {
+				return nil
+			}
+			return err
+		}
+		session := p.newSession(conn)
+		p.lock.Lock()
+		if p.closed {
+			p.lock.Unlock()
+			conn.Close()
+			continue
+		}
+		p.sessions[session] = struct{}{}
+		p.wg.Add(1)
+		p.lock.Unlock()
+		go session.serve()
+	}
+}
+
+// Close - Stop accepting clients and disconnect those connected, the upstream connection is left open
+func (p *Proxy) Close() error {
+	p.lock.Lock()
+	p.closed = true
+	listener := p.listener
+	sessions := make([]*proxySession, 0, len(p.sessions))
+	for session := range p.sessions {
+		sessions = append(sessions, session)
+	}
+	p.lock.Unlock()
+	var err error
+	if listener != nil {
+		err = listener.Close()
+	}
+	for _, session := range sessions {
+		session.conn.Close()
+	}
+	p.wg.Wait()
+	return err
+}
+
+// Clients - Number of connected clients
+func (p *Proxy) Clients() int {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	return len(p.sessions)
+}
+
+// proxySession - One client of the proxy
+type proxySession struct {
+	proxy  *Proxy
+	conn   net.Conn
+	reader *bufio.Reader
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	writeLock sync.Mutex
+
+	lock          sync.Mutex
+	format        string
+	subscriptions map[string]bool
+	filters       [][2]string
+	jobs          map[string]bool
+
+	events     chan []byte
+	dispatcher *OrderedDispatcher
+}
+
+func (p *Proxy) newSession(conn net.Conn) *proxySession {
+	ctx, cancel := context.WithCancel(p.upstream.runningContext)
+	return &proxySession{
+		proxy:         p,
+		conn:          conn,
+		reader:        bufio.NewReader(conn),
+		ctx:           ctx,
+		cancel:        cancel,
+		subscriptions: make(map[string]bool),
+		jobs:          make(map[string]bool),
+		events:        make(chan []byte, proxyEventQueue),
+	}
+}
+
+func (s *proxySession) serve() {
+	defer s.proxy.wg.Done()
+	defer s.close()
+	go func() {
+		// The client goes away with the upstream connection
+		select {
+		case <-s.proxy.upstream.done:
+			s.conn.Close()
+		case <-s.ctx.Done():
+		}
+	}()
+	if !s.authenticate() {
+		return
+	}
+	// A single worker, the client gets the events in the order freeswitch sent them
+	s.dispatcher = s.proxy.upstream.DispatchOrdered(1, 0, s.forwardEvent)
+	go s.writeEvents()
+	for {
+		cmd, headers, body, err := readCommandFrame(s.reader)
+		if err != nil {
+			return
+		}
+		if !s.handle(cmd, headers, body) {
+			return
+		}
+	}
+}
+
+func (s *proxySession) close() {
+	s.cancel()
+	upstream := s.proxy.upstream
+	if s.dispatcher != nil {
+		s.dispatcher.Stop()
+	}
+	s.lock.Lock()
+	keys := make([]string, 0, len(s.subscriptions))
+	for key := range s.subscriptions {
+		keys = append(keys, key)
+	}
+	s.subscriptions = make(map[string]bool)
+	s.lock.Unlock()
+	if len(keys) > 0 && upstream.Err() == nil {
+		_ = upstream.Unsubscribe(keys...)
+	}
+	s.conn.Close()
+	s.proxy.lock.Lock()
+	delete(s.proxy.sessions, s)
+	s.proxy.lock.Unlock()
+}
+
+// authenticate - Play the freeswitch side of the auth handshake
+func (s *proxySession) authenticate() bool {
+	if s.write(marshalFrame(ContentType_AuthRequest, nil, nil)) != nil {
+		return false
+	}
+	for {
+		cmd, _, _, err := readCommandFrame(s.reader)
+		if err != nil {
+			return false
+		}
+		switch {
+		case cmd == "exit":
+			s.reply("+OK bye")
+			return false
+		case !strings.HasPrefix(cmd, "auth "):
+			s.reply("-ERR command not found")
+		case strings.TrimPrefix(cmd, "auth ") == s.proxy.password:
+			return s.reply("+OK accepted") == nil
+		default:
+			s.reply("-ERR invalid")
+			return false
+		}
+	}
+}
+
+// handle - Run a command of the client, false when the session ends
+func (s *proxySession) handle(cmd string, headers []string, body string) bool {
+	name, args := cmd, ""
+	if i := strings.IndexByte(cmd, ' '); i > 0 {
+		name, args = cmd[:i], strings.TrimSpace(cmd[i+1:])
+	}
+	upstream := s.proxy.upstream
+	switch strings.ToLower(name) {
+	case "api":
+		response, err := upstream.ApiWithContext(s.ctx, args)
+		if response == nil {
+			return s.write(marshalFrame(ContentType_APIResponse, nil, []byte("-ERR "+err.Error()+"\n"))) == nil
+		}
+		return s.write(marshalFrame(ContentType_APIResponse, nil, response.Body)) == nil
+	case "bgapi":
+		jobUUID := ""
+		for _, header := range headers {
+			if strings.HasPrefix(strings.ToLower(header), "job-uuid:") {
+				jobUUID = strings.TrimSpace(header[len("job-uuid:"):])
+			}
+		}
+		if jobUUID == "" {
+			jobUUID = newUUID()
+		}
+		s.lock.Lock()
+		// Without a subscription upstream may never receive the event which forgets the job
+		if s.subscriptions[EventAll] || s.subscriptions[EventBackgroundJob] {
+			s.jobs[jobUUID] = true
+		}
+		s.lock.Unlock()
+		return s.forward("bgapi "+args, []string{"Job-UUID: " + jobUUID}, "")
+	case "sendevent", "sendmsg":
+		return s.forward(cmd, headers, body)
+	case "event":
+		return s.subscribe(args)
+	case "nixevent":
+		keys := parseSubscriptionKeys([]string{args})
+		s.unsubscribe(keys)
+		return s.reply("+OK events removed") == nil
+	case "noevents":
+		s.lock.Lock()
+		keys := make([]string, 0, len(s.subscriptions))
+		for key := range s.subscriptions {
+			keys = append(keys, key)
+		}
+		s.lock.Unlock()
+		s.unsubscribe(keys)
+		return s.reply("+OK no longer listening for events") == nil
+	case "filter":
+		return s.filter(args)
+	case "exit":
+		s.reply("+OK bye")
+		s.write(marshalFrame(ContentType_Disconnect, nil, []byte("Disconnected, goodbye.\nSee you at ClueCon! http://www.cluecon.com/\n")))
+		return false
+	}
+	return s.reply("-ERR command not supported by proxy") == nil
+}
+
+// forward - Send a frame upstream and hand the reply back to the client
+func (s *proxySession) forward(cmd string, headers []string, body string) bool {
+	frame, err := buildFrame(cmd, headers, body)
+	if err != nil {
+		return s.reply("-ERR "+err.Error()) == nil
+	}
+	response, err := s.proxy.upstream.sendFrame(s.ctx, frame)
+	if response == nil {
+		return s.reply("-ERR "+err.Error()) == nil
+	}
+	reply := response.GetHeader("Reply-Text")
+	var replyHeaders []HeaderField
+	for _, f := range response.Headers.Fields() {
+		if key := headerKey(f.Name); key != "content-type" && key != "content-length" {
+			replyHeaders = append(replyHeaders, f)
+		}
+	}
+	if reply == "" {
+		replyHeaders = append(replyHeaders, HeaderField{Name: "Reply-Text", Value: "+OK"})
+	}
+	return s.write(marshalFrame(ContentType_Reply, replyHeaders, response.Body)) == nil
+}
+
+func (s *proxySession) subscribe(args string) bool {
+	words := strings.Fields(args)
+	format := EventFormatPlain
+	if len(words) > 0 {
+		switch strings.ToLower(words[0]) {
+		case EventFormatPlain, EventFormatJSON:
+			format, words = strings.ToLower(words[0]), words[1:]
+		case EventFormatXML:
+			return s.reply("-ERR xml events are not supported by proxy") == nil
+		}
+	}
+	keys := parseSubscriptionKeys(words)
+	s.lock.Lock()
+	s.format = format
+	var added []string
+	for _, key := range keys {
+		if !s.subscriptions[key] {
+			s.subscriptions[key] = true
+			added = append(added, key)
+		}
+	}
+	s.lock.Unlock()
+	if len(added) > 0 {
+		if err := s.proxy.upstream.subscribeInternal(added...); err != nil {
+			s.lock.Lock()
+			for _, key := range added {
+				delete(s.subscriptions, key)
+			}
+			s.lock.Unlock()
+			return s.reply("-ERR "+err.Error()) == nil
+		}
+	}
+	return s.reply("+OK event listener enabled "+format) == nil
+}
+
+func (s *proxySession) unsubscribe(keys []string) {
+	var removed []string
+	s.lock.Lock()
+	for _, key := range keys {
+		if s.subscriptions[key] {
+			delete(s.subscriptions, key)
+			removed = append(removed, key)
+		}
+	}
+	if !s.subscriptions[EventAll] && !s.subscriptions[EventBackgroundJob] {
+		s.jobs = make(map[string]bool)
+	}
+	s.lock.Unlock()
+	if len(removed) > 0 {
+		_ = s.proxy.upstream.Unsubscribe(removed...)
+	}
+}
+
+// filter - filter <header> <value> and filter delete <header> [<value>], kept by the proxy for this client
+func (s *proxySession) filter(args string) bool {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if strings.HasPrefix(args, "delete ") {
+		args = strings.TrimSpace(args[len("delete "):])
+		header, value := splitFilter(args)
+		kept := s.filters[:0]
+		for _, f := range s.filters {
+			if header != "all" && (!strings.EqualFold(f[0], header) || value != "" && f[1] != value) {
+				kept = append(kept, f)
+			}
+		}
+		s.filters = kept
+		return s.reply("+OK filter deleted. ["+header+"]=["+value+"]") == nil
+	}
+	header, value := splitFilter(args)
+	if header == "" || value == "" {
+		return s.reply("-ERR invalid syntax") == nil
+	}
+	s.filters = append(s.filters, [2]string{header, value})
+	return s.reply("+OK filter added. ["+header+"]=["+value+"]") == nil
+}
+
+func splitFilter(args string) (string, string) {
+	if i := strings.IndexByte(args, ' '); i > 0 {
+		return args[:i], strings.TrimSpace(args[i+1:])
+	}
+	return args, ""
+}
+
+// forwardEvent - Upstream listener, queue the event when the client subscribed it and it passes the filters
+func (s *proxySession) forwardEvent(event *Event) {
+	name := event.GetHeader("Event-Name")
+	s.lock.Lock()
+	format := s.format
+	subscribed := s.subscriptions[EventAll] || name != EventCustom && s.subscriptions[name]
+	if subclass := event.GetHeader("Event-Subclass"); name == EventCustom {
+		// Like freeswitch, CUSTOM alone only gets the custom events without subclass
+		subscribed = subscribed || s.subscriptions[EventCustom+" "+subclass] || subclass == "" && s.subscriptions[EventCustom]
+	}
+	if name == EventBackgroundJob {
+		// The job is done whether or not its event is forwarded, jobs of other clients are not theirs to see
+		job := event.GetHeader("Job-UUID")
+		subscribed = subscribed && s.jobs[job]
+		delete(s.jobs, job)
+	}
+	if subscribed && len(s.filters) > 0 {
+		subscribed = false
+		for _, f := range s.filters {
+			if event.GetHeader(f[0]) == f[1] {
+				subscribed = true
+				break
+			}
+		}
+	}
+	s.lock.Unlock()
+	if !subscribed {
+		return
+	}
+	frame, err := event.Marshal(format)
+	if err != nil {
+		return
+	}
+	select {
+	case s.events <- frame:
+	default:
+	}
+}
+
+func (s *proxySession) writeEvents() {
+	for {
+		select {
+		case frame := <-s.events:
+			if s.write(frame) != nil {
+				return
+			}
+		case <-s.ctx.Done():
+			return
+		}
+	}
+}
+
+func (s *proxySession) reply(text string) error {
+	return s.write(marshalFrame(ContentType_Reply, []HeaderField{{Name: "Reply-Text", Value: text}}, nil))
+}
+
+func (s *proxySession) write(frame []byte) error {
+	s.writeLock.Lock()
+	defer s.writeLock.Unlock()
+	_, err := s.conn.Write(frame)
+	return err
+}
+
+// readCommandFrame - Read a command sent by a client, its headers and the body announced by Content-Length
+func readCommandFrame(reader *bufio.Reader) (string, []string, string, error) {
+	var lines []string
+	length := 0
+	for {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			return "", nil, "", err
+		}
+		line = strings.TrimRight(line, "\r\n")
+		if line == "" {
+			if len(lines) > 0 {
+				break
+			}
+			continue
+		}
+		if i := strings.IndexByte(line, ':'); i > 0 && len(lines) > 0 && strings.EqualFold(line[:i], "Content-Length") {
+			if length, err = strconv.Atoi(strings.TrimSpace(line[i+1:])); err != nil || length < 0 || length > proxyMaxBody {
+				return "", nil, "", errors.New("invalid content length : " + line)
+			}
+			continue
+		}
+		lines = append(lines, line)
+	}
+	body := make([]byte, length)
+	if _, err := io.ReadFull(reader, body); err != nil {
+		return "", nil, "", err
+	}
+	return lines[0], lines[1:], string(body), nil
+}
@@ -0,0 +1,78 @@
+/*
+ * Copyright (c) 2021 LuanDNH
+ *
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at https://mozilla.org/MPL/2.0/.
+ *
+ * Contributor(s):
+ * LuanDNH <luandnh98@gmail.com>
+ */
+package goesl
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+// ErrRateLimited - A command was refused by the rate limiter in fail fast mode, see Options.RateLimit
+var ErrRateLimited = errors.New("command rate limit exceeded")
+
+// tokenBucket - Rate limiter of the commands of a connection, rate tokens per second up to burst
+type tokenBucket struct {
+	lock     sync.Mutex
+	rate     float64
+	burst    float64
+	tokens   float64
+	last     time.Time
+	failFast bool
+}
+
+func newTokenBucket(rate float64, burst int, failFast bool) *tokenBucket {
+	if burst <= 0 {
+		burst = 1
+	}
+	return &tokenBucket{
+		rate:     rate,
+		burst:    float64(burst),
+		tokens:   float64(burst),
+		last:     time.Now(),
+		failFast: failFast,
+	}
+}
+
+// take - Take a token, waiting for one unless fail fast is set
+func (b *tokenBucket) take(ctx context.Context, done <-chan struct{}) error {
+	for {
+		b.lock.Lock()
+		now := time.Now()
+		b.tokens += now.Sub(b.last).Seconds() * b.rate
+		if b.tokens > b.burst {
+			b.tokens = b.burst
+		}
+		b.last = now
+		if b.tokens >= 1 {
+			b.tokens--
+			b.lock.Unlock()
+			return nil
+		}
+		wait := time.Duration((1 - b.tokens) / b.rate * float64(time.Second))
+		b.lock.Unlock()
+
+		if b.failFast {
+			return ErrRateLimited
+		}
+		timer := time.NewTimer(wait)
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		case <-done:
+			timer.Stop()
+			return ErrConnectionClosed
+		}
+	}
+}
@@ -0,0 +1,218 @@
+/*
+ * Copyright (c) 2021 LuanDNH
+ *
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at https://mozilla.org/MPL/2.0/.
+ *
+ * Contributor(s):
+ * LuanDNH <luandnh98@gmail.com>
+ */
+package goesl
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// registrationEvents - Sofia events a RegistrationTracker follows
+var registrationEvents = []string{EventCustom + " sofia::register sofia::unregister sofia::expire"}
+
+// Registration - A SIP registration seen by a RegistrationTracker
+type Registration struct {
+	Profile     string
+	User        string
+	Realm       string
+	Contact     string
+	CallID      string
+	NetworkIP   string
+	NetworkPort int
+	UserAgent   string
+	// Expires - When the registration expires if not refreshed, zero when unknown
+	Expires time.Time
+}
+
+// RegistrationTrackerOptions - Callbacks of TrackRegistrations, called one at a time in the order of the events
+type RegistrationTrackerOptions struct {
+	// OnAdd - A contact registered, refreshes of a known registration are not reported
+	OnAdd func(reg Registration)
+	// OnRemove - A contact unregistered, expired is true when it was not refreshed in time
+	OnRemove func(reg Registration, expired bool)
+}
+
+// RegistrationTracker - Table of the current SIP registrations, fed by sofia::register, sofia::unregister
+// and sofia::expire events. See TrackRegistrations
+type RegistrationTracker struct {
+	connection *ESLConnection
+	opts       RegistrationTrackerOptions
+	dispatcher *OrderedDispatcher
+	lock       sync.RWMutex
+	// users - Registrations by user@realm then Call-ID, a user may register several contacts
+	users    map[string]map[string]Registration
+	stopOnce sync.Once
+}
+
+// TrackRegistrations - Start following the registrations until Stop. Only the registrations made from now on are known,
+// use SofiaRegistrations for the current ones. On an outbound connection the events must be enabled with myevents
+func (c *ESLConnection) TrackRegistrations(opts RegistrationTrackerOptions) (*RegistrationTracker, error) {
+	if !c.outbound {
+		if err := c.subscribeInternal(registrationEvents...); err != nil {
+			return nil, err
+		}
+	}
+	tracker := &RegistrationTracker{
+		connection: c,
+		opts:       opts,
+		users:      make(map[string]map[string]Registration),
+	}
+	// A single worker keeps register and unregister of a contact in order
+	tracker.dispatcher = c.DispatchOrdered(1, 0, tracker.apply)
+	return tracker, nil
+}
+
+// Stop - Stop following the registrations, the table is kept as is
+func (t *RegistrationTracker) Stop() error {
+	var err error
+	t.stopOnce.Do(func() {
+		t.dispatcher.Stop()
+		if !t.connection.outbound {
+			err = t.connection.Unsubscribe(registrationEvents...)
+		}
+	})
+	return err
+}
+
+func (t *RegistrationTracker) apply(event *Event) {
+	if event.GetHeader("Event-Name") != EventCustom {
+		return
+	}
+	switch event.GetHeader("Event-Subclass") {
+	case "sofia::register":
+		reg := parseRegistration(event)
+		t.lock.Lock()
+		contacts := t.users[registrationKey(reg.User, reg.Realm)]
+		if contacts == nil {
+			contacts = make(map[string]Registration)
+			t.users[registrationKey(reg.User, reg.Realm)] = contacts
+		}
+		_, known := contacts[reg.CallID]
+		contacts[reg.CallID] = reg
+		t.lock.Unlock()
+		if !known && t.opts.OnAdd != nil {
+			t.connection.runHandler("registration handler", func() { t.opts.OnAdd(reg) })
+		}
+	case "sofia::unregister":
+		t.remove(parseRegistration(event), false)
+	case "sofia::expire":
+		t.remove(parseRegistration(event), true)
+	}
+}
+
+// remove - Drop the contact with the Call-ID of reg, or every contact of the user when the event has none
+func (t *RegistrationTracker) remove(reg Registration, expired bool) {
+	key := registrationKey(reg.User, reg.Realm)
+	var removed []Registration
+	t.lock.Lock()
+	contacts := t.users[key]
+	for callID, known := range contacts {
+		if reg.CallID == "" || callID == reg.CallID {
+			removed = append(removed, known)
+			delete(contacts, callID)
+		}
+	}
+	if len(t.users[key]) == 0 {
+		delete(t.users, key)
+	}
+	t.lock.Unlock()
+	if t.opts.OnRemove == nil {
+		return
+	}
+	for _, known := range removed {
+		known := known
+		t.connection.runHandler("registration handler", func() { t.opts.OnRemove(known, expired) })
+	}
+}
+
+// parseRegistration - Registration carried by a sofia::register, unregister or expire event,
+// the user and host headers are named differently in each
+func parseRegistration(event *Event) Registration {
+	reg := Registration{
+		Profile:     event.GetHeader("profile-name"),
+		User:        firstNonEmpty(event.GetHeader("from-user"), event.GetHeader("user"), event.GetHeader("username")),
+		Realm:       firstNonEmpty(event.GetHeader("from-host"), event.GetHeader("host"), event.GetHeader("realm")),
+		Contact:     event.GetHeader("contact"),
+		CallID:      event.GetHeader("call-id"),
+		NetworkIP:   event.GetHeader("network-ip"),
+		NetworkPort: atoi(event.GetHeader("network-port")),
+		UserAgent:   event.GetHeader("user-agent"),
+	}
+	if expires, err := strconv.Atoi(event.GetHeader("expires")); err == nil && expires > 0 {
+		reg.Expires = time.Now().Add(time.Duration(expires) * time.Second)
+	}
+	return reg
+}
+
+func registrationKey(user, realm string) string {
+	return strings.ToLower(user + "@" + realm)
+}
+
+// Get - Contacts registered by user in realm
+func (t *RegistrationTracker) Get(user, realm string) []Registration {
+	t.lock.RLock()
+	defer t.lock.RUnlock()
+	contacts := t.users[registrationKey(user, realm)]
+	registrations := make([]Registration, 0, len(contacts))
+	for _, reg := range contacts {
+		registrations = append(registrations, reg)
+	}
+	sortRegistrations(registrations)
+	return registrations
+}
+
+// IsRegistered - Tells if user has at least one contact registered in realm
+func (t *RegistrationTracker) IsRegistered(user, realm string) bool {
+	t.lock.RLock()
+	defer t.lock.RUnlock()
+	return len(t.users[registrationKey(user, realm)]) > 0
+}
+
+// Registrations - Every registration, sorted by user, realm and Call-ID
+func (t *RegistrationTracker) Registrations() []Registration {
+	t.lock.RLock()
+	var registrations []Registration
+	for _, contacts := range t.users {
+		for _, reg := range contacts {
+			registrations = append(registrations, reg)
+		}
+	}
+	t.lock.RUnlock()
+	sortRegistrations(registrations)
+	return registrations
+}
+
+func sortRegistrations(registrations []Registration) {
+	sort.Slice(registrations, func(i, j int) bool {
+		a, b := registrations[i], registrations[j]
+		if a.User != b.User {
+			return a.User < b.User
+		}
+		if a.Realm != b.Realm {
+			return a.Realm < b.Realm
+		}
+		return a.CallID < b.CallID
+	})
+}
+
+// Count - Number of registered contacts
+func (t *RegistrationTracker) Count() int {
+	t.lock.RLock()
+	defer t.lock.RUnlock()
+	count := 0
+	for _, contacts := range t.users {
+		count += len(contacts)
+	}
+	return count
+}
@@ -12,16 +12,11 @@
 package goesl
 
 import (
-	"bufio"
-	"bytes"
-	"encoding/json"
 	"errors"
 	"fmt"
-	"io"
-	"net/textproto"
-	"net/url"
 	"strconv"
 	"strings"
+	"time"
 )
 
 const (
@@ -29,6 +24,9 @@ const (
 	ContentType_Reply       = `command/reply`
 	ContentType_APIResponse = `api/response`
 	ContentType_Disconnect  = `text/disconnect-notice`
+	ContentType_Rejection   = `text/rude-rejection`
+	// ContentType_LogData - Console log line sent once logging is enabled with the log command
+	ContentType_LogData = `log/data`
 	// for event
 	ContentType_EventPlain = `text/event-plain`
 	ContentType_EventJSON  = `text/event-json`
@@ -36,145 +34,160 @@ const (
 )
 
 var (
-	ReadBufferSize      = 1024 << 6
-	AllowedContentTypes = []string{
-		ContentType_AuthRequest,
-		ContentType_Reply,
-		ContentType_APIResponse,
-		ContentType_Disconnect,
-		ContentType_EventPlain,
-		ContentType_EventJSON,
-		ContentType_EventXML,
-	}
+	// ReadBufferSize - Default size of the read buffer of a connection, see Options.ReadBufferSize
+	ReadBufferSize = 1024 << 6
+)
+
+// HeaderDecoding - Which messages get their percent encoded header values URL decoded
+type HeaderDecoding int
+
+const (
+	// HeaderDecodingAuto - Decode every message freeswitch URL encodes, that is all but json events
+	HeaderDecodingAuto HeaderDecoding = iota
+	// HeaderDecodingAlways - Decode every message, json events included
+	HeaderDecodingAlways
+	// HeaderDecodingNever - Keep header values as received
+	HeaderDecodingNever
+	// HeaderDecodingPlainEvents - Only decode text/event-plain events
+	HeaderDecodingPlainEvents
+)
+
+// ParseMode - How the parser deals with frames it does not understand
+type ParseMode int
+
+const (
+	// ParseStrict - Unknown content types and malformed frames are errors, ending the read loop
+	ParseStrict ParseMode = iota
+	// ParseLenient - Unknown frames are passed through as raw responses, frames without Content-Type
+	// and malformed header lines are tolerated, undecodable events keep their raw body
+	ParseLenient
 )
 
 type ESLResponse struct {
-	Headers map[string]string
-	Body    []byte
+	ContentType string
+	Headers     Headers
+	Body        []byte
+
+	// stream - Body left on the socket for ApiStream, Body is empty then
+	stream *replyStream
+	// pooled - Taken from responsePool, refs - Owners left, see Release
+	pooled bool
+	refs   int32
 }
 
-// GetReply - Check value in header
+// HasHeader - Check if the header is present, the name is case insensitive
 func (r *ESLResponse) HasHeader(header string) bool {
-	_, ok := r.Headers[textproto.CanonicalMIMEHeaderKey(header)]
-	return ok
+	return r.Headers.Has(header)
 }
 
-// GetHeader - Get header value
+// GetHeader - Get header value, the first one if the header is repeated. The name is case insensitive
 func (r *ESLResponse) GetHeader(header string) string {
-	value, _ := url.PathUnescape(r.Headers[header])
-	return value
+	return r.Headers.Get(header)
 }
 
-// IsOk - Has prefix +OK
-func (r *ESLResponse) IsOk() bool {
-	return strings.HasPrefix(r.GetReply(), "+OK")
+// GetHeaderValues - Get every value of a repeated header in order
+func (r *ESLResponse) GetHeaderValues(header string) []string {
+	return r.Headers.Values(header)
 }
 
-// GetReply - Get reply value in header
-func (r *ESLResponse) GetReply() string {
-	if r.HasHeader("Reply-Text") {
-		return r.GetHeader("Reply-Text")
+// GetHeaderInt - Get header value as an integer, an error is returned when it is missing or not a number
+func (r *ESLResponse) GetHeaderInt(header string) (int, error) {
+	value, err := r.headerValue(header)
+	if err != nil {
+		return 0, err
 	}
-	return string(r.Body)
+	n, err := strconv.Atoi(value)
+	if err != nil {
+		return 0, fmt.Errorf("header %s is not an integer : %s", header, value)
+	}
+	return n, nil
 }
 
-func (c *ESLConnection) ParseResponse() (*ESLResponse, error) {
-	header, err := c.header.ReadMIMEHeader()
+// GetHeaderBool - Get header value as a boolean, true/false, yes/no, on/off and numbers are understood like freeswitch does
+func (r *ESLResponse) GetHeaderBool(header string) (bool, error) {
+	value, err := r.headerValue(header)
 	if err != nil {
-		return nil, err
+		return false, err
 	}
-	response := &ESLResponse{
-		Headers: make(map[string]string),
+	switch strings.ToLower(value) {
+	case "true", "t", "yes", "y", "on", "enabled", "active", "allow":
+		return true, nil
+	case "false", "f", "no", "n", "off", "disabled", "inactive", "disallow":
+		return false, nil
 	}
-	if err != nil && err.Error() != "EOF" {
-		return nil, err
+	if n, err := strconv.Atoi(value); err == nil {
+		return n != 0, nil
 	}
+	return false, fmt.Errorf("header %s is not a boolean : %s", header, value)
+}
 
-	if header.Get("Content-Type") == "" {
-		return nil, fmt.Errorf("Parse EOF")
+// GetHeaderDuration - Get an integer header value counted in unit, like variable_billsec with time.Second
+// or variable_billmsec with time.Millisecond
+func (r *ESLResponse) GetHeaderDuration(header string, unit time.Duration) (time.Duration, error) {
+	value, err := r.headerValue(header)
+	if err != nil {
+		return 0, err
 	}
+	n, err := strconv.ParseInt(value, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("header %s is not a duration : %s", header, value)
+	}
+	return time.Duration(n) * unit, nil
+}
 
-	if contentLength := header.Get("Content-Length"); len(contentLength) > 0 {
-		length, err := strconv.Atoi(contentLength)
-		if err != nil {
-			return nil, err
-		}
-		response.Body = make([]byte, length)
-
-		if _, err = io.ReadFull(c.reader, response.Body); err != nil {
-			return response, err
-		}
+// GetHeaderTime - Get a timestamp header like Event-Date-Timestamp or Caller-Channel-Answered-Time,
+// freeswitch sends them as epoch microseconds. 0 means the event never happened and gives the zero time
+func (r *ESLResponse) GetHeaderTime(header string) (time.Time, error) {
+	value, err := r.headerValue(header)
+	if err != nil {
+		return time.Time{}, err
+	}
+	if _, err := strconv.ParseInt(value, 10, 64); err != nil {
+		return time.Time{}, fmt.Errorf("header %s is not a timestamp : %s", header, value)
 	}
-	contentType := header.Get("Content-Type")
+	return parseEpochMicro(value), nil
+}
 
-	if !IsExistInSlice(contentType, AllowedContentTypes) {
-		return nil, errors.New(fmt.Sprintf("%s is not allowed", contentType))
+// headerValue - Trimmed header value, an error when the header is missing
+func (r *ESLResponse) headerValue(header string) (string, error) {
+	if !r.HasHeader(header) {
+		return "", errors.New("header not found : " + header)
 	}
+	return strings.TrimSpace(r.GetHeader(header)), nil
+}
+
+// IsOk - Has prefix +OK
+func (r *ESLResponse) IsOk() bool {
+	return strings.HasPrefix(r.GetReply(), "+OK")
+}
 
-	if contentType != ContentType_EventJSON {
-		for k, v := range header {
-			response.Headers[k] = v[0]
-			if strings.Contains(v[0], "%") {
-				response.Headers[k], err = url.QueryUnescape(v[0])
-				if err != nil {
-					c.logger.Error("fail to decode : %v", err)
-					continue
-				}
-			}
-		}
+// GetReply - Get reply value in header
+func (r *ESLResponse) GetReply() string {
+	if r.HasHeader("Reply-Text") {
+		return r.GetHeader("Reply-Text")
 	}
-	switch contentType {
-	case ContentType_Reply:
-		reply := header.Get("Reply-Text")
+	return string(r.Body)
+}
 
-		if strings.Contains(reply, "-ERR") {
-			return nil, errors.New("unsuccessful reply : " + reply[5:])
-		}
+// replyError - Error for an unsuccessful command/reply or api/response, nil otherwise.
+// It is checked by the sender rather than the parser so a -ERR reply doesn't end the read loop
+func (r *ESLResponse) replyError() error {
+	var reply string
+	switch r.ContentType {
+	case ContentType_Reply:
+		reply = r.GetHeader("Reply-Text")
 	case ContentType_APIResponse:
-		if strings.Contains(string(response.Body), "-ERR") {
-			return nil, errors.New("unsuccessful reply : " + string(response.Body)[5:])
-		}
-	case ContentType_EventJSON:
-		var decoded map[string]interface{}
-		if err := json.Unmarshal(response.Body, &decoded); err != nil {
-			return nil, err
-		}
-
-		for k, v := range decoded {
-			switch v.(type) {
-			case string:
-				response.Headers[k] = v.(string)
-			default:
-				c.logger.Warn("non-string property (%s)", k)
-			}
-		}
-		if v, _ := response.Headers["_body"]; v != "" {
-			response.Body = []byte(v)
-			delete(response.Headers, "_body")
-		} else {
-			response.Body = []byte("")
-		}
-	case "text/event-plain":
-		r := bufio.NewReader(bytes.NewReader(response.Body))
-
-		tr := textproto.NewReader(r)
-
-		emh, err := tr.ReadMIMEHeader()
-
-		if err != nil {
-			return nil, errors.New("could not read headers : " + string(response.Body)[5:])
-		}
-
-		if contentLength := emh.Get("Content-Length"); len(contentLength) > 0 {
-			length, err := strconv.Atoi(contentLength)
-			if err != nil {
-				return nil, errors.New("invalid content-length : " + string(response.Body)[5:])
-			}
-			response.Body = make([]byte, length)
-			if _, err = io.ReadFull(r, response.Body); err != nil {
-				return nil, errors.New("could not read body : " + string(response.Body)[5:])
-			}
-		}
+		reply = strings.TrimSpace(string(r.Body))
+	default:
+		return nil
+	}
+	if !strings.HasPrefix(reply, "-ERR") {
+		return nil
 	}
-	return response, nil
+	return errors.New("unsuccessful reply : " + strings.TrimSpace(strings.TrimPrefix(reply, "-ERR")))
+}
+
+// ParseResponse - Read the next message from the connection
+func (c *ESLConnection) ParseResponse() (*ESLResponse, error) {
+	return c.parser.parse()
 }
@@ -0,0 +1,54 @@
+/*
+ * Copyright (c) 2021 LuanDNH
+ *
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at https://mozilla.org/MPL/2.0/.
+ *
+ * Contributor(s):
+ * LuanDNH <luandnh98@gmail.com>
+ */
+package goesl
+
+import (
+	"sync"
+	"sync/atomic"
+)
+
+// responsePool - Messages of the connections with Options.PoolResponses
+var responsePool = sync.Pool{
+	New: func() interface{} {
+		return &ESLResponse{}
+	},
+}
+
+// newPooledResponse - Message taken from the pool, owned once by the read loop
+func newPooledResponse() *ESLResponse {
+	response := responsePool.Get().(*ESLResponse)
+	response.pooled = true
+	response.refs = 1
+	return response
+}
+
+// retain - Add an owner to a pooled message, each owner calls Release once
+func (r *ESLResponse) retain() {
+	if r.pooled {
+		atomic.AddInt32(&r.refs, 1)
+	}
+}
+
+// Release - Give the message back to the pool, with Options.PoolResponses. It must not be used afterwards.
+// Messages returned by ReadMessage, Send and the other commands are owned by the caller which releases them
+// once done. Listeners and dispatchers get messages they don't own, they are released when the listener returns,
+// so a listener keeping an event for later must copy it. Without pooling, or when not called, the message is
+// left to the garbage collector as usual
+func (r *ESLResponse) Release() {
+	if r == nil || !r.pooled {
+		return
+	}
+	if atomic.AddInt32(&r.refs, -1) != 0 {
+		return
+	}
+	*r = ESLResponse{}
+	responsePool.Put(r)
+}
@@ -0,0 +1,123 @@
+/*
+ * Copyright (c) 2021 LuanDNH
+ *
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at https://mozilla.org/MPL/2.0/.
+ *
+ * Contributor(s):
+ * LuanDNH <luandnh98@gmail.com>
+ */
+package goesl
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"time"
+)
+
+// RetryPolicy - How an idempotent command is retried on transient failures
+type RetryPolicy struct {
+	// MaxAttempts - Attempts including the first one, 0 and 1 mean no retry
+	MaxAttempts int
+	// Backoff - Wait before the second attempt, doubled after each attempt up to MaxBackoff when set
+	Backoff    time.Duration
+	MaxBackoff time.Duration
+	// AttemptTimeout - Each attempt gives up after it, an attempt which timed out is retried. 0 means no limit
+	AttemptTimeout time.Duration
+	// Retryable - Tells if a failed attempt is worth retrying, IsTransientError when nil
+	Retryable func(response *ESLResponse, err error) bool
+}
+
+// DefaultRetryPolicy - Three attempts, 100ms apart then 200ms, each given 5 seconds
+var DefaultRetryPolicy = RetryPolicy{
+	MaxAttempts:    3,
+	Backoff:        100 * time.Millisecond,
+	MaxBackoff:     time.Second,
+	AttemptTimeout: 5 * time.Second,
+}
+
+// transientReplies - Causes in -ERR replies which may succeed when tried again
+var transientReplies = []string{
+	"SUBSCRIBER_ABSENT",
+	"NORMAL_TEMPORARY_FAILURE",
+	"SWITCH_CONGESTION",
+	"RECOVERY_ON_TIMER_EXPIRE",
+	"NETWORK_OUT_OF_ORDER",
+	"DESTINATION_OUT_OF_ORDER",
+}
+
+// IsTransientError - Default classifier of RetryPolicy: attempt timeouts, rate limiting and -ERR replies with a
+// temporary cause like SUBSCRIBER_ABSENT are transient. A closed connection or an open circuit is not
+func IsTransientError(response *ESLResponse, err error) bool {
+	if err == nil {
+		return false
+	}
+	if errors.Is(err, context.DeadlineExceeded) || errors.Is(err, ErrRateLimited) {
+		return true
+	}
+	if response == nil {
+		return false
+	}
+	reply := response.GetReply()
+	for _, cause := range transientReplies {
+		if strings.Contains(reply, cause) {
+			return true
+		}
+	}
+	return false
+}
+
+// ApiWithRetry - Run an idempotent api command, retrying transient failures according to policy.
+// The last attempt result is returned
+func (c *ESLConnection) ApiWithRetry(ctx context.Context, cmd string, policy RetryPolicy) (*ESLResponse, error) {
+	return c.retry(ctx, policy, func(ctx context.Context) (*ESLResponse, error) {
+		return c.ApiWithContext(ctx, cmd)
+	})
+}
+
+// SendWithRetry - Send an idempotent command, retrying transient failures according to policy
+func (c *ESLConnection) SendWithRetry(ctx context.Context, cmd string, policy RetryPolicy) (*ESLResponse, error) {
+	return c.retry(ctx, policy, func(ctx context.Context) (*ESLResponse, error) {
+		return c.SendWithContext(ctx, cmd)
+	})
+}
+
+// query - Api command of the read only helpers like Status or GetVar, retried with Options.Retry
+func (c *ESLConnection) query(cmd string) (*ESLResponse, error) {
+	return c.ApiWithRetry(context.Background(), cmd, c.retryPolicy)
+}
+
+func (c *ESLConnection) retry(ctx context.Context, policy RetryPolicy, attempt func(ctx context.Context) (*ESLResponse, error)) (*ESLResponse, error) {
+	retryable := policy.Retryable
+	if retryable == nil {
+		retryable = IsTransientError
+	}
+	backoff := policy.Backoff
+	for i := 1; ; i++ {
+		attemptCtx, cancel := ctx, context.CancelFunc(func() {})
+		if policy.AttemptTimeout > 0 {
+			attemptCtx, cancel = context.WithTimeout(ctx, policy.AttemptTimeout)
+		}
+		response, err := attempt(attemptCtx)
+		cancel()
+		if err == nil || i >= policy.MaxAttempts || ctx.Err() != nil || !retryable(response, err) {
+			return response, err
+		}
+		c.logger.Warn("attempt %d failed, retrying in %s : %v", i, backoff, err)
+		timer := time.NewTimer(backoff)
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return response, err
+		case <-c.done:
+			timer.Stop()
+			return response, err
+		}
+		if backoff *= 2; policy.MaxBackoff > 0 && backoff > policy.MaxBackoff {
+			backoff = policy.MaxBackoff
+		}
+	}
+}
@@ -0,0 +1,97 @@
+/*
+ * Copyright (c) 2021 LuanDNH
+ *
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at https://mozilla.org/MPL/2.0/.
+ *
+ * Contributor(s):
+ * LuanDNH <luandnh98@gmail.com>
+ */
+
+package goesl
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// SchedTime - When a scheduled task runs, built with SchedIn, SchedEvery or SchedAt
+type SchedTime string
+
+// SchedIn - Run once after d, rounded down to the second
+func SchedIn(d time.Duration) SchedTime {
+	return SchedTime("+" + strconv.FormatInt(int64(d/time.Second), 10))
+}
+
+// SchedEvery - Run every d, rounded down to the second
+func SchedEvery(d time.Duration) SchedTime {
+	return SchedTime("@" + strconv.FormatInt(int64(d/time.Second), 10))
+}
+
+// SchedAt - Run once at t
+func SchedAt(t time.Time) SchedTime {
+	return SchedTime(strconv.FormatInt(t.Unix(), 10))
+}
+
+// SchedApi - Schedule an api command, group may be empty. The returned task id can be given to SchedDel
+func (c *ESLConnection) SchedApi(when SchedTime, group, cmd string) (int, error) {
+	if group == "" {
+		group = "none"
+	}
+	response, err := c.Api("sched_api " + string(when) + " " + group + " " + cmd)
+	if err != nil {
+		return 0, err
+	}
+	return parseSchedTaskID(string(response.Body))
+}
+
+// SchedHangup - Schedule the hangup of uuid with cause.
+// It is scheduled through sched_api in the uuid group so it returns a task id, which sched_hangup does not
+func (c *ESLConnection) SchedHangup(when SchedTime, uuid string, cause HangupCause) (int, error) {
+	return c.SchedApi(when, uuid, "uuid_kill "+uuid+" "+cause.String())
+}
+
+// SchedTransfer - Schedule the transfer of uuid to extension, dialplan and context may be empty
+func (c *ESLConnection) SchedTransfer(when SchedTime, uuid, extension, dialplan, dialplanContext string) (int, error) {
+	return c.SchedApi(when, uuid, transferCommand(uuid, extension, dialplan, dialplanContext))
+}
+
+// transferCommand - Build uuid_transfer, dialplan defaults to XML when only the context is given
+func transferCommand(uuid, extension, dialplan, dialplanContext string) string {
+	cmd := "uuid_transfer " + uuid + " " + extension
+	if dialplan != "" || dialplanContext != "" {
+		if dialplan == "" {
+			dialplan = "XML"
+		}
+		cmd += " " + dialplan
+	}
+	if dialplanContext != "" {
+		cmd += " " + dialplanContext
+	}
+	return cmd
+}
+
+// SchedDel - Cancel a scheduled task by id
+func (c *ESLConnection) SchedDel(id int) error {
+	_, err := c.Api("sched_del " + strconv.Itoa(id))
+	return err
+}
+
+// SchedDelGroup - Cancel every scheduled task of a group, like every task scheduled for a uuid
+func (c *ESLConnection) SchedDelGroup(group string) error {
+	_, err := c.Api("sched_del " + group)
+	return err
+}
+
+// parseSchedTaskID - Parse "+OK Added: <id>"
+func parseSchedTaskID(reply string) (int, error) {
+	reply = strings.TrimSpace(reply)
+	i := strings.LastIndex(reply, ":")
+	if !strings.HasPrefix(reply, "+OK") || i < 0 {
+		return 0, errors.New("unexpected sched reply : " + reply)
+	}
+	return strconv.Atoi(strings.TrimSpace(reply[i+1:]))
+}
@@ -0,0 +1,60 @@
+/*
+ * Copyright (c) 2021 LuanDNH
+ *
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at https://mozilla.org/MPL/2.0/.
+ *
+ * Contributor(s):
+ * LuanDNH <luandnh98@gmail.com>
+ */
+
+package goesl
+
+import (
+	"strconv"
+	"sync/atomic"
+)
+
+// EventGap - Events missing between two events of a freeswitch core, see Options.OnEventGap
+type EventGap struct {
+	// CoreUUID - Core-UUID of the freeswitch which fired the events
+	CoreUUID string
+	// Last - Event-Sequence of the last event received, Next - Event-Sequence of the event received after it
+	Last uint64
+	Next uint64
+}
+
+// Missed - Number of events missing
+func (g EventGap) Missed() uint64 {
+	return g.Next - g.Last - 1
+}
+
+// eventSequences - Last Event-Sequence received per Core-UUID, only used by the read loop
+type eventSequences map[string]uint64
+
+// checkSequence - Look for a gap between the last event of its core and msg, a restarted core comes with
+// a new Core-UUID and starts over
+func (c *ESLConnection) checkSequence(msg *ESLResponse) {
+	sequence, err := strconv.ParseUint(msg.GetHeader("Event-Sequence"), 10, 64)
+	if err != nil {
+		return
+	}
+	core := msg.GetHeader("Core-UUID")
+	last, seen := c.sequences[core]
+	if seen && sequence <= last {
+		// Replayed or reordered, it doesn't move the sequence back
+		return
+	}
+	c.sequences[core] = sequence
+	if !seen || sequence == last+1 {
+		return
+	}
+	gap := EventGap{CoreUUID: core, Last: last, Next: sequence}
+	atomic.AddUint64(&c.stats.missedEvents, gap.Missed())
+	if c.onEventGap != nil {
+		c.runHandler("event gap handler", func() { c.onEventGap(gap) })
+	} else {
+		c.logger.Warn("%d events missed from %s after event %d", gap.Missed(), core, last)
+	}
+}
@@ -0,0 +1,218 @@
+/*
+ * Copyright (c) 2021 LuanDNH
+ *
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at https://mozilla.org/MPL/2.0/.
+ *
+ * Contributor(s):
+ * LuanDNH <luandnh98@gmail.com>
+ */
+
+package goesl
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+)
+
+// SessionDirection - Who sent the data of a SessionEntry
+type SessionDirection string
+
+const (
+	// SessionSent - Sent by the client to freeswitch
+	SessionSent SessionDirection = "sent"
+	// SessionReceived - Sent by freeswitch to the client
+	SessionReceived SessionDirection = "received"
+)
+
+// SessionEntry - Data exchanged on a recorded connection, one json document per line in the record.
+// Data holds valid utf-8, Binary anything else
+type SessionEntry struct {
+	Time      time.Time        `json:"time"`
+	Direction SessionDirection `json:"direction"`
+	Data      string           `json:"data,omitempty"`
+	Binary    []byte           `json:"binary,omitempty"`
+}
+
+// Bytes - Data exchanged
+func (e *SessionEntry) Bytes() []byte {
+	if e.Binary != nil {
+		return e.Binary
+	}
+	return []byte(e.Data)
+}
+
+// SessionRecorder - Connection recording both directions of a session, see RecordSession
+type SessionRecorder struct {
+	net.Conn
+	lock    sync.Mutex
+	encoder *json.Encoder
+	err     error
+}
+
+// RecordSession - Wrap conn so everything read and written is appended to w, timestamped. Give the result to
+// NewConnectionFromConn, or return it from a DialContext. The password of auth is redacted, every frame written
+// is an entry while reads are recorded as they come. Recording stops on the first error, see Err
+func RecordSession(conn net.Conn, w io.Writer) *SessionRecorder {
+	return &SessionRecorder{Conn: conn, encoder: json.NewEncoder(w)}
+}
+
+func (r *SessionRecorder) Read(p []byte) (int, error) {
+	n, err := r.Conn.Read(p)
+	if n > 0 {
+		r.record(SessionReceived, p[:n])
+	}
+	return n, err
+}
+
+func (r *SessionRecorder) Write(p []byte) (int, error) {
+	// Recorded first, freeswitch may answer before Write returns
+	if len(p) > 0 {
+		r.record(SessionSent, redactFrame(p))
+	}
+	return r.Conn.Write(p)
+}
+
+func (r *SessionRecorder) record(direction SessionDirection, data []byte) {
+	entry := SessionEntry{Time: time.Now(), Direction: direction}
+	if utf8.Valid(data) {
+		entry.Data = string(data)
+	} else {
+		entry.Binary = append([]byte(nil), data...)
+	}
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	if r.err == nil {
+		r.err = r.encoder.Encode(entry)
+	}
+}
+
+// Err - Error which stopped the recording, nil while recording
+func (r *SessionRecorder) Err() error {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	return r.err
+}
+
+// ReadSession - Read the entries of a session recorded by RecordSession
+func ReadSession(r io.Reader) ([]SessionEntry, error) {
+	var entries []SessionEntry
+	decoder := json.NewDecoder(r)
+	for {
+		var entry SessionEntry
+		if err := decoder.Decode(&entry); err == io.EOF {
+			return entries, nil
+		} else if err != nil {
+			return entries, fmt.Errorf("invalid session entry %d : %v", len(entries)+1, err)
+		}
+		entries = append(entries, entry)
+	}
+}
+
+// SessionReplayOptions - Options of ReplaySession
+type SessionReplayOptions struct {
+	// Speed - Pace of the replay, 1 waits as long as the recorded session between what freeswitch sent, 2 twice
+	// as fast. 0 sends everything as soon as the client asked for it
+	Speed float64
+	// Strict - Fail with a *SessionMismatchError when the client sends something else than the recorded frame,
+	// the replay goes on otherwise
+	Strict bool
+}
+
+// SessionMismatchError - Frame sent by the client during a strict replay which differs from the recording
+type SessionMismatchError struct {
+	// Entry - Index of the entry in the session
+	Entry    int
+	Expected string
+	Got      string
+}
+
+func (e *SessionMismatchError) Error() string {
+	return fmt.Sprintf("entry %d : expected %q, got %q", e.Entry, e.Expected, e.Got)
+}
+
+// ReplaySession - Play the freeswitch side of a recorded session on conn, the client end: what freeswitch sent
+// is written back and each frame the client sent is read before going on, so a client doing the same as in the
+// recording sees the same session. conn is closed once the session is played
+func ReplaySession(conn net.Conn, entries []SessionEntry, opts SessionReplayOptions) error {
+	defer conn.Close()
+	reader := bufio.NewReader(conn)
+	var last time.Time
+	for i := range entries {
+		entry := &entries[i]
+		switch entry.Direction {
+		case SessionSent:
+			frame, err := readClientFrame(reader)
+			if err != nil {
+				return err
+			}
+			if expected := entry.Bytes(); !bytes.Equal(redactFrame(frame), expected) && opts.Strict {
+				return &SessionMismatchError{Entry: i, Expected: string(expected), Got: string(frame)}
+			}
+		case SessionReceived:
+			if opts.Speed > 0 && !last.IsZero() {
+				time.Sleep(time.Duration(float64(entry.Time.Sub(last)) / opts.Speed))
+			}
+			if _, err := conn.Write(entry.Bytes()); err != nil {
+				return err
+			}
+		}
+		last = entry.Time
+	}
+	return nil
+}
+
+// ServeReplay - Replay the session to every client connecting to listener until it is closed, like a freeswitch
+// which always answers the same
+func ServeReplay(listener net.Listener, entries []SessionEntry, opts SessionReplayOptions) error {
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			return err
+		}
+		go func() { _ = ReplaySession(conn, entries, opts) }()
+	}
+}
+
+// readClientFrame - Read a command frame: lines up to an empty one, then the body announced by Content-Length
+func readClientFrame(reader *bufio.Reader) ([]byte, error) {
+	var frame []byte
+	length := 0
+	for {
+		line, err := reader.ReadBytes('\n')
+		frame = append(frame, line...)
+		if err != nil {
+			return frame, err
+		}
+		text := strings.TrimRight(string(line), "\r\n")
+		if text == "" {
+			if len(bytes.TrimSpace(frame)) == 0 {
+				// Blank lines between frames
+				frame = frame[:0]
+				continue
+			}
+			break
+		}
+		if i := strings.Index(text, ":"); i > 0 && strings.EqualFold(strings.TrimSpace(text[:i]), "Content-Length") {
+			length, _ = strconv.Atoi(strings.TrimSpace(text[i+1:]))
+		}
+	}
+	if length > 0 {
+		body := make([]byte, length)
+		if _, err := io.ReadFull(reader, body); err != nil {
+			return frame, err
+		}
+		frame = append(frame, body...)
+	}
+	return frame, nil
+}
@@ -0,0 +1,84 @@
+/*
+ * Copyright (c) 2021 LuanDNH
+ *
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at https://mozilla.org/MPL/2.0/.
+ *
+ * Contributor(s):
+ * LuanDNH <luandnh98@gmail.com>
+ */
+
+package goesl
+
+import "errors"
+
+// ChatMessage - A SEND_MESSAGE event handled by mod_sofia to deliver a SIP MESSAGE to a registered user
+type ChatMessage struct {
+	Profile string
+	User    string
+	Host    string
+	// ContentType - Defaults to text/plain
+	ContentType string
+	Subject     string
+	// UUID - Optional channel the message is related to
+	UUID string
+	Body string
+}
+
+// NewChatMessage - Message for user@host registered on profile
+func NewChatMessage(profile, user, host, body string) *ChatMessage {
+	return &ChatMessage{Profile: profile, User: user, Host: host, Body: body}
+}
+
+// WithContentType - Set the content type, like application/im-iscomposing+xml
+func (m *ChatMessage) WithContentType(contentType string) *ChatMessage {
+	m.ContentType = contentType
+	return m
+}
+
+// WithSubject - Set the message subject
+func (m *ChatMessage) WithSubject(subject string) *ChatMessage {
+	m.Subject = subject
+	return m
+}
+
+// WithUUID - Relate the message to a channel
+func (m *ChatMessage) WithUUID(uuid string) *ChatMessage {
+	m.UUID = uuid
+	return m
+}
+
+// Headers - sendevent headers of the message, the body is framed separately
+func (m *ChatMessage) Headers() ([]string, error) {
+	if m.Profile == "" || m.User == "" || m.Host == "" {
+		return nil, errors.New("chat message needs a profile, user and host")
+	}
+	contentType := m.ContentType
+	if contentType == "" {
+		contentType = "text/plain"
+	}
+	headers := []string{
+		"profile: " + m.Profile,
+		"user: " + m.User,
+		"host: " + m.Host,
+		"content-type: " + contentType,
+	}
+	if m.Subject != "" {
+		headers = append(headers, "subject: "+m.Subject)
+	}
+	if m.UUID != "" {
+		headers = append(headers, "uuid: "+m.UUID)
+	}
+	return headers, nil
+}
+
+// SendChatMessage - Send the message with sendevent SEND_MESSAGE
+func (c *ESLConnection) SendChatMessage(message *ChatMessage) error {
+	headers, err := message.Headers()
+	if err != nil {
+		return err
+	}
+	_, err = c.SendEvent(EventSendMessage, headers, message.Body)
+	return err
+}
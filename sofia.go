@@ -0,0 +1,249 @@
+/*
+ * Copyright (c) 2021 LuanDNH
+ *
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at https://mozilla.org/MPL/2.0/.
+ *
+ * Contributor(s):
+ * LuanDNH <luandnh98@gmail.com>
+ */
+
+package goesl
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// SofiaStatus - Profiles, aliases and gateways reported by mod_sofia
+type SofiaStatus struct {
+	Profiles []SofiaProfile
+	Aliases  []SofiaAlias
+	Gateways []SofiaGateway
+}
+
+// SofiaProfile - A sip profile, State is RUNNING, DOWN, ... and Calls the active call count
+type SofiaProfile struct {
+	Name  string
+	URL   string
+	State string
+	Calls int
+}
+
+// SofiaAlias - An alias pointing to a sip profile
+type SofiaAlias struct {
+	Name    string
+	Profile string
+	State   string
+}
+
+// SofiaGateway - A gateway with its registration state and ping statistics
+type SofiaGateway struct {
+	Name           string
+	Profile        string
+	Scheme         string
+	Realm          string
+	Username       string
+	From           string
+	Contact        string
+	Proxy          string
+	Context        string
+	Expires        int
+	Freq           int
+	PingFreq       int
+	PingTime       time.Duration
+	Pinging        bool
+	State          string
+	Status         string
+	Uptime         time.Duration
+	CallsIn        int
+	CallsOut       int
+	FailedCallsIn  int
+	FailedCallsOut int
+}
+
+// IsUp - Check if the gateway status is UP
+func (g SofiaGateway) IsUp() bool {
+	return g.Status == "UP"
+}
+
+// IsRegistered - Check if the gateway registration state is REGED
+func (g SofiaGateway) IsRegistered() bool {
+	return g.State == "REGED"
+}
+
+// SofiaRegistration - A registration on a sip profile
+type SofiaRegistration struct {
+	CallID       string
+	User         string
+	Contact      string
+	Agent        string
+	Status       string
+	PingStatus   string
+	PingTime     time.Duration
+	Host         string
+	NetworkIP    string
+	NetworkPort  int
+	SIPAuthUser  string
+	SIPAuthRealm string
+	MWIAccount   string
+}
+
+type sofiaStatusXML struct {
+	Profiles []sofiaEntryXML `xml:"profile"`
+	Aliases  []sofiaEntryXML `xml:"alias"`
+}
+
+type sofiaEntryXML struct {
+	Name  string `xml:"name"`
+	Type  string `xml:"type"`
+	Data  string `xml:"data"`
+	State string `xml:"state"`
+}
+
+type sofiaGatewaysXML struct {
+	Gateways []struct {
+		Name           string `xml:"name"`
+		Profile        string `xml:"profile"`
+		Scheme         string `xml:"scheme"`
+		Realm          string `xml:"realm"`
+		Username       string `xml:"username"`
+		From           string `xml:"from"`
+		Contact        string `xml:"contact"`
+		Proxy          string `xml:"proxy"`
+		Context        string `xml:"context"`
+		Expires        string `xml:"expires"`
+		Freq           string `xml:"freq"`
+		PingFreq       string `xml:"pingfreq"`
+		PingTime       string `xml:"pingtime"`
+		Pinging        string `xml:"pinging"`
+		State          string `xml:"state"`
+		Status         string `xml:"status"`
+		UptimeUsec     string `xml:"uptime-usec"`
+		CallsIn        string `xml:"calls-in"`
+		CallsOut       string `xml:"calls-out"`
+		FailedCallsIn  string `xml:"failed-calls-in"`
+		FailedCallsOut string `xml:"failed-calls-out"`
+	} `xml:"gateway"`
+}
+
+type sofiaRegistrationsXML struct {
+	Registrations []struct {
+		CallID       string `xml:"call-id"`
+		User         string `xml:"user"`
+		Contact      string `xml:"contact"`
+		Agent        string `xml:"agent"`
+		Status       string `xml:"status"`
+		PingStatus   string `xml:"ping-status"`
+		PingTime     string `xml:"ping-time"`
+		Host         string `xml:"host"`
+		NetworkIP    string `xml:"network-ip"`
+		NetworkPort  string `xml:"network-port"`
+		SIPAuthUser  string `xml:"sip-auth-user"`
+		SIPAuthRealm string `xml:"sip-auth-realm"`
+		MWIAccount   string `xml:"mwi-account"`
+	} `xml:"registrations>registration"`
+}
+
+// SofiaStatus - Run sofia xmlstatus and parse profiles, aliases and gateways
+func (c *ESLConnection) SofiaStatus() (*SofiaStatus, error) {
+	response, err := c.query("sofia xmlstatus")
+	if err != nil {
+		return nil, err
+	}
+	var decoded sofiaStatusXML
+	if err := decodeSofiaXML(response.Body, &decoded); err != nil {
+		return nil, err
+	}
+	status := &SofiaStatus{}
+	for _, p := range decoded.Profiles {
+		profile := SofiaProfile{Name: p.Name, URL: p.Data, State: p.State}
+		// State looks like "RUNNING (2)", the number being the active calls
+		if i := strings.Index(p.State, " ("); i > 0 {
+			profile.State = p.State[:i]
+			profile.Calls, _ = strconv.Atoi(strings.TrimSuffix(p.State[i+2:], ")"))
+		}
+		status.Profiles = append(status.Profiles, profile)
+	}
+	for _, a := range decoded.Aliases {
+		status.Aliases = append(status.Aliases, SofiaAlias{Name: a.Name, Profile: a.Data, State: a.State})
+	}
+
+	response, err = c.query("sofia xmlstatus gateway")
+	if err != nil {
+		return nil, err
+	}
+	var gateways sofiaGatewaysXML
+	if err := decodeSofiaXML(response.Body, &gateways); err != nil {
+		return nil, err
+	}
+	for _, g := range gateways.Gateways {
+		status.Gateways = append(status.Gateways, SofiaGateway{
+			Name:           g.Name,
+			Profile:        g.Profile,
+			Scheme:         g.Scheme,
+			Realm:          g.Realm,
+			Username:       g.Username,
+			From:           g.From,
+			Contact:        g.Contact,
+			Proxy:          g.Proxy,
+			Context:        g.Context,
+			Expires:        atoi(g.Expires),
+			Freq:           atoi(g.Freq),
+			PingFreq:       atoi(g.PingFreq),
+			PingTime:       parseMilliseconds(g.PingTime),
+			Pinging:        g.Pinging == "1",
+			State:          g.State,
+			Status:         g.Status,
+			Uptime:         time.Duration(atoi(g.UptimeUsec)) * time.Microsecond,
+			CallsIn:        atoi(g.CallsIn),
+			CallsOut:       atoi(g.CallsOut),
+			FailedCallsIn:  atoi(g.FailedCallsIn),
+			FailedCallsOut: atoi(g.FailedCallsOut),
+		})
+	}
+	return status, nil
+}
+
+// SofiaRegistrations - Run sofia xmlstatus profile <profile> reg and parse the registrations
+func (c *ESLConnection) SofiaRegistrations(profile string) ([]SofiaRegistration, error) {
+	response, err := c.query("sofia xmlstatus profile " + profile + " reg")
+	if err != nil {
+		return nil, err
+	}
+	var decoded sofiaRegistrationsXML
+	if err := decodeSofiaXML(response.Body, &decoded); err != nil {
+		return nil, err
+	}
+	registrations := make([]SofiaRegistration, 0, len(decoded.Registrations))
+	for _, r := range decoded.Registrations {
+		registrations = append(registrations, SofiaRegistration{
+			CallID:       r.CallID,
+			User:         r.User,
+			Contact:      r.Contact,
+			Agent:        r.Agent,
+			Status:       r.Status,
+			PingStatus:   r.PingStatus,
+			PingTime:     parseMilliseconds(r.PingTime),
+			Host:         r.Host,
+			NetworkIP:    r.NetworkIP,
+			NetworkPort:  atoi(r.NetworkPort),
+			SIPAuthUser:  r.SIPAuthUser,
+			SIPAuthRealm: r.SIPAuthRealm,
+			MWIAccount:   r.MWIAccount,
+		})
+	}
+	return registrations, nil
+}
+
+func decodeSofiaXML(body []byte, v interface{}) error {
+	trimmed := strings.TrimSpace(string(body))
+	if !strings.HasPrefix(trimmed, "<") {
+		// Unknown profile or gateway are reported as plain text
+		return errors.New("unexpected sofia reply : " + trimmed)
+	}
+	return unmarshalXML([]byte(trimmed), v)
+}
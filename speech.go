@@ -0,0 +1,205 @@
+/*
+ * Copyright (c) 2021 LuanDNH
+ *
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at https://mozilla.org/MPL/2.0/.
+ *
+ * Contributor(s):
+ * LuanDNH <luandnh98@gmail.com>
+ */
+
+package goesl
+
+import (
+	"context"
+	"encoding/xml"
+	"errors"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Speech-Type values of DETECTED_SPEECH events
+const (
+	SpeechTypeBeginSpeaking  = "begin-speaking"
+	SpeechTypeDetectedSpeech = "detected-speech"
+	SpeechTypeClosed         = "closed"
+)
+
+// SpeechParams - Recognizer of PlayAndDetectSpeech and DetectSpeech
+type SpeechParams struct {
+	// Engine - Speech module, like "unimrcp", "unimrcp:profile" or "pocketsphinx"
+	Engine string
+	// Grammar - Grammar path or uri, like "builtin:grammar/boolean"
+	Grammar string
+	// GrammarName - Name the grammar is loaded as by DetectSpeech, goesl when empty
+	GrammarName string
+	// Params - Recognizer parameters sent as a {name=value,...} prefix of the grammar, like no-input-timeout
+	Params map[string]string
+}
+
+// SpeechResult - Outcome of a recognition
+type SpeechResult struct {
+	// Text - Recognized text, the instance of the best interpretation or its input
+	Text string
+	// Confidence - Confidence of the best interpretation from 0 to 1, 0 when not reported
+	Confidence float64
+	// Raw - Result as reported by the engine, usually NLSML
+	Raw string
+}
+
+// PlayAndDetectSpeech - Play file on uuid while recognizing speech, and wait for the result.
+// The result is empty when nothing was recognized
+func (c *ESLConnection) PlayAndDetectSpeech(ctx context.Context, uuid, file string, params SpeechParams) (*SpeechResult, error) {
+	if file == "" {
+		return nil, errors.New("play_and_detect_speech needs a file")
+	}
+	grammar, err := speechGrammar(params)
+	if err != nil {
+		return nil, err
+	}
+	event, err := c.ExecuteAndWait(ctx, uuid, "play_and_detect_speech", file+" detect:"+params.Engine+" "+grammar, &ExecuteOptions{EventLock: true})
+	if err != nil {
+		return nil, err
+	}
+	return ParseSpeechResult(event.GetHeader("variable_detect_speech_result"))
+}
+
+// DetectSpeech - Start detect_speech on uuid and wait for its first detected-speech event, the recognizer is stopped
+// when ctx is done first. On an inbound connection DETECTED_SPEECH is subscribed while waiting, an outbound connection
+// must use myevents
+func (c *ESLConnection) DetectSpeech(ctx context.Context, uuid string, params SpeechParams) (*SpeechResult, error) {
+	grammar, err := speechGrammar(params)
+	if err != nil {
+		return nil, err
+	}
+	name := params.GrammarName
+	if name == "" {
+		name = "goesl"
+	}
+	if !c.outbound {
+		if err := c.subscribeInternal(EventDetectedSpeech); err != nil {
+			return nil, err
+		}
+		defer c.Unsubscribe(EventDetectedSpeech)
+	}
+	listenUUID := uuid
+	if listenUUID == "" {
+		listenUUID = EventListenAll
+	}
+	waiter := c.newEventWaiter(listenUUID, func(event *Event) bool {
+		return event.GetHeader("Event-Name") == EventDetectedSpeech &&
+			event.GetHeader("Speech-Type") == SpeechTypeDetectedSpeech
+	})
+	defer waiter.Close()
+
+	if _, err := c.Execute(uuid, "detect_speech", params.Engine+" "+name+" "+grammar, &ExecuteOptions{EventLock: true}); err != nil {
+		return nil, err
+	}
+	event, err := waiter.Wait(ctx)
+	if err != nil {
+		if ctx.Err() != nil {
+			_ = c.StopDetectSpeech(uuid)
+		}
+		return nil, err
+	}
+	defer event.Release()
+	return ParseSpeechResult(string(event.Body))
+}
+
+// StopDetectSpeech - Stop the recognizer started on uuid by detect_speech
+func (c *ESLConnection) StopDetectSpeech(uuid string) error {
+	_, err := c.Execute(uuid, "detect_speech", "stop", nil)
+	return err
+}
+
+// speechGrammar - Grammar argument with the recognizer parameters as prefix, names are sorted
+func speechGrammar(params SpeechParams) (string, error) {
+	if params.Engine == "" || params.Grammar == "" {
+		return "", errors.New("speech detection needs an engine and a grammar")
+	}
+	if strings.ContainsAny(params.Engine+params.Grammar+params.GrammarName, " \t\r\n") {
+		return "", errors.New("speech engine, grammar and grammar name can not contain spaces")
+	}
+	if len(params.Params) == 0 {
+		return params.Grammar, nil
+	}
+	names := make([]string, 0, len(params.Params))
+	for name := range params.Params {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	pairs := make([]string, 0, len(names))
+	for _, name := range names {
+		value := params.Params[name]
+		if strings.ContainsAny(name+value, " \t\r\n,{}") {
+			return "", errors.New("invalid recognizer parameter : " + name)
+		}
+		pairs = append(pairs, name+"="+value)
+	}
+	return "{" + strings.Join(pairs, ",") + "}" + params.Grammar, nil
+}
+
+type speechInterpretationXML struct {
+	XMLName    xml.Name
+	Confidence string `xml:"confidence,attr"`
+	Score      string `xml:"score,attr"`
+	Instance   string `xml:"instance"`
+	Input      struct {
+		Confidence string `xml:"confidence,attr"`
+		Text       string `xml:",chardata"`
+	} `xml:"input"`
+}
+
+type speechResultXML struct {
+	Interpretations []speechInterpretationXML `xml:"interpretation"`
+}
+
+// ParseSpeechResult - Decode an NLSML result of a recognizer. A result which is not xml is kept as text
+func ParseSpeechResult(raw string) (*SpeechResult, error) {
+	result := &SpeechResult{Raw: raw}
+	trimmed := strings.TrimSpace(raw)
+	if trimmed == "" {
+		return result, nil
+	}
+	if !strings.HasPrefix(trimmed, "<") {
+		result.Text = trimmed
+		return result, nil
+	}
+	// NLSML wraps the interpretations in a result, pocketsphinx sends a single interpretation
+	var single speechInterpretationXML
+	if err := unmarshalXML([]byte(trimmed), &single); err != nil {
+		return nil, err
+	}
+	best := single
+	if single.XMLName.Local != "interpretation" {
+		var decoded speechResultXML
+		if err := unmarshalXML([]byte(trimmed), &decoded); err != nil {
+			return nil, err
+		}
+		if len(decoded.Interpretations) == 0 {
+			return result, nil
+		}
+		// Interpretations are listed best first
+		best = decoded.Interpretations[0]
+	}
+	result.Text = strings.TrimSpace(best.Instance)
+	if result.Text == "" {
+		result.Text = strings.TrimSpace(best.Input.Text)
+	}
+	result.Confidence = parseConfidence(firstNonEmpty(best.Confidence, best.Score, best.Input.Confidence))
+	return result, nil
+}
+
+// parseConfidence - Engines report either 0 to 1 or 0 to 100
+func parseConfidence(value string) float64 {
+	confidence, err := strconv.ParseFloat(strings.TrimSpace(value), 64)
+	if err != nil || confidence < 0 {
+		return 0
+	}
+	if confidence > 1 {
+		confidence /= 100
+	}
+	return confidence
+}
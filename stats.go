@@ -0,0 +1,148 @@
+/*
+ * Copyright (c) 2021 LuanDNH
+ *
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at https://mozilla.org/MPL/2.0/.
+ *
+ * Contributor(s):
+ * LuanDNH <luandnh98@gmail.com>
+ */
+
+package goesl
+
+import (
+	"io"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// ConnectionStats - Snapshot of the counters of a connection, see ESLConnection.Stats
+type ConnectionStats struct {
+	// CommandsSent - Frames written, auth included
+	CommandsSent uint64
+	// RepliesReceived - command/reply and api/response messages read
+	RepliesReceived uint64
+	// EventsReceived - Events read, EventsByName counts them by Event-Name, custom events as "CUSTOM subclass"
+	EventsReceived uint64
+	EventsByName   map[string]uint64
+	// ParseErrors - Malformed frames, whether they ended the connection or were kept with ParseLenient
+	ParseErrors uint64
+	// DroppedEvents - See ESLConnection.DroppedEvents
+	DroppedEvents uint64
+	// MissedEvents - Events freeswitch did not send, with Options.DetectEventGaps
+	MissedEvents uint64
+	// Reconnects - Connections established by a Client after its first one, always 0 for a connection
+	Reconnects uint64
+	// BytesRead and BytesWritten - Bytes exchanged on the socket
+	BytesRead    uint64
+	BytesWritten uint64
+	// LastSent, LastReceived and LastEvent - When a frame was last written, a message and an event last read,
+	// zero until then
+	LastSent     time.Time
+	LastReceived time.Time
+	LastEvent    time.Time
+}
+
+// connectionStats - Counters updated by the writer and the read loop, 64 bit fields first for atomic access
+type connectionStats struct {
+	commandsSent    uint64
+	repliesReceived uint64
+	eventsReceived  uint64
+	parseErrors     uint64
+	bytesRead       uint64
+	bytesWritten    uint64
+	missedEvents    uint64
+	// lastSent, lastReceived and lastEvent - Unix nanoseconds
+	lastSent     int64
+	lastReceived int64
+	lastEvent    int64
+
+	eventsLock   sync.Mutex
+	eventsByName map[string]uint64
+}
+
+func newConnectionStats() *connectionStats {
+	return &connectionStats{eventsByName: make(map[string]uint64)}
+}
+
+// sent - Count a frame of size bytes written
+func (s *connectionStats) sent(size int) {
+	atomic.AddUint64(&s.commandsSent, 1)
+	atomic.AddUint64(&s.bytesWritten, uint64(size))
+	atomic.StoreInt64(&s.lastSent, time.Now().UnixNano())
+}
+
+// received - Count a message read
+func (s *connectionStats) received(msg *ESLResponse) {
+	now := time.Now().UnixNano()
+	atomic.StoreInt64(&s.lastReceived, now)
+	if !msg.IsEvent() {
+		if isReply(msg) {
+			atomic.AddUint64(&s.repliesReceived, 1)
+		}
+		return
+	}
+	atomic.AddUint64(&s.eventsReceived, 1)
+	atomic.StoreInt64(&s.lastEvent, now)
+	name := msg.GetHeader("Event-Name")
+	if name == EventCustom {
+		name += " " + msg.GetHeader("Event-Subclass")
+	}
+	s.eventsLock.Lock()
+	s.eventsByName[name]++
+	s.eventsLock.Unlock()
+}
+
+// malformed - Count a parse error, s may be nil for a parser without connection
+func (s *connectionStats) malformed() {
+	if s != nil {
+		atomic.AddUint64(&s.parseErrors, 1)
+	}
+}
+
+// countingReader - Socket reader counting the bytes read
+type countingReader struct {
+	reader io.Reader
+	count  *uint64
+}
+
+func (r countingReader) Read(p []byte) (int, error) {
+	n, err := r.reader.Read(p)
+	atomic.AddUint64(r.count, uint64(n))
+	return n, err
+}
+
+// Stats - Counters of the connection since it was created, safe to call at any time, like from a health endpoint
+func (c *ESLConnection) Stats() ConnectionStats {
+	s := c.stats
+	stats := ConnectionStats{
+		CommandsSent:    atomic.LoadUint64(&s.commandsSent),
+		RepliesReceived: atomic.LoadUint64(&s.repliesReceived),
+		EventsReceived:  atomic.LoadUint64(&s.eventsReceived),
+		ParseErrors:     atomic.LoadUint64(&s.parseErrors),
+		DroppedEvents:   c.DroppedEvents(),
+		MissedEvents:    atomic.LoadUint64(&s.missedEvents),
+		BytesRead:       atomic.LoadUint64(&s.bytesRead),
+		BytesWritten:    atomic.LoadUint64(&s.bytesWritten),
+		LastSent:        unixNanoTime(atomic.LoadInt64(&s.lastSent)),
+		LastReceived:    unixNanoTime(atomic.LoadInt64(&s.lastReceived)),
+		LastEvent:       unixNanoTime(atomic.LoadInt64(&s.lastEvent)),
+	}
+	s.eventsLock.Lock()
+	stats.EventsByName = make(map[string]uint64, len(s.eventsByName))
+	for name, count := range s.eventsByName {
+		stats.EventsByName[name] = count
+	}
+	s.eventsLock.Unlock()
+	return stats
+}
+
+// unixNanoTime - Time of nanoseconds since the epoch, the zero time for 0
+func unixNanoTime(nanoseconds int64) time.Time {
+	if nanoseconds == 0 {
+		return time.Time{}
+	}
+	return time.Unix(0, nanoseconds)
+}
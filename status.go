@@ -0,0 +1,108 @@
+/*
+ * Copyright (c) 2021 LuanDNH
+ *
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at https://mozilla.org/MPL/2.0/.
+ *
+ * Contributor(s):
+ * LuanDNH <luandnh98@gmail.com>
+ */
+
+package goesl
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// CoreStatus - Parsed output of api status
+type CoreStatus struct {
+	Up                        bool
+	Uptime                    time.Duration
+	Version                   string
+	Ready                     bool
+	SessionsSinceStartup      int
+	Sessions                  int
+	SessionsPeak              int
+	SessionsPeak5Min          int
+	SessionsPerSecond         int
+	SessionsPerSecondMax      int
+	SessionsPerSecondPeak     int
+	SessionsPerSecondPeak5Min int
+	MaxSessions               int
+	// MinIdleCPU - Configured min-idle-cpu, IdleCPU the current idle cpu percentage
+	MinIdleCPU float64
+	IdleCPU    float64
+	// StackSize and StackMax are in bytes
+	StackSize int
+	StackMax  int
+}
+
+var (
+	statusUptimeRegexp   = regexp.MustCompile(`(\d+) (year|day|hour|minute|second|millisecond|microsecond)s?`)
+	statusVersionRegexp  = regexp.MustCompile(`\(Version ([^)]+)\)`)
+	statusSinceRegexp    = regexp.MustCompile(`(\d+) session\(s\) since startup`)
+	statusSessionsRegexp = regexp.MustCompile(`^(\d+) session\(s\) - peak (\d+), last 5min (\d+)`)
+	statusPerSecRegexp   = regexp.MustCompile(`(\d+) session\(s\) per Sec out of max (\d+), peak (\d+), last 5min (\d+)`)
+	statusMaxRegexp      = regexp.MustCompile(`(\d+) session\(s\) max`)
+	statusCPURegexp      = regexp.MustCompile(`min idle cpu ([\d.]+)/([\d.]+)`)
+	statusStackRegexp    = regexp.MustCompile(`Stack Size/Max (\d+)K/(\d+)K`)
+)
+
+var uptimeUnits = map[string]time.Duration{
+	"year":        365 * 24 * time.Hour,
+	"day":         24 * time.Hour,
+	"hour":        time.Hour,
+	"minute":      time.Minute,
+	"second":      time.Second,
+	"millisecond": time.Millisecond,
+	"microsecond": time.Microsecond,
+}
+
+// Status - Run api status and parse it into a CoreStatus
+func (c *ESLConnection) Status() (*CoreStatus, error) {
+	response, err := c.query("status")
+	if err != nil {
+		return nil, err
+	}
+	return parseCoreStatus(string(response.Body)), nil
+}
+
+func parseCoreStatus(body string) *CoreStatus {
+	status := &CoreStatus{}
+	for _, line := range strings.Split(body, "\n") {
+		line = strings.TrimSpace(line)
+		switch {
+		case strings.HasPrefix(line, "UP "):
+			status.Up = true
+			for _, m := range statusUptimeRegexp.FindAllStringSubmatch(line, -1) {
+				status.Uptime += time.Duration(atoi(m[1])) * uptimeUnits[m[2]]
+			}
+		case statusVersionRegexp.MatchString(line):
+			status.Version = statusVersionRegexp.FindStringSubmatch(line)[1]
+			status.Ready = strings.HasSuffix(line, "is ready")
+		case statusSinceRegexp.MatchString(line):
+			status.SessionsSinceStartup = atoi(statusSinceRegexp.FindStringSubmatch(line)[1])
+		case statusSessionsRegexp.MatchString(line):
+			m := statusSessionsRegexp.FindStringSubmatch(line)
+			status.Sessions, status.SessionsPeak, status.SessionsPeak5Min = atoi(m[1]), atoi(m[2]), atoi(m[3])
+		case statusPerSecRegexp.MatchString(line):
+			m := statusPerSecRegexp.FindStringSubmatch(line)
+			status.SessionsPerSecond, status.SessionsPerSecondMax = atoi(m[1]), atoi(m[2])
+			status.SessionsPerSecondPeak, status.SessionsPerSecondPeak5Min = atoi(m[3]), atoi(m[4])
+		case statusMaxRegexp.MatchString(line):
+			status.MaxSessions = atoi(statusMaxRegexp.FindStringSubmatch(line)[1])
+		case statusCPURegexp.MatchString(line):
+			m := statusCPURegexp.FindStringSubmatch(line)
+			status.MinIdleCPU, _ = strconv.ParseFloat(m[1], 64)
+			status.IdleCPU, _ = strconv.ParseFloat(m[2], 64)
+		case statusStackRegexp.MatchString(line):
+			m := statusStackRegexp.FindStringSubmatch(line)
+			status.StackSize, status.StackMax = atoi(m[1])*1024, atoi(m[2])*1024
+		}
+	}
+	return status
+}
@@ -0,0 +1,66 @@
+/*
+ * Copyright (c) 2021 LuanDNH
+ *
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at https://mozilla.org/MPL/2.0/.
+ *
+ * Contributor(s):
+ * LuanDNH <luandnh98@gmail.com>
+ */
+
+package goesl
+
+import (
+	"bufio"
+	"context"
+	"io"
+	"sync"
+)
+
+// replyStream - Body of an api/response read straight from the socket, limited to its Content-Length.
+// The read loop waits for it to be read to the end or closed before parsing the next message
+type replyStream struct {
+	reader *io.LimitedReader
+	done   chan struct{}
+	once   sync.Once
+}
+
+func newReplyStream(r *bufio.Reader, length int64) *replyStream {
+	return &replyStream{
+		reader: &io.LimitedReader{R: r, N: length},
+		done:   make(chan struct{}),
+	}
+}
+
+// Read - Read the body, io.ErrUnexpectedEOF is returned if the connection ends before Content-Length bytes
+func (s *replyStream) Read(p []byte) (int, error) {
+	n, err := s.reader.Read(p)
+	if err == io.EOF && s.reader.N > 0 {
+		err = io.ErrUnexpectedEOF
+	}
+	if err != nil {
+		s.release()
+	}
+	return n, err
+}
+
+// Close - Discard what is left of the body so the connection can go on with the next message
+func (s *replyStream) Close() error {
+	defer s.release()
+	_, err := io.Copy(io.Discard, s.reader)
+	return err
+}
+
+func (s *replyStream) release() {
+	s.once.Do(func() {
+		close(s.done)
+	})
+}
+
+func (s *replyStream) wait(ctx context.Context) {
+	select {
+	case <-s.done:
+	case <-ctx.Done():
+	}
+}
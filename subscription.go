@@ -0,0 +1,190 @@
+/*
+ * Copyright (c) 2021 LuanDNH
+ *
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at https://mozilla.org/MPL/2.0/.
+ *
+ * Contributor(s):
+ * LuanDNH <luandnh98@gmail.com>
+ */
+
+package goesl
+
+import (
+	"errors"
+	"sort"
+	"strings"
+)
+
+const (
+	EventFormatPlain = "plain"
+	EventFormatJSON  = "json"
+	EventFormatXML   = "xml"
+)
+
+// Subscribe - Subscribe to events in the given format (plain, json or xml).
+// Subscriptions are reference counted, the event command is only sent for events not already subscribed,
+// CUSTOM subclasses are given as "CUSTOM sofia::register" like in the event command
+func (c *ESLConnection) Subscribe(format string, events ...string) error {
+	c.subscriptionLock.Lock()
+	defer c.subscriptionLock.Unlock()
+
+	if c.subscriptionFormat != "" && len(c.subscriptions) > 0 && c.subscriptionFormat != format {
+		return errors.New("event format already set to " + c.subscriptionFormat)
+	}
+
+	keys := parseSubscriptionKeys(events)
+	var added []string
+	for _, key := range keys {
+		if !IsEventName(key) && !strings.HasPrefix(key, EventCustom+" ") {
+			c.logger.Warn("subscribing to unknown event %s", key)
+		}
+		if c.subscriptions[key] == 0 {
+			added = append(added, key)
+		}
+		c.subscriptions[key]++
+	}
+	// With ALL already active the effective set does not change
+	if c.subscriptions[EventAll] > 0 && !IsExistInSlice(EventAll, added) {
+		added = nil
+	}
+	if len(added) == 0 {
+		return nil
+	}
+	if _, err := c.Send("event " + format + " " + joinSubscriptionKeys(added)); err != nil {
+		for _, key := range keys {
+			c.decrementSubscription(key)
+		}
+		return err
+	}
+	c.subscriptionFormat = format
+	return nil
+}
+
+// MyEvents - Receive every event of the channel uuid in the given format, uuid may be empty on an outbound
+// connection for its own channel. Later subscriptions made by the helpers use the same format
+func (c *ESLConnection) MyEvents(format, uuid string) error {
+	switch format {
+	case EventFormatPlain, EventFormatJSON, EventFormatXML:
+	default:
+		return errors.New("unsupported event format : " + format)
+	}
+	cmd := "myevents " + format
+	if uuid != "" {
+		cmd += " " + uuid
+	}
+	if _, err := c.Send(cmd); err != nil {
+		return err
+	}
+	c.subscriptionLock.Lock()
+	c.subscriptionFormat = format
+	c.subscriptionLock.Unlock()
+	return nil
+}
+
+// Unsubscribe - Release events previously subscribed with Subscribe.
+// The nixevent command is only sent for events no other subscriber still holds
+func (c *ESLConnection) Unsubscribe(events ...string) error {
+	c.subscriptionLock.Lock()
+	defer c.subscriptionLock.Unlock()
+
+	var removed []string
+	for _, key := range parseSubscriptionKeys(events) {
+		if c.subscriptions[key] == 0 {
+			continue
+		}
+		if c.decrementSubscription(key) {
+			removed = append(removed, key)
+		}
+	}
+	if len(removed) == 0 {
+		return nil
+	}
+
+	if IsExistInSlice(EventAll, removed) {
+		// nixevent ALL drops every event, start over with what is left
+		if _, err := c.Send("noevents"); err != nil {
+			return err
+		}
+		if remaining := c.subscribedKeys(); len(remaining) > 0 {
+			_, err := c.Send("event " + c.subscriptionFormat + " " + joinSubscriptionKeys(remaining))
+			return err
+		}
+		return nil
+	}
+	if c.subscriptions[EventAll] > 0 {
+		return nil
+	}
+	_, err := c.Send("nixevent " + joinSubscriptionKeys(removed))
+	return err
+}
+
+// Subscriptions - List events currently subscribed through Subscribe
+func (c *ESLConnection) Subscriptions() []string {
+	c.subscriptionLock.Lock()
+	defer c.subscriptionLock.Unlock()
+	return c.subscribedKeys()
+}
+
+func (c *ESLConnection) decrementSubscription(key string) bool {
+	c.subscriptions[key]--
+	if c.subscriptions[key] <= 0 {
+		delete(c.subscriptions, key)
+		return true
+	}
+	return false
+}
+
+func (c *ESLConnection) subscribedKeys() []string {
+	keys := make([]string, 0, len(c.subscriptions))
+	for key := range c.subscriptions {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// parseSubscriptionKeys - Split event lists the way mod_event_socket does, every word after CUSTOM is a subclass.
+// CUSTOM without subclasses is a key of its own, for the custom events which have none
+func parseSubscriptionKeys(events []string) []string {
+	var keys []string
+	custom, subclasses := false, false
+	for _, event := range events {
+		for _, word := range strings.Fields(event) {
+			if custom {
+				keys = append(keys, EventCustom+" "+word)
+				subclasses = true
+				continue
+			}
+			if strings.ToUpper(word) == EventCustom {
+				custom = true
+				continue
+			}
+			keys = append(keys, strings.ToUpper(word))
+		}
+	}
+	if custom && !subclasses {
+		keys = append(keys, EventCustom)
+	}
+	return keys
+}
+
+// joinSubscriptionKeys - Build the event list of an event or nixevent command, subclasses must come last
+func joinSubscriptionKeys(keys []string) string {
+	var names, subclasses []string
+	for _, key := range keys {
+		if strings.HasPrefix(key, EventCustom+" ") {
+			subclasses = append(subclasses, strings.TrimPrefix(key, EventCustom+" "))
+			continue
+		}
+		if key != EventCustom {
+			names = append(names, key)
+		}
+	}
+	if len(subclasses) > 0 || IsExistInSlice(EventCustom, keys) {
+		names = append(names, EventCustom)
+		names = append(names, subclasses...)
+	}
+	return strings.Join(names, " ")
+}
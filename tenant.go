@@ -0,0 +1,230 @@
+/*
+ * Copyright (c) 2021 LuanDNH
+ *
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at https://mozilla.org/MPL/2.0/.
+ *
+ * Contributor(s):
+ * LuanDNH <luandnh98@gmail.com>
+ */
+
+package goesl
+
+import (
+	"strconv"
+	"sync"
+	"sync/atomic"
+)
+
+// TenantRouter - Splits the events of a connection into a stream per tenant, keyed by a header like
+// variable_domain_name. Every stream has its own queue, goroutine and handlers, so a slow tenant only drops
+// its own events. The router does not subscribe events on the connection, see Subscribe
+type TenantRouter struct {
+	// unrouted - Events of no stream, first for atomic access
+	unrouted    uint64
+	dispatcher  *OrderedDispatcher
+	headers     []string
+	queueSize   int
+	onNewTenant func(stream *TenantStream)
+	lock        sync.RWMutex
+	streams     map[string]*TenantStream
+	closeOnce   sync.Once
+}
+
+// TenantStream - Events of a tenant of a TenantRouter
+type TenantStream struct {
+	dropped uint64
+	// Tenant - Value of the header the stream is keyed by, empty for the events without it
+	Tenant string
+
+	router       *TenantRouter
+	queue        chan *Event
+	handlersLock sync.RWMutex
+	handlers     map[string]EventListener
+	nextHandler  uint64
+	done         chan struct{}
+	once         sync.Once
+}
+
+// NewTenantRouter - Start a router fed by the events of c until Close. The tenant of an event is the value of
+// the first of headers it has, like "variable_domain_name" then "domain" for the events of no channel.
+// queueSize is the queue of each stream, DefaultBusQueueSize when 0. onNewTenant is called from the router
+// goroutine with the stream of a tenant seen for the first time, to add its handlers. When it is nil
+// only the streams created with Tenant get events
+func (c *ESLConnection) NewTenantRouter(queueSize int, onNewTenant func(stream *TenantStream), headers ...string) *TenantRouter {
+	if queueSize <= 0 {
+		queueSize = DefaultBusQueueSize
+	}
+	router := &TenantRouter{
+		headers:     headers,
+		queueSize:   queueSize,
+		onNewTenant: onNewTenant,
+		streams:     make(map[string]*TenantStream),
+	}
+	// A single worker so every stream gets its events in the order received
+	router.dispatcher = c.DispatchOrdered(1, 0, router.route)
+	return router
+}
+
+// Tenant - Stream of tenant, created when needed. The empty tenant gets the events without any of the headers
+func (r *TenantRouter) Tenant(tenant string) *TenantStream {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	return r.stream(tenant)
+}
+
+// stream - Stream of tenant, called with the lock held
+func (r *TenantRouter) stream(tenant string) *TenantStream {
+	if stream, ok := r.streams[tenant]; ok {
+		return stream
+	}
+	stream := &TenantStream{
+		Tenant:   tenant,
+		router:   r,
+		queue:    make(chan *Event, r.queueSize),
+		handlers: make(map[string]EventListener),
+		done:     make(chan struct{}),
+	}
+	r.streams[tenant] = stream
+	go stream.run()
+	return stream
+}
+
+// Remove - Stop the stream of tenant and wait until its handlers return, it must not be called from them.
+// Events still queued are released without being handled
+func (r *TenantRouter) Remove(tenant string) {
+	r.lock.Lock()
+	stream, ok := r.streams[tenant]
+	delete(r.streams, tenant)
+	r.lock.Unlock()
+	if !ok {
+		return
+	}
+	stream.once.Do(func() {
+		// Nothing is queued once removed, routing happens under the read lock
+	drain:
+		for {
+			select {
+			case event := <-stream.queue:
+				event.Release()
+			default:
+				break drain
+			}
+		}
+		close(stream.queue)
+	})
+	<-stream.done
+}
+
+// Tenants - Tenants having a stream
+func (r *TenantRouter) Tenants() []string {
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+	tenants := make([]string, 0, len(r.streams))
+	for tenant := range r.streams {
+		tenants = append(tenants, tenant)
+	}
+	return tenants
+}
+
+// Unrouted - Events of a tenant without stream, when there is no onNewTenant
+func (r *TenantRouter) Unrouted() uint64 {
+	return atomic.LoadUint64(&r.unrouted)
+}
+
+// Close - Stop the router and every stream, the events already queued are still handled
+func (r *TenantRouter) Close() {
+	r.closeOnce.Do(func() {
+		r.dispatcher.Stop()
+		r.lock.Lock()
+		streams := r.streams
+		r.streams = make(map[string]*TenantStream)
+		r.lock.Unlock()
+		for _, stream := range streams {
+			stream.once.Do(func() { close(stream.queue) })
+			<-stream.done
+		}
+	})
+}
+
+// tenantOf - Value of the first header event has
+func (r *TenantRouter) tenantOf(event *Event) string {
+	for _, header := range r.headers {
+		if tenant := event.GetHeader(header); tenant != "" {
+			return tenant
+		}
+	}
+	return ""
+}
+
+func (r *TenantRouter) route(event *Event) {
+	tenant := r.tenantOf(event)
+	r.lock.RLock()
+	stream, ok := r.streams[tenant]
+	r.lock.RUnlock()
+	if !ok {
+		if r.onNewTenant == nil {
+			atomic.AddUint64(&r.unrouted, 1)
+			return
+		}
+		r.lock.Lock()
+		stream = r.stream(tenant)
+		r.lock.Unlock()
+		// Called before the first event is queued, so its handlers see it
+		r.dispatcher.connection.runHandler("new tenant handler", func() { r.onNewTenant(stream) })
+	}
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+	if r.streams[tenant] != stream {
+		// Removed by onNewTenant
+		return
+	}
+	event.retain()
+	select {
+	case stream.queue <- event:
+	default:
+		event.Release()
+		atomic.AddUint64(&stream.dropped, 1)
+	}
+}
+
+// Handle - Add a handler called with every event of the stream, from the goroutine of the stream.
+// The returned id is used to remove it
+func (s *TenantStream) Handle(handler EventListener) string {
+	s.handlersLock.Lock()
+	defer s.handlersLock.Unlock()
+	s.nextHandler++
+	id := strconv.FormatUint(s.nextHandler, 10)
+	s.handlers[id] = handler
+	return id
+}
+
+// RemoveHandler - Remove a handler added with Handle
+func (s *TenantStream) RemoveHandler(id string) {
+	s.handlersLock.Lock()
+	defer s.handlersLock.Unlock()
+	delete(s.handlers, id)
+}
+
+// Dropped - Events dropped because the queue of the stream was full
+func (s *TenantStream) Dropped() uint64 {
+	return atomic.LoadUint64(&s.dropped)
+}
+
+func (s *TenantStream) run() {
+	defer close(s.done)
+	for event := range s.queue {
+		s.handlersLock.RLock()
+		handlers := make([]EventListener, 0, len(s.handlers))
+		for _, handler := range s.handlers {
+			handlers = append(handlers, handler)
+		}
+		s.handlersLock.RUnlock()
+		for _, handler := range handlers {
+			event.retain()
+			s.router.dispatcher.connection.callListener(handler, event)
+		}
+		event.Release()
+	}
+}
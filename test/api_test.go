@@ -0,0 +1,974 @@
+/*
+ * Copyright (c) 2021 LuanDNH
+ *
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at https://mozilla.org/MPL/2.0/.
+ *
+ * Contributor(s):
+ * LuanDNH <luandnh98@gmail.com>
+ */
+
+package test
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/luandnh/goesl"
+	"github.com/stretchr/testify/assert"
+)
+
+const statusBody = `UP 0 years, 1 day, 2 hours, 3 minutes, 4 seconds, 5 milliseconds, 6 microseconds
+FreeSWITCH (Version 1.10.7 -release 64bit) is ready
+120 session(s) since startup
+3 session(s) - peak 10, last 5min 4 
+1 session(s) per Sec out of max 30, peak 5, last 5min 2 
+1000 session(s) max
+min idle cpu 0.00/97.53
+Current Stack Size/Max 240K/8192K
+`
+
+func TestConnection_Status(t *testing.T) {
+	con, fs := newPipeConnection(t)
+	go func() {
+		if readCommand(fs) == "api status" {
+			fs.APIResponse(statusBody)
+		}
+	}()
+	status, err := con.Status()
+	assert.Nil(t, err)
+	assert.True(t, status.Up)
+	assert.True(t, status.Ready)
+	assert.Equal(t, "1.10.7 -release 64bit", status.Version)
+	assert.Equal(t, 26*time.Hour+3*time.Minute+4*time.Second+5*time.Millisecond+6*time.Microsecond, status.Uptime)
+	assert.Equal(t, 120, status.SessionsSinceStartup)
+	assert.Equal(t, 3, status.Sessions)
+	assert.Equal(t, 10, status.SessionsPeak)
+	assert.Equal(t, 30, status.SessionsPerSecondMax)
+	assert.Equal(t, 1000, status.MaxSessions)
+	assert.Equal(t, 97.53, status.IdleCPU)
+	assert.Equal(t, 8192*1024, status.StackMax)
+}
+
+func TestConnection_ChannelVar(t *testing.T) {
+	con, fs := newPipeConnection(t)
+	go func() {
+		readCommand(fs)
+		fs.APIResponse("_undef_")
+		readCommand(fs)
+		fs.APIResponse("-ERR No such channel!\n")
+		fs.ExpectCommand(`api uuid_setvar abc greeting 'it\'s me'`)
+		fs.APIResponse("+OK")
+	}()
+	_, ok, err := con.GetChannelVar("abc", "missing")
+	assert.Nil(t, err)
+	assert.False(t, ok)
+	// A -ERR reply must not close the connection
+	_, _, err = con.GetChannelVar("gone", "missing")
+	assert.EqualError(t, err, "unsuccessful reply : No such channel!")
+	assert.Nil(t, con.SetChannelVar("abc", "greeting", "it's me"))
+}
+
+func TestConnection_SetVars(t *testing.T) {
+	con, fs := newPipeConnection(t)
+	go func() {
+		fs.ExpectCommand(`api uuid_setvar_multi abc a=x\=1\;y;b=;c=it\'s me`)
+		fs.APIResponse("+OK")
+		for _, app := range []string{"set", "export", "push"} {
+			frame, body := readFrame(fs)
+			assert.Equal(t, "sendmsg abc\ncall-command: execute\nexecute-app-name: "+app+"\nevent-lock: true\ncontent-type: text/plain\nContent-Length: 9", frame)
+			assert.Equal(t, "name=a=b;", body)
+			fs.Reply("+OK")
+		}
+	}()
+	assert.Nil(t, con.SetChannelVars("abc", map[string]string{"c": "it's me", "a": "x=1;y", "b": ""}))
+	assert.Nil(t, con.SetVar("abc", "name", "a=b;"))
+	assert.Nil(t, con.ExportVar("abc", "name", "a=b;"))
+	assert.Nil(t, con.PushVar("abc", "name", "a=b;"))
+	assert.NotNil(t, con.SetVar("abc", "bad name", "x"))
+	assert.NotNil(t, con.SetChannelVars("abc", map[string]string{"a": "line\nbreak"}))
+}
+
+func TestConnection_SendChatMessage(t *testing.T) {
+	con, fs := newPipeConnection(t)
+	frames := make(chan [2]string, 1)
+	go func() {
+		command, body := readFrame(fs)
+		frames <- [2]string{command, body}
+		fs.Reply("+OK")
+	}()
+	err := con.SendChatMessage(goesl.NewChatMessage("internal", "1000", "example.com", "hello there"))
+	assert.Nil(t, err)
+	frame := <-frames
+	assert.Equal(t, "sendevent SEND_MESSAGE\nprofile: internal\nuser: 1000\nhost: example.com\ncontent-type: text/plain\nContent-Length: 11", frame[0])
+	assert.Equal(t, "hello there", frame[1])
+}
+
+func TestCommand_Quoting(t *testing.T) {
+	assert.Equal(t, `uuid_setvar abc name 'John O\'Neil'`, goesl.Command("uuid_setvar", "abc", "name", "John O'Neil"))
+	assert.Equal(t, `uuid_setvar abc x 'a b'`, goesl.Command("uuid_setvar", "abc", "x", "a\nb"))
+	assert.Equal(t, `echo '\$\${hostname} \\\\'`, goesl.SafeCommand("echo", `$${hostname} \`))
+}
+
+func TestConnection_ListUsers(t *testing.T) {
+	con, fs := newPipeConnection(t)
+	go func() {
+		if readCommand(fs) == "api list_users domain example.com" {
+			fs.APIResponse("userid|context|domain|group|contact|callgroup|effective_caller_id_name|effective_caller_id_number\n" +
+				"1000|default|example.com|default|sofia/internal/sip:1000@10.0.0.5:5060|techsupport|Extension 1000|1000\n" +
+				"1001|default|example.com|default|error/user_not_registered|techsupport|Extension 1001|1001\n\n+OK\n")
+		}
+	}()
+	users, err := con.ListUsers("example.com")
+	assert.Nil(t, err)
+	assert.Len(t, users, 2)
+	assert.Equal(t, "Extension 1000", users[0].EffectiveCallerIDName)
+	assert.True(t, users[0].IsRegistered())
+	assert.False(t, users[1].IsRegistered())
+}
+
+func TestConnection_AudioFork(t *testing.T) {
+	con, fs := newPipeConnection(t)
+	go func() {
+		for _, expected := range []string{
+			`api uuid_audio_fork abc start wss://asr.example.com/stream stereo 16k {"lang":"en"}`,
+			`api uuid_audio_fork abc send_text 'hello there'`,
+			`api uuid_audio_fork abc stop`,
+			`api uuid_record abc start /tmp/abc.wav 60`,
+			`api uuid_record abc stop all`,
+		} {
+			assert.Equal(t, expected, readCommand(fs))
+			fs.APIResponse("+OK Success\n")
+		}
+	}()
+	assert.Nil(t, con.AudioForkStart("abc", goesl.AudioForkOptions{
+		URL:        "wss://asr.example.com/stream",
+		Mix:        goesl.AudioForkStereo,
+		SampleRate: 16000,
+		Metadata:   `{"lang":"en"}`,
+	}))
+	assert.NotNil(t, con.AudioForkStart("abc", goesl.AudioForkOptions{URL: "http://example.com"}))
+	assert.NotNil(t, con.AudioForkStart("abc", goesl.AudioForkOptions{URL: "ws://example.com", SampleRate: 12000}))
+	assert.Nil(t, con.AudioForkSendText("abc", "hello there"))
+	assert.Nil(t, con.AudioForkStop("abc", ""))
+	assert.Nil(t, con.RecordStart("abc", "/tmp/abc.wav", 60))
+	assert.Nil(t, con.RecordStop("abc", ""))
+
+	event := newEvent(t, `{"Event-Name":"CUSTOM","Event-Subclass":"mod_audio_fork::json","Unique-ID":"abc","_body":"{\"text\":\"hi\"}"}`)
+	fork, ok := goesl.ParseAudioForkEvent(event)
+	if assert.True(t, ok) {
+		assert.Equal(t, "abc", fork.UUID)
+		assert.Equal(t, goesl.AudioForkJSON, fork.Subclass)
+		assert.Equal(t, `{"text":"hi"}`, string(fork.Body))
+	}
+	_, ok = goesl.ParseAudioForkEvent(newEvent(t, `{"Event-Name":"CHANNEL_ANSWER","Unique-ID":"abc"}`))
+	assert.False(t, ok)
+}
+
+func TestConnection_JSONApi(t *testing.T) {
+	con, fs := newPipeConnection(t)
+	go func() {
+		fs.ExpectCommand(`api json {"command":"status"}`)
+		fs.APIResponse(`{"command":"status","status":"success","response":{"systemStatus":"ready","sessions":{"count":{"active":3}}}}`)
+		fs.ExpectCommand(`api json {"command":"mediaStats","data":{"uuid":"abc"}}`)
+		fs.APIResponse(`{"command":"mediaStats","data":{"uuid":"abc"},"status":"error","response":"Session not found"}`)
+		fs.ExpectCommand(`api json {"command":"bogus","data":"x"}`)
+		fs.APIResponse("-ERR JSON command parse error\n")
+	}()
+	var status struct {
+		SystemStatus string `json:"systemStatus"`
+		Sessions     struct {
+			Count struct {
+				Active int `json:"active"`
+			} `json:"count"`
+		} `json:"sessions"`
+	}
+	assert.Nil(t, con.JSONApiInto("status", nil, &status))
+	assert.Equal(t, "ready", status.SystemStatus)
+	assert.Equal(t, 3, status.Sessions.Count.Active)
+
+	_, err := con.JSONApi("mediaStats", json.RawMessage(`{"uuid":"abc"}`))
+	var apiErr *goesl.JSONApiError
+	if assert.ErrorAs(t, err, &apiErr) {
+		assert.Equal(t, "Session not found", apiErr.Message)
+	}
+	_, err = con.JSONApi("bogus", "x")
+	assert.NotNil(t, err)
+}
+
+func TestConnection_ApiDecode(t *testing.T) {
+	con, fs := newPipeConnection(t)
+	go func() {
+		fs.ExpectCommand("api show calls")
+		fs.APIResponse("uuid,direction,cid_num\nabc,inbound,1000\ndef,outbound,2000\n\n2 total.\n")
+		fs.ExpectCommand("api show registrations as json")
+		fs.APIResponse(`{"row_count":1,"rows":[{"reg_user":"1000","realm":"example.com"}]}`)
+		fs.ExpectCommand("api uuid_dump abc")
+		fs.APIResponse("Event-Name: CHANNEL_DATA\nUnique-ID: abc\nChannel-State: CS_EXECUTE\n")
+		for i := 0; i < 3; i++ {
+			fs.ExpectCommand("api version")
+			fs.APIResponse("FreeSWITCH Version 1.10.7\n")
+		}
+	}()
+	ctx := context.Background()
+	var calls []struct {
+		UUID      string `json:"uuid"`
+		Direction string `json:"direction"`
+	}
+	if assert.Nil(t, con.ApiDecode(ctx, "show calls", &calls)) && assert.Len(t, calls, 2) {
+		assert.Equal(t, "def", calls[1].UUID)
+		assert.Equal(t, "outbound", calls[1].Direction)
+	}
+	var registrations []map[string]string
+	assert.Nil(t, con.ApiDecode(ctx, "show registrations as json", &registrations))
+	assert.Equal(t, []map[string]string{{"reg_user": "1000", "realm": "example.com"}}, registrations)
+	var dump struct {
+		UUID  string `json:"Unique-ID"`
+		State string `json:"Channel-State"`
+	}
+	assert.Nil(t, con.ApiDecode(ctx, "uuid_dump abc", &dump))
+	assert.Equal(t, "CS_EXECUTE", dump.State)
+	var version map[string]string
+	assert.NotNil(t, con.ApiDecode(ctx, "version", &version))
+
+	unregister := goesl.RegisterApiDecoder(func(cmd string, body []byte, v interface{}) (bool, error) {
+		if cmd != "version" {
+			return false, nil
+		}
+		*v.(*map[string]string) = map[string]string{"version": strings.TrimPrefix(strings.TrimSpace(string(body)), "FreeSWITCH Version ")}
+		return true, nil
+	})
+	t.Cleanup(unregister)
+	assert.Nil(t, con.ApiDecode(ctx, "version", &version))
+	assert.Equal(t, "1.10.7", version["version"])
+
+	// Gone once unregistered
+	unregister()
+	assert.NotNil(t, con.ApiDecode(ctx, "version", &version))
+}
+
+func TestConnection_ShowChannels(t *testing.T) {
+	con, fs := newPipeConnection(t)
+	go func() {
+		fs.ExpectCommand("api show channels as json")
+		fs.APIResponse(`{"row_count":1,"rows":[{"uuid":"abc","direction":"inbound","created_epoch":"1600000000","name":"sofia/internal/1000@example.com","state":"CS_EXECUTE","callstate":"ACTIVE","cid_num":"1000","read_codec":"PCMU","read_rate":"8000","hostname":"fs1"}]}`)
+		// Without json support the csv output is parsed
+		fs.ExpectCommand("api show calls as json")
+		fs.APIResponse("-USAGE: [as json]\n")
+		fs.ExpectCommand("api show calls")
+		fs.APIResponse("uuid,direction,created_epoch,cid_num,hostname,call_uuid,call_created_epoch,b_uuid,b_direction,b_cid_num\n" +
+			"abc,inbound,1600000000,1000,fs1,abc,1600000002,def,outbound,2000\n\n1 total.\n")
+	}()
+	channels, err := con.ShowChannels()
+	if assert.Nil(t, err) && assert.Len(t, channels, 1) {
+		channel := channels[0]
+		assert.Equal(t, "abc", channel.UUID)
+		assert.Equal(t, "CS_EXECUTE", channel.State)
+		assert.Equal(t, "ACTIVE", channel.CallState)
+		assert.Equal(t, 8000, channel.ReadRate)
+		assert.Equal(t, time.Unix(1600000000, 0), channel.Created)
+		assert.Equal(t, "fs1", channel.Fields["hostname"])
+	}
+	calls, err := con.ShowCalls()
+	if assert.Nil(t, err) && assert.Len(t, calls, 1) {
+		call := calls[0]
+		assert.Equal(t, "abc", call.A.UUID)
+		assert.Equal(t, "def", call.B.UUID)
+		assert.Equal(t, "outbound", call.B.Direction)
+		assert.Equal(t, "2000", call.B.CIDNum)
+		assert.Equal(t, "fs1", call.B.Hostname)
+		assert.Equal(t, time.Unix(1600000002, 0), call.Created)
+	}
+}
+
+func TestConnection_ApiDecodeRaw(t *testing.T) {
+	con, fs := newPipeConnection(t)
+	go func() {
+		fs.ExpectCommand(`api json {"command":"status"}`)
+		fs.APIResponse(`{"status":"success","response":{"systemStatus":"ready"}}`)
+		fs.ExpectCommand("api hostname")
+		fs.APIResponse("fs1")
+	}()
+	var reply map[string]interface{}
+	if assert.Nil(t, con.ApiDecode(context.Background(), `json {"command":"status"}`, &reply)) {
+		assert.Equal(t, "success", reply["status"])
+	}
+	var hostname string
+	assert.Nil(t, con.ApiDecode(context.Background(), "hostname", &hostname))
+	assert.Equal(t, "fs1", hostname)
+}
+
+// Captured from sofia xmlstatus on freeswitch 1.10, declared ISO-8859-1 while the registration agent is utf-8
+const sofiaXMLStatus = `<?xml version="1.0" encoding="ISO-8859-1"?>
+<profiles>
+  <profile>
+    <name>external</name>
+    <type>profile</type>
+    <data>sip:mod_sofia@203.0.113.10:5080</data>
+    <state>RUNNING (0)</state>
+  </profile>
+  <gateway>
+    <name>external::carrier</name>
+    <type>gateway</type>
+    <data>sip:trunk@sip.carrier.example</data>
+    <state>REGED</state>
+  </gateway>
+  <profile>
+    <name>internal</name>
+    <type>profile</type>
+    <data>sip:mod_sofia@203.0.113.10:5060</data>
+    <state>RUNNING (2)</state>
+  </profile>
+  <alias>
+    <name>203.0.113.10</name>
+    <type>alias</type>
+    <data>internal</data>
+    <state>ALIASED</state>
+  </alias>
+</profiles>
+`
+
+const sofiaXMLStatusGateway = `<?xml version="1.0" encoding="ISO-8859-1"?>
+<gateways>
+  <gateway>
+    <name>carrier</name>
+    <profile>external</profile>
+    <scheme>Digest</scheme>
+    <realm>sip.carrier.example</realm>
+    <username>trunk</username>
+    <password>no</password>
+    <from>&lt;sip:trunk@sip.carrier.example&gt;</from>
+    <contact>&lt;sip:gw+carrier@203.0.113.10:5080;transport=udp;gw=carrier&gt;</contact>
+    <exten>trunk</exten>
+    <to>sip:trunk@sip.carrier.example</to>
+    <proxy>sip:sip.carrier.example</proxy>
+    <context>public</context>
+    <expires>3600</expires>
+    <freq>3600</freq>
+    <ping>1760490000</ping>
+    <pingfreq>30</pingfreq>
+    <pingmin>1</pingmin>
+    <pingcount>1</pingcount>
+    <pingmax>1</pingmax>
+    <pingtime>12.50</pingtime>
+    <pinging>0</pinging>
+    <state>REGED</state>
+    <status>UP</status>
+    <uptime-usec>5000000</uptime-usec>
+    <calls-in>3</calls-in>
+    <calls-out>7</calls-out>
+    <failed-calls-in>0</failed-calls-in>
+    <failed-calls-out>1</failed-calls-out>
+  </gateway>
+</gateways>
+`
+
+const sofiaXMLStatusReg = "<?xml version=\"1.0\" encoding=\"ISO-8859-1\"?>\n" + `<profile>
+  <registrations>
+    <registration>
+        <call-id>6b1f1f0e-2c3d-4e5f-8a9b-0c1d2e3f4a5b</call-id>
+        <user>1000@example.com</user>
+        <contact>&quot;1000&quot; &lt;sip:1000@198.51.100.7:5060;ob&gt;</contact>
+        <agent>Téléphone 2.1</agent>
+        <status>Registered(UDP)(unknown) exp(2026-10-15 03:00:00) expsecs(3590)</status>
+        <ping-status>Reachable</ping-status>
+        <ping-time>0.45</ping-time>
+        <host>fs1</host>
+        <network-ip>198.51.100.7</network-ip>
+        <network-port>5060</network-port>
+        <sip-auth-user>1000</sip-auth-user>
+        <sip-auth-realm>example.com</sip-auth-realm>
+        <mwi-account>1000@example.com</mwi-account>
+    </registration>
+  </registrations>
+</profile>
+`
+
+func TestConnection_SofiaStatus(t *testing.T) {
+	con, fs := newPipeConnection(t)
+	go func() {
+		fs.ExpectCommand("api sofia xmlstatus")
+		fs.APIResponse(sofiaXMLStatus)
+		fs.ExpectCommand("api sofia xmlstatus gateway")
+		fs.APIResponse(sofiaXMLStatusGateway)
+		fs.ExpectCommand("api sofia xmlstatus profile internal reg")
+		fs.APIResponse(sofiaXMLStatusReg)
+		fs.ExpectCommand("api sofia xmlstatus profile missing reg")
+		fs.APIResponse("Invalid Profile!\n")
+	}()
+	status, err := con.SofiaStatus()
+	if assert.Nil(t, err) {
+		assert.Equal(t, []goesl.SofiaProfile{
+			{Name: "external", URL: "sip:mod_sofia@203.0.113.10:5080", State: "RUNNING", Calls: 0},
+			{Name: "internal", URL: "sip:mod_sofia@203.0.113.10:5060", State: "RUNNING", Calls: 2},
+		}, status.Profiles)
+		assert.Equal(t, []goesl.SofiaAlias{{Name: "203.0.113.10", Profile: "internal", State: "ALIASED"}}, status.Aliases)
+		if assert.Len(t, status.Gateways, 1) {
+			gateway := status.Gateways[0]
+			assert.Equal(t, "carrier", gateway.Name)
+			assert.Equal(t, "<sip:trunk@sip.carrier.example>", gateway.From)
+			assert.Equal(t, 3600, gateway.Expires)
+			assert.Equal(t, 12500*time.Microsecond, gateway.PingTime)
+			assert.Equal(t, 5*time.Second, gateway.Uptime)
+			assert.Equal(t, 7, gateway.CallsOut)
+			assert.Equal(t, 1, gateway.FailedCallsOut)
+			assert.True(t, gateway.IsUp())
+			assert.True(t, gateway.IsRegistered())
+		}
+	}
+
+	registrations, err := con.SofiaRegistrations("internal")
+	if assert.Nil(t, err) && assert.Len(t, registrations, 1) {
+		registration := registrations[0]
+		assert.Equal(t, "1000@example.com", registration.User)
+		assert.Equal(t, `"1000" <sip:1000@198.51.100.7:5060;ob>`, registration.Contact)
+		assert.Equal(t, "Téléphone 2.1", registration.Agent)
+		assert.Equal(t, 450*time.Microsecond, registration.PingTime)
+		assert.Equal(t, 5060, registration.NetworkPort)
+	}
+
+	_, err = con.SofiaRegistrations("missing")
+	assert.EqualError(t, err, "unexpected sofia reply : Invalid Profile!")
+}
+
+func TestConnection_AdminCommands(t *testing.T) {
+	con, fs := newPipeConnection(t)
+	go func() {
+		fs.ExpectCommand("api reloadxml")
+		fs.APIResponse("+OK [Success]\n")
+		fs.ExpectCommand("api reloadacl")
+		fs.APIResponse("+OK acl reloaded\n")
+		fs.ExpectCommand("api reload mod_sofia")
+		fs.APIResponse("+OK Reloading XML\n+OK module unloaded\n+OK module loaded\n")
+		fs.ExpectCommand("api load mod_missing")
+		fs.APIResponse("-ERR [module load file routine returned an error]\n")
+		fs.ExpectCommand("api unload mod_sofia")
+		fs.APIResponse("+OK\n")
+		fs.ExpectCommand("api fsctl shutdown elegant")
+		fs.APIResponse("+OK\n")
+		fs.ExpectCommand("api fsctl shutdown")
+		fs.APIResponse("+OK\n")
+	}()
+	ctx := context.Background()
+	result, err := con.ReloadXML(ctx)
+	if assert.Nil(t, err) {
+		assert.True(t, result.Success)
+		assert.Equal(t, []string{"Success"}, result.Messages)
+	}
+	result, err = con.ReloadACL(ctx)
+	if assert.Nil(t, err) {
+		assert.True(t, result.Success)
+	}
+	result, err = con.ReloadModule(ctx, "mod_sofia")
+	if assert.Nil(t, err) {
+		assert.True(t, result.Success)
+		assert.Equal(t, []string{"Reloading XML", "module unloaded", "module loaded"}, result.Messages)
+	}
+	// A failed load is a result, not an error
+	result, err = con.LoadModule(ctx, "mod_missing")
+	if assert.Nil(t, err) {
+		assert.False(t, result.Success)
+		assert.Equal(t, []string{"module load file routine returned an error"}, result.Messages)
+		assert.Equal(t, "-ERR [module load file routine returned an error]\n", result.Raw)
+	}
+	result, err = con.UnloadModule(ctx, "mod_sofia")
+	if assert.Nil(t, err) {
+		assert.True(t, result.Success)
+		assert.Empty(t, result.Messages)
+	}
+	_, err = con.Shutdown(ctx, goesl.ShutdownElegant)
+	assert.Nil(t, err)
+	_, err = con.Shutdown(ctx, goesl.ShutdownNow)
+	assert.Nil(t, err)
+	// Invalid module names are refused before anything is sent
+	_, err = con.LoadModule(ctx, "mod_sofia; shutdown")
+	assert.NotNil(t, err)
+	_, err = con.UnloadModule(ctx, "")
+	assert.NotNil(t, err)
+}
+
+func TestConnection_Hupall(t *testing.T) {
+	con, fs := newPipeConnection(t)
+	go func() {
+		fs.ExpectCommand("api hupall MANAGER_REQUEST")
+		fs.APIResponse("+OK hangup all channels with cause MANAGER_REQUEST\n")
+		fs.ExpectCommand("api hupall NORMAL_CLEARING campaign 'spring sale'")
+		fs.APIResponse("+OK hangup all channels matching [campaign]=[spring sale] with cause NORMAL_CLEARING\n")
+		fs.ExpectCommand("api hupall USER_BUSY tenant a")
+		fs.APIResponse("-ERR Usage: hupall <cause> [<var> <value>]\n")
+	}()
+	assert.Nil(t, con.Hupall(goesl.HangupCauseManagerRequest, "", ""))
+	assert.Nil(t, con.Hupall(goesl.HangupCauseNormalClearing, "campaign", "spring sale"))
+	assert.EqualError(t, con.Hupall(goesl.HangupCauseUserBusy, "tenant", "a"), "unsuccessful reply : Usage: hupall <cause> [<var> <value>]")
+	assert.NotNil(t, con.Hupall(goesl.HangupCauseNormalClearing, "bad name", "x"))
+}
+
+func TestParseHangupCause(t *testing.T) {
+	for input, expected := range map[string]goesl.HangupCause{
+		"NORMAL_CLEARING":   goesl.HangupCauseNormalClearing,
+		" user_busy ":       goesl.HangupCauseUserBusy,
+		"16":                goesl.HangupCauseNormalClearing,
+		"ORIGINATOR_CANCEL": goesl.HangupCauseOriginatorCancel,
+	} {
+		cause, err := goesl.ParseHangupCause(input)
+		assert.Nil(t, err, input)
+		assert.Equal(t, expected, cause, input)
+	}
+	for _, input := range []string{"", "NOT_A_CAUSE", "4", "-1"} {
+		cause, err := goesl.ParseHangupCause(input)
+		assert.NotNil(t, err, input)
+		assert.Equal(t, goesl.HangupCauseNone, cause, input)
+	}
+	assert.Equal(t, "ORIGINATOR_CANCEL", goesl.HangupCauseOriginatorCancel.String())
+	assert.Equal(t, "UNKNOWN", goesl.HangupCause(4).String())
+}
+
+func TestConnection_Sched(t *testing.T) {
+	con, fs := newPipeConnection(t)
+	go func() {
+		fs.ExpectCommand("api sched_api +90 none status")
+		fs.APIResponse("+OK Added: 5\n")
+		fs.ExpectCommand("api sched_api 1600000000 abc uuid_kill abc USER_BUSY")
+		fs.APIResponse("+OK Added: 6\n")
+		fs.ExpectCommand("api sched_api @3600 abc uuid_transfer abc 1000 XML default")
+		fs.APIResponse("+OK Added: 7\n")
+		fs.ExpectCommand("api sched_del 5")
+		fs.APIResponse("+OK Deleted: 5\n")
+		fs.ExpectCommand("api sched_del abc")
+		fs.APIResponse("+OK Deleted: 2\n")
+		fs.ExpectCommand("api sched_api +1 none status")
+		fs.APIResponse("-ERR Invalid syntax\n")
+		fs.ExpectCommand("api sched_api +1 none status")
+		fs.APIResponse("+OK\n")
+	}()
+	id, err := con.SchedApi(goesl.SchedIn(90*time.Second+500*time.Millisecond), "", "status")
+	assert.Nil(t, err)
+	assert.Equal(t, 5, id)
+	id, err = con.SchedHangup(goesl.SchedAt(time.Unix(1600000000, 0)), "abc", goesl.HangupCauseUserBusy)
+	assert.Nil(t, err)
+	assert.Equal(t, 6, id)
+	id, err = con.SchedTransfer(goesl.SchedEvery(time.Hour), "abc", "1000", "", "default")
+	assert.Nil(t, err)
+	assert.Equal(t, 7, id)
+	assert.Nil(t, con.SchedDel(5))
+	assert.Nil(t, con.SchedDelGroup("abc"))
+
+	_, err = con.SchedApi(goesl.SchedIn(time.Second), "", "status")
+	assert.EqualError(t, err, "unsuccessful reply : Invalid syntax")
+	_, err = con.SchedApi(goesl.SchedIn(time.Second), "", "status")
+	assert.EqualError(t, err, "unexpected sched reply : +OK")
+}
+
+func TestConnection_SendNotify(t *testing.T) {
+	con, fs := newPipeConnection(t)
+	frames := make(chan [2]string, 4)
+	go func() {
+		for i := 0; i < 4; i++ {
+			command, body := readFrame(fs)
+			frames <- [2]string{command, body}
+			if i == 3 {
+				fs.Reply("-ERR invalid event")
+				continue
+			}
+			fs.Reply("+OK")
+		}
+	}()
+	assert.Nil(t, con.SendNotify(&goesl.Notify{
+		Profile:     "internal",
+		User:        "1000",
+		Host:        "example.com",
+		EventString: "talk",
+		ContentType: "application/simple-message-summary",
+		Body:        "Messages-Waiting: no",
+	}))
+	frame := <-frames
+	assert.Equal(t, "sendevent NOTIFY\nprofile: internal\nuser: 1000\nhost: example.com\nevent-string: talk\n"+
+		"content-type: application/simple-message-summary\nContent-Length: 20", frame[0])
+	assert.Equal(t, "Messages-Waiting: no", frame[1])
+
+	assert.Nil(t, con.NotifyCheckSync("internal", "1000", "example.com", true))
+	frame = <-frames
+	assert.Equal(t, "sendevent NOTIFY\nprofile: internal\nuser: 1000\nhost: example.com\nevent-string: check-sync;reboot=true", frame[0])
+	assert.Equal(t, "", frame[1])
+
+	assert.Nil(t, con.SendMessageWaiting(&goesl.MessageWaiting{Account: "1000@example.com", New: 2, Old: 5, UrgentNew: 1}))
+	frame = <-frames
+	assert.Equal(t, "sendevent MESSAGE_WAITING\nMWI-Messages-Waiting: yes\nMWI-Message-Account: sip:1000@example.com\n"+
+		"MWI-Voice-Message: 2/5 (1/0)", frame[0])
+
+	assert.EqualError(t, con.NotifyResync("internal", "1000", "example.com"), "unsuccessful reply : invalid event")
+	frame = <-frames
+	assert.Equal(t, "sendevent NOTIFY\nprofile: internal\nuser: 1000\nhost: example.com\nevent-string: resync", frame[0])
+
+	// Incomplete events are refused before anything is sent
+	assert.NotNil(t, con.SendNotify(&goesl.Notify{Profile: "internal", User: "1000"}))
+	assert.NotNil(t, con.SendMessageWaiting(&goesl.MessageWaiting{New: 1}))
+	headers, err := (&goesl.MessageWaiting{Account: "1000@example.com"}).Headers()
+	assert.Nil(t, err)
+	assert.Contains(t, headers, "MWI-Messages-Waiting: no")
+}
+
+func TestConnection_ChannelInfo(t *testing.T) {
+	con, fs := newPipeConnection(t)
+	go func() {
+		fs.ExpectCommand("api uuid_dump abc json")
+		fs.APIResponse(`{"Unique-ID":"abc","Channel-Name":"sofia/internal/1000@example.com","Channel-State":"CS_EXECUTE",` +
+			`"Channel-Call-State":"ACTIVE","Call-Direction":"inbound","Caller-Caller-ID-Number":"1000","Caller-Destination-Number":"2000",` +
+			`"Caller-Channel-Created-Time":"1600000000000000","Caller-Channel-Answered-Time":"1600000001500000","Caller-Channel-Hangup-Time":"0",` +
+			`"Channel-Read-Codec-Name":"PCMU","Channel-Read-Codec-Rate":"8000","Channel-Read-Codec-Bit-Rate":"64000","variable_sip_user_agent":"Phone 1.0"}`)
+		// Older builds ignore "json" and dump url encoded headers
+		fs.ExpectCommand("api uuid_dump def json")
+		fs.APIResponse("Event-Name: CHANNEL_DATA\nUnique-ID: def\nCaller-Caller-ID-Name: John%20Doe\nChannel-Write-Codec-Name: opus\n" +
+			"Channel-Write-Codec-Rate: 48000\nvariable_greeting: it%27s%20me\n")
+		fs.ExpectCommand("api uuid_dump gone json")
+		fs.APIResponse("-ERR No such channel!\n")
+	}()
+	info, err := con.ChannelInfo("abc")
+	if assert.Nil(t, err) {
+		assert.Equal(t, "abc", info.UUID)
+		assert.Equal(t, "CS_EXECUTE", info.State)
+		assert.Equal(t, "ACTIVE", info.CallState)
+		assert.Equal(t, "1000", info.Caller.CallerIDNumber)
+		assert.Equal(t, "2000", info.Caller.DestinationNumber)
+		assert.Equal(t, 1500*time.Millisecond, info.Answered.Sub(info.Created))
+		assert.True(t, info.Hangup.IsZero())
+		assert.Equal(t, goesl.MediaInfo{Codec: "PCMU", Rate: 8000, BitRate: 64000}, info.Read)
+		assert.Equal(t, "Phone 1.0", info.Variables["sip_user_agent"])
+	}
+	info, err = con.ChannelInfo("def")
+	if assert.Nil(t, err) {
+		assert.Equal(t, "def", info.UUID)
+		assert.Equal(t, "John Doe", info.Caller.CallerIDName)
+		assert.Equal(t, goesl.MediaInfo{Codec: "opus", Rate: 48000}, info.Write)
+		assert.Equal(t, "it's me", info.Variables["greeting"])
+		assert.Equal(t, "CHANNEL_DATA", info.Headers["Event-Name"])
+	}
+	_, err = con.ChannelInfo("gone")
+	assert.EqualError(t, err, "unsuccessful reply : No such channel!")
+}
+
+func TestConnection_Limit(t *testing.T) {
+	con, fs := newPipeConnection(t)
+	go func() {
+		fs.ExpectCommand("api limit_usage hash outbound gw1")
+		fs.APIResponse("3")
+		fs.ExpectCommand("api limit_usage db outbound gw2")
+		fs.APIResponse("-USAGE: <backend> <realm> <id>\n")
+		fs.ExpectCommand("api uuid_limit_release abc hash")
+		fs.APIResponse("+OK\n")
+		fs.ExpectCommand("api uuid_limit_release abc hash outbound gw1")
+		fs.APIResponse("+OK\n")
+		fs.ExpectCommand("api uuid_limit_release abc db outbound")
+		fs.APIResponse("-ERR Invalid backend\n")
+	}()
+	count, err := con.LimitUsage("hash", "outbound", "gw1")
+	assert.Nil(t, err)
+	assert.Equal(t, 3, count)
+	_, err = con.LimitUsage("db", "outbound", "gw2")
+	assert.EqualError(t, err, "unexpected limit_usage reply : -USAGE: <backend> <realm> <id>")
+	assert.Nil(t, con.LimitRelease("abc", "hash", "", "gw1"))
+	assert.Nil(t, con.LimitRelease("abc", "hash", "outbound", "gw1"))
+	assert.EqualError(t, con.LimitRelease("abc", "db", "outbound", ""), "unsuccessful reply : Invalid backend")
+}
+
+func TestConnection_HashAndDB(t *testing.T) {
+	con, fs := newPipeConnection(t)
+	go func() {
+		fs.ExpectCommand("api hash insert/realm/key/http://example.com/a")
+		fs.APIResponse("+OK\n")
+		fs.ExpectCommand("api hash select/realm/key")
+		fs.APIResponse("http://example.com/a")
+		fs.ExpectCommand("api hash select/realm/missing")
+		fs.APIResponse("")
+		fs.ExpectCommand("api hash delete/realm/missing")
+		fs.APIResponse("-ERR Not found\n")
+		fs.ExpectCommand("api db insert/realm/key/1")
+		fs.APIResponse("+OK\n")
+		fs.ExpectCommand("api db exists/realm/key")
+		fs.APIResponse("true")
+		fs.ExpectCommand("api db exists/realm/other")
+		fs.APIResponse("false")
+		fs.ExpectCommand("api db select/realm/key")
+		fs.APIResponse("1\n")
+		fs.ExpectCommand("api db delete/realm/key")
+		fs.APIResponse("-ERR Database error\n")
+	}()
+	assert.Nil(t, con.HashInsert("realm", "key", "http://example.com/a"))
+	value, ok, err := con.HashSelect("realm", "key")
+	assert.Nil(t, err)
+	assert.True(t, ok)
+	assert.Equal(t, "http://example.com/a", value)
+	_, ok, err = con.HashSelect("realm", "missing")
+	assert.Nil(t, err)
+	assert.False(t, ok)
+	assert.Nil(t, con.HashDelete("realm", "missing"))
+	assert.Nil(t, con.DBInsert("realm", "key", "1"))
+	exists, err := con.DBExists("realm", "key")
+	assert.Nil(t, err)
+	assert.True(t, exists)
+	exists, err = con.DBExists("realm", "other")
+	assert.Nil(t, err)
+	assert.False(t, exists)
+	value, ok, err = con.DBSelect("realm", "key")
+	assert.Nil(t, err)
+	assert.True(t, ok)
+	assert.Equal(t, "1", value)
+	assert.EqualError(t, con.DBDelete("realm", "key"), "unsuccessful reply : Database error")
+
+	// Nothing is sent for invalid paths
+	assert.EqualError(t, con.HashInsert("realm", "a/b", "1"), "invalid realm or key : realm/a/b")
+	_, _, err = con.DBSelect("", "key")
+	assert.EqualError(t, err, "invalid realm or key : /key")
+	_, err = con.DBExists("realm", "a b")
+	assert.EqualError(t, err, "invalid realm or key : realm/a b")
+	assert.NotNil(t, con.HashInsert("realm", "key", "a\nb"))
+}
+
+func TestConnection_Eavesdrop(t *testing.T) {
+	con, fs := newPipeConnection(t)
+	go func() {
+		fs.ExpectCommand("api originate '{eavesdrop_enable_dtmf=true,origination_caller_id_name=Supervisor,origination_uuid=sup}user/1000' &eavesdrop(abc)")
+		fs.APIResponse("+OK sup\n")
+		fs.ExpectCommand("api originate '{eavesdrop_whisper_aleg=true,origination_uuid=sup2}user/1001' &userspy(1002@example.com)")
+		fs.APIResponse("-ERR USER_BUSY\n")
+		fs.ExpectCommand("api uuid_recv_dtmf sup 2")
+		fs.APIResponse("+OK\n")
+		fs.ExpectCommand("api uuid_recv_dtmf sup 3")
+		fs.APIResponse("-ERR no such channel\n")
+	}()
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	supervisor, err := con.Eavesdrop(ctx, "abc", goesl.EavesdropOptions{
+		Endpoint:  "user/1000",
+		Variables: map[string]string{"origination_uuid": "sup", "origination_caller_id_name": "Supervisor"},
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, "sup", supervisor)
+	_, err = con.UserSpy(ctx, "1002@example.com", goesl.EavesdropOptions{
+		Endpoint:    "user/1001",
+		Variables:   map[string]string{"origination_uuid": "sup2"},
+		DisableDTMF: true,
+		Whisper:     true,
+	})
+	assert.EqualError(t, err, "unsuccessful reply : USER_BUSY")
+	assert.Nil(t, con.SetEavesdropMode("sup", goesl.EavesdropWhisperB))
+	assert.EqualError(t, con.EscalateThreeWay("sup"), "unsuccessful reply : no such channel")
+
+	// Nothing is sent for invalid arguments
+	_, err = con.Eavesdrop(ctx, "", goesl.EavesdropOptions{Endpoint: "user/1000"})
+	assert.EqualError(t, err, "eavesdrop needs a uuid and an endpoint")
+	_, err = con.UserSpy(ctx, "1002@example.com", goesl.EavesdropOptions{})
+	assert.EqualError(t, err, "userspy needs a user and an endpoint")
+}
+
+// valetInfo - valet_info output of mod_valet_parking
+const valetInfo = `<lots>
+  <lot name="lot1">
+    <extension uuid="abc">6001</extension>
+    <extension uuid="def">6002</extension>
+  </lot>
+  <lot name="lot2">
+  </lot>
+</lots>
+`
+
+func TestConnection_ValetInfo(t *testing.T) {
+	con, fs := newPipeConnection(t)
+	go func() {
+		fs.ExpectCommand("api valet_info")
+		fs.APIResponse(valetInfo)
+		fs.ExpectCommand("api valet_info lot2")
+		fs.APIResponse("<lots>\n</lots>\n")
+		fs.ExpectCommand("api valet_info lot3")
+		fs.APIResponse("Invalid Command!\n")
+		fs.ExpectCommand("api valet_info lot4")
+		fs.APIResponse("-ERR valet_info Command not found!\n")
+	}()
+	lots, err := con.ValetInfo("")
+	assert.Nil(t, err)
+	assert.Equal(t, []goesl.ValetLot{
+		{Name: "lot1", Extensions: []goesl.ValetExtension{{Extension: "6001", UUID: "abc"}, {Extension: "6002", UUID: "def"}}},
+		{Name: "lot2"},
+	}, lots)
+	lots, err = con.ValetInfo("lot2")
+	assert.Nil(t, err)
+	assert.Empty(t, lots)
+	_, err = con.ValetInfo("lot3")
+	assert.EqualError(t, err, "unexpected valet_info reply : Invalid Command!")
+	_, err = con.ValetInfo("lot4")
+	assert.EqualError(t, err, "unsuccessful reply : valet_info Command not found!")
+}
+
+func TestConnection_ValetPark(t *testing.T) {
+	con, fs := newPipeConnection(t)
+	go func() {
+		frame, body := readFrame(fs)
+		assert.Equal(t, "sendmsg abc\ncall-command: execute\nexecute-app-name: valet_park\ncontent-type: text/plain\nContent-Length: 9", frame)
+		assert.Equal(t, "lot1 6001", body)
+		fs.Reply("+OK")
+		_, body = readFrame(fs)
+		assert.Equal(t, "lot1 auto in 6001 6099", body)
+		fs.Reply("+OK")
+		_, body = readFrame(fs)
+		assert.Equal(t, "lot1 6002", body)
+		fs.Reply("-ERR invalid session id [def]")
+	}()
+	assert.Nil(t, con.ValetPark("abc", "lot1", "6001"))
+	assert.Nil(t, con.ValetParkAuto("abc", "lot1", 6001, 6099))
+	assert.EqualError(t, con.ValetRetrieve("def", "lot1", "6002"), "unsuccessful reply : invalid session id [def]")
+
+	// Nothing is sent for invalid arguments
+	assert.EqualError(t, con.ValetPark("abc", "lot1", ""), "valet_park needs a lot and an extension")
+	assert.EqualError(t, con.ValetParkAuto("abc", "lot1", 6099, 6001), "valet_park needs a lot and a valid extension range")
+}
+
+// fifoList - fifo list output of mod_fifo, the channel dumps of the callers are left out
+const fifoList = `<fifo_report>
+  <fifo name="support@example.com" consumer_count="1" caller_count="1" waiting_count="1" importance="2" outbound_per_cycle="1" outbound_per_cycle_min="1" outbound_priority="5" outbound_strategy="ringall">
+    <outbound>
+      <member simo="1" use_count="0" timeout="60" lag="5" outbound-call-count="0" outbound-fail-count="0" taking-calls="1" status="Available" next-available="" next-available-epoch="0">user/1000</member>
+    </outbound>
+    <callers>
+      <caller uuid="abc" status="WAITING" timestamp="2021-06-01 10:00:00">
+      </caller>
+    </callers>
+    <consumers>
+      <consumer uuid="def" status="TALKING" timestamp="2021-06-01 09:59:00">
+      </consumer>
+    </consumers>
+    <bridges>
+    </bridges>
+  </fifo>
+</fifo_report>
+`
+
+func TestConnection_FifoList(t *testing.T) {
+	con, fs := newPipeConnection(t)
+	go func() {
+		fs.ExpectCommand("api fifo list")
+		fs.APIResponse(fifoList)
+		fs.ExpectCommand("api fifo list sales")
+		fs.APIResponse("-ERR fifo Command not found!\n")
+		fs.ExpectCommand("api fifo list bad")
+		fs.APIResponse("Invalid!\n")
+	}()
+	queues, err := con.FifoList("")
+	assert.Nil(t, err)
+	assert.Equal(t, []goesl.FifoQueue{{
+		Name:             "support@example.com",
+		ConsumerCount:    1,
+		CallerCount:      1,
+		WaitingCount:     1,
+		Importance:       2,
+		OutboundStrategy: "ringall",
+		Callers:          []goesl.FifoChannel{{UUID: "abc", Status: "WAITING", Timestamp: "2021-06-01 10:00:00"}},
+		Consumers:        []goesl.FifoChannel{{UUID: "def", Status: "TALKING", Timestamp: "2021-06-01 09:59:00"}},
+		Members:          []goesl.FifoMember{{Dialstring: "user/1000", Simo: 1, Timeout: 60, Lag: 5}},
+	}}, queues)
+	_, err = con.FifoList("sales")
+	assert.EqualError(t, err, "unsuccessful reply : fifo Command not found!")
+	_, err = con.FifoList("bad")
+	assert.EqualError(t, err, "unexpected fifo list reply : Invalid!")
+}
+
+func TestConnection_FifoCount(t *testing.T) {
+	con, fs := newPipeConnection(t)
+	go func() {
+		fs.ExpectCommand("api fifo count")
+		fs.APIResponse("support@example.com:1:2:3:0:1\nsip:sales:0:0:1:0:0\n")
+		fs.ExpectCommand("api fifo count sales")
+		fs.APIResponse("\n")
+	}()
+	counts, err := con.FifoCount("")
+	assert.Nil(t, err)
+	assert.Equal(t, []goesl.FifoCount{
+		{Name: "support@example.com", ConsumerCount: 1, CallerCount: 2, MemberCount: 3, IdleConsumerCount: 1},
+		{Name: "sip:sales", MemberCount: 1},
+	}, counts)
+	counts, err = con.FifoCount("sales")
+	assert.Nil(t, err)
+	assert.Empty(t, counts)
+}
+
+func TestConnection_FifoMembers(t *testing.T) {
+	con, fs := newPipeConnection(t)
+	go func() {
+		_, body := readFrame(fs)
+		assert.Equal(t, "support in", body)
+		fs.Reply("+OK")
+		fs.ExpectCommand("api uuid_transfer abc 1000 XML default")
+		fs.APIResponse("+OK\n")
+		fs.ExpectCommand("api fifo_member add support '{fifo_member_wait=nowait}user/1000' 1 60 5")
+		fs.APIResponse("+OK\n")
+		fs.ExpectCommand("api fifo_member del support user/1001")
+		fs.APIResponse("-ERR Usage: fifo_member add|del <fifo_name> <originate_string>\n")
+	}()
+	assert.Nil(t, con.FifoAddCaller("abc", "support"))
+	assert.Nil(t, con.FifoRemoveCaller("abc", "1000", "", "default"))
+	assert.Nil(t, con.FifoAddMember("support", "{fifo_member_wait=nowait}user/1000", 1, 60, 5))
+	assert.EqualError(t, con.FifoRemoveMember("support", "user/1001"),
+		"unsuccessful reply : Usage: fifo_member add|del <fifo_name> <originate_string>")
+}
+
+func TestConnection_Voicemail(t *testing.T) {
+	con, fs := newPipeConnection(t)
+	go func() {
+		fs.ExpectCommand("api vm_list 1000@example.com")
+		fs.APIResponse("1600000000:0:1000:example.com:inbox:/var/lib/freeswitch/storage/voicemail/default/example.com/1000/msg_a.wav:a:John Doe:2000:12:\n" +
+			"1600000100:1600000200:1000:example.com:inbox:/var/lib/freeswitch/storage/voicemail/default/example.com/1000/msg_b.wav:b:Alice:3000:5:B:urgent\n")
+		fs.ExpectCommand("api vm_list 1001@example.com")
+		fs.APIResponse("-ERR no such mailbox\n")
+		fs.ExpectCommand("api vm_delete 1000@example.com a")
+		fs.APIResponse("+OK\n")
+		fs.ExpectCommand("api vm_delete 1000@example.com")
+		fs.APIResponse("+OK\n")
+		fs.ExpectCommand("api vm_read 1000@example.com read b")
+		fs.APIResponse("+OK\n")
+		fs.ExpectCommand("api vm_read 1000@example.com unread")
+		fs.APIResponse("+OK\n")
+		fs.ExpectCommand("api vm_boxcount 1000@example.com|all")
+		fs.APIResponse("1:2:1:0")
+		fs.ExpectCommand("api vm_boxcount 1001@example.com|all")
+		fs.APIResponse("0")
+		frame, _ := readFrame(fs)
+		assert.Equal(t, "sendevent MESSAGE_QUERY\nMessage-Account: sip:1000@example.com", frame)
+		fs.Reply("+OK")
+	}()
+	messages, err := con.VoicemailList("1000@example.com")
+	if assert.Nil(t, err) && assert.Len(t, messages, 2) {
+		assert.Equal(t, time.Unix(1600000000, 0), messages[0].Received)
+		assert.False(t, messages[0].IsRead())
+		assert.Equal(t, "inbox", messages[0].Folder)
+		assert.Equal(t, "a", messages[0].UUID)
+		assert.Equal(t, "John Doe", messages[0].CIDName)
+		assert.Equal(t, "2000", messages[0].CIDNumber)
+		assert.Equal(t, 12*time.Second, messages[0].Length)
+		assert.Equal(t, "", messages[0].Flags)
+		assert.True(t, messages[1].IsRead())
+		assert.Equal(t, time.Unix(1600000200, 0), messages[1].Read)
+		assert.Equal(t, "/var/lib/freeswitch/storage/voicemail/default/example.com/1000/msg_b.wav", messages[1].Path)
+		assert.Equal(t, "B:urgent", messages[1].Flags)
+	}
+	_, err = con.VoicemailList("1001@example.com")
+	assert.EqualError(t, err, "unsuccessful reply : no such mailbox")
+	assert.Nil(t, con.VoicemailDelete("1000@example.com", "a"))
+	assert.Nil(t, con.VoicemailDelete("1000@example.com", ""))
+	assert.Nil(t, con.VoicemailMarkRead("1000@example.com", "b", true))
+	assert.Nil(t, con.VoicemailMarkRead("1000@example.com", "", false))
+	count, err := con.VoicemailBoxCount("1000@example.com")
+	assert.Nil(t, err)
+	assert.Equal(t, &goesl.VoicemailBoxCount{New: 1, Saved: 2, NewUrgent: 1}, count)
+	_, err = con.VoicemailBoxCount("1001@example.com")
+	assert.EqualError(t, err, "unexpected vm_boxcount reply : 0")
+	assert.Nil(t, con.RefreshMWI("1000@example.com"))
+
+	// Nothing is sent for invalid mailboxes
+	_, err = con.VoicemailList("1000")
+	assert.EqualError(t, err, "invalid mailbox : 1000")
+	assert.EqualError(t, con.VoicemailDelete("1000@example.com a", ""), "invalid mailbox : 1000@example.com a")
+	assert.NotNil(t, con.RefreshMWI(""))
+}
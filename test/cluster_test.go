@@ -0,0 +1,284 @@
+/*
+ * Copyright (c) 2021 LuanDNH
+ *
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at https://mozilla.org/MPL/2.0/.
+ *
+ * Contributor(s):
+ * LuanDNH <luandnh98@gmail.com>
+ */
+
+package test
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/luandnh/goesl"
+	"github.com/luandnh/goesl/goesltest"
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeNode - Freeswitch listening on TCP, answering every api command with its name
+type fakeNode struct {
+	listener net.Listener
+	lock     sync.Mutex
+	conns    []net.Conn
+	// sick - api status fails when set
+	sick int32
+}
+
+func newFakeNode(t *testing.T, name string) *fakeNode {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.Nil(t, err)
+	node := &fakeNode{listener: listener}
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			node.lock.Lock()
+			node.conns = append(node.conns, conn)
+			node.lock.Unlock()
+			go func() {
+				fs := goesltest.NewServer(t, conn)
+				fs.Write("Content-Type: auth/request\n\n")
+				readCommand(fs)
+				fs.Reply("+OK accepted")
+				for {
+					command := readCommand(fs)
+					switch {
+					case command == "":
+						return
+					case strings.HasPrefix(command, "event ") || strings.HasPrefix(command, "nixevent "):
+						fs.Reply("+OK")
+					case command == "api status" && atomic.LoadInt32(&node.sick) == 1:
+						fs.APIResponse("-ERR sick")
+					default:
+						fs.APIResponse(name)
+					}
+				}
+			}()
+		}
+	}()
+	t.Cleanup(node.kill)
+	return node
+}
+
+func (node *fakeNode) address() string {
+	return node.listener.Addr().String()
+}
+
+// heartbeat - Send a HEARTBEAT event on every connection
+func (node *fakeNode) heartbeat() {
+	node.lock.Lock()
+	defer node.lock.Unlock()
+	body := `{"Event-Name":"HEARTBEAT","Session-Count":"0"}`
+	for _, conn := range node.conns {
+		_, _ = fmt.Fprintf(conn, "Content-Type: text/event-json\nContent-Length: %d\n\n%s", len(body), body)
+	}
+}
+
+// kill - Stop listening and drop every connection
+func (node *fakeNode) kill() {
+	node.listener.Close()
+	node.lock.Lock()
+	defer node.lock.Unlock()
+	for _, conn := range node.conns {
+		conn.Close()
+	}
+}
+
+func TestCluster_Failover(t *testing.T) {
+	primary, backup := newFakeNode(t, "primary"), newFakeNode(t, "backup")
+	cluster, err := goesl.NewCluster(goesl.ClusterOptions{
+		Addresses: []string{primary.address(), backup.address()},
+		Password:  "ClueCon",
+		Timeout:   1,
+	})
+	assert.Nil(t, err)
+	defer cluster.Close()
+
+	response, err := cluster.Api("eval node")
+	assert.Nil(t, err)
+	assert.Equal(t, "primary", string(response.Body))
+
+	primary.kill()
+	assert.Eventually(t, func() bool {
+		return !cluster.Nodes()[0].Connected
+	}, time.Second, 10*time.Millisecond)
+	response, err = cluster.Api("eval node")
+	assert.Nil(t, err)
+	assert.Equal(t, "backup", string(response.Body))
+
+	backup.kill()
+	assert.Eventually(t, func() bool {
+		return !cluster.Nodes()[1].Connected
+	}, time.Second, 10*time.Millisecond)
+	_, err = cluster.Api("eval node")
+	assert.Equal(t, goesl.ErrNoHealthyNode, err)
+}
+
+func TestCluster_RoundRobin(t *testing.T) {
+	first, second := newFakeNode(t, "first"), newFakeNode(t, "second")
+	cluster, err := goesl.NewCluster(goesl.ClusterOptions{
+		Addresses: []string{first.address(), second.address()},
+		Password:  "ClueCon",
+		Timeout:   1,
+		Strategy:  goesl.ClusterRoundRobin,
+	})
+	assert.Nil(t, err)
+	defer cluster.Close()
+	seen := map[string]int{}
+	for i := 0; i < 4; i++ {
+		response, err := cluster.Api("eval node")
+		assert.Nil(t, err)
+		seen[string(response.Body)]++
+	}
+	assert.Equal(t, map[string]int{"first": 2, "second": 2}, seen)
+}
+
+// fakeResolver - SRV records served from memory
+type fakeResolver struct {
+	lock    sync.Mutex
+	records []*net.SRV
+}
+
+func (r *fakeResolver) set(records ...*net.SRV) {
+	r.lock.Lock()
+	r.records = records
+	r.lock.Unlock()
+}
+
+func (r *fakeResolver) LookupSRV(_ context.Context, _, _, name string) (string, []*net.SRV, error) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	return name, r.records, nil
+}
+
+func (r *fakeResolver) LookupHost(_ context.Context, host string) ([]string, error) {
+	return []string{"10.0.0.1", "10.0.0.2"}, nil
+}
+
+func srvRecord(address string, priority, weight uint16) *net.SRV {
+	host, port, _ := net.SplitHostPort(address)
+	n, _ := strconv.Atoi(port)
+	return &net.SRV{Target: host + ".", Port: uint16(n), Priority: priority, Weight: weight}
+}
+
+func TestResolveEndpoints(t *testing.T) {
+	resolver := &fakeResolver{}
+	resolver.set(srvRecord("b:8021", 20, 0), srvRecord("a1:8021", 10, 50), srvRecord("a2:8021", 10, 50))
+	endpoints, err := goesl.ResolveEndpoints(context.Background(), resolver, "_esl._tcp.example.com")
+	assert.Nil(t, err)
+	assert.Len(t, endpoints, 3)
+	assert.ElementsMatch(t, []string{"a1:8021", "a2:8021"}, []string{endpoints[0].Address, endpoints[1].Address})
+	assert.Equal(t, "b:8021", endpoints[2].Address)
+
+	endpoints, err = goesl.ResolveEndpoints(context.Background(), resolver, "freeswitch.example.com:8021")
+	assert.Nil(t, err)
+	assert.Equal(t, []goesl.Endpoint{{Address: "10.0.0.1:8021"}, {Address: "10.0.0.2:8021"}}, endpoints)
+}
+
+func TestCluster_Discover(t *testing.T) {
+	first, second := newFakeNode(t, "first"), newFakeNode(t, "second")
+	resolver := &fakeResolver{}
+	resolver.set(srvRecord(first.address(), 10, 0))
+	cluster, err := goesl.NewCluster(goesl.ClusterOptions{
+		Discover:          "_esl._tcp.example.com",
+		Resolver:          resolver,
+		ResolveInterval:   20 * time.Millisecond,
+		ReconnectInterval: 20 * time.Millisecond,
+		Password:          "ClueCon",
+		Timeout:           1,
+	})
+	assert.Nil(t, err)
+	defer cluster.Close()
+	response, err := cluster.Api("eval node")
+	assert.Nil(t, err)
+	assert.Equal(t, "first", string(response.Body))
+
+	// The fleet moved to the second node
+	resolver.set(srvRecord(second.address(), 10, 0))
+	assert.Eventually(t, func() bool {
+		nodes := cluster.Nodes()
+		return len(nodes) == 1 && nodes[0].Address == second.address() && nodes[0].Connected
+	}, time.Second, 10*time.Millisecond)
+	response, err = cluster.Api("eval node")
+	assert.Nil(t, err)
+	assert.Equal(t, "second", string(response.Body))
+}
+
+func TestCluster_HealthCheck(t *testing.T) {
+	first, second := newFakeNode(t, "first"), newFakeNode(t, "second")
+	cluster, err := goesl.NewCluster(goesl.ClusterOptions{
+		Addresses:           []string{first.address(), second.address()},
+		Password:            "ClueCon",
+		Timeout:             1,
+		Strategy:            goesl.ClusterLeastOutstanding,
+		HealthCheckInterval: 20 * time.Millisecond,
+	})
+	assert.Nil(t, err)
+	defer cluster.Close()
+
+	atomic.StoreInt32(&first.sick, 1)
+	assert.Eventually(t, func() bool {
+		return !cluster.Nodes()[0].Healthy
+	}, time.Second, 10*time.Millisecond)
+	status := cluster.Nodes()[0]
+	assert.True(t, status.Connected)
+	assert.NotNil(t, status.LastError)
+	assert.False(t, status.LastCheck.IsZero())
+	for i := 0; i < 3; i++ {
+		response, err := cluster.Api("eval node")
+		assert.Nil(t, err)
+		assert.Equal(t, "second", string(response.Body))
+	}
+
+	atomic.StoreInt32(&first.sick, 0)
+	assert.Eventually(t, func() bool {
+		return cluster.Nodes()[0].Healthy
+	}, time.Second, 10*time.Millisecond)
+	assert.Equal(t, 0, cluster.Nodes()[0].Outstanding)
+}
+
+func TestCluster_HeartbeatResume(t *testing.T) {
+	node := newFakeNode(t, "node")
+	cluster, err := goesl.NewCluster(goesl.ClusterOptions{
+		Addresses:       []string{node.address()},
+		Password:        "ClueCon",
+		Timeout:         1,
+		HeartbeatWindow: 100 * time.Millisecond,
+	})
+	assert.Nil(t, err)
+	defer cluster.Close()
+
+	// No heartbeat within the window
+	assert.Eventually(t, func() bool {
+		return !cluster.Nodes()[0].Healthy
+	}, time.Second, 10*time.Millisecond)
+	status := cluster.Nodes()[0]
+	assert.True(t, status.Connected)
+	assert.EqualError(t, status.LastError, "no heartbeat")
+	_, err = cluster.Api("eval node")
+	assert.Equal(t, goesl.ErrNoHealthyNode, err)
+
+	// Without health checks the next heartbeat brings the node back
+	node.heartbeat()
+	assert.Eventually(t, func() bool {
+		return cluster.Nodes()[0].Healthy
+	}, time.Second, 10*time.Millisecond)
+	assert.Nil(t, cluster.Nodes()[0].LastError)
+	response, err := cluster.Api("eval node")
+	assert.Nil(t, err)
+	assert.Equal(t, "node", string(response.Body))
+}
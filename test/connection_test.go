@@ -0,0 +1,1876 @@
+/*
+ * Copyright (c) 2021 LuanDNH
+ *
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at https://mozilla.org/MPL/2.0/.
+ *
+ * Contributor(s):
+ * LuanDNH <luandnh98@gmail.com>
+ */
+
+package test
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"expvar"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/luandnh/goesl"
+	"github.com/luandnh/goesl/goesltest"
+	"github.com/stretchr/testify/assert"
+)
+
+func newPipeConnection(t *testing.T) (*goesl.ESLConnection, *goesltest.Server) {
+	return newPipeConnectionWith(t, goesl.Options{})
+}
+
+// newPipeConnectionWith - Authenticated inbound connection created with opts
+func newPipeConnectionWith(t *testing.T, opts goesl.Options) (*goesl.ESLConnection, *goesltest.Server) {
+	return goesltest.NewInbound(t, opts)
+}
+
+// readCommand - Next frame of fs with its headers, joined by newlines. Empty once the connection is closed
+func readCommand(fs *goesltest.Server) string {
+	command, _ := readFrame(fs)
+	return command
+}
+
+// readFrame - Next frame of fs with its headers joined by newlines, and its body
+func readFrame(fs *goesltest.Server) (string, string) {
+	command := fs.ReadCommand()
+	if command == nil {
+		return "", ""
+	}
+	return strings.Join(append([]string{command.Line}, command.Headers...), "\n"), command.Body
+}
+
+// jsonEvent - Send the json document body as a text/event-json
+func jsonEvent(fs *goesltest.Server, body string) {
+	fs.Write(fmt.Sprintf("Content-Type: text/event-json\nContent-Length: %d\n\n%s", len(body), body))
+}
+
+// newEvent - Event parsed from the json document of a text/event-json
+func newEvent(t *testing.T, body string) *goesl.Event {
+	event, err := goesl.ParseMessage(bufio.NewReader(strings.NewReader(fmt.Sprintf("Content-Type: text/event-json\nContent-Length: %d\n\n%s", len(body), body))))
+	assert.Nil(t, err)
+	return event
+}
+
+func TestConnection_Api(t *testing.T) {
+	con, fs := newPipeConnection(t)
+	go func() {
+		if readCommand(fs) == "api eval Hello goesl" {
+			fs.APIResponse("Hello goesl")
+		}
+	}()
+	response, err := con.Api("eval Hello goesl")
+	assert.Nil(t, err)
+	assert.Equal(t, "Hello goesl", string(response.Body))
+}
+
+func TestConnection_WaitFor(t *testing.T) {
+	con, fs := newPipeConnection(t)
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	seen := make(chan struct{}, 1)
+	go func() {
+		// Heartbeats until WaitFor sees one, its listener is then registered for the gateway event
+		for ctx.Err() == nil {
+			jsonEvent(fs, `{"Event-Name":"HEARTBEAT"}`)
+			select {
+			case <-seen:
+				jsonEvent(fs, `{"Event-Name":"CUSTOM","Event-Subclass":"sofia::gateway_state","Gateway":"gw1"}`)
+				return
+			case <-time.After(10 * time.Millisecond):
+			}
+		}
+	}()
+	event, err := con.WaitFor(ctx, func(event *goesl.Event) bool {
+		select {
+		case seen <- struct{}{}:
+		default:
+		}
+		return event.GetHeader("Gateway") == "gw1"
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, "sofia::gateway_state", event.GetHeader("Event-Subclass"))
+}
+
+func TestConnection_ApiStream(t *testing.T) {
+	con, fs := newPipeConnection(t)
+	body := strings.Repeat("uuid,direction,created\n", 4096)
+	go func() {
+		fs.ExpectCommand("api show channels")
+		fs.APIResponse(body)
+		fs.ExpectCommand("api eval next")
+		fs.APIResponse("next")
+	}()
+	stream, err := con.ApiStream("show channels")
+	assert.Nil(t, err)
+	received, err := io.ReadAll(stream)
+	assert.Nil(t, err)
+	assert.Equal(t, body, string(received))
+	assert.Nil(t, stream.Close())
+
+	response, err := con.Api("eval next")
+	assert.Nil(t, err)
+	assert.Equal(t, "next", string(response.Body))
+}
+
+func TestConnection_ApiStreamInterceptor(t *testing.T) {
+	// The interceptor gives up after 10ms and hands its context over so the server answers too late
+	intercepted := make(chan context.Context, 4)
+	con, fs := newPipeConnectionWith(t, goesl.Options{Interceptors: []goesl.Interceptor{
+		func(ctx context.Context, cmd string, next goesl.Invoker) (*goesl.ESLResponse, error) {
+			ctx, cancel := context.WithTimeout(ctx, 10*time.Millisecond)
+			defer cancel()
+			intercepted <- ctx
+			return next(ctx, cmd)
+		},
+	}})
+	answerLate := func() {
+		select {
+		case ctx := <-intercepted:
+			<-ctx.Done()
+		default:
+		}
+	}
+	body := strings.Repeat("uuid,direction,created\n", 4096)
+	go func() {
+		fs.ExpectCommand("api show channels")
+		answerLate()
+		fs.APIResponse(body)
+		fs.ExpectCommand("api eval next")
+		fs.APIResponse("next")
+	}()
+	stream, err := con.ApiStream("show channels")
+	if assert.Nil(t, err) {
+		received, err := io.ReadAll(stream)
+		assert.Nil(t, err)
+		assert.Equal(t, body, string(received))
+		assert.Nil(t, stream.Close())
+	}
+
+	// The other commands still get their replies
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	response, err := con.ApiWithContext(ctx, "eval next")
+	if assert.Nil(t, err) {
+		assert.Equal(t, "next", string(response.Body))
+	}
+}
+
+func TestConnection_AccessDenied(t *testing.T) {
+	client, server := net.Pipe()
+	defer server.Close()
+	con := goesl.NewConnectionFromConn(client, goesl.Options{})
+	defer con.Close()
+	go func() {
+		reason := "Access Denied, go away.\n"
+		_, _ = server.Write([]byte(fmt.Sprintf("Content-Type: text/rude-rejection\nContent-Length: %d\n\n%s", len(reason), reason)))
+	}()
+	err := con.Authenticate(context.Background(), "ClueCon")
+	assert.True(t, errors.Is(err, goesl.ErrAccessDenied))
+	var denied *goesl.AccessDeniedError
+	assert.True(t, errors.As(err, &denied))
+	assert.Equal(t, "Access Denied, go away.", denied.Reason)
+}
+
+func TestConnection_DisconnectNotice(t *testing.T) {
+	con, fs := newPipeConnection(t)
+	notices := make(chan *goesl.DisconnectNotice, 2)
+	con.OnDisconnectNotice(func(notice *goesl.DisconnectNotice) {
+		notices <- notice
+	})
+	lingered := make(chan bool)
+	go func() {
+		fs.Write("Content-Type: text/disconnect-notice\nControlled-Session-UUID: abc\nContent-Disposition: linger\nContent-Length: 23\n\nDisconnected, goodbye.\n")
+		jsonEvent(fs, `{"Event-Name":"CHANNEL_HANGUP_COMPLETE","Unique-ID":"abc"}`)
+		<-lingered
+		fs.Write("Content-Type: text/disconnect-notice\nContent-Disposition: disconnect\nContent-Length: 23\n\nDisconnected, goodbye.\n")
+	}()
+	notice := <-notices
+	assert.True(t, notice.Linger)
+	assert.Equal(t, "abc", notice.ChannelUUID)
+	assert.Equal(t, "Disconnected, goodbye.", notice.Reason)
+	close(lingered)
+
+	for _, contentType := range []string{"text/disconnect-notice", "text/event-json", "text/disconnect-notice"} {
+		message, err := con.ReadMessage()
+		assert.Nil(t, err)
+		assert.Equal(t, contentType, message.ContentType)
+	}
+	notice = <-notices
+	assert.False(t, notice.Linger)
+	_, err := con.Api("status")
+	assert.NotNil(t, err)
+}
+
+func TestConnection_MaxFrameSize(t *testing.T) {
+	con, fs := newPipeConnectionWith(t, goesl.Options{ReadBufferSize: 512, MaxFrameSize: 16})
+	go func() {
+		fs.APIResponse("small")
+		fs.APIResponse(strings.Repeat("x", 17))
+	}()
+	response, err := con.ReadMessage()
+	assert.Nil(t, err)
+	assert.Equal(t, "small", string(response.Body))
+	_, err = con.ReadMessage()
+	assert.NotNil(t, err)
+}
+
+func TestConnection_ReplyCorrelation(t *testing.T) {
+	con, fs := newPipeConnection(t)
+	go func() {
+		fs.ExpectCommand("api eval late")
+		fs.ExpectCommand("api eval next")
+		fs.APIResponse("late")
+		fs.APIResponse("next")
+	}()
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	_, err := con.ApiWithContext(ctx, "eval late")
+	assert.Equal(t, context.DeadlineExceeded, err)
+
+	// The late reply is dropped instead of being taken as the reply of the next command
+	response, err := con.Api("eval next")
+	assert.Nil(t, err)
+	assert.Equal(t, "next", string(response.Body))
+}
+
+func TestConnection_Backpressure(t *testing.T) {
+	for _, test := range []struct {
+		policy   goesl.BackpressurePolicy
+		expected []string
+	}{
+		{goesl.BackpressureDropOldest, []string{"3", "4"}},
+		{goesl.BackpressureDropNewest, []string{"1", "2"}},
+		{goesl.BackpressureCallback, []string{"1", "2"}},
+	} {
+		var overflow []string
+		con, fs := newPipeConnectionWith(t, goesl.Options{
+			EventBufferSize: 2,
+			Backpressure:    test.policy,
+			OnEventOverflow: func(message *goesl.ESLResponse) {
+				overflow = append(overflow, message.GetHeader("Event-Sequence"))
+			},
+		})
+		go func() {
+			for i := 1; i <= 4; i++ {
+				jsonEvent(fs, fmt.Sprintf(`{"Event-Name":"HEARTBEAT","Event-Sequence":"%d"}`, i))
+			}
+			readCommand(fs)
+			fs.APIResponse("+OK")
+		}()
+		// The reply comes after the events, so they have all been queued or dropped once it is received
+		_, err := con.Api("status")
+		assert.Nil(t, err)
+		assert.Equal(t, uint64(2), con.DroppedEvents())
+		for _, sequence := range test.expected {
+			message, err := con.ReadMessage()
+			assert.Nil(t, err)
+			assert.Equal(t, sequence, message.GetHeader("Event-Sequence"))
+		}
+		if test.policy == goesl.BackpressureCallback {
+			assert.Equal(t, []string{"3", "4"}, overflow)
+		}
+	}
+}
+
+func TestConnection_BackpressureListenersOnly(t *testing.T) {
+	con, fs := newPipeConnection(t)
+	var received int32
+	con.RegisterEventListener(goesl.EventListenAll, func(event *goesl.Event) {
+		atomic.AddInt32(&received, 1)
+	})
+	events := goesl.EventBufferSize + 100
+	go func() {
+		for i := 1; i <= events; i++ {
+			jsonEvent(fs, fmt.Sprintf(`{"Event-Name":"HEARTBEAT","Event-Sequence":"%d"}`, i))
+		}
+		readCommand(fs)
+		fs.APIResponse("+OK")
+	}()
+	// Nobody calls ReadMessage, the read loop must not wait for it
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	_, err := con.ApiWithContext(ctx, "status")
+	assert.Nil(t, err)
+	assert.Equal(t, uint64(0), con.DroppedEvents())
+	assert.Eventually(t, func() bool {
+		return atomic.LoadInt32(&received) == int32(events)
+	}, time.Second, 5*time.Millisecond)
+
+	// The most recent messages are still there for a late reader
+	message, err := con.ReadMessage()
+	assert.Nil(t, err)
+	assert.Equal(t, strconv.Itoa(events-goesl.EventBufferSize+1), message.GetHeader("Event-Sequence"))
+}
+
+func TestConnection_SubscribeReferenceCounting(t *testing.T) {
+	con, fs := newPipeConnection(t)
+	commands := make(chan string, 16)
+	go func() {
+		for command := readCommand(fs); command != ""; command = readCommand(fs) {
+			commands <- command
+			fs.Reply("+OK")
+		}
+	}()
+	assert.Nil(t, con.Subscribe(goesl.EventFormatPlain, goesl.EventChannelAnswer))
+	assert.Nil(t, con.Subscribe(goesl.EventFormatPlain, goesl.EventChannelAnswer))
+	assert.Equal(t, "event plain CHANNEL_ANSWER", <-commands)
+	assert.Nil(t, con.Unsubscribe(goesl.EventChannelAnswer))
+	assert.Equal(t, []string{goesl.EventChannelAnswer}, con.Subscriptions())
+	assert.Nil(t, con.Unsubscribe(goesl.EventChannelAnswer))
+	// Nothing was sent by the second Subscribe nor the first Unsubscribe
+	assert.Equal(t, "nixevent CHANNEL_ANSWER", <-commands)
+	assert.Empty(t, con.Subscriptions())
+
+	// Subclasses follow CUSTOM, in the same word or the next ones
+	assert.Nil(t, con.Subscribe(goesl.EventFormatPlain, goesl.EventCustom, "sofia::register"))
+	assert.Equal(t, "event plain CUSTOM sofia::register", <-commands)
+	assert.Nil(t, con.Subscribe(goesl.EventFormatPlain, "CUSTOM sofia::register sofia::unregister"))
+	assert.Equal(t, "event plain CUSTOM sofia::unregister", <-commands)
+	// CUSTOM alone is a key of its own
+	assert.Nil(t, con.Subscribe(goesl.EventFormatPlain, goesl.EventCustom))
+	assert.Equal(t, "event plain CUSTOM", <-commands)
+	assert.Equal(t, []string{"CUSTOM", "CUSTOM sofia::register", "CUSTOM sofia::unregister"}, con.Subscriptions())
+	assert.Nil(t, con.Unsubscribe("CUSTOM sofia::register sofia::unregister"))
+	assert.Equal(t, "nixevent CUSTOM sofia::unregister", <-commands)
+	assert.Nil(t, con.Unsubscribe(goesl.EventCustom))
+	assert.Equal(t, "nixevent CUSTOM", <-commands)
+	assert.Nil(t, con.Unsubscribe(goesl.EventCustom, "sofia::register"))
+	assert.Equal(t, "nixevent CUSTOM sofia::register", <-commands)
+	assert.Empty(t, con.Subscriptions())
+	assert.Empty(t, commands)
+}
+
+func TestConnection_MonitorHeartbeat(t *testing.T) {
+	con, fs := newPipeConnection(t)
+	go func() {
+		fs.ExpectCommand("event json HEARTBEAT")
+		fs.Reply("+OK event listener enabled json")
+		jsonEvent(fs, `{"Event-Name":"HEARTBEAT","Session-Count":"3","Idle-CPU":"97.5","Heartbeat-Interval":"20","Uptime-msec":"1500"}`)
+	}()
+	timeouts := make(chan goesl.Heartbeat, 1)
+	monitor, err := con.MonitorHeartbeat(goesl.HeartbeatOptions{
+		Window: 100 * time.Millisecond,
+		OnTimeout: func(last goesl.Heartbeat) {
+			timeouts <- last
+		},
+	})
+	assert.Nil(t, err)
+	select {
+	case last := <-timeouts:
+		assert.Equal(t, 3, last.Sessions)
+		assert.Equal(t, 97.5, last.IdleCPU)
+		assert.Equal(t, 20*time.Second, last.Interval)
+		assert.Equal(t, 1500*time.Millisecond, last.Uptime)
+	case <-time.After(time.Second):
+		t.Fatal("heartbeat timeout not reported")
+	}
+	_, seen := monitor.Last()
+	assert.True(t, seen)
+}
+
+func TestDial(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.Nil(t, err)
+	defer listener.Close()
+	accepted := make(chan net.Conn, 1)
+	go func() {
+		conn, _ := listener.Accept()
+		accepted <- conn
+	}()
+	conn, err := goesl.Dial("tcp", listener.Addr().String(), time.Second, goesl.DialOptions{
+		LocalAddr:         "127.0.0.1:0",
+		KeepAlive:         30 * time.Second,
+		KeepAliveInterval: 5 * time.Second,
+		KeepAliveCount:    3,
+		DisableNoDelay:    true,
+	})
+	assert.Nil(t, err)
+	defer conn.Close()
+	server := <-accepted
+	defer server.Close()
+	assert.Equal(t, "127.0.0.1", conn.LocalAddr().(*net.TCPAddr).IP.String())
+	assert.Equal(t, conn.LocalAddr().String(), server.RemoteAddr().String())
+}
+
+func TestConnection_IdleTimeout(t *testing.T) {
+	con, fs := newPipeConnectionWith(t, goesl.Options{IdleTimeout: 200 * time.Millisecond})
+	go func() {
+		// Each frame refreshes the deadline, the frames together take longer than the idle timeout
+		for i := 0; i < 3; i++ {
+			time.Sleep(100 * time.Millisecond)
+			jsonEvent(fs, `{"Event-Name":"HEARTBEAT"}`)
+		}
+	}()
+	for i := 0; i < 3; i++ {
+		message, err := con.ReadMessage()
+		assert.Nil(t, err)
+		assert.Equal(t, "text/event-json", message.ContentType)
+	}
+	_, err := con.ReadMessage()
+	assert.Equal(t, goesl.ErrIdleTimeout, err)
+	_, err = con.Api("status")
+	assert.NotNil(t, err)
+}
+
+func TestConnection_PanicRecovery(t *testing.T) {
+	panics := make(chan *goesl.PanicError, 2)
+	con, fs := newPipeConnectionWith(t, goesl.Options{
+		OnPanic: func(err *goesl.PanicError) {
+			panics <- err
+		},
+	})
+	con.RegisterEventListener(goesl.EventListenAll, func(event *goesl.Event) {
+		panic("listener failure")
+	})
+	goesl.RegisterContentDecoder("application/x-goesl-panic", func(*goesl.ESLResponse, goesl.Logger) error {
+		panic("decoder failure")
+	})
+	go func() {
+		jsonEvent(fs, `{"Event-Name":"HEARTBEAT"}`)
+		fs.Write("Content-Type: application/x-goesl-panic\n\n")
+	}()
+
+	// A panicking listener does not stop the dispatch
+	message, err := con.ReadMessage()
+	assert.Nil(t, err)
+	assert.Equal(t, "text/event-json", message.ContentType)
+
+	// A panic in the read loop ends the connection with a PanicError
+	_, err = con.ReadMessage()
+	var panicErr *goesl.PanicError
+	assert.True(t, errors.As(err, &panicErr))
+	assert.Equal(t, "read loop", panicErr.Where)
+	assert.Equal(t, "decoder failure", panicErr.Value)
+
+	where := map[string]bool{}
+	for i := 0; i < 2; i++ {
+		select {
+		case err := <-panics:
+			where[err.Where] = true
+		case <-time.After(time.Second):
+			t.Fatal("panic not reported")
+		}
+	}
+	assert.Equal(t, map[string]bool{"event listener": true, "read loop": true}, where)
+}
+
+func TestConnection_ConcurrentClose(t *testing.T) {
+	con, fs := newPipeConnection(t)
+	go func() {
+		// Nobody reads these, the read loop must not stay blocked on them
+		for i := 0; i < 8; i++ {
+			jsonEvent(fs, `{"Event-Name":"HEARTBEAT"}`)
+		}
+	}()
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(3)
+		go func() {
+			defer wg.Done()
+			_, _ = con.Api("status")
+		}()
+		go func() {
+			defer wg.Done()
+			_, _ = con.ReadMessage()
+		}()
+		go func() {
+			defer wg.Done()
+			con.Close()
+		}()
+	}
+	wg.Wait()
+	assert.Nil(t, con.Close())
+	_, err := con.Api("status")
+	assert.NotNil(t, err)
+}
+
+func TestConnection_ReplyBeforeClose(t *testing.T) {
+	// Freeswitch may hang up right after answering, the reply still wins over the close
+	for i := 0; i < 100; i++ {
+		con, fs := newPipeConnection(t)
+		go func() {
+			fs.ExpectCommand("api status")
+			fs.APIResponse("UP")
+			fs.Close()
+		}()
+		response, err := con.Api("status")
+		if !assert.Nil(t, err) {
+			return
+		}
+		assert.Equal(t, "UP", string(response.Body))
+	}
+}
+
+func TestConnection_ErrAndDone(t *testing.T) {
+	con, fs := newPipeConnection(t)
+	assert.Nil(t, con.Err())
+	// Nobody is reading messages, the failure must still be reported
+	fs.Close()
+	select {
+	case <-con.Done():
+	case <-time.After(time.Second):
+		t.Fatal("connection not closed")
+	}
+	assert.Equal(t, io.EOF, con.Err())
+	_, err := con.ReadMessage()
+	assert.Equal(t, io.EOF, err)
+	assert.Nil(t, con.Close())
+	assert.Equal(t, io.EOF, con.Err())
+
+	closed, _ := newPipeConnection(t)
+	closed.Close()
+	assert.Equal(t, goesl.ErrConnectionClosed, closed.Err())
+	_, err = closed.Api("status")
+	assert.Equal(t, goesl.ErrConnectionClosed, err)
+}
+
+func TestConnection_Pipeline(t *testing.T) {
+	con, fs := newPipeConnectionWith(t, goesl.Options{MaxInFlight: 2})
+	commands := make(chan string, 5)
+	go func() {
+		for i := 0; i < 5; i++ {
+			commands <- readCommand(fs)
+		}
+	}()
+	type result struct {
+		responses []*goesl.ESLResponse
+		errs      []error
+	}
+	done := make(chan result, 1)
+	go func() {
+		responses, errs := con.Pipeline(context.Background(), "api eval 1", "api eval 2", "api eval 3", "api eval 4", "api eval 5")
+		done <- result{responses, errs}
+	}()
+
+	assert.Equal(t, "api eval 1", <-commands)
+	assert.Equal(t, "api eval 2", <-commands)
+	select {
+	case cmd := <-commands:
+		t.Fatalf("%s written above MaxInFlight", cmd)
+	case <-time.After(50 * time.Millisecond):
+	}
+	fs.APIResponse("1")
+	for i := 3; i <= 5; i++ {
+		assert.Equal(t, fmt.Sprintf("api eval %d", i), <-commands)
+		fs.APIResponse(strconv.Itoa(i - 1))
+	}
+	fs.APIResponse("-ERR 5")
+
+	r := <-done
+	for i := 0; i < 4; i++ {
+		assert.Nil(t, r.errs[i])
+		assert.Equal(t, strconv.Itoa(i+1), string(r.responses[i].Body))
+	}
+	assert.NotNil(t, r.errs[4])
+}
+
+func TestConnection_DispatchOrdered(t *testing.T) {
+	con, fs := newPipeConnection(t)
+	var lock sync.Mutex
+	received := map[string][]string{}
+	var handled sync.WaitGroup
+	handled.Add(40)
+	dispatcher := con.DispatchOrdered(4, 2, func(event *goesl.Event) {
+		defer handled.Done()
+		if event.GetHeader("Unique-ID") == "a" {
+			// A slow channel does not reorder its own events
+			time.Sleep(time.Millisecond)
+		}
+		lock.Lock()
+		uuid := event.GetHeader("Unique-ID")
+		received[uuid] = append(received[uuid], event.GetHeader("Event-Sequence"))
+		lock.Unlock()
+	})
+	go func() {
+		for i := 0; i < 20; i++ {
+			for _, uuid := range []string{"a", "b"} {
+				jsonEvent(fs, fmt.Sprintf(`{"Event-Name":"CHANNEL_STATE","Unique-ID":"%s","Event-Sequence":"%d"}`, uuid, i))
+			}
+		}
+	}()
+	handled.Wait()
+	dispatcher.Stop()
+	for _, uuid := range []string{"a", "b"} {
+		assert.Len(t, received[uuid], 20)
+		for i, sequence := range received[uuid] {
+			assert.Equal(t, strconv.Itoa(i), sequence)
+		}
+	}
+}
+
+func TestConnection_DispatchOrderedRegisterFromHandler(t *testing.T) {
+	con, fs := newPipeConnection(t)
+	release := make(chan struct{})
+	var handled int32
+	dispatcher := con.DispatchOrdered(1, 1, func(event *goesl.Event) {
+		if event.GetHeader("Event-Sequence") == "1" {
+			<-release
+			// The read loop is waiting for room in the queue meanwhile
+			id := con.RegisterEventListener("abc", func(event *goesl.Event) {})
+			con.RemoveEventListener("abc", id)
+		}
+		atomic.AddInt32(&handled, 1)
+	})
+	defer dispatcher.Stop()
+	written := make(chan struct{})
+	go func() {
+		for i := 1; i <= 3; i++ {
+			jsonEvent(fs, fmt.Sprintf(`{"Event-Name":"CHANNEL_STATE","Unique-ID":"abc","Event-Sequence":"%d"}`, i))
+		}
+		close(written)
+		readCommand(fs)
+		fs.APIResponse("+OK")
+	}()
+	// The first event is handled, the second queued and the third, read once written, waits for room
+	assert.Eventually(t, func() bool {
+		return dispatcher.Stats().Queued == 1
+	}, time.Second, time.Millisecond)
+	<-written
+	close(release)
+	assert.Eventually(t, func() bool {
+		return atomic.LoadInt32(&handled) == 3
+	}, time.Second, time.Millisecond)
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	_, err := con.ApiWithContext(ctx, "status")
+	assert.Nil(t, err)
+}
+
+func TestConnection_RateLimit(t *testing.T) {
+	con, fs := newPipeConnectionWith(t, goesl.Options{RateLimit: 20, RateBurst: 2, RateLimitFailFast: true})
+	go func() {
+		for {
+			if readCommand(fs) == "" {
+				return
+			}
+		}
+	}()
+	assert.Nil(t, con.SendAsync("noevents"))
+	assert.Nil(t, con.SendAsync("noevents"))
+	assert.Equal(t, goesl.ErrRateLimited, con.SendAsync("noevents"))
+
+	waiting, waitingFs := newPipeConnectionWith(t, goesl.Options{RateLimit: 20, RateBurst: 1})
+	go func() {
+		for {
+			if readCommand(waitingFs) == "" {
+				return
+			}
+		}
+	}()
+	start := time.Now()
+	for i := 0; i < 3; i++ {
+		assert.Nil(t, waiting.SendAsync("noevents"))
+	}
+	assert.True(t, time.Since(start) >= 90*time.Millisecond)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	_, err := waiting.SendWithContext(ctx, "noevents")
+	assert.Equal(t, context.DeadlineExceeded, err)
+}
+
+func TestConnection_CircuitBreaker(t *testing.T) {
+	con, fs := newPipeConnectionWith(t, goesl.Options{CircuitThreshold: 2, CircuitProbeInterval: 50 * time.Millisecond})
+	probed := make(chan bool)
+	go func() {
+		fs.ExpectCommand("api eval 1")
+		fs.ExpectCommand("api eval 2")
+		fs.ExpectCommand("api status")
+		// Late replies of the timed out commands, then the one of the probe
+		fs.APIResponse("1")
+		fs.APIResponse("2")
+		fs.APIResponse("UP 0 years, 0 days")
+		close(probed)
+	}()
+	for i := 1; i <= 2; i++ {
+		ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+		_, err := con.ApiWithContext(ctx, fmt.Sprintf("eval %d", i))
+		cancel()
+		assert.Equal(t, context.DeadlineExceeded, err)
+	}
+	assert.Equal(t, goesl.CircuitOpen, con.CircuitState())
+	_, err := con.Api("eval 3")
+	assert.Equal(t, goesl.ErrCircuitOpen, err)
+
+	<-probed
+	assert.Eventually(t, func() bool {
+		return con.CircuitState() == goesl.CircuitClosed
+	}, time.Second, 10*time.Millisecond)
+}
+
+func TestConnection_PoolResponses(t *testing.T) {
+	con, fs := newPipeConnectionWith(t, goesl.Options{PoolResponses: true})
+	var listened sync.WaitGroup
+	listened.Add(10)
+	con.RegisterEventListener(goesl.EventListenAll, func(event *goesl.Event) {
+		defer listened.Done()
+		// The event stays valid until the listener returns, whatever ReadMessage callers do
+		time.Sleep(time.Millisecond)
+		assert.Equal(t, "HEARTBEAT", event.GetHeader("Event-Name"))
+	})
+	go func() {
+		for i := 0; i < 10; i++ {
+			jsonEvent(fs, fmt.Sprintf(`{"Event-Name":"HEARTBEAT","Event-Sequence":"%d"}`, i))
+		}
+	}()
+	for i := 0; i < 10; i++ {
+		message, err := con.ReadMessage()
+		assert.Nil(t, err)
+		assert.Equal(t, strconv.Itoa(i), message.GetHeader("Event-Sequence"))
+		message.Release()
+	}
+	listened.Wait()
+}
+
+// countingConn - net.Conn counting its writes
+type countingConn struct {
+	net.Conn
+	writes int32
+}
+
+func (c *countingConn) Write(p []byte) (int, error) {
+	atomic.AddInt32(&c.writes, 1)
+	return c.Conn.Write(p)
+}
+
+func TestConnection_SendEventSingleWrite(t *testing.T) {
+	client, server := net.Pipe()
+	counting := &countingConn{Conn: client}
+	con := goesl.NewConnectionFromConn(counting, goesl.Options{Role: goesl.RoleOutbound})
+	fs := goesltest.NewServer(t, server)
+	defer con.Close()
+	defer server.Close()
+	go func() {
+		command, body := readFrame(fs)
+		assert.Equal(t, "sendevent CUSTOM\nEvent-Subclass: goesl::test\nContent-Length: 5", command)
+		assert.Equal(t, "hello", body)
+		fs.Reply("+OK")
+	}()
+	_, err := con.SendEvent("CUSTOM", []string{"Event-Subclass: goesl::test"}, "hello")
+	assert.Nil(t, err)
+	assert.Equal(t, int32(1), atomic.LoadInt32(&counting.writes))
+}
+
+func TestConnection_ApiWithRetry(t *testing.T) {
+	con, fs := newPipeConnection(t)
+	go func() {
+		fs.ExpectCommand("api uuid_getvar abc foo")
+		fs.APIResponse("-ERR SUBSCRIBER_ABSENT")
+		fs.ExpectCommand("api uuid_getvar abc foo")
+		fs.APIResponse("bar")
+		fs.ExpectCommand("api uuid_getvar abc missing")
+		fs.APIResponse("-ERR No such channel!")
+	}()
+	policy := goesl.RetryPolicy{MaxAttempts: 3, Backoff: time.Millisecond}
+	response, err := con.ApiWithRetry(context.Background(), "uuid_getvar abc foo", policy)
+	assert.Nil(t, err)
+	assert.Equal(t, "bar", string(response.Body))
+
+	// Not transient, a single attempt
+	_, err = con.ApiWithRetry(context.Background(), "uuid_getvar abc missing", policy)
+	assert.NotNil(t, err)
+}
+
+func TestConnection_RetryPolicyOption(t *testing.T) {
+	con, fs := newPipeConnectionWith(t, goesl.Options{Retry: goesl.RetryPolicy{
+		MaxAttempts:    2,
+		Backoff:        time.Millisecond,
+		AttemptTimeout: 50 * time.Millisecond,
+	}})
+	go func() {
+		fs.ExpectCommand("api global_getvar hostname")
+		// The first attempt times out, its late reply keeps its place
+		fs.ExpectCommand("api global_getvar hostname")
+		fs.APIResponse("late")
+		fs.APIResponse("fs01")
+	}()
+	value, ok, err := con.GetGlobalVar("hostname")
+	assert.Nil(t, err)
+	assert.True(t, ok)
+	assert.Equal(t, "fs01", value)
+}
+
+func TestConnection_TrackCall(t *testing.T) {
+	con, fs := newPipeConnection(t)
+	go func() {
+		assert.True(t, strings.HasPrefix(readCommand(fs), "event json CHANNEL_CREATE"))
+		fs.Reply("+OK event listener enabled json")
+	}()
+	call, err := con.TrackCall("abc")
+	assert.Nil(t, err)
+
+	jsonEvent(fs, `{"Event-Name":"CHANNEL_CREATE","Unique-ID":"abc","Event-Sequence":"1","Channel-State":"CS_INIT","Call-Direction":"outbound","Caller-Channel-Created-Time":"1600000000000000","variable_foo":"bar"}`)
+	jsonEvent(fs, `{"Event-Name":"CHANNEL_ANSWER","Unique-ID":"abc","Event-Sequence":"2","Channel-State":"CS_EXECUTE","Channel-Call-State":"ACTIVE","Caller-Channel-Answered-Time":"1600000001000000"}`)
+	jsonEvent(fs, `{"Event-Name":"CHANNEL_HANGUP_COMPLETE","Unique-ID":"abc","Event-Sequence":"3","Channel-State":"CS_REPORTING","Channel-Call-State":"HANGUP","Hangup-Cause":"NORMAL_CLEARING","Caller-Channel-Answered-Time":"1600000001000000","Caller-Channel-Hangup-Time":"1600000005000000"}`)
+	unsubscribed := make(chan string, 1)
+	go func() {
+		unsubscribed <- readCommand(fs)
+		fs.Reply("+OK events removed")
+	}()
+	select {
+	case <-call.Done():
+	case <-time.After(time.Second):
+		t.Fatal("call not done after CHANNEL_HANGUP_COMPLETE")
+	}
+	assert.Equal(t, goesl.ChannelStateReporting, call.State())
+	assert.Equal(t, goesl.CallStateHangup, call.CallState())
+	assert.Equal(t, goesl.HangupCauseNormalClearing, call.HangupCause())
+	assert.Equal(t, 4*time.Second, call.HungupAt().Sub(call.AnsweredAt()))
+	assert.Equal(t, time.Second, call.AnsweredAt().Sub(call.CreatedAt()))
+	assert.Equal(t, "bar", call.Variable("foo"))
+	// The channel events are dropped once the call is done
+	assert.True(t, strings.HasPrefix(<-unsubscribed, "nixevent"))
+}
+
+func TestConnection_OnNewCall(t *testing.T) {
+	con, fs := newPipeConnection(t)
+	go func() {
+		assert.True(t, strings.HasPrefix(readCommand(fs), "event json CHANNEL_CREATE"))
+		fs.Reply("+OK event listener enabled json")
+	}()
+	calls := make(chan *goesl.Call, 20)
+	stop, err := con.OnNewCall(func(call *goesl.Call) {
+		calls <- call
+	})
+	if !assert.Nil(t, err) {
+		return
+	}
+	// The hangup is read right after the creation, the call must still see it
+	var frames strings.Builder
+	for i := 0; i < cap(calls); i++ {
+		for _, body := range []string{
+			fmt.Sprintf(`{"Event-Name":"CHANNEL_CREATE","Unique-ID":"call-%d","Channel-State":"CS_INIT"}`, i),
+			fmt.Sprintf(`{"Event-Name":"CHANNEL_HANGUP_COMPLETE","Unique-ID":"call-%d","Channel-State":"CS_REPORTING","Hangup-Cause":"NORMAL_CLEARING"}`, i),
+		} {
+			fmt.Fprintf(&frames, "Content-Type: text/event-json\nContent-Length: %d\n\n%s", len(body), body)
+		}
+	}
+	fs.Write(frames.String())
+	for i := 0; i < cap(calls); i++ {
+		select {
+		case call := <-calls:
+			select {
+			case <-call.Done():
+			case <-time.After(time.Second):
+				t.Fatalf("%s not done after CHANNEL_HANGUP_COMPLETE", call.UUID())
+			}
+			assert.Equal(t, goesl.HangupCauseNormalClearing, call.HangupCause())
+		case <-time.After(time.Second):
+			t.Fatal("new call handler not called")
+		}
+	}
+	go func() {
+		assert.True(t, strings.HasPrefix(readCommand(fs), "nixevent"))
+		fs.Reply("+OK events removed")
+	}()
+	stop()
+}
+
+// answerSubscriptions - Accept the event commands sent before a bgapi, then return the bgapi frame
+func answerSubscriptions(fs *goesltest.Server) string {
+	for {
+		command := readCommand(fs)
+		if !strings.HasPrefix(command, "event ") {
+			return command
+		}
+		fs.Reply("+OK event listener enabled json")
+	}
+}
+
+func TestConnection_DialCall(t *testing.T) {
+	uuidPattern := regexp.MustCompile(`origination_uuid=([^,}]+)`)
+	jobPattern := regexp.MustCompile(`Job-UUID: (\S+)`)
+	con, fs := newPipeConnection(t)
+	go func() {
+		frame := answerSubscriptions(fs)
+		assert.Contains(t, frame, "originate_timeout=30")
+		uuid := uuidPattern.FindStringSubmatch(frame)[1]
+		fs.Reply("+OK Job-UUID: " + jobPattern.FindStringSubmatch(frame)[1])
+		jsonEvent(fs, `{"Event-Name":"CHANNEL_ANSWER","Unique-ID":"`+uuid+`","Event-Sequence":"1","Channel-Call-State":"ACTIVE"}`)
+		readCommand(fs)
+		fs.Reply("+OK events removed")
+	}()
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	call, err := con.DialCall(ctx, goesl.OriginateSpec{Endpoint: "user/1000", Timeout: 30 * time.Second})
+	assert.Nil(t, err)
+	if assert.NotNil(t, call) {
+		assert.Equal(t, goesl.CallStateActive, call.CallState())
+	}
+
+	go func() {
+		frame := answerSubscriptions(fs)
+		job := jobPattern.FindStringSubmatch(frame)[1]
+		fs.Reply("+OK Job-UUID: " + job)
+		body := "-ERR USER_BUSY\n"
+		event := fmt.Sprintf(`{"Event-Name":"BACKGROUND_JOB","Job-UUID":"%s","_body":%q}`, job, body)
+		jsonEvent(fs, event)
+		for command := readCommand(fs); command != ""; command = readCommand(fs) {
+			fs.Reply("+OK events removed")
+		}
+	}()
+	_, err = con.DialCall(ctx, goesl.OriginateSpec{Endpoint: "user/1001"})
+	var originateErr *goesl.OriginateError
+	if assert.True(t, errors.As(err, &originateErr)) {
+		assert.Equal(t, goesl.HangupCauseUserBusy, originateErr.Cause)
+	}
+}
+
+func TestConnection_Bridge(t *testing.T) {
+	con, fs := newPipeConnection(t)
+	go func() {
+		assert.Equal(t, "api uuid_bridge a b", answerSubscriptions(fs))
+		fs.APIResponse("+OK a\n")
+		jsonEvent(fs, `{"Event-Name":"CHANNEL_BRIDGE","Unique-ID":"a","Other-Leg-Unique-ID":"b"}`)
+		fs.ExpectCommand("api uuid_park a")
+		fs.APIResponse("+OK\n")
+		fs.ExpectCommand("api uuid_park b")
+		fs.APIResponse("+OK\n")
+		jsonEvent(fs, `{"Event-Name":"CHANNEL_UNBRIDGE","Unique-ID":"b","Other-Leg-Unique-ID":"a"}`)
+		for command := readCommand(fs); command != ""; command = readCommand(fs) {
+			if strings.HasPrefix(command, "api ") {
+				fs.APIResponse("-ERR Invalid uuid c\n")
+				continue
+			}
+			fs.Reply("+OK")
+		}
+	}()
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	bridge, err := con.Bridge(ctx, "a", "b")
+	if assert.Nil(t, err) {
+		assert.Nil(t, bridge.Unbridge(ctx))
+		assert.False(t, bridge.HungUp())
+	}
+
+	_, err = con.Bridge(ctx, "c", "a")
+	assert.True(t, errors.Is(err, goesl.ErrChannelNotFound))
+}
+
+func TestIVR_RunMenu(t *testing.T) {
+	con, fs := goesltest.NewOutbound(t, goesl.Options{})
+	appPattern := regexp.MustCompile(`Event-UUID: (\S+)`)
+	dtmf := func(digit string) {
+		jsonEvent(fs, `{"Event-Name":"DTMF","Unique-ID":"abc","DTMF-Digit":"`+digit+`"}`)
+	}
+	// playback - Read a playback, answer it and return its Application-UUID
+	playback := func(file string) string {
+		frame, body := readFrame(fs)
+		assert.Equal(t, file, body)
+		fs.Reply("+OK")
+		return appPattern.FindStringSubmatch(frame)[1]
+	}
+	complete := func(app string) {
+		jsonEvent(fs, `{"Event-Name":"CHANNEL_EXECUTE_COMPLETE","Unique-ID":"abc","Application-UUID":"`+app+`"}`)
+	}
+	breakPlayback := func() {
+		fs.ExpectCommand("api uuid_break abc")
+		fs.APIResponse("+OK\n")
+	}
+	go func() {
+		// Barge-in with an invalid entry
+		app := playback("menu.wav")
+		dtmf("9")
+		breakPlayback()
+		complete(app)
+		dtmf("#")
+		complete(playback("invalid.wav"))
+		// Valid entry on the second try
+		app = playback("menu.wav")
+		dtmf("1")
+		breakPlayback()
+		complete(app)
+		dtmf("2")
+	}()
+	ivr, err := con.NewIVR("abc")
+	if !assert.Nil(t, err) {
+		return
+	}
+	defer ivr.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	choice, err := ivr.RunMenu(ctx, goesl.Menu{
+		Prompt:        []string{"menu.wav"},
+		Choices:       []string{"12", "3"},
+		InvalidPrompt: "invalid.wav",
+		Timeout:       500 * time.Millisecond,
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, "12", choice)
+}
+
+func TestCallRegistry(t *testing.T) {
+	con, fs := newPipeConnection(t)
+	checked := make(chan struct{})
+	go func() {
+		assert.Equal(t, "api show channels as json", answerSubscriptions(fs))
+		fs.APIResponse(`{"row_count":1,"rows":[{"uuid":"old","direction":"inbound","created_epoch":"1600000000","state":"CS_EXECUTE","callstate":"ACTIVE","cid_num":"1000","dest":"2000"}]}`)
+		jsonEvent(fs, `{"Event-Name":"CHANNEL_CREATE","Unique-ID":"new","Channel-State":"CS_INIT","Call-Direction":"outbound","Caller-Caller-ID-Number":"1001","Caller-Channel-Created-Time":"1600000001000000"}`)
+		jsonEvent(fs, `{"Event-Name":"CHANNEL_ANSWER","Unique-ID":"new","Channel-Call-State":"ACTIVE","Caller-Channel-Answered-Time":"1600000002000000"}`)
+		<-checked
+		jsonEvent(fs, `{"Event-Name":"CHANNEL_HANGUP_COMPLETE","Unique-ID":"old","Channel-Call-State":"HANGUP"}`)
+		// Late event of a channel already gone
+		jsonEvent(fs, `{"Event-Name":"CHANNEL_STATE","Unique-ID":"old","Channel-State":"CS_DESTROY"}`)
+	}()
+	registry := goesl.NewCallRegistry()
+	assert.Nil(t, registry.Attach(con))
+	old, ok := registry.Get("old")
+	if assert.True(t, ok) {
+		assert.Equal(t, "1000", old.CallerNumber)
+		assert.Equal(t, "2000", old.CalleeNumber)
+	}
+	close(checked)
+	assert.Eventually(t, func() bool {
+		_, ok := registry.Get("old")
+		return !ok && registry.Count() == 1
+	}, time.Second, 5*time.Millisecond)
+	calls := registry.Snapshot()
+	if assert.Len(t, calls, 1) {
+		assert.Equal(t, "new", calls[0].UUID)
+		assert.Equal(t, goesl.CallStateActive, calls[0].CallState)
+		assert.Equal(t, "1001", calls[0].CallerNumber)
+		assert.False(t, calls[0].Answered.IsZero())
+	}
+}
+
+func TestConnection_TrackRegistrations(t *testing.T) {
+	con, fs := newPipeConnection(t)
+	go func() {
+		fs.ExpectCommand("event json CUSTOM sofia::register sofia::unregister sofia::expire")
+		fs.Reply("+OK event listener enabled json")
+	}()
+	added := make(chan goesl.Registration, 4)
+	removed := make(chan bool, 4)
+	tracker, err := con.TrackRegistrations(goesl.RegistrationTrackerOptions{
+		OnAdd:    func(reg goesl.Registration) { added <- reg },
+		OnRemove: func(reg goesl.Registration, expired bool) { removed <- expired },
+	})
+	if !assert.Nil(t, err) {
+		return
+	}
+	register := `{"Event-Name":"CUSTOM","Event-Subclass":"sofia::register","profile-name":"internal","from-user":"1000","from-host":"example.com","call-id":"%s","contact":"sip:1000@10.0.0.%s","network-ip":"10.0.0.%s","expires":"300"}`
+	jsonEvent(fs, fmt.Sprintf(register, "a", "1", "1"))
+	jsonEvent(fs, fmt.Sprintf(register, "b", "2", "2"))
+	// Refresh, not reported again
+	jsonEvent(fs, fmt.Sprintf(register, "a", "1", "1"))
+	jsonEvent(fs, `{"Event-Name":"CUSTOM","Event-Subclass":"sofia::expire","profile-name":"internal","user":"1000","host":"example.com","call-id":"b"}`)
+
+	assert.Equal(t, "10.0.0.1", (<-added).NetworkIP)
+	assert.Equal(t, "10.0.0.2", (<-added).NetworkIP)
+	assert.True(t, <-removed)
+	assert.True(t, tracker.IsRegistered("1000", "example.com"))
+	regs := tracker.Get("1000", "example.com")
+	if assert.Len(t, regs, 1) {
+		assert.Equal(t, "a", regs[0].CallID)
+		assert.False(t, regs[0].Expires.IsZero())
+	}
+
+	jsonEvent(fs, `{"Event-Name":"CUSTOM","Event-Subclass":"sofia::unregister","profile-name":"internal","from-user":"1000","from-host":"example.com","call-id":"a"}`)
+	assert.False(t, <-removed)
+	assert.Equal(t, 0, tracker.Count())
+	assert.Empty(t, added)
+}
+
+func TestConnection_TrackPresence(t *testing.T) {
+	con, fs := newPipeConnection(t)
+	go func() {
+		fs.ExpectCommand("event json PRESENCE_IN PRESENCE_PROBE")
+		fs.Reply("+OK event listener enabled json")
+	}()
+	changes := make(chan goesl.PresenceChange, 8)
+	tracker, err := con.TrackPresence(func(change goesl.PresenceChange) { changes <- change })
+	if !assert.Nil(t, err) {
+		return
+	}
+	presence := `{"Event-Name":"PRESENCE_IN","from":"1000@example.com","Unique-ID":"%s","answer-state":"%s"}`
+	jsonEvent(fs, `{"Event-Name":"PRESENCE_PROBE","from":"1001@example.com","to":"1002@example.com"}`)
+	jsonEvent(fs, fmt.Sprintf(presence, "a", "early"))
+	jsonEvent(fs, fmt.Sprintf(presence, "a", "confirmed"))
+	// A second call ringing while on call does not change the state
+	jsonEvent(fs, fmt.Sprintf(presence, "b", "early"))
+	jsonEvent(fs, fmt.Sprintf(presence, "a", "terminated"))
+	jsonEvent(fs, fmt.Sprintf(presence, "b", "terminated"))
+
+	for _, expected := range []goesl.PresenceState{goesl.PresenceRinging, goesl.PresenceOnCall, goesl.PresenceRinging, goesl.PresenceIdle} {
+		change := <-changes
+		assert.Equal(t, "1000@example.com", change.User)
+		assert.Equal(t, expected, change.State)
+	}
+	assert.Equal(t, goesl.PresenceIdle, tracker.State("1000@example.com"))
+	assert.Equal(t, map[string]goesl.PresenceState{
+		"1000@example.com": goesl.PresenceIdle,
+		"1002@example.com": goesl.PresenceIdle,
+	}, tracker.States())
+}
+
+func TestConnection_ManageConferences(t *testing.T) {
+	con, fs := newPipeConnection(t)
+	go func() {
+		fs.ExpectCommand("event json CUSTOM conference::maintenance")
+		fs.Reply("+OK event listener enabled json")
+	}()
+	manager, err := con.ManageConferences()
+	if !assert.Nil(t, err) {
+		return
+	}
+	changes, unwatch := manager.Watch("room")
+	defer unwatch()
+	maintenance := `{"Event-Name":"CUSTOM","Event-Subclass":"conference::maintenance","Conference-Name":"room","Action":"%s","Member-ID":"%d","Unique-ID":"leg-%d","Caller-Caller-ID-Number":"100%d","Speak":"true","Hear":"true"}`
+	jsonEvent(fs, fmt.Sprintf(maintenance, "add-member", 1, 1, 1))
+	jsonEvent(fs, fmt.Sprintf(maintenance, "add-member", 2, 2, 2))
+	jsonEvent(fs, fmt.Sprintf(maintenance, "start-talking", 1, 1, 1))
+	jsonEvent(fs, `{"Event-Name":"CUSTOM","Event-Subclass":"conference::maintenance","Conference-Name":"room","Action":"mute-member","Member-ID":"2","Speak":"false","Hear":"true"}`)
+	jsonEvent(fs, fmt.Sprintf(maintenance, "del-member", 1, 1, 1))
+
+	for _, action := range []string{"add-member", "add-member", "start-talking", "mute-member", "del-member"} {
+		assert.Equal(t, action, (<-changes).Action)
+	}
+	assert.Equal(t, []string{"room"}, manager.Conferences())
+	members := manager.Members("room")
+	if assert.Len(t, members, 1) {
+		assert.Equal(t, 2, members[0].ID)
+		assert.Equal(t, "1002", members[0].Number)
+		assert.True(t, members[0].Muted)
+	}
+
+	go func() {
+		fs.ExpectCommand("api conference room unmute 2")
+		fs.APIResponse("OK unmute 2\n")
+		fs.ExpectCommand("api conference room kick 9")
+		fs.APIResponse("Non-Existant ID 9\n")
+	}()
+	assert.Nil(t, manager.Unmute("room", 2))
+	var confErr *goesl.ConferenceError
+	assert.True(t, errors.As(manager.Kick("room", 9), &confErr))
+}
+
+func TestConnection_ForwardEvents(t *testing.T) {
+	var requests int32
+	batches := make(chan []map[string]string, 4)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		assert.Equal(t, "sha256="+goesl.SignWebhook("secret", body), r.Header.Get(goesl.WebhookSignatureHeader))
+		// The first attempt fails and is retried
+		if atomic.AddInt32(&requests, 1) == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		var batch []map[string]string
+		assert.Nil(t, json.Unmarshal(body, &batch))
+		batches <- batch
+	}))
+	defer server.Close()
+
+	con, fs := newPipeConnection(t)
+	go func() {
+		fs.ExpectCommand("event json CHANNEL_ANSWER")
+		fs.Reply("+OK event listener enabled json")
+	}()
+	forwarder, err := con.ForwardEvents(goesl.WebhookOptions{
+		URL:          server.URL,
+		Events:       []string{goesl.EventChannelAnswer},
+		Filter:       func(event *goesl.Event) bool { return event.GetHeader("variable_tenant") == "acme" },
+		BatchSize:    2,
+		RetryBackoff: time.Millisecond,
+		Secret:       "secret",
+	})
+	if !assert.Nil(t, err) {
+		return
+	}
+	jsonEvent(fs, `{"Event-Name":"CHANNEL_ANSWER","Unique-ID":"a","variable_tenant":"acme"}`)
+	jsonEvent(fs, `{"Event-Name":"CHANNEL_ANSWER","Unique-ID":"b","variable_tenant":"other"}`)
+	jsonEvent(fs, `{"Event-Name":"CHANNEL_ANSWER","Unique-ID":"c","variable_tenant":"acme"}`)
+
+	select {
+	case batch := <-batches:
+		if assert.Len(t, batch, 2) {
+			uuids := []string{batch[0]["Unique-ID"], batch[1]["Unique-ID"]}
+			sort.Strings(uuids)
+			assert.Equal(t, []string{"a", "c"}, uuids)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("no batch delivered")
+	}
+	go func() {
+		readCommand(fs)
+		fs.Reply("+OK events removed")
+	}()
+	assert.Nil(t, forwarder.Stop())
+	assert.Equal(t, int32(2), atomic.LoadInt32(&requests))
+}
+
+func TestEventBus(t *testing.T) {
+	con, fs := newPipeConnection(t)
+	bus := con.NewEventBus(0)
+	defer bus.Close()
+	collect := func(received chan string) goesl.EventListener {
+		return func(event *goesl.Event) {
+			received <- event.GetHeader("Event-Name") + " " + event.GetHeader("Unique-ID")
+		}
+	}
+	channel := make(chan string, 8)
+	custom := make(chan string, 8)
+	leg := make(chan string, 8)
+	bus.Subscribe("CHANNEL_*", collect(channel))
+	bus.Subscribe("CUSTOM sofia::*", collect(custom))
+	legSub := bus.SubscribeHeader("Unique-ID", "b", collect(leg))
+
+	jsonEvent(fs, `{"Event-Name":"CHANNEL_CREATE","Unique-ID":"a"}`)
+	jsonEvent(fs, `{"Event-Name":"HEARTBEAT"}`)
+	jsonEvent(fs, `{"Event-Name":"CUSTOM","Event-Subclass":"sofia::register"}`)
+	jsonEvent(fs, `{"Event-Name":"CUSTOM","Event-Subclass":"conference::maintenance"}`)
+	jsonEvent(fs, `{"Event-Name":"CHANNEL_ANSWER","Unique-ID":"b"}`)
+
+	assert.Equal(t, "CHANNEL_CREATE a", <-channel)
+	assert.Equal(t, "CHANNEL_ANSWER b", <-channel)
+	assert.Equal(t, "CUSTOM ", <-custom)
+	assert.Equal(t, "CHANNEL_ANSWER b", <-leg)
+
+	legSub.Unsubscribe()
+	jsonEvent(fs, `{"Event-Name":"CHANNEL_HANGUP","Unique-ID":"b"}`)
+	assert.Equal(t, "CHANNEL_HANGUP b", <-channel)
+	assert.Empty(t, leg)
+	assert.Empty(t, custom)
+}
+
+func TestConnection_ExpectEvent(t *testing.T) {
+	con, fs := newPipeConnection(t)
+	go func() {
+		fs.ExpectCommand("api uuid_kill abc")
+		// The event is sent before the reply, it is still seen by Wait
+		jsonEvent(fs, `{"Event-Name":"CHANNEL_HANGUP","Unique-ID":"abc"}`)
+		fs.APIResponse("+OK\n")
+	}()
+	pending := con.ExpectEvent(func(event *goesl.Event) bool {
+		return event.GetHeader("Event-Name") == goesl.EventChannelHangup && event.GetHeader("Unique-ID") == "abc"
+	})
+	defer pending.Cancel()
+	_, err := con.Api("uuid_kill abc")
+	assert.Nil(t, err)
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	event, err := pending.Wait(ctx)
+	if assert.Nil(t, err) {
+		assert.Equal(t, "abc", event.GetHeader("Unique-ID"))
+	}
+}
+
+func TestEventMatcher(t *testing.T) {
+	event := &goesl.Event{}
+	event.Headers.Add("Event-Name", "CHANNEL_ANSWER")
+	event.Headers.Add("Unique-ID", "abc")
+	event.Headers.Add("variable_tenant", "acme")
+
+	assert.True(t, goesl.And(goesl.EventName("CHANNEL_ANSWER"), goesl.VarEq("tenant", "acme")).Match(event))
+	assert.False(t, goesl.And(goesl.EventName("CHANNEL_ANSWER"), goesl.Not(goesl.HeaderEq("Unique-ID", "abc"))).Match(event))
+	assert.True(t, goesl.Or(goesl.EventName("CUSTOM sofia::register"), goesl.HeaderEq("Unique-ID", "abc")).Match(event))
+	assert.False(t, goesl.EventName("CUSTOM sofia::register").Match(event))
+	assert.True(t, goesl.MatchFunc(func(e *goesl.Event) bool { return e.GetHeader("variable_tenant") != "" }).Match(event))
+}
+
+func TestConnection_ListenMatching(t *testing.T) {
+	con, fs := newPipeConnection(t)
+	commands := make(chan string, 8)
+	go func() {
+		for command := readCommand(fs); command != ""; command = readCommand(fs) {
+			commands <- command
+			fs.Reply("+OK filter added")
+		}
+	}()
+	received := make(chan string, 4)
+	matcher := goesl.Or(goesl.EventName(goesl.EventChannelAnswer), goesl.EventName("CUSTOM sofia::register"))
+	stop, err := con.ListenMatching(matcher, true, func(event *goesl.Event) {
+		received <- event.GetHeader("Event-Name")
+	})
+	if !assert.Nil(t, err) {
+		return
+	}
+	assert.Equal(t, "filter Event-Name CHANNEL_ANSWER", <-commands)
+	assert.Equal(t, "filter Event-Subclass sofia::register", <-commands)
+	jsonEvent(fs, `{"Event-Name":"HEARTBEAT"}`)
+	jsonEvent(fs, `{"Event-Name":"CHANNEL_ANSWER"}`)
+	assert.Equal(t, "CHANNEL_ANSWER", <-received)
+	assert.Nil(t, stop())
+	assert.Equal(t, "filter delete Event-Name CHANNEL_ANSWER", <-commands)
+	assert.Equal(t, "filter delete Event-Subclass sofia::register", <-commands)
+
+	// An intersection is only matched on the client
+	stop, err = con.ListenMatching(goesl.And(goesl.EventName(goesl.EventChannelAnswer), goesl.VarEq("tenant", "acme")), true, func(event *goesl.Event) {})
+	assert.Nil(t, err)
+	assert.Nil(t, stop())
+	assert.Empty(t, commands)
+}
+
+func TestConnection_JournalReplay(t *testing.T) {
+	for _, format := range []goesl.JournalFormat{goesl.JournalNDJSON, goesl.JournalBinary} {
+		path := filepath.Join(t.TempDir(), "events.journal")
+		con, fs := newPipeConnection(t)
+		journal, err := con.StartJournal(goesl.JournalOptions{Path: path, Format: format, MaxSize: 300, MaxFiles: 2})
+		if !assert.Nil(t, err) {
+			return
+		}
+		for i := 0; i < 6; i++ {
+			jsonEvent(fs, fmt.Sprintf(`{"Event-Name":"CHANNEL_STATE","Unique-ID":"abc","Event-Sequence":"%d","Channel-State":"CS_EXECUTE"}`, i))
+		}
+		jsonEvent(fs, `{"Event-Name":"HEARTBEAT","_body":"body text"}`)
+		// The last event is journaled once it is read, ReadMessage returns after the read loop queued it
+		for i := 0; i < 7; i++ {
+			_, err := con.ReadMessage()
+			assert.Nil(t, err)
+		}
+		assert.Nil(t, journal.Close())
+		_, err = os.Stat(path + ".1")
+		assert.Nil(t, err, "journal not rotated")
+
+		file, err := os.Open(path)
+		if !assert.Nil(t, err) {
+			return
+		}
+		replayed, _ := newPipeConnection(t)
+		var names []string
+		var lock sync.Mutex
+		replayed.RegisterEventListener(goesl.EventListenAll, func(event *goesl.Event) {
+			lock.Lock()
+			names = append(names, event.GetHeader("Event-Name")+" "+string(event.Body))
+			lock.Unlock()
+		})
+		assert.Nil(t, replayed.Replay(context.Background(), file, goesl.ReplayOptions{Format: format, Speed: 100}))
+		file.Close()
+		assert.Eventually(t, func() bool {
+			lock.Lock()
+			defer lock.Unlock()
+			for _, name := range names {
+				if name == "HEARTBEAT body text" {
+					return true
+				}
+			}
+			return false
+		}, time.Second, 5*time.Millisecond)
+	}
+}
+
+func TestEncodeJournalEntry(t *testing.T) {
+	event := newEvent(t, `{"Event-Name":"CUSTOM","Event-Subclass":"sofia::register","_body":"body text"}`)
+	received := time.Unix(1600000000, 123)
+	for _, format := range []goesl.JournalFormat{goesl.JournalNDJSON, goesl.JournalBinary} {
+		var journal bytes.Buffer
+		for i := 0; i < 2; i++ {
+			entry, err := goesl.EncodeJournalEntry(received, event, format)
+			assert.Nil(t, err)
+			journal.Write(entry)
+		}
+		reader := goesl.NewJournalReader(&journal, format)
+		for i := 0; i < 2; i++ {
+			at, read, err := reader.Next()
+			if !assert.Nil(t, err) {
+				return
+			}
+			assert.True(t, received.Equal(at))
+			assert.Equal(t, "sofia::register", read.GetHeader("Event-Subclass"))
+			assert.Equal(t, "body text", string(read.Body))
+		}
+		_, _, err := reader.Next()
+		assert.Equal(t, io.EOF, err)
+	}
+}
+
+func TestConnection_Tracer(t *testing.T) {
+	var lock sync.Mutex
+	var trace []string
+	record := func(line string) {
+		lock.Lock()
+		trace = append(trace, line)
+		lock.Unlock()
+	}
+	con, fs := newPipeConnectionWith(t, goesl.Options{Tracer: goesl.TracerFuncs{
+		Send: func(raw []byte) { record("> " + string(raw)) },
+		Receive: func(headers *goesl.Headers, body []byte) {
+			record("< " + headers.Get("Content-Type") + " " + string(body))
+		},
+	}})
+	go func() {
+		readCommand(fs)
+		fs.APIResponse("+OK\n")
+	}()
+	_, err := con.Api("status")
+	assert.Nil(t, err)
+	lock.Lock()
+	defer lock.Unlock()
+	assert.Equal(t, []string{
+		"< auth/request ",
+		"> auth ********\r\n\r\n",
+		"< command/reply ",
+		"> api status\r\n\r\n",
+		"< api/response +OK\n",
+	}, trace)
+}
+
+func TestConnection_Stats(t *testing.T) {
+	con, fs := newPipeConnectionWith(t, goesl.Options{ParseMode: goesl.ParseLenient})
+	go func() {
+		readCommand(fs)
+		fs.APIResponse("+OK\n")
+		jsonEvent(fs, `{"Event-Name":"HEARTBEAT"}`)
+		jsonEvent(fs, `{"Event-Name":"CUSTOM","Event-Subclass":"sofia::register"}`)
+		jsonEvent(fs, `{"Event-Name":"HEARTBEAT"}`)
+		// Kept raw with ParseLenient
+		jsonEvent(fs, `["not an event"]`)
+	}()
+	start := time.Now()
+	_, err := con.Api("status")
+	assert.Nil(t, err)
+	for i := 0; i < 4; i++ {
+		_, err := con.ReadMessage()
+		assert.Nil(t, err)
+	}
+	stats := con.Stats()
+	// auth and api status
+	assert.Equal(t, uint64(2), stats.CommandsSent)
+	assert.Equal(t, uint64(1), stats.RepliesReceived)
+	assert.Equal(t, uint64(4), stats.EventsReceived)
+	assert.Equal(t, uint64(2), stats.EventsByName[goesl.EventHeartbeat])
+	assert.Equal(t, uint64(1), stats.EventsByName["CUSTOM sofia::register"])
+	assert.Equal(t, uint64(1), stats.ParseErrors)
+	assert.Equal(t, uint64(len("auth ClueCon\r\n\r\napi status\r\n\r\n")), stats.BytesWritten)
+	assert.True(t, stats.BytesRead > 0)
+	assert.False(t, stats.LastSent.Before(start))
+	assert.False(t, stats.LastEvent.Before(stats.LastSent))
+	assert.Equal(t, stats.LastEvent, stats.LastReceived)
+}
+
+func TestConnection_PublishExpvar(t *testing.T) {
+	con, _ := newPipeConnectionWith(t, goesl.Options{ExpvarPrefix: "goesl_test"})
+	dispatcher := con.DispatchOrdered(2, 0, func(event *goesl.Event) {})
+	defer dispatcher.Stop()
+	published, ok := expvar.Get("goesl_test").(*expvar.Map)
+	if !assert.True(t, ok) {
+		return
+	}
+	var values []goesl.ExpvarConnection
+	published.Do(func(kv expvar.KeyValue) {
+		var value goesl.ExpvarConnection
+		assert.Nil(t, json.Unmarshal([]byte(kv.Value.String()), &value))
+		values = append(values, value)
+	})
+	if assert.Len(t, values, 1) {
+		assert.Equal(t, "pipe", values[0].RemoteAddress)
+		assert.Equal(t, uint64(1), values[0].Stats.CommandsSent)
+		assert.Equal(t, []goesl.DispatcherStats{{Workers: 2}}, values[0].Dispatchers)
+	}
+	// A name taken by something else is refused, it is kept from a previous run with -count
+	if expvar.Get("goesl_test_int") == nil {
+		expvar.NewInt("goesl_test_int")
+	}
+	assert.NotNil(t, con.PublishExpvar("goesl_test_int"))
+
+	// The entry goes away with the connection
+	con.Close()
+	assert.Eventually(t, func() bool {
+		empty := true
+		published.Do(func(expvar.KeyValue) { empty = false })
+		return empty
+	}, time.Second, 10*time.Millisecond)
+}
+
+func TestConnection_DetectEventGaps(t *testing.T) {
+	gaps := make(chan goesl.EventGap, 4)
+	con, fs := newPipeConnectionWith(t, goesl.Options{
+		DetectEventGaps: true,
+		OnEventGap:      func(gap goesl.EventGap) { gaps <- gap },
+	})
+	go func() {
+		for _, sequence := range []string{"10", "11", "15", "12", "16"} {
+			jsonEvent(fs, `{"Event-Name":"HEARTBEAT","Core-UUID":"a","Event-Sequence":"`+sequence+`"}`)
+		}
+		// A restarted core starts over
+		jsonEvent(fs, `{"Event-Name":"HEARTBEAT","Core-UUID":"b","Event-Sequence":"1"}`)
+	}()
+	for i := 0; i < 6; i++ {
+		_, err := con.ReadMessage()
+		assert.Nil(t, err)
+	}
+	assert.Equal(t, goesl.EventGap{CoreUUID: "a", Last: 11, Next: 15}, <-gaps)
+	assert.Len(t, gaps, 0)
+	assert.Equal(t, uint64(3), con.Stats().MissedEvents)
+}
+
+func TestTenantRouter(t *testing.T) {
+	con, fs := newPipeConnection(t)
+	acmeEvents := make(chan string, 8)
+	otherEvents := make(chan string, 8)
+	router := con.NewTenantRouter(0, func(stream *goesl.TenantStream) {
+		if stream.Tenant == "" {
+			return
+		}
+		stream.Handle(func(event *goesl.Event) {
+			otherEvents <- stream.Tenant + " " + event.GetHeader("Event-Name")
+		})
+	}, "variable_domain_name", "domain")
+	defer router.Close()
+	router.Tenant("acme.com").Handle(func(event *goesl.Event) {
+		acmeEvents <- event.GetHeader("Event-Name")
+	})
+
+	jsonEvent(fs, `{"Event-Name":"CHANNEL_CREATE","variable_domain_name":"acme.com"}`)
+	jsonEvent(fs, `{"Event-Name":"CUSTOM","Event-Subclass":"sofia::register","domain":"globex.com"}`)
+	jsonEvent(fs, `{"Event-Name":"HEARTBEAT"}`)
+	jsonEvent(fs, `{"Event-Name":"CHANNEL_ANSWER","variable_domain_name":"acme.com"}`)
+
+	// The events of a tenant keep their order
+	assert.Equal(t, goesl.EventChannelCreate, <-acmeEvents)
+	assert.Equal(t, goesl.EventChannelAnswer, <-acmeEvents)
+	assert.Equal(t, "globex.com CUSTOM", <-otherEvents)
+	assert.ElementsMatch(t, []string{"acme.com", "globex.com", ""}, router.Tenants())
+
+	router.Remove("globex.com")
+	assert.ElementsMatch(t, []string{"acme.com", ""}, router.Tenants())
+	assert.Empty(t, otherEvents)
+}
+
+func TestConnection_Interceptors(t *testing.T) {
+	var seen []string
+	con, fs := newPipeConnectionWith(t, goesl.Options{Interceptors: []goesl.Interceptor{
+		func(ctx context.Context, cmd string, next goesl.Invoker) (*goesl.ESLResponse, error) {
+			seen = append(seen, cmd)
+			return next(ctx, cmd)
+		},
+	}})
+	denied := errors.New("denied")
+	con.Use(func(ctx context.Context, cmd string, next goesl.Invoker) (*goesl.ESLResponse, error) {
+		if strings.HasPrefix(cmd, "api fsctl") {
+			return nil, denied
+		}
+		// Commands may be rewritten
+		return next(ctx, strings.Replace(cmd, "api uptime", "api status", 1))
+	}, func(ctx context.Context, cmd string, next goesl.Invoker) (*goesl.ESLResponse, error) {
+		// Retry once, the frame is written again
+		response, err := next(ctx, cmd)
+		if err != nil {
+			return next(ctx, cmd)
+		}
+		return response, err
+	})
+	go func() {
+		fs.ExpectCommand("api status")
+		fs.APIResponse("+OK\n")
+		for i := 0; i < 2; i++ {
+			frame, body := readFrame(fs)
+			assert.Equal(t, "sendevent CUSTOM\nEvent-Subclass: goesl::test\nContent-Length: 5", frame)
+			assert.Equal(t, "hello", body)
+			fs.Reply([]string{"-ERR busy", "+OK"}[i])
+		}
+	}()
+	_, err := con.Api("uptime")
+	assert.Nil(t, err)
+	_, err = con.Api("fsctl shutdown")
+	assert.Equal(t, denied, err)
+	_, err = con.SendEvent("CUSTOM", []string{"Event-Subclass: goesl::test"}, "hello")
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"api uptime", "api fsctl shutdown", "sendevent CUSTOM"}, seen)
+}
+
+// fakeProxy - SOCKS5 and HTTP CONNECT proxy expecting the credentials user and secret, the target
+// of each tunnel is sent to targets
+func fakeProxy(t *testing.T, targets chan<- string) net.Listener {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if !assert.Nil(t, err) {
+		t.FailNow()
+	}
+	t.Cleanup(func() { listener.Close() })
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				reader := bufio.NewReader(conn)
+				var target string
+				if first, _ := reader.Peek(1); len(first) == 1 && first[0] == 0x05 {
+					greeting := make([]byte, 4)
+					io.ReadFull(reader, greeting)
+					conn.Write([]byte{0x05, 0x02})
+					readField := func() string {
+						length, _ := reader.ReadByte()
+						field := make([]byte, length)
+						io.ReadFull(reader, field)
+						return string(field)
+					}
+					reader.ReadByte()
+					if readField() != "user" || readField() != "secret" {
+						conn.Write([]byte{0x01, 0x01})
+						return
+					}
+					conn.Write([]byte{0x01, 0x00})
+					request := make([]byte, 5)
+					io.ReadFull(reader, request)
+					host := make([]byte, int(request[4])+2)
+					io.ReadFull(reader, host)
+					target = net.JoinHostPort(string(host[:len(host)-2]), strconv.Itoa(int(host[len(host)-2])<<8|int(host[len(host)-1])))
+					conn.Write([]byte{0x05, 0x00, 0x00, 0x01, 127, 0, 0, 1, 0, 0})
+				} else {
+					request, err := http.ReadRequest(reader)
+					if err != nil || request.Method != http.MethodConnect {
+						return
+					}
+					if request.Header.Get("Proxy-Authorization") != "Basic dXNlcjpzZWNyZXQ=" {
+						conn.Write([]byte("HTTP/1.1 407 Proxy Authentication Required\r\n\r\n"))
+						return
+					}
+					target = request.Host
+					conn.Write([]byte("HTTP/1.1 200 Connection established\r\n\r\n"))
+				}
+				targets <- target
+				upstream, err := net.Dial("tcp", strings.Replace(target, "freeswitch.local", "127.0.0.1", 1))
+				if err != nil {
+					return
+				}
+				defer upstream.Close()
+				go io.Copy(upstream, reader)
+				io.Copy(conn, upstream)
+			}()
+		}
+	}()
+	return listener
+}
+
+func TestDial_Proxy(t *testing.T) {
+	server, err := net.Listen("tcp", "127.0.0.1:0")
+	if !assert.Nil(t, err) {
+		return
+	}
+	defer server.Close()
+	go func() {
+		for {
+			conn, err := server.Accept()
+			if err != nil {
+				return
+			}
+			// freeswitch speaks first
+			conn.Write([]byte("Content-Type: auth/request\n\n"))
+			defer conn.Close()
+		}
+	}()
+	targets := make(chan string, 4)
+	proxy := fakeProxy(t, targets)
+	_, port, _ := net.SplitHostPort(server.Addr().String())
+	address := net.JoinHostPort("freeswitch.local", port)
+
+	for _, scheme := range []string{"socks5", "http"} {
+		conn, err := goesl.Dial("tcp", address, time.Second, goesl.DialOptions{
+			Proxy: scheme + "://user:secret@" + proxy.Addr().String(),
+		})
+		if !assert.Nil(t, err, scheme) {
+			continue
+		}
+		assert.Equal(t, address, <-targets)
+		line, _ := bufio.NewReader(conn).ReadString('\n')
+		assert.Equal(t, "Content-Type: auth/request\n", line)
+		conn.Close()
+	}
+	_, err = goesl.Dial("tcp", address, time.Second, goesl.DialOptions{Proxy: "http://user:wrong@" + proxy.Addr().String()})
+	assert.NotNil(t, err)
+	_, err = goesl.Dial("tcp", address, time.Second, goesl.DialOptions{Proxy: "socks5://user:wrong@" + proxy.Addr().String()})
+	assert.NotNil(t, err)
+
+	t.Setenv("ALL_PROXY", "socks5://user:secret@"+proxy.Addr().String())
+	t.Setenv("NO_PROXY", "localhost, .example.com")
+	assert.Equal(t, "", goesl.ProxyFromEnvironment("pbx.example.com:8021"))
+	assert.Equal(t, "", goesl.ProxyFromEnvironment("localhost:8021"))
+	conn, err := goesl.Dial("tcp", address, time.Second, goesl.DialOptions{ProxyFromEnvironment: true})
+	if assert.Nil(t, err) {
+		assert.Equal(t, address, <-targets)
+		conn.Close()
+	}
+}
+
+func TestDial_DialContext(t *testing.T) {
+	dialed := make(chan string, 2)
+	dialContext := func(ctx context.Context, network, address string) (net.Conn, error) {
+		_, hasDeadline := ctx.Deadline()
+		assert.True(t, hasDeadline)
+		dialed <- network + " " + address
+		client, server := net.Pipe()
+		go func() {
+			server.Write([]byte("Content-Type: auth/request\n\n"))
+			server.Close()
+		}()
+		return client, nil
+	}
+	conn, err := goesl.Dial("tcp", "mesh.local:8021", time.Second, goesl.DialOptions{DialContext: dialContext})
+	if assert.Nil(t, err) {
+		assert.Equal(t, "tcp mesh.local:8021", <-dialed)
+		line, _ := bufio.NewReader(conn).ReadString('\n')
+		assert.Equal(t, "Content-Type: auth/request\n", line)
+		conn.Close()
+	}
+
+	con, _ := newPipeConnectionWith(t, goesl.Options{DialContext: dialContext})
+	conn, err = con.Dial("tcp", "other.local:8021", time.Second)
+	if assert.Nil(t, err) {
+		assert.Equal(t, "tcp other.local:8021", <-dialed)
+		conn.Close()
+	}
+}
+
+func TestNewClientWithConn(t *testing.T) {
+	client, server := net.Pipe()
+	fs := goesltest.NewServer(t, server)
+	defer server.Close()
+	go func() {
+		fs.Write("Content-Type: auth/request\n\n")
+		fs.ExpectCommand("auth ClueCon")
+		fs.Reply("+OK accepted")
+		fs.ExpectCommand("api status")
+		fs.APIResponse("+OK\n")
+	}()
+	c, err := goesl.NewClientWithConn(client, "ClueCon", 1, goesl.Options{})
+	if !assert.Nil(t, err) {
+		return
+	}
+	defer c.Close()
+	assert.Equal(t, "pipe", c.Address)
+	_, err = c.Api("status")
+	assert.Nil(t, err)
+
+	client, server = net.Pipe()
+	fs = goesltest.NewServer(t, server)
+	defer server.Close()
+	go func() {
+		fs.Write("Content-Type: auth/request\n\n")
+		readCommand(fs)
+		fs.Reply("-ERR invalid")
+	}()
+	_, err = goesl.NewClientWithConn(client, "wrong", 1, goesl.Options{})
+	assert.NotNil(t, err)
+}
+
+func TestNewClientWithConn_Redial(t *testing.T) {
+	// Every dial gets a new pipe served by a fake freeswitch
+	dialed := make(chan string, 2)
+	dial := func(ctx context.Context, network, address string) (net.Conn, error) {
+		client, server := net.Pipe()
+		t.Cleanup(func() { server.Close() })
+		fs := goesltest.NewServer(t, server)
+		go func() {
+			fs.Write("Content-Type: auth/request\n\n")
+			fs.ExpectCommand("auth ClueCon")
+			fs.Reply("+OK accepted")
+		}()
+		dialed <- network + " " + address
+		return client, nil
+	}
+	conn, err := dial(context.Background(), "", "")
+	assert.Nil(t, err)
+	<-dialed
+	c, err := goesl.NewClientWithConn(conn, "ClueCon", 1, goesl.Options{DialContext: dial})
+	if !assert.Nil(t, err) {
+		return
+	}
+	defer c.Close()
+	assert.Equal(t, "pipe", c.Protocol)
+	connection, err := c.EstablishConnection()
+	if assert.Nil(t, err) {
+		connection.Close()
+		assert.Equal(t, "pipe pipe", <-dialed)
+	}
+
+	// A net.Pipe can not be dialed again without DialContext
+	conn, _ = dial(context.Background(), "", "")
+	<-dialed
+	c, err = goesl.NewClientWithConn(conn, "ClueCon", 1, goesl.Options{})
+	if !assert.Nil(t, err) {
+		return
+	}
+	defer c.Close()
+	_, err = c.EstablishConnection()
+	assert.NotNil(t, err)
+}
+
+func TestSession_RecordReplay(t *testing.T) {
+	var record bytes.Buffer
+	client, server := net.Pipe()
+	recorder := goesl.RecordSession(client, &record)
+	fs := goesltest.NewServer(t, server)
+	con := goesl.NewConnectionFromConn(recorder, goesl.Options{Role: goesl.RoleInbound})
+	done := make(chan error, 1)
+	go func() {
+		done <- con.Authenticate(context.Background(), "ClueCon")
+	}()
+	fs.Write("Content-Type: auth/request\n\n")
+	fs.ExpectCommand("auth ClueCon")
+	fs.Reply("+OK accepted")
+	assert.Nil(t, <-done)
+	go func() {
+		fs.ExpectCommand("api status")
+		fs.APIResponse("UP 0 years, 0 days")
+	}()
+	response, err := con.Api("status")
+	assert.Nil(t, err)
+	assert.Equal(t, "UP 0 years, 0 days", string(response.Body))
+	con.Close()
+	server.Close()
+	assert.Nil(t, recorder.Err())
+	assert.NotContains(t, record.String(), "ClueCon", "password recorded")
+
+	entries, err := goesl.ReadSession(&record)
+	if !assert.Nil(t, err) {
+		return
+	}
+	assert.Equal(t, goesl.SessionReceived, entries[0].Direction)
+
+	replay := func(cmd string) (*goesl.ESLResponse, error, error) {
+		client, server := net.Pipe()
+		replayed := make(chan error, 1)
+		go func() {
+			replayed <- goesl.ReplaySession(server, entries, goesl.SessionReplayOptions{Strict: true})
+		}()
+		con := goesl.NewConnectionFromConn(client, goesl.Options{Role: goesl.RoleInbound})
+		defer con.Close()
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+		if err := con.Authenticate(ctx, "ClueCon"); err != nil {
+			return nil, err, <-replayed
+		}
+		response, err := con.ApiWithContext(ctx, cmd)
+		return response, err, <-replayed
+	}
+	response, err, replayErr := replay("status")
+	assert.Nil(t, err)
+	assert.Nil(t, replayErr)
+	if assert.NotNil(t, response) {
+		assert.Equal(t, "UP 0 years, 0 days", string(response.Body))
+	}
+
+	_, err, replayErr = replay("uptime")
+	assert.NotNil(t, err)
+	var mismatch *goesl.SessionMismatchError
+	if assert.True(t, errors.As(replayErr, &mismatch)) {
+		assert.Equal(t, "api uptime\r\n\r\n", mismatch.Got)
+	}
+}
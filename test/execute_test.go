@@ -0,0 +1,285 @@
+/*
+ * Copyright (c) 2021 LuanDNH
+ *
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at https://mozilla.org/MPL/2.0/.
+ *
+ * Contributor(s):
+ * LuanDNH <luandnh98@gmail.com>
+ */
+
+package test
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/luandnh/goesl"
+	"github.com/luandnh/goesl/goesltest"
+	"github.com/stretchr/testify/assert"
+)
+
+// eventUUID - Event-UUID header of a sendmsg frame
+func eventUUID(frame string) string {
+	for _, line := range strings.Split(frame, "\n") {
+		if strings.HasPrefix(line, "Event-UUID: ") {
+			return strings.TrimPrefix(line, "Event-UUID: ")
+		}
+	}
+	return ""
+}
+
+func TestConnection_PlayAndGetDigits(t *testing.T) {
+	con, fs := newPipeConnection(t)
+	go func() {
+		fs.ExpectCommand("event json CHANNEL_EXECUTE_COMPLETE")
+		fs.Reply("+OK event listener enabled json")
+		frame, body := readFrame(fs)
+		assert.True(t, strings.HasPrefix(frame, "sendmsg abc\ncall-command: execute\nexecute-app-name: play_and_get_digits\n"))
+		assert.Equal(t, `1 4 3 5000 # ivr/enter.wav silence_stream://250 goesl_digits '\\d+'`, body)
+		fs.Reply("+OK")
+		jsonEvent(fs, fmt.Sprintf(`{"Event-Name":"CHANNEL_EXECUTE_COMPLETE","Unique-ID":"abc","Application-UUID":%q,"variable_goesl_digits":"1234","variable_read_terminator_used":"#"}`, eventUUID(frame)))
+		fs.ExpectCommand("nixevent CHANNEL_EXECUTE_COMPLETE")
+		fs.Reply("+OK events nixed")
+	}()
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	result, err := con.PlayAndGetDigits(ctx, "abc", goesl.PlayAndGetDigitsParams{
+		Max:         4,
+		Tries:       3,
+		Terminators: "#",
+		File:        "ivr/enter.wav",
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, "1234", result.Digits)
+	assert.Equal(t, "#", result.Terminator)
+}
+
+const nlsmlResult = `<?xml version="1.0"?><result><interpretation grammar="session:yesno" confidence="87"><instance>yes</instance><input mode="speech">yes please</input></interpretation></result>`
+
+func TestConnection_PlayAndDetectSpeech(t *testing.T) {
+	con, fs := newPipeConnection(t)
+	go func() {
+		fs.ExpectCommand("event json CHANNEL_EXECUTE_COMPLETE")
+		fs.Reply("+OK event listener enabled json")
+		frame, body := readFrame(fs)
+		assert.Contains(t, frame, "execute-app-name: play_and_detect_speech\n")
+		assert.Equal(t, "ask.wav detect:unimrcp {no-input-timeout=5000,start-input-timers=false}builtin:grammar/boolean", body)
+		fs.Reply("+OK")
+		event, _ := json.Marshal(map[string]string{
+			"Event-Name":                    "CHANNEL_EXECUTE_COMPLETE",
+			"Unique-ID":                     "abc",
+			"Application-UUID":              eventUUID(frame),
+			"variable_detect_speech_result": nlsmlResult,
+		})
+		jsonEvent(fs, string(event))
+		fs.ExpectCommand("nixevent CHANNEL_EXECUTE_COMPLETE")
+		fs.Reply("+OK events nixed")
+	}()
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	result, err := con.PlayAndDetectSpeech(ctx, "abc", "ask.wav", goesl.SpeechParams{
+		Engine:  "unimrcp",
+		Grammar: "builtin:grammar/boolean",
+		Params:  map[string]string{"start-input-timers": "false", "no-input-timeout": "5000"},
+	})
+	if assert.Nil(t, err) {
+		assert.Equal(t, "yes", result.Text)
+		assert.Equal(t, 0.87, result.Confidence)
+		assert.Equal(t, nlsmlResult, result.Raw)
+	}
+}
+
+func TestConnection_DetectSpeech(t *testing.T) {
+	con, fs := newPipeConnection(t)
+	go func() {
+		fs.ExpectCommand("event json DETECTED_SPEECH")
+		fs.Reply("+OK event listener enabled json")
+		frame, body := readFrame(fs)
+		assert.Contains(t, frame, "execute-app-name: detect_speech\n")
+		assert.Equal(t, "pocketsphinx goesl yesno", body)
+		fs.Reply("+OK")
+		jsonEvent(fs, `{"Event-Name":"DETECTED_SPEECH","Unique-ID":"abc","Speech-Type":"begin-speaking"}`)
+		event, _ := json.Marshal(map[string]string{
+			"Event-Name":  "DETECTED_SPEECH",
+			"Unique-ID":   "abc",
+			"Speech-Type": "detected-speech",
+			"_body":       `<interpretation grammar="yesno" score="0.5"><result name="match">no</result><input mode="speech">no</input></interpretation>`,
+		})
+		jsonEvent(fs, string(event))
+		fs.ExpectCommand("nixevent DETECTED_SPEECH")
+		fs.Reply("+OK events nixed")
+	}()
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	result, err := con.DetectSpeech(ctx, "abc", goesl.SpeechParams{Engine: "pocketsphinx", Grammar: "yesno"})
+	if assert.Nil(t, err) {
+		assert.Equal(t, "no", result.Text)
+		assert.Equal(t, 0.5, result.Confidence)
+	}
+}
+
+func TestParseSpeechResult(t *testing.T) {
+	result, err := goesl.ParseSpeechResult("")
+	assert.Nil(t, err)
+	assert.Equal(t, "", result.Text)
+	result, err = goesl.ParseSpeechResult("hello")
+	assert.Nil(t, err)
+	assert.Equal(t, "hello", result.Text)
+	_, err = goesl.ParseSpeechResult("<result><interpretation>")
+	assert.NotNil(t, err)
+	result, err = goesl.ParseSpeechResult("<?xml version=\"1.0\" encoding=\"ISO-8859-1\"?>\n" +
+		"<result><interpretation confidence=\"80\"><input mode=\"speech\">José, café</input></interpretation></result>")
+	if assert.Nil(t, err) {
+		assert.Equal(t, "José, café", result.Text)
+	}
+}
+
+func TestConnection_AnswerAndHangup(t *testing.T) {
+	con, fs := newPipeConnection(t)
+	go func() {
+		fs.ExpectCommand("api uuid_answer abc")
+		fs.APIResponse("+OK\n")
+		fs.ExpectCommand("api uuid_pre_answer gone")
+		fs.APIResponse("-ERR No such channel!\n")
+		// ring_ready has no api, it is executed
+		fs.ExpectCommand("event json CHANNEL_EXECUTE_COMPLETE")
+		fs.Reply("+OK event listener enabled json")
+		frame, _ := readFrame(fs)
+		assert.Contains(t, frame, "sendmsg abc\ncall-command: execute\nexecute-app-name: ring_ready\n")
+		fs.Reply("+OK")
+		jsonEvent(fs, `{"Event-Name":"CHANNEL_EXECUTE_COMPLETE","Unique-ID":"abc","Application-UUID":"`+eventUUID(frame)+`"}`)
+		fs.ExpectCommand("nixevent CHANNEL_EXECUTE_COMPLETE")
+		fs.Reply("+OK events nixed")
+
+		fs.ExpectCommand("event json CHANNEL_HANGUP")
+		fs.Reply("+OK event listener enabled json")
+		fs.ExpectCommand("api uuid_kill abc USER_BUSY")
+		fs.APIResponse("+OK\n")
+		jsonEvent(fs, `{"Event-Name":"CHANNEL_HANGUP","Unique-ID":"abc","Hangup-Cause":"USER_BUSY"}`)
+		fs.ExpectCommand("nixevent CHANNEL_HANGUP")
+		fs.Reply("+OK events nixed")
+	}()
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	assert.Nil(t, con.Answer(ctx, "abc"))
+	assert.NotNil(t, con.PreAnswer(ctx, "gone"))
+	assert.Nil(t, con.RingReady(ctx, "abc"))
+	assert.Nil(t, con.Hangup(ctx, "abc", goesl.HangupCauseUserBusy))
+}
+
+func TestConnection_AnswerAndHangupOutbound(t *testing.T) {
+	con, fs := goesltest.NewOutbound(t, goesl.Options{})
+	go func() {
+		frame, _ := readFrame(fs)
+		assert.Contains(t, frame, "sendmsg\ncall-command: execute\nexecute-app-name: answer\n")
+		fs.Reply("+OK")
+		jsonEvent(fs, `{"Event-Name":"CHANNEL_EXECUTE_COMPLETE","Unique-ID":"abc","Application-UUID":"`+eventUUID(frame)+`"}`)
+		assert.Equal(t, "sendmsg\ncall-command: hangup\nhangup-cause: NORMAL_CLEARING", readCommand(fs))
+		fs.Reply("+OK")
+		// The socket is closed right after the hangup without linger
+		fs.Disconnect("Goodbye!\n")
+	}()
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	assert.Nil(t, con.Answer(ctx, ""))
+	assert.Nil(t, con.Hangup(ctx, "", goesl.HangupCauseNormalClearing))
+}
+
+func TestConnection_ParkAndWait(t *testing.T) {
+	con, fs := newPipeConnection(t)
+	go func() {
+		fs.ExpectCommand("event json CHANNEL_HANGUP CUSTOM queue::decision")
+		fs.Reply("+OK event listener enabled json")
+		fs.ExpectCommand("api uuid_park abc")
+		fs.APIResponse("+OK\n")
+		// Events of other channels and unmatched events are skipped
+		jsonEvent(fs, `{"Event-Name":"CUSTOM","Event-Subclass":"queue::decision","Unique-ID":"other"}`)
+		jsonEvent(fs, `{"Event-Name":"CUSTOM","Event-Subclass":"queue::decision","Unique-ID":"abc","action":"wait"}`)
+		jsonEvent(fs, `{"Event-Name":"CUSTOM","Event-Subclass":"queue::decision","Unique-ID":"abc","action":"route"}`)
+		fs.ExpectCommand("nixevent CHANNEL_HANGUP CUSTOM queue::decision")
+		fs.Reply("+OK events nixed")
+
+		fs.ExpectCommand("event json CHANNEL_HANGUP DTMF")
+		fs.Reply("+OK event listener enabled json")
+		fs.ExpectCommand("api uuid_park abc")
+		fs.APIResponse("+OK\n")
+		jsonEvent(fs, `{"Event-Name":"CHANNEL_HANGUP","Unique-ID":"abc"}`)
+		fs.ExpectCommand("nixevent CHANNEL_HANGUP DTMF")
+		fs.Reply("+OK events nixed")
+	}()
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	event, err := con.ParkAndWait(ctx, "abc", goesl.HeaderEq("action", "route"), goesl.EventCustom, "queue::decision")
+	if assert.Nil(t, err) {
+		assert.Equal(t, "route", event.GetHeader("action"))
+	}
+	_, err = con.ParkAndWait(ctx, "abc", goesl.EventName(goesl.EventDTMF), goesl.EventDTMF)
+	assert.ErrorIs(t, err, goesl.ErrChannelNotFound)
+}
+
+func TestConnection_SayAndSpeak(t *testing.T) {
+	con, fs := newPipeConnection(t)
+	go func() {
+		fs.ExpectCommand("event json CHANNEL_EXECUTE_COMPLETE")
+		fs.Reply("+OK event listener enabled json")
+		frame, body := readFrame(fs)
+		assert.True(t, strings.HasPrefix(frame, "sendmsg abc\ncall-command: execute\nexecute-app-name: say\n"))
+		assert.Contains(t, frame, "\nevent-lock: true\n")
+		assert.Equal(t, "en number pronounced 1234", body)
+		fs.Reply("+OK")
+		jsonEvent(fs, fmt.Sprintf(`{"Event-Name":"CHANNEL_EXECUTE_COMPLETE","Unique-ID":"abc","Application-UUID":%q,"Application-Response":"FILE PLAYED"}`, eventUUID(frame)))
+		fs.ExpectCommand("nixevent CHANNEL_EXECUTE_COMPLETE")
+		fs.Reply("+OK events nixed")
+
+		// Terminators are set before speak is queued
+		frame, body = readFrame(fs)
+		assert.True(t, strings.HasPrefix(frame, "sendmsg abc\ncall-command: execute\nexecute-app-name: set\n"))
+		assert.Equal(t, "playback_terminators=#", body)
+		fs.Reply("+OK")
+		fs.ExpectCommand("event json CHANNEL_EXECUTE_COMPLETE")
+		fs.Reply("+OK event listener enabled json")
+		frame, body = readFrame(fs)
+		assert.True(t, strings.HasPrefix(frame, "sendmsg abc\ncall-command: execute\nexecute-app-name: speak\n"))
+		assert.Equal(t, "flite|kal|Hello, world", body)
+		fs.Reply("+OK")
+		jsonEvent(fs, fmt.Sprintf(`{"Event-Name":"CHANNEL_EXECUTE_COMPLETE","Unique-ID":"abc","Application-UUID":%q,"Application-Response":"FILE PLAYED","variable_playback_terminator_used":"#"}`, eventUUID(frame)))
+		fs.ExpectCommand("nixevent CHANNEL_EXECUTE_COMPLETE")
+		fs.Reply("+OK events nixed")
+
+		fs.ExpectCommand("event json CHANNEL_EXECUTE_COMPLETE")
+		fs.Reply("+OK event listener enabled json")
+		frame, _ = readFrame(fs)
+		assert.True(t, strings.HasPrefix(frame, "sendmsg gone\n"))
+		fs.Reply("-ERR invalid session id [gone]")
+		fs.ExpectCommand("nixevent CHANNEL_EXECUTE_COMPLETE")
+		fs.Reply("+OK events nixed")
+	}()
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	result, err := con.Say(ctx, "abc", "en", "number", "pronounced", "1234", nil)
+	if assert.Nil(t, err) {
+		assert.Equal(t, "FILE PLAYED", result.Response)
+		assert.Equal(t, "", result.Terminator)
+	}
+	result, err = con.Speak(ctx, "abc", "flite", "kal", "Hello, world", &goesl.PlaybackOptions{Terminators: "#"})
+	if assert.Nil(t, err) {
+		assert.Equal(t, "FILE PLAYED", result.Response)
+		assert.Equal(t, "#", result.Terminator)
+	}
+	_, err = con.Speak(ctx, "gone", "flite", "kal", "Hello", nil)
+	assert.EqualError(t, err, "unsuccessful reply : invalid session id [gone]")
+
+	// Nothing is sent for invalid arguments
+	_, err = con.Say(ctx, "abc", "en", "", "pronounced", "1234", nil)
+	assert.EqualError(t, err, "say needs a language, type and method")
+	_, err = con.Speak(ctx, "abc", "flite", "", "Hello", nil)
+	assert.EqualError(t, err, "speak needs an engine and a voice")
+	_, err = con.Speak(ctx, "abc", "unimrcp|x", "kal", "Hello", nil)
+	assert.EqualError(t, err, "speak engine and voice can not contain |")
+}
@@ -0,0 +1,71 @@
+/*
+ * Copyright (c) 2021 LuanDNH
+ *
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at https://mozilla.org/MPL/2.0/.
+ *
+ * Contributor(s):
+ * LuanDNH <luandnh98@gmail.com>
+ */
+
+package test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/luandnh/goesl"
+	"github.com/luandnh/goesl/goesltest"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGoesltest_Inbound(t *testing.T) {
+	con, server := goesltest.NewInbound(t, goesl.Options{})
+	go func() {
+		server.ExpectCommand("api status")
+		server.APIResponse("UP 0 years\n")
+		server.ExpectCommand("event json CHANNEL_ANSWER")
+		server.Reply("+OK event listener enabled json")
+		server.Event(map[string]string{"Event-Name": "CHANNEL_ANSWER", "Unique-ID": "abc"})
+		// Never answered, the command times out
+		server.ExpectCommand("api uuid_kill abc")
+		server.Disconnect("Disconnected, goodbye.\n")
+	}()
+	response, err := con.Api("status")
+	if assert.Nil(t, err) {
+		assert.Equal(t, "UP 0 years\n", string(response.Body))
+	}
+	assert.Nil(t, con.Subscribe(goesl.EventFormatJSON, goesl.EventChannelAnswer))
+	event, err := con.ReadMessage()
+	if assert.Nil(t, err) {
+		assert.Equal(t, "abc", event.GetHeader("Unique-ID"))
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	_, err = con.ApiWithContext(ctx, "uuid_kill abc")
+	assert.NotNil(t, err)
+	select {
+	case <-con.Done():
+	case <-time.After(time.Second):
+		t.Error("connection not closed")
+	}
+}
+
+func TestGoesltest_Outbound(t *testing.T) {
+	con, server := goesltest.NewOutbound(t, goesl.Options{})
+	go func() {
+		server.ExpectCommand("connect")
+		server.ConnectReply(map[string]string{"Unique-ID": "abc", "Caller-Destination-Number": "1000"})
+		command := server.ExpectCommand("sendmsg")
+		assert.Equal(t, "execute", command.Header("call-command"))
+		assert.Equal(t, "ivr/welcome.wav", command.Body)
+		server.Reply("+OK")
+	}()
+	_, err := con.Connect(context.Background())
+	assert.Nil(t, err)
+	assert.Equal(t, "1000", con.ChannelData().Caller.DestinationNumber)
+	_, err = con.Execute("", "playback", "ivr/welcome.wav", nil)
+	assert.Nil(t, err)
+}
@@ -0,0 +1,227 @@
+/*
+ * Copyright (c) 2021 LuanDNH
+ *
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at https://mozilla.org/MPL/2.0/.
+ *
+ * Contributor(s):
+ * LuanDNH <luandnh98@gmail.com>
+ */
+
+package test
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/luandnh/goesl"
+	"github.com/luandnh/goesl/goesltest"
+	"github.com/stretchr/testify/assert"
+)
+
+// dialOutbound - Play the socket application connecting to the server at address, the channel data
+// is the reply of connect
+func dialOutbound(t *testing.T, address, channelData string) *goesltest.Server {
+	conn, err := net.Dial("tcp", address)
+	if !assert.Nil(t, err) {
+		t.FailNow()
+	}
+	t.Cleanup(func() { conn.Close() })
+	fs := goesltest.NewServer(t, conn)
+	fs.ExpectCommand("connect")
+	fs.Write("Content-Type: command/reply\nSocket-Mode: async\nControl: full\n" + channelData + "\n")
+	return fs
+}
+
+func TestOutboundMux(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if !assert.Nil(t, err) {
+		return
+	}
+	routed := make(chan string, 4)
+	route := func(name string) goesl.OutboundHandler {
+		return goesl.OutboundHandlerFunc(func(c *goesl.ESLConnection, data *goesl.ESLResponse) {
+			routed <- name + " " + data.GetHeader("Unique-ID")
+		})
+	}
+	mux := goesl.NewOutboundMux()
+	mux.HandleDestination("1000", route("voicemail"))
+	mux.HandleVariable("app", "queue sales", route("queue"))
+	mux.HandleContext("public", route("public"))
+	server := goesl.NewOutboundServer(mux, goesl.Options{})
+	go server.Serve(listener)
+	defer server.Close()
+
+	// Routes are tried in order, the destination matches before the context
+	dialOutbound(t, listener.Addr().String(), "Unique-ID: a\nCaller-Destination-Number: 1000\nCaller-Context: public\n")
+	assert.Equal(t, "voicemail a", <-routed)
+	dialOutbound(t, listener.Addr().String(), "Unique-ID: b\nCaller-Destination-Number: 2000\nvariable_app: queue%20sales\n")
+	assert.Equal(t, "queue b", <-routed)
+	dialOutbound(t, listener.Addr().String(), "Unique-ID: c\nCaller-Context: public\n")
+	assert.Equal(t, "public c", <-routed)
+
+	// Without a route the connection is closed
+	fs := dialOutbound(t, listener.Addr().String(), "Unique-ID: d\nCaller-Context: default\n")
+	assert.Nil(t, fs.ReadCommand())
+	mux.NotFound(route("not found"))
+	dialOutbound(t, listener.Addr().String(), "Unique-ID: e\nCaller-Context: default\n")
+	assert.Equal(t, "not found e", <-routed)
+}
+
+func TestOutboundServer_Close(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if !assert.Nil(t, err) {
+		return
+	}
+	served := make(chan struct{})
+	server := goesl.NewOutboundServer(goesl.OutboundHandlerFunc(func(c *goesl.ESLConnection, data *goesl.ESLResponse) {
+		close(served)
+		<-c.Done()
+	}), goesl.Options{})
+	stopped := make(chan error, 1)
+	go func() { stopped <- server.Serve(listener) }()
+
+	dialOutbound(t, listener.Addr().String(), "Unique-ID: a\n")
+	<-served
+	assert.Equal(t, 1, server.Connections())
+	// Close ends the handler waiting on its connection
+	assert.Nil(t, server.Close())
+	assert.Equal(t, 0, server.Connections())
+	select {
+	case err := <-stopped:
+		assert.Nil(t, err)
+	case <-time.After(time.Second):
+		t.Error("Serve did not return")
+	}
+}
+
+func TestOutbound_ChannelData(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if !assert.Nil(t, err) {
+		return
+	}
+	data := make(chan *goesl.ChannelData, 1)
+	server := goesl.NewOutboundServer(goesl.OutboundHandlerFunc(func(c *goesl.ESLConnection, _ *goesl.ESLResponse) {
+		data <- c.ChannelData()
+	}), goesl.Options{})
+	go server.Serve(listener)
+	defer server.Close()
+
+	dialOutbound(t, listener.Addr().String(), "Unique-ID: abc\nChannel-Name: sofia/internal/1000%40example.com\n"+
+		"Call-Direction: inbound\nCaller-Caller-ID-Number: 1000\nCaller-Destination-Number: 5000\nCaller-Context: default\n"+
+		"Caller-Channel-Created-Time: 1600000000000000\nvariable_sip_from_user: 1000\nvariable_tenant: acme%20corp\n")
+	channel := <-data
+	if assert.NotNil(t, channel) {
+		assert.Equal(t, "abc", channel.UUID)
+		assert.Equal(t, "sofia/internal/1000@example.com", channel.Name)
+		assert.Equal(t, "async", channel.SocketMode)
+		assert.Equal(t, "full", channel.Control)
+		assert.Equal(t, "1000", channel.Caller.CallerIDNumber)
+		assert.Equal(t, "5000", channel.Caller.DestinationNumber)
+		assert.Equal(t, "default", channel.Caller.Context)
+		assert.Equal(t, int64(1600000000), channel.Created.Unix())
+		assert.Equal(t, "acme corp", channel.Variables["tenant"])
+	}
+
+	inbound, _ := newPipeConnection(t)
+	assert.Nil(t, inbound.ChannelData())
+}
+
+func TestOutboundServer_MyEvents(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if !assert.Nil(t, err) {
+		return
+	}
+	received := make(chan string, 1)
+	server := goesl.NewOutboundServer(goesl.OutboundHandlerFunc(func(c *goesl.ESLConnection, _ *goesl.ESLResponse) {
+		event, err := c.ReadMessage()
+		if assert.Nil(t, err) {
+			received <- event.GetHeader("Event-Name")
+		}
+	}), goesl.Options{})
+	server.MyEvents = goesl.EventFormatJSON
+	go server.Serve(listener)
+	defer server.Close()
+
+	fs := dialOutbound(t, listener.Addr().String(), "Unique-ID: abc\n")
+	fs.ExpectCommand("myevents json")
+	fs.Reply("+OK Events Enabled")
+	jsonEvent(fs, `{"Event-Name":"CHANNEL_ANSWER","Unique-ID":"abc"}`)
+	assert.Equal(t, goesl.EventChannelAnswer, <-received)
+}
+
+func TestConnection_MyEvents(t *testing.T) {
+	con, fs := newPipeConnection(t)
+	go func() {
+		fs.ExpectCommand("myevents plain abc")
+		fs.Reply("+OK Events Enabled")
+		// Helpers subscribing afterwards keep the format
+		fs.ExpectCommand("event plain CHANNEL_EXECUTE_COMPLETE")
+		fs.Reply("+OK event listener enabled plain")
+		frame, _ := readFrame(fs)
+		fs.Reply("+OK")
+		event := "Event-Name: CHANNEL_EXECUTE_COMPLETE\nUnique-ID: abc\nApplication-UUID: " + eventUUID(frame) + "\n\n"
+		fs.Write(fmt.Sprintf("Content-Type: text/event-plain\nContent-Length: %d\n\n%s", len(event), event))
+		fs.ExpectCommand("nixevent CHANNEL_EXECUTE_COMPLETE")
+		fs.Reply("+OK events nixed")
+	}()
+	assert.Nil(t, con.MyEvents(goesl.EventFormatPlain, "abc"))
+	assert.NotNil(t, con.MyEvents("yaml", "abc"))
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	_, err := con.ExecuteAndWait(ctx, "abc", "answer", "", nil)
+	assert.Nil(t, err)
+}
+
+func TestOutboundServer_AsyncFull(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if !assert.Nil(t, err) {
+		return
+	}
+	results := make(chan string, 2)
+	server := goesl.NewOutboundServer(goesl.OutboundHandlerFunc(func(c *goesl.ESLConnection, _ *goesl.ESLResponse) {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+		var queued []*goesl.PendingExecution
+		for _, file := range []string{"first.wav", "second.wav"} {
+			pending, err := c.ExecuteAsync(ctx, "", "playback", file, &goesl.ExecuteOptions{Async: true})
+			if !assert.Nil(t, err) {
+				return
+			}
+			queued = append(queued, pending)
+		}
+		for _, pending := range queued {
+			event, err := pending.Wait(ctx)
+			if assert.Nil(t, err) {
+				results <- event.GetHeader("Application-Data")
+			}
+		}
+	}), goesl.Options{})
+	server.Linger = true
+	server.MyEvents = goesl.EventFormatJSON
+	go server.Serve(listener)
+	defer server.Close()
+
+	fs := dialOutbound(t, listener.Addr().String(), "Unique-ID: abc\n")
+	fs.ExpectCommand("linger")
+	fs.Reply("+OK will linger")
+	fs.ExpectCommand("myevents json")
+	fs.Reply("+OK Events Enabled")
+	var frames []string
+	for i := 0; i < 2; i++ {
+		frame, _ := readFrame(fs)
+		assert.Contains(t, frame, "sendmsg\ncall-command: execute\nexecute-app-name: playback\n")
+		assert.Contains(t, frame, "async: true\n")
+		frames = append(frames, frame)
+		fs.Reply("+OK")
+	}
+	// Completions arrive in any order, each is matched by its Event-UUID
+	jsonEvent(fs, `{"Event-Name":"CHANNEL_EXECUTE_COMPLETE","Unique-ID":"abc","Application-Data":"second.wav","Application-UUID":"`+eventUUID(frames[1])+`"}`)
+	jsonEvent(fs, `{"Event-Name":"CHANNEL_EXECUTE_COMPLETE","Unique-ID":"abc","Application-Data":"first.wav","Application-UUID":"`+eventUUID(frames[0])+`"}`)
+	assert.Equal(t, "first.wav", <-results)
+	assert.Equal(t, "second.wav", <-results)
+}
@@ -0,0 +1,133 @@
+/*
+ * Copyright (c) 2021 LuanDNH
+ *
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at https://mozilla.org/MPL/2.0/.
+ *
+ * Contributor(s):
+ * LuanDNH <luandnh98@gmail.com>
+ */
+
+package test
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/luandnh/goesl"
+)
+
+// repeatConn - net.Conn reading the same frame over and over
+type repeatConn struct {
+	net.Conn
+	frame  []byte
+	offset int
+}
+
+func (c *repeatConn) Read(p []byte) (int, error) {
+	n := copy(p, c.frame[c.offset:])
+	c.offset = (c.offset + n) % len(c.frame)
+	return n, nil
+}
+
+func (c *repeatConn) Close() error { return nil }
+
+// benchmarkHeaders - Headers of a typical CHANNEL_ANSWER event
+func benchmarkHeaders() [][2]string {
+	headers := [][2]string{
+		{"Event-Name", "CHANNEL_ANSWER"},
+		{"Core-UUID", "6b1b2d5e-0c3a-4bde-9f6a-6a1f2a3b4c5d"},
+		{"FreeSWITCH-Hostname", "fs01.example.com"},
+		{"Event-Date-Local", "2021-10-14 18:46:52"},
+		{"Event-Date-Timestamp", "1634237212123456"},
+		{"Unique-ID", "0d0f5c4e-9a1b-4b8e-8e43-2b7f1c3d9e11"},
+		{"Channel-State", "CS_EXECUTE"},
+		{"Channel-Call-State", "ACTIVE"},
+		{"Call-Direction", "inbound"},
+		{"Caller-Caller-ID-Name", "John Doe"},
+		{"Caller-Caller-ID-Number", "1000"},
+		{"Caller-Destination-Number", "2000"},
+	}
+	for i := 0; i < 40; i++ {
+		headers = append(headers, [2]string{fmt.Sprintf("variable_custom_%d", i), fmt.Sprintf("sip:%d@example.com;transport=udp", i)})
+	}
+	return headers
+}
+
+func benchmarkFrame(format string) []byte {
+	var body string
+	switch format {
+	case goesl.EventFormatJSON:
+		var fields []string
+		for _, h := range benchmarkHeaders() {
+			name, _ := json.Marshal(h[0])
+			value, _ := json.Marshal(h[1])
+			fields = append(fields, string(name)+":"+string(value))
+		}
+		body = "{" + strings.Join(fields, ",") + "}"
+	case goesl.EventFormatPlain:
+		var lines strings.Builder
+		for _, h := range benchmarkHeaders() {
+			lines.WriteString(h[0] + ": " + url.PathEscape(h[1]) + "\n")
+		}
+		lines.WriteString("\n")
+		body = lines.String()
+	}
+	return []byte(fmt.Sprintf("Content-Type: text/event-%s\nContent-Length: %d\n\n%s", format, len(body), body))
+}
+
+func BenchmarkParseResponse(b *testing.B) {
+	for _, format := range []string{goesl.EventFormatJSON, goesl.EventFormatPlain} {
+		b.Run(format, func(b *testing.B) {
+			frame := benchmarkFrame(format)
+			con := goesl.NewConnectionFromConn(&repeatConn{frame: frame}, goesl.Options{})
+			b.SetBytes(int64(len(frame)))
+			b.ReportAllocs()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				if _, err := con.ParseResponse(); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+// BenchmarkParseEvent - Standalone parser throughput, reported in events/s along with allocs/op
+func BenchmarkParseEvent(b *testing.B) {
+	for _, format := range []string{goesl.EventFormatJSON, goesl.EventFormatPlain} {
+		for _, pooled := range []bool{false, true} {
+			name := format
+			if pooled {
+				name += "/pooled"
+			}
+			b.Run(name, func(b *testing.B) {
+				frame := benchmarkFrame(format)
+				reader := bufio.NewReaderSize(&repeatConn{frame: frame}, goesl.ReadBufferSize)
+				opts := goesl.Options{PoolResponses: pooled}
+				b.SetBytes(int64(len(frame)))
+				b.ReportAllocs()
+				b.ResetTimer()
+				start := time.Now()
+				for i := 0; i < b.N; i++ {
+					event, err := goesl.ParseMessageWithOptions(reader, opts)
+					if err != nil {
+						b.Fatal(err)
+					}
+					if event.GetHeader("Event-Name") != "CHANNEL_ANSWER" {
+						b.Fatal("unexpected event")
+					}
+					event.Release()
+				}
+				b.ReportMetric(float64(b.N)/time.Since(start).Seconds(), "events/s")
+			})
+		}
+	}
+}
@@ -0,0 +1,215 @@
+/*
+ * Copyright (c) 2021 LuanDNH
+ *
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at https://mozilla.org/MPL/2.0/.
+ *
+ * Contributor(s):
+ * LuanDNH <luandnh98@gmail.com>
+ */
+
+package test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/luandnh/goesl"
+	"github.com/stretchr/testify/assert"
+)
+
+// proxyClient - Client authenticated on the proxy listening at address
+func proxyClient(t *testing.T, address, password string) (*goesl.ESLConnection, error) {
+	conn, err := net.Dial("tcp", address)
+	if err != nil {
+		return nil, err
+	}
+	con := goesl.NewConnectionFromConn(conn, goesl.Options{Role: goesl.RoleInbound})
+	t.Cleanup(func() { con.Close() })
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	return con, con.Authenticate(ctx, password)
+}
+
+func TestProxy(t *testing.T) {
+	upstream, fs := newPipeConnection(t)
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if !assert.Nil(t, err) {
+		return
+	}
+	proxy := goesl.NewProxy(upstream, "secret")
+	go proxy.Serve(listener)
+
+	_, err = proxyClient(t, listener.Addr().String(), "wrong")
+	var denied *goesl.AccessDeniedError
+	assert.NotNil(t, err)
+	assert.False(t, errors.As(err, &denied))
+
+	answers, err := proxyClient(t, listener.Addr().String(), "secret")
+	if !assert.Nil(t, err) {
+		return
+	}
+	heartbeats, err := proxyClient(t, listener.Addr().String(), "secret")
+	if !assert.Nil(t, err) {
+		return
+	}
+
+	// Both subscriptions share the upstream connection
+	upstreamCommands := make(chan string, 4)
+	go func() {
+		for i := 0; i < 2; i++ {
+			upstreamCommands <- readCommand(fs)
+			fs.Reply("+OK event listener enabled json")
+		}
+	}()
+	assert.Nil(t, answers.Subscribe(goesl.EventFormatJSON, goesl.EventChannelAnswer))
+	assert.Nil(t, heartbeats.Subscribe(goesl.EventFormatPlain, goesl.EventHeartbeat))
+	assert.Equal(t, "event json CHANNEL_ANSWER", <-upstreamCommands)
+	assert.Equal(t, "event json HEARTBEAT", <-upstreamCommands)
+
+	jsonEvent(fs, `{"Event-Name":"HEARTBEAT","Session-Count":"2"}`)
+	jsonEvent(fs, `{"Event-Name":"CHANNEL_ANSWER","Unique-ID":"abc"}`)
+	event, err := answers.ReadMessage()
+	if assert.Nil(t, err) {
+		assert.Equal(t, goesl.ContentType_EventJSON, event.ContentType)
+		assert.Equal(t, "abc", event.GetHeader("Unique-ID"))
+	}
+	event, err = heartbeats.ReadMessage()
+	if assert.Nil(t, err) {
+		assert.Equal(t, goesl.ContentType_EventPlain, event.ContentType)
+		assert.Equal(t, "2", event.GetHeader("Session-Count"))
+	}
+
+	go func() {
+		fs.ExpectCommand("api status")
+		fs.APIResponse("UP 0 years\n")
+	}()
+	response, err := answers.Api("status")
+	if assert.Nil(t, err) {
+		assert.Equal(t, "UP 0 years\n", string(response.Body))
+	}
+	assert.Equal(t, 2, proxy.Clients())
+
+	// Subscriptions of the clients are released upstream when the proxy closes
+	go func() {
+		for command := readCommand(fs); command != ""; command = readCommand(fs) {
+			upstreamCommands <- command
+			fs.Reply("+OK events removed")
+		}
+	}()
+	assert.Nil(t, proxy.Close())
+	removed := []string{<-upstreamCommands, <-upstreamCommands}
+	sort.Strings(removed)
+	assert.Equal(t, []string{"nixevent CHANNEL_ANSWER", "nixevent HEARTBEAT"}, removed)
+}
+
+func TestProxy_BackgroundJobs(t *testing.T) {
+	upstream, fs := newPipeConnection(t)
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if !assert.Nil(t, err) {
+		return
+	}
+	proxy := goesl.NewProxy(upstream, "secret")
+	go proxy.Serve(listener)
+	client, err := proxyClient(t, listener.Addr().String(), "secret")
+	if !assert.Nil(t, err) {
+		return
+	}
+	bgapi := func(job string) {
+		go func() {
+			frame, _ := readFrame(fs)
+			assert.Equal(t, "bgapi status\nJob-UUID: "+job, frame)
+			fs.Write("Content-Type: command/reply\nReply-Text: +OK Job-UUID: " + job + "\nJob-UUID: " + job + "\n\n")
+		}()
+		_, err := client.Send("bgapi status\nJob-UUID: " + job)
+		assert.Nil(t, err)
+	}
+	jobEvent := func(job string) {
+		jsonEvent(fs, `{"Event-Name":"BACKGROUND_JOB","Job-UUID":"`+job+`","Job-Command":"status","_body":"+OK"}`)
+	}
+
+	// Neither subscribed nor kept, its result is not forwarded once the client subscribes
+	bgapi("job-1")
+	go func() {
+		fs.ExpectCommand("event json BACKGROUND_JOB")
+		fs.Reply("+OK event listener enabled json")
+	}()
+	assert.Nil(t, client.Subscribe(goesl.EventFormatJSON, goesl.EventBackgroundJob))
+	jobEvent("job-1")
+
+	// Dropped by the filter, the job is forgotten all the same
+	assert.Nil(t, client.Filter("Job-Command", "reloadxml"))
+	bgapi("job-2")
+	jobEvent("job-2")
+	assert.Nil(t, client.FilterDelete("Job-Command", "reloadxml"))
+	jobEvent("job-2")
+
+	bgapi("job-3")
+	jobEvent("job-3")
+	event, err := client.ReadMessage()
+	if assert.Nil(t, err) {
+		assert.Equal(t, "job-3", event.GetHeader("Job-UUID"))
+	}
+
+	go func() {
+		fs.ExpectCommand("nixevent BACKGROUND_JOB")
+		fs.Reply("+OK events removed")
+	}()
+	assert.Nil(t, proxy.Close())
+}
+
+func TestProxy_EventOrder(t *testing.T) {
+	upstream, fs := newPipeConnection(t)
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if !assert.Nil(t, err) {
+		return
+	}
+	proxy := goesl.NewProxy(upstream, "secret")
+	go proxy.Serve(listener)
+	client, err := proxyClient(t, listener.Addr().String(), "secret")
+	if !assert.Nil(t, err) {
+		return
+	}
+	go func() {
+		fs.ExpectCommand("event json CHANNEL_CREATE CHANNEL_HANGUP")
+		fs.Reply("+OK event listener enabled json")
+	}()
+	assert.Nil(t, client.Subscribe(goesl.EventFormatJSON, goesl.EventChannelCreate, goesl.EventChannelHangup))
+
+	// Sent at once, the events of a call must reach the client in the upstream order
+	var frames strings.Builder
+	for i := 0; i < 50; i++ {
+		for _, name := range []string{goesl.EventChannelCreate, goesl.EventChannelHangup} {
+			body := fmt.Sprintf(`{"Event-Name":%q,"Unique-ID":"call-%d","Event-Sequence":"%d"}`, name, i, frames.Len())
+			fmt.Fprintf(&frames, "Content-Type: text/event-json\nContent-Length: %d\n\n%s", len(body), body)
+		}
+	}
+	go fs.Write(frames.String())
+	last := -1
+	for i := 0; i < 100; i++ {
+		event, err := client.ReadMessage()
+		if !assert.Nil(t, err) {
+			return
+		}
+		sequence, _ := strconv.Atoi(event.GetHeader("Event-Sequence"))
+		if !assert.Greater(t, sequence, last, fmt.Sprintf("event %d out of order", i)) {
+			return
+		}
+		last = sequence
+	}
+
+	go func() {
+		// In no particular order
+		assert.ElementsMatch(t, []string{"nixevent", "CHANNEL_CREATE", "CHANNEL_HANGUP"}, strings.Fields(readCommand(fs)))
+		fs.Reply("+OK events removed")
+	}()
+	assert.Nil(t, proxy.Close())
+}
@@ -0,0 +1,449 @@
+/*
+ * Copyright (c) 2021 LuanDNH
+ *
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at https://mozilla.org/MPL/2.0/.
+ *
+ * Contributor(s):
+ * LuanDNH <luandnh98@gmail.com>
+ */
+
+package test
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/luandnh/goesl"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestResponse_DuplicateHeaders(t *testing.T) {
+	con, fs := newPipeConnection(t)
+	go func() {
+		readCommand(fs)
+		fs.Write("Content-Type: api/response\nX-Route: a\nX-Other: 1\nX-Route: b\nContent-Length: 3\n\n+OK")
+	}()
+	response, err := con.Api("status")
+	assert.Nil(t, err)
+	assert.Equal(t, "a", response.GetHeader("X-Route"))
+	assert.Equal(t, []string{"a", "b"}, response.GetHeaderValues("X-Route"))
+
+	fields := response.Headers.Fields()
+	assert.Equal(t, "Content-Type", fields[0].Name)
+	assert.Equal(t, "X-Route", fields[1].Name)
+	assert.Equal(t, "X-Other", fields[2].Name)
+
+	encoded, err := json.Marshal(response.Headers)
+	assert.Nil(t, err)
+	assert.Equal(t, `{"Content-Type":"api/response","X-Route":["a","b"],"X-Other":"1","Content-Length":"3"}`, string(encoded))
+}
+
+func TestResponse_CaseInsensitiveHeaders(t *testing.T) {
+	con, fs := newPipeConnection(t)
+	body := "<event>\n  <headers>\n    <Event-Name>CUSTOM</Event-Name>\n    <Event-Subclass>sofia%3A%3Aregister</Event-Subclass>\n  </headers>\n</event>"
+	go fs.Write(fmt.Sprintf("Content-Type: text/event-xml\nContent-Length: %d\n\n%s", len(body), body))
+	event, err := con.ReadMessage()
+	assert.Nil(t, err)
+	assert.True(t, event.HasHeader("event-name"))
+	assert.Equal(t, "CUSTOM", event.GetHeader("EVENT-NAME"))
+	assert.Equal(t, "sofia::register", event.GetHeader("event-subclass"))
+}
+
+func TestResponse_TypedHeaders(t *testing.T) {
+	event := &goesl.Event{}
+	event.Headers.Add("Event-Date-Timestamp", "1602700000123456")
+	event.Headers.Add("Caller-Channel-Hangup-Time", "0")
+	event.Headers.Add("variable_billsec", "42")
+	event.Headers.Add("variable_is_outbound", "true")
+	event.Headers.Add("Core-UUID", "abc")
+
+	billsec, err := event.GetHeaderInt("variable_billsec")
+	assert.Nil(t, err)
+	assert.Equal(t, 42, billsec)
+	duration, err := event.GetHeaderDuration("variable_billsec", time.Second)
+	assert.Nil(t, err)
+	assert.Equal(t, 42*time.Second, duration)
+	outbound, err := event.GetHeaderBool("variable_is_outbound")
+	assert.Nil(t, err)
+	assert.True(t, outbound)
+
+	date, err := event.GetHeaderTime("Event-Date-Timestamp")
+	assert.Nil(t, err)
+	assert.Equal(t, time.Unix(1602700000, 123456000), date)
+	hangup, err := event.GetHeaderTime("Caller-Channel-Hangup-Time")
+	assert.Nil(t, err)
+	assert.True(t, hangup.IsZero())
+
+	_, err = event.GetHeaderInt("Core-UUID")
+	assert.NotNil(t, err)
+	_, err = event.GetHeaderInt("Missing")
+	assert.NotNil(t, err)
+}
+
+func TestResponse_Variables(t *testing.T) {
+	event := &goesl.Event{}
+	event.Headers.Add("Event-Name", "CHANNEL_ANSWER")
+	event.Headers.Add("variable_sip_from_user", "1000")
+	event.Headers.Add("variable_effective_caller_id_name", "John Doe")
+	event.Headers.Add("variable_", "ignored")
+
+	assert.Equal(t, map[string]string{
+		"sip_from_user":            "1000",
+		"effective_caller_id_name": "John Doe",
+	}, event.Variables())
+	assert.Equal(t, "1000", event.Variable("sip_from_user"))
+	assert.Equal(t, "", event.Variable("missing"))
+}
+
+func TestResponse_HangupCause(t *testing.T) {
+	event := &goesl.Event{}
+	event.Headers.Add("Hangup-Cause", "USER_BUSY")
+	assert.Equal(t, goesl.HangupCauseUserBusy, event.HangupCause())
+	assert.Equal(t, "USER_BUSY", event.HangupCause().String())
+	assert.Equal(t, 17, event.HangupCause().Q850())
+
+	event = &goesl.Event{}
+	event.Headers.Add("variable_hangup_cause_q850", "16")
+	assert.Equal(t, goesl.HangupCauseNormalClearing, event.HangupCause())
+
+	cause, err := goesl.ParseHangupCause("no_answer")
+	assert.Nil(t, err)
+	assert.Equal(t, goesl.HangupCauseNoAnswer, cause)
+	_, err = goesl.ParseHangupCause("NOT_A_CAUSE")
+	assert.NotNil(t, err)
+}
+
+func TestResponse_ChannelState(t *testing.T) {
+	event := &goesl.Event{}
+	event.Headers.Add("Channel-State", "CS_EXECUTE")
+	event.Headers.Add("Channel-Call-State", "ACTIVE")
+	event.Headers.Add("Call-Direction", "outbound")
+	assert.Equal(t, goesl.ChannelStateExecute, event.ChannelState())
+	assert.Equal(t, goesl.CallStateActive, event.CallState())
+	assert.Equal(t, goesl.DirectionOutbound, event.Direction())
+
+	event = &goesl.Event{}
+	event.Headers.Add("Channel-State-Number", "10")
+	assert.Equal(t, goesl.ChannelStateHangup, event.ChannelState())
+	assert.Equal(t, "CS_HANGUP", event.ChannelState().String())
+	assert.Equal(t, goesl.CallState(""), event.CallState())
+
+	state, err := goesl.ParseChannelState("park")
+	assert.Nil(t, err)
+	assert.Equal(t, goesl.ChannelStatePark, state)
+	_, err = goesl.ParseDirection("sideways")
+	assert.NotNil(t, err)
+}
+
+func TestResponse_JSONArrayHeaders(t *testing.T) {
+	con, fs := newPipeConnection(t)
+	go jsonEvent(fs, `{"Event-Name":"CUSTOM","X-Route":["a","b"],"Core-UUID":"abc"}`)
+	event, err := con.ReadMessage()
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"a", "b"}, event.GetHeaderValues("X-Route"))
+	assert.Equal(t, "abc", event.GetHeader("Core-UUID"))
+}
+
+func TestResponse_HeaderDecoding(t *testing.T) {
+	con, fs := newPipeConnection(t)
+	go func() {
+		fs.Write("Content-Type: command/reply\nReply-Text: +OK\nvariable_sip_from_uri: 1000%40example.com\n\n")
+		jsonEvent(fs, `{"Event-Name":"CUSTOM","variable_payload":"{\"a\":\"100%25\"}"}`)
+	}()
+	reply, err := con.ReadMessage()
+	assert.Nil(t, err)
+	assert.Equal(t, "1000@example.com", reply.GetHeader("variable_sip_from_uri"))
+	event, err := con.ReadMessage()
+	assert.Nil(t, err)
+	assert.Equal(t, `{"a":"100%25"}`, event.GetHeader("variable_payload"))
+
+	con, fs = newPipeConnectionWith(t, goesl.Options{HeaderDecoding: goesl.HeaderDecodingNever})
+	go fs.Write("Content-Type: command/reply\nReply-Text: +OK\nvariable_sip_from_uri: 1000%40example.com\n\n")
+	reply, err = con.ReadMessage()
+	assert.Nil(t, err)
+	assert.Equal(t, "1000%40example.com", reply.GetHeader("variable_sip_from_uri"))
+}
+
+func TestResponse_Marshal(t *testing.T) {
+	event := &goesl.Event{ContentType: "text/event-json", Body: []byte("hello")}
+	event.Headers.Add("Event-Name", "CUSTOM")
+	event.Headers.Add("Caller-Caller-ID-Name", "John Doe")
+
+	plain, err := event.Marshal(goesl.EventFormatPlain)
+	assert.Nil(t, err)
+	body := "Event-Name: CUSTOM\nCaller-Caller-ID-Name: John%20Doe\nContent-Length: 5\n\nhello"
+	assert.Equal(t, fmt.Sprintf("Content-Length: %d\nContent-Type: text/event-plain\n\n%s", len(body), body), string(plain))
+
+	encoded, err := event.Marshal(goesl.EventFormatJSON)
+	assert.Nil(t, err)
+	body = `{"Event-Name":"CUSTOM","Caller-Caller-ID-Name":"John Doe","Content-Length":"5","_body":"hello"}`
+	assert.Equal(t, fmt.Sprintf("Content-Length: %d\nContent-Type: text/event-json\n\n%s", len(body), body), string(encoded))
+
+	// A marshaled event is parsed back to the same headers
+	con, fs := newPipeConnection(t)
+	go fs.Write(string(encoded))
+	parsed, err := con.ReadMessage()
+	assert.Nil(t, err)
+	assert.Equal(t, "John Doe", parsed.GetHeader("Caller-Caller-ID-Name"))
+	assert.Equal(t, "hello", string(parsed.Body))
+
+	_, err = event.Marshal("yaml")
+	assert.NotNil(t, err)
+}
+
+func TestResponse_DumpAndJSON(t *testing.T) {
+	event := &goesl.Event{ContentType: "text/event-json", Body: []byte("hello")}
+	event.Headers.Add("Event-Name", "CHANNEL_ANSWER")
+	event.Headers.Add("Unique-ID", "abc")
+
+	assert.Equal(t, "Content-Type: text/event-json\nEvent-Name: CHANNEL_ANSWER\nUnique-ID: abc\n\nhello\n", event.Dump())
+	assert.Equal(t, "text/event-json CHANNEL_ANSWER abc", event.String())
+
+	encoded, err := json.Marshal(event)
+	assert.Nil(t, err)
+	assert.Equal(t, `{"content_type":"text/event-json","headers":{"Event-Name":"CHANNEL_ANSWER","Unique-ID":"abc"},"body":"hello"}`, string(encoded))
+
+	reply := &goesl.ESLResponse{ContentType: "command/reply"}
+	reply.Headers.Add("Reply-Text", "+OK accepted")
+	assert.Equal(t, `command/reply "+OK accepted"`, reply.String())
+}
+
+func TestResponse_ParseMode(t *testing.T) {
+	con, fs := newPipeConnectionWith(t, goesl.Options{ParseMode: goesl.ParseLenient})
+	go func() {
+		fs.Write("Content-Type: application/x-mydata\nContent-Length: 4\n\ndata")
+		fs.Write("X-Module: custom\nnot a header\n\n")
+		jsonEvent(fs, `{"Event-Name":`)
+	}()
+	raw, err := con.ReadMessage()
+	assert.Nil(t, err)
+	assert.Equal(t, "application/x-mydata", raw.ContentType)
+	assert.Equal(t, "data", string(raw.Body))
+
+	raw, err = con.ReadMessage()
+	assert.Nil(t, err)
+	assert.Equal(t, "", raw.ContentType)
+	assert.Equal(t, "custom", raw.GetHeader("X-Module"))
+
+	event, err := con.ReadMessage()
+	assert.Nil(t, err)
+	assert.Equal(t, `{"Event-Name":`, string(event.Body))
+
+	strict, fs := newPipeConnection(t)
+	go fs.Write("Content-Type: application/x-mydata\n\n")
+	_, err = strict.ReadMessage()
+	assert.NotNil(t, err)
+}
+
+func TestResponse_ContentDecoder(t *testing.T) {
+	goesl.RegisterContentDecoder("application/x-goesl-test", func(response *goesl.ESLResponse, logger goesl.Logger) error {
+		response.Headers.Add("X-Decoded", strings.ToUpper(string(response.Body)))
+		return nil
+	})
+
+	con, fs := newPipeConnection(t)
+	go fs.Write("Content-Type: application/x-goesl-test\nContent-Length: 4\n\ndata")
+	response, err := con.ReadMessage()
+	assert.Nil(t, err)
+	assert.Equal(t, "DATA", response.GetHeader("X-Decoded"))
+}
+
+func TestResponse_PlainEvent(t *testing.T) {
+	con, fs := newPipeConnection(t)
+	body := "Event-Name: CUSTOM\nEvent-Subclass: sofia%3A%3Aregister\nvariable_sip_from_uri: 1000%40example.com\nContent-Length: 5\n\nhello"
+	go fs.Write(fmt.Sprintf("Content-Type: text/event-plain\nContent-Length: %d\n\n%s", len(body), body))
+	event, err := con.ReadMessage()
+	assert.Nil(t, err)
+	assert.Equal(t, "CUSTOM", event.GetHeader("Event-Name"))
+	assert.Equal(t, "sofia::register", event.GetHeader("Event-Subclass"))
+	assert.Equal(t, "1000@example.com", event.Variable("sip_from_uri"))
+	assert.Equal(t, "hello", string(event.Body))
+}
+
+func TestResponse_JSONEscapes(t *testing.T) {
+	con, fs := newPipeConnection(t)
+	go func() {
+		jsonEvent(fs, `{"Event-Name":"CUSTOM", "X-Quote":"say \"hi\"\n", "X-Name":"José"}`)
+		jsonEvent(fs, `{"Event-Name":"CUSTOM","X-Count":3,"X-Name":"kept"}`)
+	}()
+	event, err := con.ReadMessage()
+	assert.Nil(t, err)
+	assert.Equal(t, "say \"hi\"\n", event.GetHeader("X-Quote"))
+	assert.Equal(t, "José", event.GetHeader("X-Name"))
+
+	event, err = con.ReadMessage()
+	assert.Nil(t, err)
+	assert.False(t, event.HasHeader("X-Count"))
+	assert.Equal(t, "kept", event.GetHeader("X-Name"))
+}
+
+func TestParseMessage(t *testing.T) {
+	parse := func(frame string, opts goesl.Options) (*goesl.ESLResponse, error) {
+		return goesl.ParseMessageWithOptions(bufio.NewReader(strings.NewReader(frame)), opts)
+	}
+
+	response, err := goesl.ParseMessage(bufio.NewReader(strings.NewReader("Content-Type: api/response\nContent-Length: 3\n\n+OK")))
+	assert.Nil(t, err)
+	assert.Equal(t, "+OK", string(response.Body))
+
+	for name, frame := range map[string]string{
+		"negative length": "Content-Type: api/response\nContent-Length: -1\n\n",
+		"invalid length":  "Content-Type: api/response\nContent-Length: 3x\n\n+OK",
+		"truncated body":  "Content-Type: api/response\nContent-Length: 2000000000\n\n+OK",
+		"truncated event": "Content-Type: text/event-json\nContent-Length: 10\n\n{}",
+		"no blank line":   "Content-Type: api/response",
+		"empty":           "",
+	} {
+		_, err := parse(frame, goesl.Options{})
+		assert.NotNil(t, err, name)
+	}
+
+	huge := "Content-Type: api/response\nX-Huge: " + strings.Repeat("x", 2048) + "\n\n"
+	_, err = parse(huge, goesl.Options{MaxHeaderSize: 1024})
+	assert.NotNil(t, err)
+	_, err = parse(huge, goesl.Options{})
+	assert.Nil(t, err)
+}
+
+func TestParseCDR(t *testing.T) {
+	event := &goesl.Event{}
+	for _, header := range [][2]string{
+		{"Event-Name", "CHANNEL_HANGUP_COMPLETE"},
+		{"Unique-ID", "abc"},
+		{"Call-Direction", "inbound"},
+		{"Caller-Caller-ID-Number", "1000"},
+		{"Caller-Destination-Number", "2000"},
+		{"Caller-Channel-Created-Time", "1600000000000000"},
+		{"Caller-Channel-Answered-Time", "1600000002000000"},
+		{"Caller-Channel-Hangup-Time", "1600000012000000"},
+		{"Hangup-Cause", "NORMAL_CLEARING"},
+		{"variable_billusec", "9500000"},
+		{"variable_sip_call_id", "call-1@host"},
+	} {
+		event.Headers.Add(header[0], header[1])
+	}
+	cdr := goesl.ParseCDR(event, []string{"sip_call_id", "accountcode"})
+	assert.Equal(t, "abc", cdr.UUID)
+	assert.Equal(t, goesl.DirectionInbound, cdr.Direction)
+	assert.Equal(t, "2000", cdr.Caller.DestinationNumber)
+	assert.Equal(t, goesl.HangupCauseNormalClearing, cdr.HangupCause)
+	// No uduration, computed from the times
+	assert.Equal(t, 12*time.Second, cdr.Duration)
+	assert.Equal(t, 9500*time.Millisecond, cdr.Billsec)
+	assert.Equal(t, map[string]string{"sip_call_id": "call-1@host"}, cdr.Variables)
+}
+
+func TestEventNames(t *testing.T) {
+	// EVENT_NAMES of switch_event.c, in the order of switch_event_types_t
+	names := []struct {
+		constant string
+		name     string
+	}{
+		{goesl.EventCustom, "CUSTOM"},
+		{goesl.EventClone, "CLONE"},
+		{goesl.EventChannelCreate, "CHANNEL_CREATE"},
+		{goesl.EventChannelDestroy, "CHANNEL_DESTROY"},
+		{goesl.EventChannelState, "CHANNEL_STATE"},
+		{goesl.EventChannelCallState, "CHANNEL_CALLSTATE"},
+		{goesl.EventChannelAnswer, "CHANNEL_ANSWER"},
+		{goesl.EventChannelHangup, "CHANNEL_HANGUP"},
+		{goesl.EventChannelHangupComplete, "CHANNEL_HANGUP_COMPLETE"},
+		{goesl.EventChannelExecute, "CHANNEL_EXECUTE"},
+		{goesl.EventChannelExecuteComplete, "CHANNEL_EXECUTE_COMPLETE"},
+		{goesl.EventChannelHold, "CHANNEL_HOLD"},
+		{goesl.EventChannelUnhold, "CHANNEL_UNHOLD"},
+		{goesl.EventChannelBridge, "CHANNEL_BRIDGE"},
+		{goesl.EventChannelUnbridge, "CHANNEL_UNBRIDGE"},
+		{goesl.EventChannelProgress, "CHANNEL_PROGRESS"},
+		{goesl.EventChannelProgressMedia, "CHANNEL_PROGRESS_MEDIA"},
+		{goesl.EventChannelOutgoing, "CHANNEL_OUTGOING"},
+		{goesl.EventChannelPark, "CHANNEL_PARK"},
+		{goesl.EventChannelUnpark, "CHANNEL_UNPARK"},
+		{goesl.EventChannelApplication, "CHANNEL_APPLICATION"},
+		{goesl.EventChannelOriginate, "CHANNEL_ORIGINATE"},
+		{goesl.EventChannelUUID, "CHANNEL_UUID"},
+		{goesl.EventApi, "API"},
+		{goesl.EventLog, "LOG"},
+		{goesl.EventInboundChan, "INBOUND_CHAN"},
+		{goesl.EventOutboundChan, "OUTBOUND_CHAN"},
+		{goesl.EventStartup, "STARTUP"},
+		{goesl.EventShutdown, "SHUTDOWN"},
+		{goesl.EventPublish, "PUBLISH"},
+		{goesl.EventUnpublish, "UNPUBLISH"},
+		{goesl.EventTalk, "TALK"},
+		{goesl.EventNoTalk, "NOTALK"},
+		{goesl.EventSessionCrash, "SESSION_CRASH"},
+		{goesl.EventModuleLoad, "MODULE_LOAD"},
+		{goesl.EventModuleUnload, "MODULE_UNLOAD"},
+		{goesl.EventDTMF, "DTMF"},
+		{goesl.EventMessage, "MESSAGE"},
+		{goesl.EventPresenceIn, "PRESENCE_IN"},
+		{goesl.EventNotifyIn, "NOTIFY_IN"},
+		{goesl.EventPresenceOut, "PRESENCE_OUT"},
+		{goesl.EventPresenceProbe, "PRESENCE_PROBE"},
+		{goesl.EventMessageWaiting, "MESSAGE_WAITING"},
+		{goesl.EventMessageQuery, "MESSAGE_QUERY"},
+		{goesl.EventRoster, "ROSTER"},
+		{goesl.EventCodec, "CODEC"},
+		{goesl.EventBackgroundJob, "BACKGROUND_JOB"},
+		{goesl.EventDetectedSpeech, "DETECTED_SPEECH"},
+		{goesl.EventDetectedTone, "DETECTED_TONE"},
+		{goesl.EventPrivateCommand, "PRIVATE_COMMAND"},
+		{goesl.EventHeartbeat, "HEARTBEAT"},
+		{goesl.EventTrap, "TRAP"},
+		{goesl.EventAddSchedule, "ADD_SCHEDULE"},
+		{goesl.EventDelSchedule, "DEL_SCHEDULE"},
+		{goesl.EventExeSchedule, "EXE_SCHEDULE"},
+		{goesl.EventReSchedule, "RE_SCHEDULE"},
+		{goesl.EventReloadXML, "RELOADXML"},
+		{goesl.EventNotify, "NOTIFY"},
+		{goesl.EventPhoneFeature, "PHONE_FEATURE"},
+		{goesl.EventPhoneFeatureSubscribe, "PHONE_FEATURE_SUBSCRIBE"},
+		{goesl.EventSendMessage, "SEND_MESSAGE"},
+		{goesl.EventRecvMessage, "RECV_MESSAGE"},
+		{goesl.EventRequestParams, "REQUEST_PARAMS"},
+		{goesl.EventChannelData, "CHANNEL_DATA"},
+		{goesl.EventGeneral, "GENERAL"},
+		{goesl.EventCommand, "COMMAND"},
+		{goesl.EventSessionHeartbeat, "SESSION_HEARTBEAT"},
+		{goesl.EventClientDisconnected, "CLIENT_DISCONNECTED"},
+		{goesl.EventServerDisconnected, "SERVER_DISCONNECTED"},
+		{goesl.EventSendInfo, "SEND_INFO"},
+		{goesl.EventRecvInfo, "RECV_INFO"},
+		{goesl.EventRecvRTCPMessage, "RECV_RTCP_MESSAGE"},
+		{goesl.EventSendRTCPMessage, "SEND_RTCP_MESSAGE"},
+		{goesl.EventCallSecure, "CALL_SECURE"},
+		{goesl.EventNAT, "NAT"},
+		{goesl.EventRecordStart, "RECORD_START"},
+		{goesl.EventRecordStop, "RECORD_STOP"},
+		{goesl.EventPlaybackStart, "PLAYBACK_START"},
+		{goesl.EventPlaybackStop, "PLAYBACK_STOP"},
+		{goesl.EventCallUpdate, "CALL_UPDATE"},
+		{goesl.EventFailure, "FAILURE"},
+		{goesl.EventSocketData, "SOCKET_DATA"},
+		{goesl.EventMediaBugStart, "MEDIA_BUG_START"},
+		{goesl.EventMediaBugStop, "MEDIA_BUG_STOP"},
+		{goesl.EventConferenceDataQuery, "CONFERENCE_DATA_QUERY"},
+		{goesl.EventConferenceData, "CONFERENCE_DATA"},
+		{goesl.EventCallSetupReq, "CALL_SETUP_REQ"},
+		{goesl.EventCallSetupResult, "CALL_SETUP_RESULT"},
+		{goesl.EventCallDetail, "CALL_DETAIL"},
+		{goesl.EventDeviceState, "DEVICE_STATE"},
+		{goesl.EventText, "TEXT"},
+		{goesl.EventShutdownRequested, "SHUTDOWN_REQUESTED"},
+		{goesl.EventAll, "ALL"},
+	}
+	for _, n := range names {
+		assert.Equal(t, n.name, n.constant)
+		assert.True(t, goesl.IsEventName(n.constant), n.name)
+	}
+	for _, name := range []string{"", "channel_create", "CHANNEL_CREATED", "CUSTOM sofia::register", "SOFIA::REGISTER"} {
+		assert.False(t, goesl.IsEventName(name), name)
+	}
+}
@@ -0,0 +1,104 @@
+/*
+ * Copyright (c) 2021 LuanDNH
+ *
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at https://mozilla.org/MPL/2.0/.
+ *
+ * Contributor(s):
+ * LuanDNH <luandnh98@gmail.com>
+ */
+
+package goesl
+
+import (
+	"bytes"
+	"net/textproto"
+)
+
+// redactedPassword - Replaces the passwords of auth and userauth in traced frames
+const redactedPassword = "********"
+
+// Tracer - Sees the protocol exchange of a connection as it goes through the socket, see Options.Tracer.
+// The methods are called from the writer and the read loop, they must not block nor keep raw, headers or body
+// which may be reused once they return
+type Tracer interface {
+	// OnSend - Frame about to be written, passwords are redacted
+	OnSend(raw []byte)
+	// OnReceive - Message read, before its headers are decoded. body is nil for a streamed api response,
+	// see ApiStream
+	OnReceive(headers *Headers, body []byte)
+}
+
+// TracerFuncs - Funcs used as Tracer, a nil func is skipped
+type TracerFuncs struct {
+	Send    func(raw []byte)
+	Receive func(headers *Headers, body []byte)
+}
+
+// OnSend - Call Send
+func (t TracerFuncs) OnSend(raw []byte) {
+	if t.Send != nil {
+		t.Send(raw)
+	}
+}
+
+// OnReceive - Call Receive
+func (t TracerFuncs) OnReceive(headers *Headers, body []byte) {
+	if t.Receive != nil {
+		t.Receive(headers, body)
+	}
+}
+
+// traceSend - Pass frame to the tracer, with its password redacted
+func (c *ESLConnection) traceSend(frame []byte) {
+	if c.tracer == nil {
+		return
+	}
+	c.runHandler("tracer", func() { c.tracer.OnSend(redactFrame(frame)) })
+}
+
+// traceReceive - Pass a message read to the tracer
+func (c *ESLConnection) traceReceive(headers *Headers, body []byte) {
+	c.runHandler("tracer", func() { c.tracer.OnReceive(headers, body) })
+}
+
+// traceMIMEHeader - Pass a header of the auth handshake, read before the read loop starts, to the tracer
+func (c *ESLConnection) traceMIMEHeader(header textproto.MIMEHeader) {
+	if c.tracer == nil {
+		return
+	}
+	var headers Headers
+	for name, values := range header {
+		for _, value := range values {
+			headers.Add(name, value)
+		}
+	}
+	c.traceReceive(&headers, nil)
+}
+
+// redactFrame - Frame with the password of auth or userauth user@domain:password masked, frame itself otherwise
+func redactFrame(frame []byte) []byte {
+	var start int
+	switch {
+	case bytes.HasPrefix(frame, []byte("auth ")):
+		start = len("auth ")
+	case bytes.HasPrefix(frame, []byte("userauth ")):
+		start = len("userauth ")
+		colon := bytes.IndexByte(frame[start:], ':')
+		if colon < 0 {
+			return frame
+		}
+		start += colon + 1
+	default:
+		return frame
+	}
+	end := bytes.IndexAny(frame[start:], "\r\n")
+	if end < 0 {
+		end = len(frame) - start
+	}
+	redacted := make([]byte, 0, len(frame))
+	redacted = append(redacted, frame[:start]...)
+	redacted = append(redacted, redactedPassword...)
+	return append(redacted, frame[start+end:]...)
+}
@@ -0,0 +1,39 @@
+/*
+ * Copyright (c) 2021 LuanDNH
+ *
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at https://mozilla.org/MPL/2.0/.
+ *
+ * Contributor(s):
+ * LuanDNH <luandnh98@gmail.com>
+ */
+
+package goesl
+
+import (
+	"context"
+	"errors"
+	"strings"
+)
+
+// Say - Run say on uuid, like Say(ctx, uuid, "en", "number", "pronounced", "1234", nil), and wait until it is done.
+// Set opts.Terminators to stop on DTMF
+func (c *ESLConnection) Say(ctx context.Context, uuid, lang, sayType, method, text string, opts *PlaybackOptions) (*PlaybackResult, error) {
+	if lang == "" || sayType == "" || method == "" {
+		return nil, errors.New("say needs a language, type and method")
+	}
+	return c.executeMedia(ctx, uuid, "say", strings.Join([]string{lang, sayType, method, text}, " "), opts)
+}
+
+// Speak - Run speak with a tts engine and voice on uuid, like Speak(ctx, uuid, "flite", "kal", "Hello", nil),
+// and wait until it is done. Set opts.Terminators to stop on DTMF
+func (c *ESLConnection) Speak(ctx context.Context, uuid, engine, voice, text string, opts *PlaybackOptions) (*PlaybackResult, error) {
+	if engine == "" || voice == "" {
+		return nil, errors.New("speak needs an engine and a voice")
+	}
+	if strings.Contains(engine+voice, "|") {
+		return nil, errors.New("speak engine and voice can not contain |")
+	}
+	return c.executeMedia(ctx, uuid, "speak", engine+"|"+voice+"|"+text, opts)
+}
@@ -0,0 +1,98 @@
+/*
+ * Copyright (c) 2021 LuanDNH
+ *
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at https://mozilla.org/MPL/2.0/.
+ *
+ * Contributor(s):
+ * LuanDNH <luandnh98@gmail.com>
+ */
+
+package goesl
+
+import "strings"
+
+// DirectoryUser - A row of list_users
+type DirectoryUser struct {
+	UserID                  string
+	Context                 string
+	Domain                  string
+	Group                   string
+	Contact                 string
+	CallGroup               string
+	EffectiveCallerIDName   string
+	EffectiveCallerIDNumber string
+}
+
+// IsRegistered - list_users reports error/user_not_registered as contact of unregistered users
+func (u DirectoryUser) IsRegistered() bool {
+	return u.Contact != "" && !strings.HasPrefix(u.Contact, "error/")
+}
+
+// ListUsersFilter - Filters of list_users, empty fields are not filtered on
+type ListUsersFilter struct {
+	Domain  string
+	Group   string
+	User    string
+	Context string
+}
+
+// ListUsers - Run list_users for a domain, every domain when empty
+func (c *ESLConnection) ListUsers(domain string) ([]DirectoryUser, error) {
+	return c.ListUsersWith(ListUsersFilter{Domain: domain})
+}
+
+// ListUsersWith - Run list_users with filters
+func (c *ESLConnection) ListUsersWith(filter ListUsersFilter) ([]DirectoryUser, error) {
+	cmd := "list_users"
+	for _, f := range [][2]string{
+		{"group", filter.Group},
+		{"domain", filter.Domain},
+		{"user", filter.User},
+		{"context", filter.Context},
+	} {
+		if f[1] != "" {
+			cmd += " " + f[0] + " " + QuoteArgument(f[1])
+		}
+	}
+	response, err := c.Api(cmd)
+	if err != nil {
+		return nil, err
+	}
+	return parseListUsers(string(response.Body)), nil
+}
+
+// parseListUsers - Parse the pipe delimited output, a header line, rows and a +OK footer
+func parseListUsers(body string) []DirectoryUser {
+	var users []DirectoryUser
+	var columns []string
+	for _, line := range strings.Split(body, "\n") {
+		line = strings.TrimRight(line, "\r")
+		if line == "" || strings.HasPrefix(line, "+OK") {
+			continue
+		}
+		fields := strings.Split(line, "|")
+		if columns == nil {
+			columns = fields
+			continue
+		}
+		row := make(map[string]string, len(columns))
+		for i, column := range columns {
+			if i < len(fields) {
+				row[column] = fields[i]
+			}
+		}
+		users = append(users, DirectoryUser{
+			UserID:                  row["userid"],
+			Context:                 row["context"],
+			Domain:                  row["domain"],
+			Group:                   row["group"],
+			Contact:                 row["contact"],
+			CallGroup:               row["callgroup"],
+			EffectiveCallerIDName:   row["effective_caller_id_name"],
+			EffectiveCallerIDNumber: row["effective_caller_id_number"],
+		})
+	}
+	return users
+}
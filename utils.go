@@ -11,6 +11,17 @@
 
 package goesl
 
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
 func IsExistInSlice(s string, list []string) bool {
 	for _, v := range list {
 		if v == s {
@@ -19,3 +30,68 @@ func IsExistInSlice(s string, list []string) bool {
 	}
 	return false
 }
+
+// atoi - Parse an integer, returning 0 on empty or invalid input
+func atoi(s string) int {
+	v, _ := strconv.Atoi(strings.TrimSpace(s))
+	return v
+}
+
+// firstNonEmpty - First of values which is not empty
+func firstNonEmpty(values ...string) string {
+	for _, v := range values {
+		if v != "" {
+			return v
+		}
+	}
+	return ""
+}
+
+// parseMilliseconds - Parse a float number of milliseconds like "12.34" into a duration
+func parseMilliseconds(s string) time.Duration {
+	v, err := strconv.ParseFloat(strings.TrimSpace(s), 64)
+	if err != nil {
+		return 0
+	}
+	return time.Duration(v * float64(time.Millisecond))
+}
+
+// QuoteArgument - Quote an api argument the way switch_separate_string unquotes it,
+// so spaces, quotes, backslashes and = are passed through as a single argument.
+// Line breaks would end the command frame and are replaced by spaces
+func QuoteArgument(s string) string {
+	s = lineBreakReplacer.Replace(s)
+	if s != "" && !strings.ContainsAny(s, " \t'\\=") {
+		return s
+	}
+	replacer := strings.NewReplacer(`\`, `\\`, `'`, `\'`)
+	return "'" + replacer.Replace(s) + "'"
+}
+
+var lineBreakReplacer = strings.NewReplacer("\r\n", " ", "\r", " ", "\n", " ")
+
+// newUUID - Random version 4 uuid, used to correlate commands with their events
+func newUUID() string {
+	var b [16]byte
+	_, _ = rand.Read(b[:])
+	b[6] = (b[6] & 0x0f) | 0x40
+	b[8] = (b[8] & 0x3f) | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:])
+}
+
+// unmarshalXML - xml.Unmarshal accepting the ISO-8859-1 declaration freeswitch puts on its xml output
+func unmarshalXML(data []byte, v interface{}) error {
+	decoder := xml.NewDecoder(bytes.NewReader(data))
+	decoder.CharsetReader = xmlCharsetReader
+	return decoder.Decode(v)
+}
+
+// xmlCharsetReader - Freeswitch declares ISO-8859-1 but writes its values as they are, utf-8, so the input
+// is kept unchanged
+func xmlCharsetReader(charset string, input io.Reader) (io.Reader, error) {
+	switch strings.ToLower(charset) {
+	case "iso-8859-1", "iso8859-1", "latin1", "us-ascii":
+		return input, nil
+	}
+	return nil, fmt.Errorf("unsupported charset : %s", charset)
+}
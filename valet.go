@@ -0,0 +1,96 @@
+/*
+ * Copyright (c) 2021 LuanDNH
+ *
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at https://mozilla.org/MPL/2.0/.
+ *
+ * Contributor(s):
+ * LuanDNH <luandnh98@gmail.com>
+ */
+
+package goesl
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+)
+
+// ValetLot - A valet parking lot and its occupied extensions
+type ValetLot struct {
+	Name       string
+	Extensions []ValetExtension
+}
+
+// ValetExtension - A parked call
+type ValetExtension struct {
+	Extension string
+	UUID      string
+}
+
+type valetInfoXML struct {
+	Lots []struct {
+		Name       string `xml:"name,attr"`
+		Extensions []struct {
+			UUID      string `xml:"uuid,attr"`
+			Extension string `xml:",chardata"`
+		} `xml:"extension"`
+	} `xml:"lot"`
+}
+
+// ValetInfo - Run valet_info for a lot, every lot when empty
+func (c *ESLConnection) ValetInfo(lot string) ([]ValetLot, error) {
+	cmd := "valet_info"
+	if lot != "" {
+		cmd += " " + lot
+	}
+	response, err := c.Api(cmd)
+	if err != nil {
+		return nil, err
+	}
+	body := strings.TrimSpace(string(response.Body))
+	if !strings.HasPrefix(body, "<") {
+		return nil, errors.New("unexpected valet_info reply : " + body)
+	}
+	var decoded valetInfoXML
+	if err := unmarshalXML([]byte(body), &decoded); err != nil {
+		return nil, err
+	}
+	lots := make([]ValetLot, 0, len(decoded.Lots))
+	for _, l := range decoded.Lots {
+		valetLot := ValetLot{Name: l.Name}
+		for _, e := range l.Extensions {
+			valetLot.Extensions = append(valetLot.Extensions, ValetExtension{
+				Extension: strings.TrimSpace(e.Extension),
+				UUID:      e.UUID,
+			})
+		}
+		lots = append(lots, valetLot)
+	}
+	return lots, nil
+}
+
+// ValetPark - Park uuid on extension of lot, the channel stays in valet_park until retrieved
+func (c *ESLConnection) ValetPark(uuid, lot, extension string) error {
+	if lot == "" || extension == "" {
+		return errors.New("valet_park needs a lot and an extension")
+	}
+	_, err := c.Execute(uuid, "valet_park", lot+" "+extension, nil)
+	return err
+}
+
+// ValetParkAuto - Park uuid on the first free extension of lot between min and max
+func (c *ESLConnection) ValetParkAuto(uuid, lot string, min, max int) error {
+	if lot == "" || min > max {
+		return errors.New("valet_park needs a lot and a valid extension range")
+	}
+	_, err := c.Execute(uuid, "valet_park", lot+" auto in "+strconv.Itoa(min)+" "+strconv.Itoa(max), nil)
+	return err
+}
+
+// ValetRetrieve - Bridge uuid with the call parked on extension of lot
+func (c *ESLConnection) ValetRetrieve(uuid, lot, extension string) error {
+	// Running valet_park on an occupied extension retrieves the parked call
+	return c.ValetPark(uuid, lot, extension)
+}
@@ -0,0 +1,152 @@
+/*
+ * Copyright (c) 2021 LuanDNH
+ *
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at https://mozilla.org/MPL/2.0/.
+ *
+ * Contributor(s):
+ * LuanDNH <luandnh98@gmail.com>
+ */
+
+package goesl
+
+import (
+	"errors"
+	"sort"
+	"strings"
+)
+
+// UndefinedValue - Value returned by uuid_getvar when the variable is not set
+const UndefinedValue = "_undef_"
+
+// GetGlobalVar - Get a global variable, ok is false when the variable is not set
+func (c *ESLConnection) GetGlobalVar(name string) (value string, ok bool, err error) {
+	if err := validateVarName(name); err != nil {
+		return "", false, err
+	}
+	response, err := c.query("global_getvar " + name)
+	if err != nil {
+		return "", false, err
+	}
+	// global_getvar answers an empty body for unset variables
+	value = strings.TrimRight(string(response.Body), "\r\n")
+	return value, value != "", nil
+}
+
+// SetGlobalVar - Set a global variable, value is quoted so it may contain spaces, quotes or =
+func (c *ESLConnection) SetGlobalVar(name, value string) error {
+	if err := validateVarName(name); err != nil {
+		return err
+	}
+	if err := validateVarValue(value); err != nil {
+		return err
+	}
+	_, err := c.Api("global_setvar " + name + "=" + QuoteArgument(value))
+	return err
+}
+
+// GetChannelVar - Get a variable of the channel uuid, ok is false when the variable is not set
+func (c *ESLConnection) GetChannelVar(uuid, name string) (value string, ok bool, err error) {
+	if err := validateVarName(name); err != nil {
+		return "", false, err
+	}
+	response, err := c.query("uuid_getvar " + uuid + " " + name)
+	if err != nil {
+		return "", false, err
+	}
+	value = strings.TrimRight(string(response.Body), "\r\n")
+	if value == UndefinedValue {
+		return "", false, nil
+	}
+	return value, true, nil
+}
+
+// SetChannelVar - Set a variable of the channel uuid, an empty value unsets it
+func (c *ESLConnection) SetChannelVar(uuid, name, value string) error {
+	if err := validateVarName(name); err != nil {
+		return err
+	}
+	if err := validateVarValue(value); err != nil {
+		return err
+	}
+	cmd := "uuid_setvar " + uuid + " " + name
+	if value != "" {
+		cmd += " " + QuoteArgument(value)
+	}
+	_, err := c.Api(cmd)
+	return err
+}
+
+// multiVarReplacer - uuid_setvar_multi splits on ; then on the first =, both honor backslash escapes
+var multiVarReplacer = strings.NewReplacer(`\`, `\\`, `;`, `\;`, `=`, `\=`, `'`, `\'`)
+
+// SetChannelVars - Set several variables of the channel uuid at once with uuid_setvar_multi, an empty value unsets
+// the variable. Names are sent sorted, ; and = in values are escaped
+func (c *ESLConnection) SetChannelVars(uuid string, vars map[string]string) error {
+	if len(vars) == 0 {
+		return nil
+	}
+	names := make([]string, 0, len(vars))
+	for name, value := range vars {
+		if err := validateVarName(name); err != nil {
+			return err
+		}
+		if err := validateVarValue(value); err != nil {
+			return err
+		}
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	pairs := make([]string, 0, len(names))
+	for _, name := range names {
+		pairs = append(pairs, name+"="+multiVarReplacer.Replace(vars[name]))
+	}
+	_, err := c.Api("uuid_setvar_multi " + uuid + " " + strings.Join(pairs, ";"))
+	return err
+}
+
+// SetVar - Execute set on the channel uuid, the variable is set once the applications queued before have run.
+// uuid may be empty on an outbound connection
+func (c *ESLConnection) SetVar(uuid, name, value string) error {
+	return c.executeVar(uuid, "set", name, value)
+}
+
+// ExportVar - Execute export on the channel uuid, the variable is set on it and on the legs it bridges or originates
+func (c *ESLConnection) ExportVar(uuid, name, value string) error {
+	return c.executeVar(uuid, "export", name, value)
+}
+
+// PushVar - Execute push on the channel uuid, appending value to the array variable name
+func (c *ESLConnection) PushVar(uuid, name, value string) error {
+	return c.executeVar(uuid, "push", name, value)
+}
+
+// executeVar - Run one of the name=value applications. The argument is the sendmsg body, everything after the first =
+// is the value so it needs no escaping
+func (c *ESLConnection) executeVar(uuid, app, name, value string) error {
+	if err := validateVarName(name); err != nil {
+		return err
+	}
+	if err := validateVarValue(value); err != nil {
+		return err
+	}
+	// Locked so the applications queued next see the variable
+	_, err := c.Execute(uuid, app, name+"="+value, &ExecuteOptions{EventLock: true})
+	return err
+}
+
+func validateVarName(name string) error {
+	if name == "" || strings.ContainsAny(name, " \t\r\n='\\") {
+		return errors.New("invalid variable name : " + name)
+	}
+	return nil
+}
+
+// validateVarValue - A line break would end the command frame early
+func validateVarValue(value string) error {
+	if strings.ContainsAny(value, "\r\n") {
+		return errors.New("variable value can not contain line breaks")
+	}
+	return nil
+}
@@ -0,0 +1,140 @@
+/*
+ * Copyright (c) 2021 LuanDNH
+ *
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at https://mozilla.org/MPL/2.0/.
+ *
+ * Contributor(s):
+ * LuanDNH <luandnh98@gmail.com>
+ */
+
+package goesl
+
+import (
+	"errors"
+	"strings"
+	"time"
+)
+
+// VoicemailMessage - A message of vm_list
+type VoicemailMessage struct {
+	Received  time.Time
+	Read      time.Time
+	Username  string
+	Domain    string
+	Folder    string
+	Path      string
+	UUID      string
+	CIDName   string
+	CIDNumber string
+	Length    time.Duration
+	Flags     string
+}
+
+// IsRead - Check if the message was listened to
+func (m VoicemailMessage) IsRead() bool {
+	return !m.Read.IsZero()
+}
+
+// VoicemailBoxCount - Message counts of vm_boxcount all
+type VoicemailBoxCount struct {
+	New         int
+	Saved       int
+	NewUrgent   int
+	SavedUrgent int
+}
+
+// VoicemailList - Run vm_list for mailbox, like 1000@example.com or 1000@example.com/profile
+func (c *ESLConnection) VoicemailList(mailbox string) ([]VoicemailMessage, error) {
+	if err := validateMailbox(mailbox); err != nil {
+		return nil, err
+	}
+	response, err := c.query("vm_list " + mailbox)
+	if err != nil {
+		return nil, err
+	}
+	var messages []VoicemailMessage
+	for _, line := range strings.Split(string(response.Body), "\n") {
+		fields := strings.Split(strings.TrimSpace(line), ":")
+		if len(fields) < 10 {
+			continue
+		}
+		message := VoicemailMessage{
+			Received:  parseEpoch(fields[0]),
+			Read:      parseEpoch(fields[1]),
+			Username:  fields[2],
+			Domain:    fields[3],
+			Folder:    fields[4],
+			Path:      fields[5],
+			UUID:      fields[6],
+			CIDName:   fields[7],
+			CIDNumber: fields[8],
+			Length:    time.Duration(atoi(fields[9])) * time.Second,
+		}
+		if len(fields) > 10 {
+			message.Flags = strings.Join(fields[10:], ":")
+		}
+		messages = append(messages, message)
+	}
+	return messages, nil
+}
+
+// VoicemailDelete - Delete a message of mailbox, every message when uuid is empty
+func (c *ESLConnection) VoicemailDelete(mailbox, uuid string) error {
+	if err := validateMailbox(mailbox); err != nil {
+		return err
+	}
+	_, err := c.Api(strings.TrimSpace("vm_delete " + mailbox + " " + uuid))
+	return err
+}
+
+// VoicemailMarkRead - Mark a message of mailbox read or unread, every message when uuid is empty
+func (c *ESLConnection) VoicemailMarkRead(mailbox, uuid string, read bool) error {
+	if err := validateMailbox(mailbox); err != nil {
+		return err
+	}
+	state := "unread"
+	if read {
+		state = "read"
+	}
+	_, err := c.Api(strings.TrimSpace("vm_read " + mailbox + " " + state + " " + uuid))
+	return err
+}
+
+// VoicemailBoxCount - Run vm_boxcount all for mailbox
+func (c *ESLConnection) VoicemailBoxCount(mailbox string) (*VoicemailBoxCount, error) {
+	if err := validateMailbox(mailbox); err != nil {
+		return nil, err
+	}
+	response, err := c.query("vm_boxcount " + mailbox + "|all")
+	if err != nil {
+		return nil, err
+	}
+	fields := strings.Split(strings.TrimSpace(string(response.Body)), ":")
+	if len(fields) != 4 {
+		return nil, errors.New("unexpected vm_boxcount reply : " + string(response.Body))
+	}
+	return &VoicemailBoxCount{
+		New:         atoi(fields[0]),
+		Saved:       atoi(fields[1]),
+		NewUrgent:   atoi(fields[2]),
+		SavedUrgent: atoi(fields[3]),
+	}, nil
+}
+
+// RefreshMWI - Fire MESSAGE_QUERY so mod_voicemail sends the current message waiting state of account, like 1000@example.com
+func (c *ESLConnection) RefreshMWI(account string) error {
+	if err := validateMailbox(account); err != nil {
+		return err
+	}
+	_, err := c.SendEvent(EventMessageQuery, []string{"Message-Account: sip:" + account}, "")
+	return err
+}
+
+func validateMailbox(mailbox string) error {
+	if !strings.Contains(mailbox, "@") || strings.ContainsAny(mailbox, " \t\r\n") {
+		return errors.New("invalid mailbox : " + mailbox)
+	}
+	return nil
+}
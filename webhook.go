@@ -0,0 +1,256 @@
+/*
+ * Copyright (c) 2021 LuanDNH
+ *
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at https://mozilla.org/MPL/2.0/.
+ *
+ * Contributor(s):
+ * LuanDNH <luandnh98@gmail.com>
+ */
+package goesl
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Defaults of WebhookOptions
+const (
+	DefaultWebhookBatchSize     = 50
+	DefaultWebhookFlushInterval = time.Second
+	DefaultWebhookQueueSize     = 1024
+	DefaultWebhookMaxRetries    = 3
+	DefaultWebhookRetryBackoff  = 500 * time.Millisecond
+)
+
+// WebhookSignatureHeader - Header carrying "sha256=" and the hex HMAC-SHA256 of the request body, see WebhookOptions.Secret
+const WebhookSignatureHeader = "X-Goesl-Signature"
+
+// WebhookOptions - Options of ForwardEvents
+type WebhookOptions struct {
+	// URL - Endpoint receiving a POST with a json array of events, each one as sent in text/event-json
+	URL string
+	// Events - Events subscribed for the forwarder, like "CHANNEL_ANSWER" or "CUSTOM sofia::register"
+	Events []string
+	// Filter - Only events it returns true for are forwarded, every event of Events when nil
+	Filter func(event *Event) bool
+	// BatchSize - Events per request, DefaultWebhookBatchSize when 0
+	BatchSize int
+	// FlushInterval - Longest time an event waits for its batch to fill, DefaultWebhookFlushInterval when 0
+	FlushInterval time.Duration
+	// QueueSize - Events waiting to be sent, later ones are dropped and counted, DefaultWebhookQueueSize when 0
+	QueueSize int
+	// MaxRetries - Retries of a batch on a transport error or a 5xx/429 status, DefaultWebhookMaxRetries when 0, -1 for none
+	MaxRetries int
+	// RetryBackoff - Wait before the first retry, doubled for each retry, DefaultWebhookRetryBackoff when 0
+	RetryBackoff time.Duration
+	// Secret - When set every request is signed with WebhookSignatureHeader
+	Secret string
+	// Headers - Headers added to every request, like an Authorization
+	Headers map[string]string
+	// Client - http.DefaultClient when nil
+	Client *http.Client
+	// OnError - Called with a batch which could not be delivered
+	OnError func(events int, err error)
+}
+
+// WebhookError - Status of a request refused by the webhook endpoint
+type WebhookError struct {
+	StatusCode int
+}
+
+func (e *WebhookError) Error() string {
+	return "webhook answered " + strconv.Itoa(e.StatusCode)
+}
+
+// WebhookForwarder - Pushes events to an HTTP endpoint in batches, see ForwardEvents
+type WebhookForwarder struct {
+	connection *ESLConnection
+	opts       WebhookOptions
+	listenerID string
+	// lock - Guards queue against being closed while a listener enqueues
+	lock    sync.RWMutex
+	stopped bool
+	queue   chan json.RawMessage
+	dropped uint64
+	done    chan struct{}
+}
+
+// ForwardEvents - Start forwarding events to opts.URL until Stop. Events are subscribed on an inbound connection,
+// an outbound connection must use myevents
+func (c *ESLConnection) ForwardEvents(opts WebhookOptions) (*WebhookForwarder, error) {
+	if opts.URL == "" {
+		return nil, errors.New("webhook needs a url")
+	}
+	if opts.BatchSize <= 0 {
+		opts.BatchSize = DefaultWebhookBatchSize
+	}
+	if opts.FlushInterval <= 0 {
+		opts.FlushInterval = DefaultWebhookFlushInterval
+	}
+	if opts.QueueSize <= 0 {
+		opts.QueueSize = DefaultWebhookQueueSize
+	}
+	if opts.MaxRetries == 0 {
+		opts.MaxRetries = DefaultWebhookMaxRetries
+	}
+	if opts.RetryBackoff <= 0 {
+		opts.RetryBackoff = DefaultWebhookRetryBackoff
+	}
+	if opts.Client == nil {
+		opts.Client = http.DefaultClient
+	}
+	if !c.outbound && len(opts.Events) > 0 {
+		if err := c.subscribeInternal(opts.Events...); err != nil {
+			return nil, err
+		}
+	}
+	f := &WebhookForwarder{
+		connection: c,
+		opts:       opts,
+		queue:      make(chan json.RawMessage, opts.QueueSize),
+		done:       make(chan struct{}),
+	}
+	f.listenerID = c.RegisterEventListener(EventListenAll, f.enqueue)
+	go f.sendLoop()
+	return f, nil
+}
+
+func (f *WebhookForwarder) enqueue(event *Event) {
+	if f.opts.Filter != nil && !f.opts.Filter(event) {
+		return
+	}
+	// Rendered right away, the event is not used once the listener returns
+	document, err := event.eventJSON()
+	if err != nil {
+		return
+	}
+	f.lock.RLock()
+	defer f.lock.RUnlock()
+	if f.stopped {
+		return
+	}
+	select {
+	case f.queue <- document:
+	default:
+		atomic.AddUint64(&f.dropped, 1)
+	}
+}
+
+// Dropped - Events dropped because the queue was full
+func (f *WebhookForwarder) Dropped() uint64 {
+	return atomic.LoadUint64(&f.dropped)
+}
+
+// Stop - Stop forwarding, the events already queued are sent before it returns
+func (f *WebhookForwarder) Stop() error {
+	f.lock.Lock()
+	if f.stopped {
+		f.lock.Unlock()
+		<-f.done
+		return nil
+	}
+	f.stopped = true
+	close(f.queue)
+	f.lock.Unlock()
+	f.connection.RemoveEventListener(EventListenAll, f.listenerID)
+	<-f.done
+	if !f.connection.outbound && len(f.opts.Events) > 0 && f.connection.Err() == nil {
+		return f.connection.Unsubscribe(f.opts.Events...)
+	}
+	return nil
+}
+
+func (f *WebhookForwarder) sendLoop() {
+	defer close(f.done)
+	ticker := time.NewTicker(f.opts.FlushInterval)
+	defer ticker.Stop()
+	batch := make([]json.RawMessage, 0, f.opts.BatchSize)
+	flush := func() {
+		if len(batch) == 0 {
+			return
+		}
+		if err := f.send(batch); err != nil && f.opts.OnError != nil {
+			events := len(batch)
+			f.connection.runHandler("webhook error handler", func() { f.opts.OnError(events, err) })
+		}
+		batch = make([]json.RawMessage, 0, f.opts.BatchSize)
+	}
+	for {
+		select {
+		case document, ok := <-f.queue:
+			if !ok {
+				flush()
+				return
+			}
+			batch = append(batch, document)
+			if len(batch) >= f.opts.BatchSize {
+				flush()
+			}
+		case <-ticker.C:
+			flush()
+		}
+	}
+}
+
+// send - POST a batch, retrying transport errors, 5xx and 429 with a doubling backoff
+func (f *WebhookForwarder) send(batch []json.RawMessage) error {
+	body, err := json.Marshal(batch)
+	if err != nil {
+		return err
+	}
+	backoff := f.opts.RetryBackoff
+	for attempt := 0; ; attempt++ {
+		err = f.post(body)
+		var status *WebhookError
+		retryable := !errors.As(err, &status) || status.StatusCode >= 500 || status.StatusCode == http.StatusTooManyRequests
+		if err == nil || !retryable || attempt >= f.opts.MaxRetries {
+			return err
+		}
+		time.Sleep(backoff)
+		backoff *= 2
+	}
+}
+
+func (f *WebhookForwarder) post(body []byte) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	request, err := http.NewRequestWithContext(ctx, http.MethodPost, f.opts.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	request.Header.Set("Content-Type", "application/json")
+	for name, value := range f.opts.Headers {
+		request.Header.Set(name, value)
+	}
+	if f.opts.Secret != "" {
+		request.Header.Set(WebhookSignatureHeader, "sha256="+SignWebhook(f.opts.Secret, body))
+	}
+	response, err := f.opts.Client.Do(request)
+	if err != nil {
+		return err
+	}
+	response.Body.Close()
+	if response.StatusCode < 200 || response.StatusCode >= 300 {
+		return &WebhookError{StatusCode: response.StatusCode}
+	}
+	return nil
+}
+
+// SignWebhook - Hex HMAC-SHA256 of body with secret, as sent in WebhookSignatureHeader after "sha256="
+func SignWebhook(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,228 @@
+/*
+ * Copyright (c) 2021 LuanDNH
+ *
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at https://mozilla.org/MPL/2.0/.
+ *
+ * Contributor(s):
+ * LuanDNH <luandnh98@gmail.com>
+ */
+
+package goesl
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+// ErrConnectionClosed - The connection was closed with Close, or its parent context is done
+var ErrConnectionClosed = errors.New("connection closed")
+
+// request - A command frame queued for the writer goroutine
+type request struct {
+	ctx   context.Context
+	frame []byte
+	// stream - The api/response body is left on the socket, see ApiStream
+	stream bool
+	// written - Result of the write, reply - The matching reply, both buffered so nobody blocks on a request given up on
+	written chan error
+	reply   chan requestResult
+}
+
+type requestResult struct {
+	response *ESLResponse
+	err      error
+}
+
+// submit - Hand a frame to the writer goroutine and wait until it is written
+func (c *ESLConnection) submit(ctx context.Context, frame []byte, stream bool) (*request, error) {
+	if c.isClosed() {
+		return nil, c.closeErr
+	}
+	if err := c.disconnectedError(); err != nil {
+		return nil, err
+	}
+	if c.limiter != nil {
+		if err := c.limiter.take(ctx, c.done); err != nil {
+			return nil, err
+		}
+	}
+	req := &request{
+		ctx:     ctx,
+		frame:   frame,
+		stream:  stream,
+		written: make(chan error, 1),
+		reply:   make(chan requestResult, 1),
+	}
+	select {
+	case c.commands <- req:
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case <-c.done:
+		return nil, c.closeErr
+	}
+	var err error
+	select {
+	case err = <-req.written:
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case <-c.done:
+		// Written just before the connection closed, its reply may have been read too, even before the
+		// writer reported the write
+		select {
+		case err = <-req.written:
+		default:
+			if len(req.reply) == 0 {
+				return nil, c.closeErr
+			}
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+	return req, nil
+}
+
+// writeLoop - Single writer of the connection, frames are written in the order they are submitted
+func (c *ESLConnection) writeLoop() {
+	for {
+		select {
+		case req := <-c.commands:
+			c.write(req)
+		case <-c.done:
+			return
+		}
+	}
+}
+
+func (c *ESLConnection) write(req *request) {
+	// Nothing reads the frame once the writer is done with it
+	defer putFrameBuffer(req.frame)
+	if err := req.ctx.Err(); err != nil {
+		req.written <- err
+		return
+	}
+	if c.inFlight != nil {
+		// Wait for a reply to free a slot, see Options.MaxInFlight
+		select {
+		case c.inFlight <- struct{}{}:
+		case <-req.ctx.Done():
+			req.written <- req.ctx.Err()
+			return
+		case <-c.done:
+			req.written <- c.closeErr
+			return
+		}
+	}
+	// Queued before writing since the reply may be read before Write returns
+	c.pendingLock.Lock()
+	c.pending = append(c.pending, req)
+	c.pendingLock.Unlock()
+
+	if deadline, ok := req.ctx.Deadline(); ok {
+		_ = c.conn.SetWriteDeadline(deadline)
+		defer c.conn.SetWriteDeadline(time.Time{})
+	}
+	c.traceSend(req.frame)
+	if _, err := c.conn.Write(req.frame); err != nil {
+		c.removePending(req)
+		req.written <- err
+		return
+	}
+	c.stats.sent(len(req.frame))
+	req.written <- nil
+}
+
+func (c *ESLConnection) removePending(req *request) {
+	c.pendingLock.Lock()
+	defer c.pendingLock.Unlock()
+	for i, pending := range c.pending {
+		if pending == req {
+			c.pending = append(c.pending[:i], c.pending[i+1:]...)
+			c.releaseInFlight(1)
+			return
+		}
+	}
+}
+
+// isReply - command/reply and api/response answer the commands, in order
+func isReply(response *ESLResponse) bool {
+	return response.ContentType == ContentType_Reply || response.ContentType == ContentType_APIResponse
+}
+
+// nextReplyStreams - Tells if the oldest pending request asked for its reply to be streamed
+func (c *ESLConnection) nextReplyStreams() bool {
+	c.pendingLock.Lock()
+	defer c.pendingLock.Unlock()
+	return len(c.pending) > 0 && c.pending[0].stream
+}
+
+// deliverReply - Hand a reply to the oldest pending request, false when there is none
+func (c *ESLConnection) deliverReply(response *ESLResponse) bool {
+	c.pendingLock.Lock()
+	if len(c.pending) == 0 {
+		c.pendingLock.Unlock()
+		return false
+	}
+	req := c.pending[0]
+	c.pending[0] = nil
+	c.pending = c.pending[1:]
+	c.pendingLock.Unlock()
+	c.releaseInFlight(1)
+
+	req.reply <- requestResult{response: response}
+	return true
+}
+
+// failPending - Fail every request still waiting for a reply, the connection is gone
+func (c *ESLConnection) failPending(err error) {
+	c.pendingLock.Lock()
+	pending := c.pending
+	c.pending = nil
+	c.pendingLock.Unlock()
+	c.releaseInFlight(len(pending))
+
+	for _, req := range pending {
+		req.reply <- requestResult{err: err}
+	}
+}
+
+// releaseInFlight - Free the slots of n requests which are no longer pending
+func (c *ESLConnection) releaseInFlight(n int) {
+	if c.inFlight == nil {
+		return
+	}
+	for i := 0; i < n; i++ {
+		<-c.inFlight
+	}
+}
+
+// maxPooledFrame - Frames above this size, like a large sendevent body, are not kept in the pool
+const maxPooledFrame = 1 << 16
+
+var framePool = sync.Pool{
+	New: func() interface{} {
+		frame := make([]byte, 0, 512)
+		return &frame
+	},
+}
+
+// getFrameBuffer - Empty pooled buffer with room for size bytes
+func getFrameBuffer(size int) []byte {
+	frame := *framePool.Get().(*[]byte)
+	if cap(frame) < size {
+		return make([]byte, 0, size)
+	}
+	return frame[:0]
+}
+
+func putFrameBuffer(frame []byte) {
+	if cap(frame) == 0 || cap(frame) > maxPooledFrame {
+		return
+	}
+	frame = frame[:0]
+	framePool.Put(&frame)
+}